@@ -1,16 +1,40 @@
 package chainio
 
 import (
+	"context"
 	"github.com/Layr-Labs/eigensdk-go/chainio/clients/eth"
 	contractRegistryCoordinator2 "github.com/Layr-Labs/eigensdk-go/contracts/bindings/RegistryCoordinator"
 	"github.com/ethereum/go-ethereum/accounts/abi/bind"
 	"github.com/ethereum/go-ethereum/common"
 	"goplus/avs/contracts/bindings/GoPlusServiceManager"
+	"math/big"
 )
 
+// RegistryCoordinator 中 operator 的注册状态
+const (
+	OperatorNeverRegistered uint8 = 0
+	OperatorRegistered      uint8 = 1
+	OperatorDeregistered    uint8 = 2
+)
+
+// OperatorStatusName 返回注册状态的名称
+func OperatorStatusName(status uint8) string {
+	switch status {
+	case OperatorNeverRegistered:
+		return "NEVER_REGISTERED"
+	case OperatorRegistered:
+		return "REGISTERED"
+	case OperatorDeregistered:
+		return "DEREGISTERED"
+	default:
+		return "UNKNOWN"
+	}
+}
+
 type AvsReader struct {
-	ethClient      eth.Client
-	ServiceManager *contractGoPlusServiceManager.GoPlusServiceManager
+	ethClient           eth.Client
+	RegistryCoordinator *contractRegistryCoordinator2.ContractRegistryCoordinator
+	ServiceManager      *contractGoPlusServiceManager.GoPlusServiceManager
 }
 
 func NewAvsReader(registryCoordinatorAddr common.Address, ethClient eth.Client) (*AvsReader, error) {
@@ -30,21 +54,78 @@ func NewAvsReader(registryCoordinatorAddr common.Address, ethClient eth.Client)
 	}
 
 	return &AvsReader{
-		ethClient:      ethClient,
-		ServiceManager: serverManager,
+		ethClient:           ethClient,
+		RegistryCoordinator: contractRegistryCoordinator,
+		ServiceManager:      serverManager,
 	}, nil
 }
 
-func (r *AvsReader) GatewayConfig() (common.Address, string, error) {
-	addr, err := r.ServiceManager.GatewayAddr(&bind.CallOpts{})
+// GatewayConfig 从 ServiceManager 读取当前的 Gateway 地址和 URL
+func (r *AvsReader) GatewayConfig(ctx context.Context) (common.Address, string, error) {
+	return r.gatewayConfig(&bind.CallOpts{Context: ctx})
+}
+
+// GatewayConfigAt 读取指定区块的 Gateway 地址和 URL
+func (r *AvsReader) GatewayConfigAt(ctx context.Context, blockNumber uint64) (common.Address, string, error) {
+	return r.gatewayConfig(&bind.CallOpts{Context: ctx, BlockNumber: new(big.Int).SetUint64(blockNumber)})
+}
+
+func (r *AvsReader) gatewayConfig(opts *bind.CallOpts) (common.Address, string, error) {
+	addr, err := r.ServiceManager.GatewayAddr(opts)
 	if err != nil {
 		return common.Address{}, "", err
 	}
 
-	url, err := r.ServiceManager.GatewayURI(&bind.CallOpts{})
+	url, err := r.ServiceManager.GatewayURI(opts)
 	if err != nil {
 		return common.Address{}, "", err
 	}
 
 	return addr, url, nil
 }
+
+// OperatorStatus 从 RegistryCoordinator 读取 operator 的注册状态
+func (r *AvsReader) OperatorStatus(ctx context.Context, operator common.Address) (uint8, error) {
+	return r.RegistryCoordinator.GetOperatorStatus(&bind.CallOpts{Context: ctx}, operator)
+}
+
+// BlockNumber 获取最新的区块高度，用于检查 ETH RPC 是否可用
+func (r *AvsReader) BlockNumber(ctx context.Context) (uint64, error) {
+	return r.ethClient.BlockNumber(ctx)
+}
+
+// GatewayUpdates 读取 [fromBlock, toBlock] 区间内 Gateway 地址和 URL 的变更事件，
+// 返回区间内最后一次变更后的值，没有变更时对应的返回值为 nil
+func (r *AvsReader) GatewayUpdates(ctx context.Context, fromBlock uint64, toBlock uint64) (*common.Address, *string, error) {
+	opts := &bind.FilterOpts{Start: fromBlock, End: &toBlock, Context: ctx}
+
+	var addr *common.Address
+	addrIter, err := r.ServiceManager.FilterGatewayAddressUpdated(opts, nil, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer addrIter.Close()
+	for addrIter.Next() {
+		newAddr := addrIter.Event.NewAddr
+		addr = &newAddr
+	}
+	if err := addrIter.Error(); err != nil {
+		return nil, nil, err
+	}
+
+	var uri *string
+	uriIter, err := r.ServiceManager.FilterGatewayURIUpdated(opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer uriIter.Close()
+	for uriIter.Next() {
+		newURI := uriIter.Event.NewURI
+		uri = &newURI
+	}
+	if err := uriIter.Error(); err != nil {
+		return nil, nil, err
+	}
+
+	return addr, uri, nil
+}
@@ -0,0 +1,191 @@
+package chainio
+
+import (
+	"context"
+	"fmt"
+	"github.com/Layr-Labs/eigensdk-go/chainio/clients/eth"
+	"github.com/Layr-Labs/eigensdk-go/chainio/txmgr"
+	chainioutils "github.com/Layr-Labs/eigensdk-go/chainio/utils"
+	avsdir "github.com/Layr-Labs/eigensdk-go/contracts/bindings/AVSDirectory"
+	regcoord "github.com/Layr-Labs/eigensdk-go/contracts/bindings/RegistryCoordinator"
+	"github.com/Layr-Labs/eigensdk-go/logging"
+	eigenSdkTypes "github.com/Layr-Labs/eigensdk-go/types"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	gethtypes "github.com/ethereum/go-ethereum/core/types"
+	"goplus/shared/pkg/signature"
+	"math/big"
+)
+
+// AvsWriter 向 RegistryCoordinator 发送交易。和 eigensdk 的 avsregistry.ChainWriter 不同，
+// 注册时使用 signature.ECDSASigner 和 signature.BLSSigner 签名，因此可以使用远程签名服务
+type AvsWriter struct {
+	logger              logging.Logger
+	ethClient           eth.Client
+	txMgr               txmgr.TxManager
+	RegistryCoordinator *regcoord.ContractRegistryCoordinator
+	// RegistryCoordinatorAddr 是离线交易的接收地址
+	RegistryCoordinatorAddr common.Address
+	ServiceManagerAddr      common.Address
+	AvsDirectoryAddr        common.Address
+	AvsDirectory            *avsdir.ContractAVSDirectory
+	// MaxFeePerGas 是离线交易的手续费上限，nil 表示不限制
+	MaxFeePerGas *big.Int
+}
+
+func NewAvsWriter(registryCoordinatorAddr common.Address, ethClient eth.Client, txMgr txmgr.TxManager, logger logging.Logger) (*AvsWriter, error) {
+	reader, err := NewAvsReader(registryCoordinatorAddr, ethClient)
+	if err != nil {
+		return nil, err
+	}
+
+	serviceManagerAddr, err := reader.RegistryCoordinator.ServiceManager(&bind.CallOpts{})
+	if err != nil {
+		return nil, err
+	}
+	avsDirectoryAddr, err := reader.ServiceManager.AvsDirectory(&bind.CallOpts{})
+	if err != nil {
+		return nil, err
+	}
+	avsDirectory, err := avsdir.NewContractAVSDirectory(avsDirectoryAddr, ethClient)
+	if err != nil {
+		return nil, err
+	}
+
+	return &AvsWriter{
+		logger:                  logger,
+		ethClient:               ethClient,
+		txMgr:                   txMgr,
+		RegistryCoordinator:     reader.RegistryCoordinator,
+		RegistryCoordinatorAddr: registryCoordinatorAddr,
+		ServiceManagerAddr:      serviceManagerAddr,
+		AvsDirectoryAddr:        avsDirectoryAddr,
+		AvsDirectory:            avsDirectory,
+	}, nil
+}
+
+// registrationParams 生成 BLS 公钥注册到 BLSApkRegistry 的参数，以及 operator 注册到 AVSDirectory 需要签名的摘要
+func (w *AvsWriter) registrationParams(
+	ctx context.Context,
+	operatorAddr common.Address,
+	blsSigner signature.BLSSigner,
+	operatorToAvsRegistrationSigSalt [32]byte,
+	operatorToAvsRegistrationSigExpiry *big.Int,
+) (regcoord.IBLSApkRegistryPubkeyRegistrationParams, common.Hash, error) {
+	g1HashedMsgToSign, err := w.RegistryCoordinator.PubkeyRegistrationMessageHash(&bind.CallOpts{Context: ctx}, operatorAddr)
+	if err != nil {
+		return regcoord.IBLSApkRegistryPubkeyRegistrationParams{}, common.Hash{}, err
+	}
+	signedMsg, err := blsSigner.SignHashedToCurveMessage(chainioutils.ConvertBn254GethToGnark(g1HashedMsgToSign))
+	if err != nil {
+		return regcoord.IBLSApkRegistryPubkeyRegistrationParams{}, common.Hash{}, err
+	}
+	pubkeyRegParams := regcoord.IBLSApkRegistryPubkeyRegistrationParams{
+		PubkeyRegistrationSignature: chainioutils.ConvertToBN254G1Point(signedMsg.G1Point),
+		PubkeyG1:                    chainioutils.ConvertToBN254G1Point(blsSigner.PubKeyG1()),
+		PubkeyG2:                    chainioutils.ConvertToBN254G2Point(blsSigner.PubKeyG2()),
+	}
+
+	digest, err := w.AvsDirectory.CalculateOperatorAVSRegistrationDigestHash(
+		&bind.CallOpts{Context: ctx},
+		operatorAddr,
+		w.ServiceManagerAddr,
+		operatorToAvsRegistrationSigSalt,
+		operatorToAvsRegistrationSigExpiry,
+	)
+	if err != nil {
+		return regcoord.IBLSApkRegistryPubkeyRegistrationParams{}, common.Hash{}, err
+	}
+	return pubkeyRegParams, digest, nil
+}
+
+// RegisterOperator 注册 operator 的 BLS 公钥，并把 operator 注册到指定的 quorum
+func (w *AvsWriter) RegisterOperator(
+	ctx context.Context,
+	ecdsaSigner signature.ECDSASigner,
+	blsSigner signature.BLSSigner,
+	operatorToAvsRegistrationSigSalt [32]byte,
+	operatorToAvsRegistrationSigExpiry *big.Int,
+	quorumNumbers eigenSdkTypes.QuorumNums,
+	socket string,
+) (*gethtypes.Receipt, error) {
+	operatorAddr := ecdsaSigner.Address()
+	w.logger.Info("registering operator with the AVS's registry coordinator", "operator", operatorAddr, "quorumNumbers", quorumNumbers, "socket", socket)
+
+	pubkeyRegParams, msgToSign, err := w.registrationParams(ctx, operatorAddr, blsSigner, operatorToAvsRegistrationSigSalt, operatorToAvsRegistrationSigExpiry)
+	if err != nil {
+		return nil, err
+	}
+	operatorSignature, err := ecdsaSigner.SignHash(msgToSign)
+	if err != nil {
+		return nil, err
+	}
+	// 合约要求 V 为 27 或 28
+	operatorSignature[64] += 27
+	operatorSignatureWithSaltAndExpiry := regcoord.ISignatureUtilsSignatureWithSaltAndExpiry{
+		Signature: operatorSignature,
+		Salt:      operatorToAvsRegistrationSigSalt,
+		Expiry:    operatorToAvsRegistrationSigExpiry,
+	}
+
+	noSendTxOpts, err := w.txMgr.GetNoSendTxOpts()
+	if err != nil {
+		return nil, err
+	}
+	tx, err := w.RegistryCoordinator.RegisterOperator(
+		noSendTxOpts,
+		quorumNumbers.UnderlyingType(),
+		socket,
+		pubkeyRegParams,
+		operatorSignatureWithSaltAndExpiry,
+	)
+	if err != nil {
+		return nil, err
+	}
+	receipt, err := w.txMgr.Send(ctx, tx)
+	if err != nil {
+		return receipt, fmt.Errorf("failed to send tx: %w", err)
+	}
+	w.logger.Info("successfully registered operator with AVS registry coordinator", "txHash", receipt.TxHash.String())
+	return receipt, nil
+}
+
+// UpdateSocket 更新已注册 operator 的 socket
+func (w *AvsWriter) UpdateSocket(ctx context.Context, socket string) (*gethtypes.Receipt, error) {
+	w.logger.Info("updating operator socket with the AVS's registry coordinator", "socket", socket)
+
+	noSendTxOpts, err := w.txMgr.GetNoSendTxOpts()
+	if err != nil {
+		return nil, err
+	}
+	tx, err := w.RegistryCoordinator.UpdateSocket(noSendTxOpts, socket)
+	if err != nil {
+		return nil, err
+	}
+	receipt, err := w.txMgr.Send(ctx, tx)
+	if err != nil {
+		return receipt, fmt.Errorf("failed to send tx: %w", err)
+	}
+	w.logger.Info("successfully updated operator socket", "txHash", receipt.TxHash.String())
+	return receipt, nil
+}
+
+// DeregisterOperator 把 operator 从指定的 quorum 注销，operator 在其他 quorum 的注册不受影响
+func (w *AvsWriter) DeregisterOperator(ctx context.Context, quorumNumbers eigenSdkTypes.QuorumNums) (*gethtypes.Receipt, error) {
+	w.logger.Info("deregistering operator with the AVS's registry coordinator", "quorumNumbers", quorumNumbers)
+
+	noSendTxOpts, err := w.txMgr.GetNoSendTxOpts()
+	if err != nil {
+		return nil, err
+	}
+	tx, err := w.RegistryCoordinator.DeregisterOperator(noSendTxOpts, quorumNumbers.UnderlyingType())
+	if err != nil {
+		return nil, err
+	}
+	receipt, err := w.txMgr.Send(ctx, tx)
+	if err != nil {
+		return receipt, fmt.Errorf("failed to send tx: %w", err)
+	}
+	w.logger.Info("successfully deregistered operator with AVS registry coordinator", "txHash", receipt.TxHash.String())
+	return receipt, nil
+}
@@ -0,0 +1,159 @@
+// Package chainio: GatewayWatcher 轮询 ServiceManager 的 Gateway 变更事件，
+// Gateway 地址或 URL 被更换后通知各个组件，不需要重启 operator。
+// 只处理已经有足够确认数的区块，避免链重组后使用被回滚的 Gateway
+package chainio
+
+import (
+	"context"
+	"github.com/Layr-Labs/eigensdk-go/logging"
+	"github.com/ethereum/go-ethereum/common"
+	"sync"
+	"time"
+)
+
+const (
+	gatewayPollInterval = 30 * time.Second
+	maxFilterBlockRange = 5000 // 单次查询事件的最大区块范围
+)
+
+// GatewayReader 是 GatewayWatcher 需要的链上读取接口，由 AvsReader 实现
+type GatewayReader interface {
+	BlockNumber(ctx context.Context) (uint64, error)
+	GatewayConfigAt(ctx context.Context, blockNumber uint64) (common.Address, string, error)
+	GatewayUpdates(ctx context.Context, fromBlock uint64, toBlock uint64) (*common.Address, *string, error)
+}
+
+type GatewayWatcher struct {
+	logger        logging.Logger
+	confirmations uint64 // 落后最新区块的确认区块数
+
+	lock        sync.Mutex
+	reader      GatewayReader
+	address     common.Address
+	url         string
+	nextBlock   uint64 // 下一次查询事件的起始区块，0 表示尚未开始
+	subscribers []func(address common.Address, url string)
+}
+
+func NewGatewayWatcher(logger logging.Logger, reader GatewayReader, address common.Address, url string, confirmations uint64) *GatewayWatcher {
+	return &GatewayWatcher{
+		logger:        logger,
+		confirmations: confirmations,
+		reader:        reader,
+		address:       address,
+		url:           url,
+	}
+}
+
+// ConfirmedGatewayConfig 读取 GatewayWatcher 会使用的已确认区块上的 Gateway 配置，作为启动时的 Gateway，
+// 避免 GatewayWatcher 第一次查询时先回退到旧的 Gateway。区块数不足确认数时读取最新区块
+func ConfirmedGatewayConfig(ctx context.Context, reader GatewayReader, confirmations uint64) (common.Address, string, error) {
+	head, err := reader.BlockNumber(ctx)
+	if err != nil {
+		return common.Address{}, "", err
+	}
+	if head > confirmations {
+		head -= confirmations
+	}
+	return reader.GatewayConfigAt(ctx, head)
+}
+
+// Subscribe 注册 Gateway 变更的回调
+func (w *GatewayWatcher) Subscribe(fn func(address common.Address, url string)) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	w.subscribers = append(w.subscribers, fn)
+}
+
+// SetReader 切换读取链上数据使用的 reader，用于 ETH RPC 热加载
+func (w *GatewayWatcher) SetReader(reader GatewayReader) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	w.reader = reader
+}
+
+// Gateway 返回当前的 Gateway 地址和 URL
+func (w *GatewayWatcher) Gateway() (common.Address, string) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	return w.address, w.url
+}
+
+func (w *GatewayWatcher) update(address common.Address, url string) {
+	if address == w.address && url == w.url {
+		return
+	}
+	w.logger.Infof("Gateway changed, address: %s -> %s, url: %s -> %s", w.address.Hex(), address.Hex(), w.url, url)
+	w.address = address
+	w.url = url
+	for _, fn := range w.subscribers {
+		fn(address, url)
+	}
+}
+
+// Poll 查询上次查询之后、已经确认的区块中的 Gateway 变更事件。第一次查询时直接读取
+// 已确认区块上的 Gateway 配置，以免遗漏启动过程中发生的变更
+func (w *GatewayWatcher) Poll(ctx context.Context) error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	latest, err := w.reader.BlockNumber(ctx)
+	if err != nil {
+		return err
+	}
+	if latest <= w.confirmations {
+		return nil
+	}
+	head := latest - w.confirmations
+
+	if w.nextBlock == 0 {
+		address, url, err := w.reader.GatewayConfigAt(ctx, head)
+		if err != nil {
+			return err
+		}
+		w.update(address, url)
+		w.nextBlock = head + 1
+		return nil
+	}
+
+	for w.nextBlock <= head {
+		toBlock := min(w.nextBlock+maxFilterBlockRange-1, head)
+		newAddress, newUrl, err := w.reader.GatewayUpdates(ctx, w.nextBlock, toBlock)
+		if err != nil {
+			return err
+		}
+
+		address, url := w.address, w.url
+		if newAddress != nil {
+			address = *newAddress
+		}
+		if newUrl != nil {
+			url = *newUrl
+		}
+		w.update(address, url)
+		w.nextBlock = toBlock + 1
+	}
+	return nil
+}
+
+// Start 定期查询 Gateway 变更事件
+func (w *GatewayWatcher) Start(ctx context.Context) error {
+	w.logger.Info("GatewayWatcher Start")
+
+	ticker := time.NewTicker(gatewayPollInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := w.Poll(ctx); err != nil {
+			w.logger.Errorf("Failed to poll gateway updates: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			w.logger.Info("GatewayWatcher Exit")
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+var _ GatewayReader = (*AvsReader)(nil)
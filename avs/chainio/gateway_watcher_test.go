@@ -0,0 +1,168 @@
+package chainio
+
+import (
+	"context"
+	"github.com/Layr-Labs/eigensdk-go/logging"
+	"github.com/ethereum/go-ethereum/common"
+	"testing"
+)
+
+type fakeGatewayReader struct {
+	head    uint64
+	address common.Address
+	url     string
+	// 按区块记录的 Gateway 变更
+	addressUpdates map[uint64]common.Address
+	urlUpdates     map[uint64]string
+	queries        [][2]uint64
+	configBlock    uint64
+}
+
+func (r *fakeGatewayReader) BlockNumber(ctx context.Context) (uint64, error) {
+	return r.head, nil
+}
+
+func (r *fakeGatewayReader) GatewayConfigAt(ctx context.Context, blockNumber uint64) (common.Address, string, error) {
+	r.configBlock = blockNumber
+	return r.address, r.url, nil
+}
+
+func (r *fakeGatewayReader) GatewayUpdates(ctx context.Context, fromBlock uint64, toBlock uint64) (*common.Address, *string, error) {
+	r.queries = append(r.queries, [2]uint64{fromBlock, toBlock})
+	var addr *common.Address
+	var url *string
+	for block := fromBlock; block <= toBlock; block++ {
+		if a, ok := r.addressUpdates[block]; ok {
+			addr = &a
+		}
+		if u, ok := r.urlUpdates[block]; ok {
+			url = &u
+		}
+	}
+	return addr, url, nil
+}
+
+func TestGatewayWatcher(t *testing.T) {
+	logger, _ := logging.NewZapLogger(logging.Development)
+	oldAddr := common.HexToAddress("0x01")
+	reader := &fakeGatewayReader{
+		head:    100,
+		address: oldAddr,
+		url:     "http://gateway-1",
+	}
+
+	watcher := NewGatewayWatcher(logger, reader, oldAddr, "http://gateway-0", 0)
+	var notified []string
+	watcher.Subscribe(func(address common.Address, url string) {
+		notified = append(notified, url)
+	})
+
+	// 第一次查询直接读取当前配置，补上启动过程中的变更
+	if err := watcher.Poll(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if _, url := watcher.Gateway(); url != "http://gateway-1" {
+		t.Fatalf("unexpected url %s", url)
+	}
+
+	newAddr := common.HexToAddress("0x02")
+	reader.head = 100 + maxFilterBlockRange + 10
+	reader.addressUpdates = map[uint64]common.Address{150: newAddr}
+	reader.urlUpdates = map[uint64]string{120: "http://gateway-2", 100 + maxFilterBlockRange + 5: "http://gateway-3"}
+	if err := watcher.Poll(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	addr, url := watcher.Gateway()
+	if addr != newAddr || url != "http://gateway-3" {
+		t.Fatalf("unexpected gateway %s %s", addr.Hex(), url)
+	}
+	if len(reader.queries) != 2 || reader.queries[0] != [2]uint64{101, 100 + maxFilterBlockRange} {
+		t.Fatalf("unexpected queries %v", reader.queries)
+	}
+	if len(notified) != 3 || notified[1] != "http://gateway-2" {
+		t.Fatalf("unexpected notifications %v", notified)
+	}
+
+	// 没有新区块时不查询
+	if err := watcher.Poll(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(reader.queries) != 2 {
+		t.Fatalf("unexpected queries %v", reader.queries)
+	}
+}
+
+func TestConfirmedGatewayConfig(t *testing.T) {
+	logger, _ := logging.NewZapLogger(logging.Development)
+	reader := &fakeGatewayReader{head: 100, address: common.HexToAddress("0x01"), url: "http://gateway-1"}
+
+	// 启动时和 GatewayWatcher 第一次查询读取同一个已确认的区块，不会先回退到旧的 Gateway
+	addr, url, err := ConfirmedGatewayConfig(context.Background(), reader, 12)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reader.configBlock != 88 {
+		t.Fatalf("expect config read at block 88, got %d", reader.configBlock)
+	}
+	watcher := NewGatewayWatcher(logger, reader, addr, url, 12)
+	notified := 0
+	watcher.Subscribe(func(address common.Address, url string) { notified++ })
+	if err := watcher.Poll(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if notified != 0 {
+		t.Fatalf("expect no notification on the first poll, got %d", notified)
+	}
+
+	// 区块数不足确认数时读取最新区块
+	reader.head = 5
+	if _, _, err := ConfirmedGatewayConfig(context.Background(), reader, 12); err != nil || reader.configBlock != 5 {
+		t.Fatalf("expect config read at block 5, got %d, %v", reader.configBlock, err)
+	}
+}
+
+func TestGatewayWatcherConfirmations(t *testing.T) {
+	logger, _ := logging.NewZapLogger(logging.Development)
+	oldAddr := common.HexToAddress("0x01")
+	reader := &fakeGatewayReader{head: 5, address: oldAddr, url: "http://gateway-1"}
+	watcher := NewGatewayWatcher(logger, reader, oldAddr, "http://gateway-0", 12)
+
+	// 区块数不足确认数时不读取
+	if err := watcher.Poll(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if _, url := watcher.Gateway(); url != "http://gateway-0" {
+		t.Fatalf("unexpected url %s", url)
+	}
+
+	// 第一次读取已确认区块上的配置
+	reader.head = 100
+	if err := watcher.Poll(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if _, url := watcher.Gateway(); url != "http://gateway-1" || reader.configBlock != 88 {
+		t.Fatalf("unexpected url %s at block %d", url, reader.configBlock)
+	}
+
+	// 未确认区块中的变更暂不生效
+	reader.head = 110
+	reader.urlUpdates = map[uint64]string{95: "http://gateway-2", 105: "http://gateway-3"}
+	if err := watcher.Poll(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if _, url := watcher.Gateway(); url != "http://gateway-2" {
+		t.Fatalf("unexpected url %s", url)
+	}
+	if len(reader.queries) != 1 || reader.queries[0] != [2]uint64{89, 98} {
+		t.Fatalf("unexpected queries %v", reader.queries)
+	}
+
+	reader.head = 120
+	if err := watcher.Poll(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if _, url := watcher.Gateway(); url != "http://gateway-3" {
+		t.Fatalf("unexpected url %s", url)
+	}
+}
@@ -0,0 +1,352 @@
+package chainio
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	regcoord "github.com/Layr-Labs/eigensdk-go/contracts/bindings/RegistryCoordinator"
+	eigenSdkTypes "github.com/Layr-Labs/eigensdk-go/types"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	gethtypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"goplus/shared/pkg/signature"
+	"math/big"
+	"os"
+	"strings"
+	"time"
+)
+
+// DefaultRegisterGasLimit 是离线注册交易默认的 gas 上限。注册交易在 operator 签名之前无法估算 gas
+const DefaultRegisterGasLimit = 1_000_000
+
+var (
+	ErrOfflineTxSender = errors.New("signer address does not match the sender of offline tx")
+	ErrOfflineTxDigest = errors.New("registration digest in offline tx does not match its fields")
+)
+
+// AVSDirectory 中 operator 注册签名的 EIP-712 类型
+var (
+	eip712DomainTypeHash            = crypto.Keccak256Hash([]byte("EIP712Domain(string name,uint256 chainId,address verifyingContract)"))
+	eip712DomainNameHash            = crypto.Keccak256Hash([]byte("EigenLayer"))
+	operatorAVSRegistrationTypeHash = crypto.Keccak256Hash([]byte("OperatorAVSRegistration(address operator,address avs,bytes32 salt,uint256 expiry)"))
+)
+
+// OfflineRegistration 是注册交易中需要 operator 签名的 AVSDirectory 摘要，以及计算摘要使用的字段
+type OfflineRegistration struct {
+	Digest         common.Hash    `json:"digest"`
+	Salt           common.Hash    `json:"salt"`
+	Expiry         *hexutil.Big   `json:"expiry"`
+	ServiceManager common.Address `json:"service_manager"`
+	AVSDirectory   common.Address `json:"avs_directory"`
+}
+
+// AVSRegistrationDigest 在本地计算 AVSDirectory.calculateOperatorAVSRegistrationDigestHash 的结果
+func AVSRegistrationDigest(avsDirectory common.Address, chainId *big.Int, operator common.Address, avs common.Address, salt [32]byte, expiry *big.Int) common.Hash {
+	domainSeparator := crypto.Keccak256Hash(
+		eip712DomainTypeHash.Bytes(),
+		eip712DomainNameHash.Bytes(),
+		common.LeftPadBytes(chainId.Bytes(), 32),
+		common.LeftPadBytes(avsDirectory.Bytes(), 32),
+	)
+	structHash := crypto.Keccak256Hash(
+		operatorAVSRegistrationTypeHash.Bytes(),
+		common.LeftPadBytes(operator.Bytes(), 32),
+		common.LeftPadBytes(avs.Bytes(), 32),
+		salt[:],
+		common.LeftPadBytes(expiry.Bytes(), 32),
+	)
+	return crypto.Keccak256Hash([]byte("\x19\x01"), domainSeparator.Bytes(), structHash.Bytes())
+}
+
+// OfflineTx 是未签名的交易，在没有网络的机器上使用 operator 的 ECDSA 私钥签名后再广播
+type OfflineTx struct {
+	Method       string               `json:"method"`
+	ChainId      *hexutil.Big         `json:"chain_id"`
+	From         common.Address       `json:"from"`
+	To           common.Address       `json:"to"`
+	Nonce        hexutil.Uint64       `json:"nonce"`
+	Gas          hexutil.Uint64       `json:"gas"`
+	GasTipCap    *hexutil.Big         `json:"gas_tip_cap"`
+	GasFeeCap    *hexutil.Big         `json:"gas_fee_cap"`
+	Data         hexutil.Bytes        `json:"data"`
+	Registration *OfflineRegistration `json:"registration,omitempty"` // 仅注册交易需要，data 中的 operator 签名在签名交易时填入
+}
+
+// BuildOfflineRegisterTx 构造注册 operator 的未签名交易，BLS 签名在当前机器完成，operator 的 ECDSA 签名留空
+func (w *AvsWriter) BuildOfflineRegisterTx(
+	ctx context.Context,
+	operatorAddr common.Address,
+	blsSigner signature.BLSSigner,
+	operatorToAvsRegistrationSigSalt [32]byte,
+	operatorToAvsRegistrationSigExpiry *big.Int,
+	quorumNumbers eigenSdkTypes.QuorumNums,
+	socket string,
+	gasLimit uint64,
+) (*OfflineTx, error) {
+	pubkeyRegParams, digest, err := w.registrationParams(ctx, operatorAddr, blsSigner, operatorToAvsRegistrationSigSalt, operatorToAvsRegistrationSigExpiry)
+	if err != nil {
+		return nil, err
+	}
+
+	registryCoordinatorAbi, err := regcoord.ContractRegistryCoordinatorMetaData.GetAbi()
+	if err != nil {
+		return nil, err
+	}
+	data, err := registryCoordinatorAbi.Pack("registerOperator",
+		quorumNumbers.UnderlyingType(),
+		socket,
+		pubkeyRegParams,
+		regcoord.ISignatureUtilsSignatureWithSaltAndExpiry{
+			Signature: []byte{},
+			Salt:      operatorToAvsRegistrationSigSalt,
+			Expiry:    operatorToAvsRegistrationSigExpiry,
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if gasLimit == 0 {
+		gasLimit = DefaultRegisterGasLimit
+	}
+	tx, err := w.newOfflineTx(ctx, "registerOperator", operatorAddr, data, gasLimit)
+	if err != nil {
+		return nil, err
+	}
+	// 签名的机器会在本地重新计算摘要，这里确认本地的计算和合约一致
+	localDigest := AVSRegistrationDigest(w.AvsDirectoryAddr, tx.ChainId.ToInt(), operatorAddr, w.ServiceManagerAddr, operatorToAvsRegistrationSigSalt, operatorToAvsRegistrationSigExpiry)
+	if localDigest != digest {
+		return nil, fmt.Errorf("local registration digest %s does not match avs directory %s", localDigest.Hex(), digest.Hex())
+	}
+	tx.Registration = &OfflineRegistration{
+		Digest:         digest,
+		Salt:           operatorToAvsRegistrationSigSalt,
+		Expiry:         (*hexutil.Big)(operatorToAvsRegistrationSigExpiry),
+		ServiceManager: w.ServiceManagerAddr,
+		AVSDirectory:   w.AvsDirectoryAddr,
+	}
+	return tx, nil
+}
+
+// BuildOfflineDeregisterTx 构造从 quorum 注销 operator 的未签名交易
+func (w *AvsWriter) BuildOfflineDeregisterTx(ctx context.Context, operatorAddr common.Address, quorumNumbers eigenSdkTypes.QuorumNums) (*OfflineTx, error) {
+	registryCoordinatorAbi, err := regcoord.ContractRegistryCoordinatorMetaData.GetAbi()
+	if err != nil {
+		return nil, err
+	}
+	data, err := registryCoordinatorAbi.Pack("deregisterOperator", quorumNumbers.UnderlyingType())
+	if err != nil {
+		return nil, err
+	}
+	return w.newOfflineTx(ctx, "deregisterOperator", operatorAddr, data, 0)
+}
+
+// newOfflineTx 填充发往 RegistryCoordinator 的交易的 nonce 和手续费，gasLimit 为 0 时估算 gas
+func (w *AvsWriter) newOfflineTx(ctx context.Context, method string, from common.Address, data []byte, gasLimit uint64) (*OfflineTx, error) {
+	to := w.RegistryCoordinatorAddr
+
+	chainId, err := w.ethClient.ChainID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := w.ethClient.PendingNonceAt(ctx, from)
+	if err != nil {
+		return nil, err
+	}
+	if gasLimit == 0 {
+		gasLimit, err = w.ethClient.EstimateGas(ctx, ethereum.CallMsg{From: from, To: &to, Data: data})
+		if err != nil {
+			return nil, fmt.Errorf("failed to estimate gas: %w", err)
+		}
+	}
+	gasTipCap, gasFeeCap, err := SuggestFees(ctx, w.ethClient, w.MaxFeePerGas)
+	if err != nil {
+		return nil, err
+	}
+
+	return &OfflineTx{
+		Method:    method,
+		ChainId:   (*hexutil.Big)(chainId),
+		From:      from,
+		To:        to,
+		Nonce:     hexutil.Uint64(nonce),
+		Gas:       hexutil.Uint64(gasLimit),
+		GasTipCap: (*hexutil.Big)(gasTipCap),
+		GasFeeCap: (*hexutil.Big)(gasFeeCap),
+		Data:      data,
+	}, nil
+}
+
+// OfflineCall 是从离线交易的 data 中解码出的 RegistryCoordinator 调用，签名前展示给 operator 确认
+type OfflineCall struct {
+	Method         string
+	QuorumNumbers  []byte
+	Socket         string
+	Salt           common.Hash
+	Expiry         *big.Int
+	ServiceManager common.Address
+	AVSDirectory   common.Address
+}
+
+// Decode 检查离线交易发往 registryCoordinator，并且只调用 registerOperator 或 deregisterOperator。
+// 注册交易的摘要使用 data 中的 salt 和 expiry 在本地重新计算，不信任文件中的摘要
+func (t *OfflineTx) Decode(registryCoordinator common.Address) (*OfflineCall, error) {
+	if t.To != registryCoordinator {
+		return nil, fmt.Errorf("offline tx is sent to %s, not registry coordinator %s", t.To.Hex(), registryCoordinator.Hex())
+	}
+	registryCoordinatorAbi, err := regcoord.ContractRegistryCoordinatorMetaData.GetAbi()
+	if err != nil {
+		return nil, err
+	}
+	method, err := registryCoordinatorAbi.MethodById(t.Data)
+	if err != nil {
+		return nil, err
+	}
+	if method.Name != t.Method {
+		return nil, fmt.Errorf("offline tx calls %s, expected %s", method.Name, t.Method)
+	}
+	args, err := method.Inputs.Unpack(t.Data[4:])
+	if err != nil {
+		return nil, err
+	}
+
+	call := &OfflineCall{Method: method.Name}
+	switch method.Name {
+	case "deregisterOperator":
+		if t.Registration != nil {
+			return nil, errors.New("deregistration tx must not carry a registration digest")
+		}
+		call.QuorumNumbers = args[0].([]byte)
+	case "registerOperator":
+		if t.Registration == nil || t.Registration.Expiry == nil {
+			return nil, errors.New("registration tx has no registration digest")
+		}
+		sig := *abi.ConvertType(args[3], new(regcoord.ISignatureUtilsSignatureWithSaltAndExpiry)).(*regcoord.ISignatureUtilsSignatureWithSaltAndExpiry)
+		if sig.Salt != t.Registration.Salt || sig.Expiry.Cmp(t.Registration.Expiry.ToInt()) != 0 {
+			return nil, errors.New("salt or expiry in registration tx data does not match the registration digest")
+		}
+		digest := AVSRegistrationDigest(t.Registration.AVSDirectory, t.ChainId.ToInt(), t.From, t.Registration.ServiceManager, sig.Salt, sig.Expiry)
+		if digest != t.Registration.Digest {
+			return nil, ErrOfflineTxDigest
+		}
+		call.QuorumNumbers = args[0].([]byte)
+		call.Socket = args[1].(string)
+		call.Salt = sig.Salt
+		call.Expiry = sig.Expiry
+		call.ServiceManager = t.Registration.ServiceManager
+		call.AVSDirectory = t.Registration.AVSDirectory
+	default:
+		return nil, fmt.Errorf("offline tx calls %s, only registerOperator and deregisterOperator can be signed", method.Name)
+	}
+	return call, nil
+}
+
+// Describe 返回交易和解码后调用的文本，供签名前确认
+func (t *OfflineTx) Describe(call *OfflineCall) string {
+	var b strings.Builder
+	_, _ = fmt.Fprintf(&b, "Method:\t%s\n", call.Method)
+	_, _ = fmt.Fprintf(&b, "Chain id:\t%s\n", t.ChainId.ToInt())
+	_, _ = fmt.Fprintf(&b, "From:\t%s\n", t.From.Hex())
+	_, _ = fmt.Fprintf(&b, "To:\t%s\n", t.To.Hex())
+	_, _ = fmt.Fprintf(&b, "Nonce:\t%d\n", t.Nonce)
+	_, _ = fmt.Fprintf(&b, "Gas limit:\t%d\n", t.Gas)
+	_, _ = fmt.Fprintf(&b, "Max fee per gas:\t%s wei\n", t.GasFeeCap.ToInt())
+	_, _ = fmt.Fprintf(&b, "Max priority fee per gas:\t%s wei\n", t.GasTipCap.ToInt())
+	_, _ = fmt.Fprintf(&b, "Quorums:\t%v\n", []uint8(call.QuorumNumbers))
+	if call.Method == "registerOperator" {
+		_, _ = fmt.Fprintf(&b, "Socket:\t%s\n", call.Socket)
+		_, _ = fmt.Fprintf(&b, "AVS (service manager):\t%s\n", call.ServiceManager.Hex())
+		_, _ = fmt.Fprintf(&b, "AVS directory:\t%s\n", call.AVSDirectory.Hex())
+		_, _ = fmt.Fprintf(&b, "Signature salt:\t%s\n", call.Salt.Hex())
+		_, _ = fmt.Fprintf(&b, "Signature expiry:\t%s (%s)\n", call.Expiry, time.Unix(call.Expiry.Int64(), 0).UTC().Format(time.RFC3339))
+	}
+	return b.String()
+}
+
+// Sign 检查并使用 operator 的 ECDSA signer 签名交易。注册交易会先签名本地重新计算的 AVSDirectory 摘要，并把签名填入 data
+func (t *OfflineTx) Sign(signer signature.ECDSASigner, registryCoordinator common.Address) (*gethtypes.Transaction, error) {
+	if signer.Address() != t.From {
+		return nil, ErrOfflineTxSender
+	}
+	if _, err := t.Decode(registryCoordinator); err != nil {
+		return nil, err
+	}
+
+	data := t.Data
+	if t.Registration != nil {
+		operatorSignature, err := signer.SignHash(t.Registration.Digest)
+		if err != nil {
+			return nil, err
+		}
+		// 合约要求 V 为 27 或 28
+		operatorSignature[64] += 27
+		data, err = setRegistrationSignature(t.Data, operatorSignature)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	tx := gethtypes.NewTx(&gethtypes.DynamicFeeTx{
+		ChainID:   t.ChainId.ToInt(),
+		Nonce:     uint64(t.Nonce),
+		GasTipCap: t.GasTipCap.ToInt(),
+		GasFeeCap: t.GasFeeCap.ToInt(),
+		Gas:       uint64(t.Gas),
+		To:        &t.To,
+		Data:      data,
+	})
+	return signature.TxSignerFn(signer, t.ChainId.ToInt())(t.From, tx)
+}
+
+// setRegistrationSignature 把 operator 的签名填入 registerOperator 的调用数据
+func setRegistrationSignature(data []byte, operatorSignature []byte) ([]byte, error) {
+	registryCoordinatorAbi, err := regcoord.ContractRegistryCoordinatorMetaData.GetAbi()
+	if err != nil {
+		return nil, err
+	}
+	method, err := registryCoordinatorAbi.MethodById(data)
+	if err != nil {
+		return nil, err
+	}
+	if method.Name != "registerOperator" {
+		return nil, fmt.Errorf("unexpected method %s in registration tx", method.Name)
+	}
+
+	args, err := method.Inputs.Unpack(data[4:])
+	if err != nil {
+		return nil, err
+	}
+	sig := *abi.ConvertType(args[3], new(regcoord.ISignatureUtilsSignatureWithSaltAndExpiry)).(*regcoord.ISignatureUtilsSignatureWithSaltAndExpiry)
+	sig.Signature = operatorSignature
+
+	return registryCoordinatorAbi.Pack(method.Name, args[0], args[1], args[2], sig)
+}
+
+// WriteOfflineTx 把未签名的交易写入文件
+func WriteOfflineTx(path string, tx *OfflineTx) error {
+	data, err := json.MarshalIndent(tx, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// ReadOfflineTx 从文件读取未签名的交易
+func ReadOfflineTx(path string) (*OfflineTx, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	tx := &OfflineTx{}
+	if err := json.Unmarshal(data, tx); err != nil {
+		return nil, err
+	}
+	if tx.ChainId == nil || tx.GasTipCap == nil || tx.GasFeeCap == nil {
+		return nil, errors.New("offline tx is incomplete")
+	}
+	return tx, nil
+}
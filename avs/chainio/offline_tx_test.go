@@ -0,0 +1,228 @@
+package chainio
+
+import (
+	regcoord "github.com/Layr-Labs/eigensdk-go/contracts/bindings/RegistryCoordinator"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	gethtypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"goplus/shared/pkg/signature"
+	"math/big"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestOfflineRegisterTxSign(t *testing.T) {
+	privateKey, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := signature.NewPrivateKeySigner(privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	registryCoordinatorAbi, err := regcoord.ContractRegistryCoordinatorMetaData.GetAbi()
+	if err != nil {
+		t.Fatal(err)
+	}
+	salt := common.HexToHash("0x01")
+	expiry := big.NewInt(1_000)
+	data, err := registryCoordinatorAbi.Pack("registerOperator",
+		[]byte{0},
+		`{"node_class":"xl","url":"http://operator"}`,
+		regcoord.IBLSApkRegistryPubkeyRegistrationParams{
+			PubkeyRegistrationSignature: regcoord.BN254G1Point{X: big.NewInt(1), Y: big.NewInt(2)},
+			PubkeyG1:                    regcoord.BN254G1Point{X: big.NewInt(3), Y: big.NewInt(4)},
+			PubkeyG2: regcoord.BN254G2Point{
+				X: [2]*big.Int{big.NewInt(5), big.NewInt(6)},
+				Y: [2]*big.Int{big.NewInt(7), big.NewInt(8)},
+			},
+		},
+		regcoord.ISignatureUtilsSignatureWithSaltAndExpiry{Signature: []byte{}, Salt: salt, Expiry: expiry},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	offlineTx := &OfflineTx{
+		Method:    "registerOperator",
+		ChainId:   (*hexutil.Big)(big.NewInt(17000)),
+		From:      signer.Address(),
+		To:        common.HexToAddress("0x1234"),
+		Nonce:     3,
+		Gas:       DefaultRegisterGasLimit,
+		GasTipCap: (*hexutil.Big)(big.NewInt(1)),
+		GasFeeCap: (*hexutil.Big)(big.NewInt(2)),
+		Data:      data,
+		Registration: &OfflineRegistration{
+			Salt:           salt,
+			Expiry:         (*hexutil.Big)(expiry),
+			ServiceManager: common.HexToAddress("0x5678"),
+			AVSDirectory:   common.HexToAddress("0x9abc"),
+		},
+	}
+	offlineTx.Registration.Digest = AVSRegistrationDigest(common.HexToAddress("0x9abc"), big.NewInt(17000), signer.Address(), common.HexToAddress("0x5678"), salt, expiry)
+
+	// 经过文件读写之后签名
+	path := filepath.Join(t.TempDir(), "register.json")
+	if err := WriteOfflineTx(path, offlineTx); err != nil {
+		t.Fatal(err)
+	}
+	offlineTx, err = ReadOfflineTx(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	call, err := offlineTx.Decode(common.HexToAddress("0x1234"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if call.Socket != `{"node_class":"xl","url":"http://operator"}` || !strings.Contains(offlineTx.Describe(call), "0x0000000000000000000000000000000000005678") {
+		t.Errorf("unexpected decoded call %+v", call)
+	}
+
+	tx, err := offlineTx.Sign(signer, common.HexToAddress("0x1234"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sender, err := gethtypes.Sender(gethtypes.LatestSignerForChainID(big.NewInt(17000)), tx)
+	if err != nil || sender != signer.Address() {
+		t.Fatalf("unexpected sender %s: %v", sender.Hex(), err)
+	}
+	if tx.Nonce() != 3 || tx.Gas() != DefaultRegisterGasLimit || *tx.To() != offlineTx.To {
+		t.Errorf("tx fields do not match offline tx")
+	}
+
+	args, err := registryCoordinatorAbi.Methods["registerOperator"].Inputs.Unpack(tx.Data()[4:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig := *abi.ConvertType(args[3], new(regcoord.ISignatureUtilsSignatureWithSaltAndExpiry)).(*regcoord.ISignatureUtilsSignatureWithSaltAndExpiry)
+	if sig.Salt != salt || sig.Expiry.Cmp(expiry) != 0 || len(sig.Signature) != 65 {
+		t.Fatalf("unexpected operator signature %+v", sig)
+	}
+	sig.Signature[64] -= 27
+	if !signature.VerifySignatureWithAddress(offlineTx.Registration.Digest.Bytes(), sig.Signature, signer.Address()) {
+		t.Errorf("operator signature does not match the registration digest")
+	}
+}
+
+func TestOfflineTxSignWrongSigner(t *testing.T) {
+	privateKey, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := signature.NewPrivateKeySigner(privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	offlineTx := &OfflineTx{
+		ChainId:   (*hexutil.Big)(big.NewInt(17000)),
+		From:      common.HexToAddress("0x1234"),
+		GasTipCap: (*hexutil.Big)(big.NewInt(1)),
+		GasFeeCap: (*hexutil.Big)(big.NewInt(2)),
+	}
+	if _, err := offlineTx.Sign(signer, common.HexToAddress("0x1234")); err != ErrOfflineTxSender {
+		t.Errorf("expected ErrOfflineTxSender, got %v", err)
+	}
+}
+
+func TestOfflineTxSignRejected(t *testing.T) {
+	privateKey, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := signature.NewPrivateKeySigner(privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	registryCoordinatorAbi, err := regcoord.ContractRegistryCoordinatorMetaData.GetAbi()
+	if err != nil {
+		t.Fatal(err)
+	}
+	deregisterData, err := registryCoordinatorAbi.Pack("deregisterOperator", []byte{0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	updateSocketData, err := registryCoordinatorAbi.Pack("updateSocket", "socket")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newTx := func(method string, data []byte) *OfflineTx {
+		return &OfflineTx{
+			Method:    method,
+			ChainId:   (*hexutil.Big)(big.NewInt(17000)),
+			From:      signer.Address(),
+			To:        common.HexToAddress("0x1234"),
+			GasTipCap: (*hexutil.Big)(big.NewInt(1)),
+			GasFeeCap: (*hexutil.Big)(big.NewInt(2)),
+			Data:      data,
+		}
+	}
+
+	if _, err := newTx("deregisterOperator", deregisterData).Sign(signer, common.HexToAddress("0x1234")); err != nil {
+		t.Fatal(err)
+	}
+	// 不是发往 RegistryCoordinator 的交易
+	if _, err := newTx("deregisterOperator", deregisterData).Sign(signer, common.HexToAddress("0x4321")); err == nil {
+		t.Error("expected error for tx to another contract")
+	}
+	// method 字段和 data 不一致
+	if _, err := newTx("registerOperator", deregisterData).Sign(signer, common.HexToAddress("0x1234")); err == nil {
+		t.Error("expected error for mismatched method")
+	}
+	if _, err := newTx("updateSocket", updateSocketData).Sign(signer, common.HexToAddress("0x1234")); err == nil {
+		t.Error("expected error for updateSocket")
+	}
+
+	// 文件中的摘要和字段不一致
+	salt := common.HexToHash("0x01")
+	expiry := big.NewInt(1_000)
+	registerData, err := registryCoordinatorAbi.Pack("registerOperator",
+		[]byte{0},
+		"socket",
+		regcoord.IBLSApkRegistryPubkeyRegistrationParams{
+			PubkeyRegistrationSignature: regcoord.BN254G1Point{X: big.NewInt(1), Y: big.NewInt(2)},
+			PubkeyG1:                    regcoord.BN254G1Point{X: big.NewInt(3), Y: big.NewInt(4)},
+			PubkeyG2: regcoord.BN254G2Point{
+				X: [2]*big.Int{big.NewInt(5), big.NewInt(6)},
+				Y: [2]*big.Int{big.NewInt(7), big.NewInt(8)},
+			},
+		},
+		regcoord.ISignatureUtilsSignatureWithSaltAndExpiry{Signature: []byte{}, Salt: salt, Expiry: expiry},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	registerTx := newTx("registerOperator", registerData)
+	registerTx.Registration = &OfflineRegistration{
+		Digest:         crypto.Keccak256Hash([]byte("digest of another message")),
+		Salt:           salt,
+		Expiry:         (*hexutil.Big)(expiry),
+		ServiceManager: common.HexToAddress("0x5678"),
+		AVSDirectory:   common.HexToAddress("0x9abc"),
+	}
+	if _, err := registerTx.Sign(signer, common.HexToAddress("0x1234")); err != ErrOfflineTxDigest {
+		t.Errorf("expected ErrOfflineTxDigest, got %v", err)
+	}
+}
+
+func TestAVSRegistrationDigest(t *testing.T) {
+	// 期望值由 AVSDirectory 合约的 calculateOperatorAVSRegistrationDigestHash 计算
+	digest := AVSRegistrationDigest(
+		common.HexToAddress("0x9abc"),
+		big.NewInt(1337),
+		common.HexToAddress("0x11"),
+		common.HexToAddress("0x22"),
+		common.HexToHash("0x0102"),
+		big.NewInt(123456),
+	)
+	if digest != common.HexToHash("0x42d469b7df7ef40abcd1c8903ca8b7ddcbbe0773156a4c51c1c95c65bba6ccfe") {
+		t.Errorf("unexpected digest %s", digest.Hex())
+	}
+}
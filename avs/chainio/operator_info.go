@@ -0,0 +1,170 @@
+package chainio
+
+import (
+	"context"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"math/big"
+)
+
+// OperatorInfo 是链上记录的 operator 注册信息
+type OperatorInfo struct {
+	Operator           common.Address
+	OperatorId         [32]byte
+	Status             uint8
+	Quorums            []uint8 // operator 当前所在的 quorum
+	Socket             string  // 最近一次注册或更新时写入的 socket，从未注册时为空
+	RestakedStrategies []common.Address
+}
+
+// QuorumCount 获取 RegistryCoordinator 中已创建的 quorum 数量
+func (r *AvsReader) QuorumCount(ctx context.Context) (uint8, error) {
+	return r.RegistryCoordinator.QuorumCount(&bind.CallOpts{Context: ctx})
+}
+
+// OperatorInfo 从 RegistryCoordinator 和 GoPlusServiceManager 读取 operator 的注册信息
+func (r *AvsReader) OperatorInfo(ctx context.Context, operator common.Address) (*OperatorInfo, error) {
+	opts := &bind.CallOpts{Context: ctx}
+
+	registered, err := r.RegistryCoordinator.GetOperator(opts, operator)
+	if err != nil {
+		return nil, err
+	}
+	info := &OperatorInfo{
+		Operator:   operator,
+		OperatorId: registered.OperatorId,
+		Status:     registered.Status,
+		Quorums:    make([]uint8, 0),
+	}
+	if info.Status == OperatorNeverRegistered {
+		return info, nil
+	}
+
+	bitmap, err := r.RegistryCoordinator.GetCurrentQuorumBitmap(opts, info.OperatorId)
+	if err != nil {
+		return nil, err
+	}
+	info.Quorums = quorumsFromBitmap(bitmap)
+
+	info.Socket, err = r.OperatorSocket(ctx, info.OperatorId)
+	if err != nil {
+		return nil, err
+	}
+
+	info.RestakedStrategies, err = r.ServiceManager.GetOperatorRestakedStrategies(opts, operator)
+	if err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+// OperatorSocket 读取 operator 最近一次写入的 socket。合约只在事件中记录 socket，每次注册都会写入 socket，
+// 因此只需要查询最近一次注册之后的 OperatorSocketUpdate 事件
+func (r *AvsReader) OperatorSocket(ctx context.Context, operatorId [32]byte) (string, error) {
+	fromBlock, registered, err := r.lastRegistrationBlock(ctx, operatorId)
+	if err != nil || !registered {
+		return "", err
+	}
+
+	head, err := r.ethClient.BlockNumber(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	return findLatestSocket(ctx, func(ctx context.Context, fromBlock uint64, toBlock uint64) (string, bool, error) {
+		iter, err := r.RegistryCoordinator.FilterOperatorSocketUpdate(&bind.FilterOpts{Start: fromBlock, End: &toBlock, Context: ctx}, [][32]byte{operatorId})
+		if err != nil {
+			return "", false, err
+		}
+		defer iter.Close()
+		socket, found := "", false
+		for iter.Next() {
+			socket, found = iter.Event.Socket, true
+		}
+		return socket, found, iter.Error()
+	}, fromBlock, head)
+}
+
+// lastRegistrationBlock 从 quorum bitmap 历史中找到 operator 最近一次从没有 quorum 变为有 quorum 的区块，
+// 从未注册时返回 false
+func (r *AvsReader) lastRegistrationBlock(ctx context.Context, operatorId [32]byte) (uint64, bool, error) {
+	opts := &bind.CallOpts{Context: ctx}
+
+	historyLength, err := r.RegistryCoordinator.GetQuorumBitmapHistoryLength(opts, operatorId)
+	if err != nil {
+		return 0, false, err
+	}
+	return findRegistrationBlock(historyLength.Int64(), func(index int64) (uint64, *big.Int, error) {
+		update, err := r.RegistryCoordinator.GetQuorumBitmapUpdateByIndex(opts, operatorId, big.NewInt(index))
+		if err != nil {
+			return 0, nil, err
+		}
+		return uint64(update.UpdateBlockNumber), update.QuorumBitmap, nil
+	})
+}
+
+// findRegistrationBlock 从最新的 bitmap 更新向前查找，返回最近一次注册的区块
+func findRegistrationBlock(historyLength int64, bitmapUpdate func(index int64) (uint64, *big.Int, error)) (uint64, bool, error) {
+	var registrationBlock uint64
+	registered := false
+	for index := historyLength - 1; index >= 0; index-- {
+		block, bitmap, err := bitmapUpdate(index)
+		if err != nil {
+			return 0, false, err
+		}
+		if bitmap.Sign() == 0 {
+			if registered {
+				break
+			}
+			continue
+		}
+		registrationBlock, registered = block, true
+	}
+	return registrationBlock, registered, nil
+}
+
+// socketFilter 查询 [fromBlock, toBlock] 区间内 operator 最后一次写入的 socket
+type socketFilter func(ctx context.Context, fromBlock uint64, toBlock uint64) (string, bool, error)
+
+// findLatestSocket 先用一次查询覆盖整个区间，事件按 operatorId 索引，通常只有很少的结果。
+// RPC 拒绝过大的区间时，再从最新区块向前分段查询
+func findLatestSocket(ctx context.Context, filter socketFilter, fromBlock uint64, head uint64) (string, error) {
+	if fromBlock > head {
+		return "", nil
+	}
+	socket, _, err := filter(ctx, fromBlock, head)
+	if err == nil {
+		return socket, nil
+	}
+	if ctx.Err() != nil {
+		return "", err
+	}
+
+	for toBlock := head; ; toBlock -= maxFilterBlockRange {
+		chunkStart := fromBlock
+		if toBlock-fromBlock >= maxFilterBlockRange {
+			chunkStart = toBlock - maxFilterBlockRange + 1
+		}
+		socket, found, err := filter(ctx, chunkStart, toBlock)
+		if err != nil {
+			return "", err
+		}
+		if found {
+			return socket, nil
+		}
+		if chunkStart == fromBlock {
+			return "", nil
+		}
+	}
+}
+
+// quorumsFromBitmap 把 quorum bitmap 转换为 quorum 编号列表
+func quorumsFromBitmap(bitmap *big.Int) []uint8 {
+	quorums := make([]uint8, 0)
+	for i := 0; i < bitmap.BitLen() && i < 256; i++ {
+		if bitmap.Bit(i) == 1 {
+			quorums = append(quorums, uint8(i))
+		}
+	}
+	return quorums
+}
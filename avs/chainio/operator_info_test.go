@@ -0,0 +1,110 @@
+package chainio
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"reflect"
+	"testing"
+)
+
+func TestQuorumsFromBitmap(t *testing.T) {
+	cases := []struct {
+		bitmap  int64
+		quorums []uint8
+	}{
+		{0, []uint8{}},
+		{1, []uint8{0}},
+		{0b1010, []uint8{1, 3}},
+	}
+	for _, c := range cases {
+		quorums := quorumsFromBitmap(big.NewInt(c.bitmap))
+		if !reflect.DeepEqual(quorums, c.quorums) {
+			t.Errorf("bitmap %b: expected %v, got %v", c.bitmap, c.quorums, quorums)
+		}
+	}
+}
+
+func TestFindRegistrationBlock(t *testing.T) {
+	type update struct {
+		block  uint64
+		bitmap int64
+	}
+	cases := []struct {
+		name       string
+		history    []update
+		block      uint64
+		registered bool
+	}{
+		{"never registered", nil, 0, false},
+		{"registered", []update{{100, 1}}, 100, true},
+		// 加入新的 quorum 不是重新注册
+		{"joined quorum", []update{{100, 1}, {200, 3}}, 100, true},
+		{"registered again", []update{{100, 1}, {200, 0}, {300, 2}, {400, 3}}, 300, true},
+		// 已经注销时返回注销前最后一次注册的区块
+		{"deregistered", []update{{100, 1}, {200, 0}, {300, 2}, {400, 0}}, 300, true},
+	}
+	for _, c := range cases {
+		queries := 0
+		block, registered, err := findRegistrationBlock(int64(len(c.history)), func(index int64) (uint64, *big.Int, error) {
+			queries++
+			return c.history[index].block, big.NewInt(c.history[index].bitmap), nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if block != c.block || registered != c.registered {
+			t.Errorf("%s: expected %d %v, got %d %v", c.name, c.block, c.registered, block, registered)
+		}
+		if c.name == "registered again" && queries != 3 {
+			t.Errorf("%s: expected 3 queries, got %d", c.name, queries)
+		}
+	}
+}
+
+func TestFindLatestSocket(t *testing.T) {
+	updates := map[uint64]string{1000: "socket-1", 22000: "socket-2"}
+	var queries [][2]uint64
+	maxRange := uint64(0) // 为 0 时不限制查询的区间
+	filter := func(ctx context.Context, fromBlock uint64, toBlock uint64) (string, bool, error) {
+		queries = append(queries, [2]uint64{fromBlock, toBlock})
+		if maxRange != 0 && toBlock-fromBlock+1 > maxRange {
+			return "", false, errors.New("block range too large")
+		}
+		socket, found, last := "", false, uint64(0)
+		for block, s := range updates {
+			if block >= fromBlock && block <= toBlock && (!found || block > last) {
+				socket, found, last = s, true, block
+			}
+		}
+		return socket, found, nil
+	}
+
+	// 一次查询覆盖整个区间
+	socket, err := findLatestSocket(context.Background(), filter, 1000, 100000)
+	if err != nil || socket != "socket-2" || len(queries) != 1 {
+		t.Fatalf("unexpected socket %s, queries %v, err %v", socket, queries, err)
+	}
+
+	// RPC 限制区间时从最新区块向前分段查询，找到后停止
+	queries = nil
+	maxRange = maxFilterBlockRange
+	socket, err = findLatestSocket(context.Background(), filter, 1000, 30000)
+	if err != nil || socket != "socket-2" {
+		t.Fatalf("unexpected socket %s, err %v", socket, err)
+	}
+	if len(queries) != 3 || queries[1] != [2]uint64{25001, 30000} || queries[2] != [2]uint64{20001, 25000} {
+		t.Fatalf("unexpected queries %v", queries)
+	}
+
+	// 最后一段从注册区块开始
+	queries = nil
+	delete(updates, 22000)
+	socket, err = findLatestSocket(context.Background(), filter, 1000, 12000)
+	if err != nil || socket != "socket-1" {
+		t.Fatalf("unexpected socket %s, err %v", socket, err)
+	}
+	if last := queries[len(queries)-1]; last != [2]uint64{1000, 2000} {
+		t.Fatalf("unexpected queries %v", queries)
+	}
+}
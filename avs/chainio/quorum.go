@@ -0,0 +1,59 @@
+package chainio
+
+import (
+	"fmt"
+	eigenSdkTypes "github.com/Layr-Labs/eigensdk-go/types"
+	"slices"
+)
+
+// ValidateQuorums 检查 quorum 都已在 RegistryCoordinator 中创建，并且没有重复
+func ValidateQuorums(quorums []uint8, quorumCount uint8) error {
+	if len(quorums) == 0 {
+		return fmt.Errorf("no quorum specified")
+	}
+	seen := make(map[uint8]bool)
+	for _, q := range quorums {
+		if q >= quorumCount {
+			return fmt.Errorf("quorum %d does not exist, registry coordinator has %d quorums", q, quorumCount)
+		}
+		if seen[q] {
+			return fmt.Errorf("quorum %d is duplicated", q)
+		}
+		seen[q] = true
+	}
+	return nil
+}
+
+// QuorumsToJoin 返回 operator 还没有加入的 quorum，已经加入的 quorum 不能重复注册
+func QuorumsToJoin(wanted []uint8, current []uint8) []uint8 {
+	quorums := make([]uint8, 0)
+	for _, q := range wanted {
+		if !slices.Contains(current, q) {
+			quorums = append(quorums, q)
+		}
+	}
+	return quorums
+}
+
+// QuorumsToLeave 返回 operator 已经加入的 quorum，没有加入的 quorum 不能注销
+func QuorumsToLeave(wanted []uint8, current []uint8) []uint8 {
+	quorums := make([]uint8, 0)
+	for _, q := range wanted {
+		if slices.Contains(current, q) {
+			quorums = append(quorums, q)
+		}
+	}
+	return quorums
+}
+
+// ToQuorumNums 转换为 eigensdk 使用的 quorum 列表，合约要求 quorum 按升序排列
+func ToQuorumNums(quorums []uint8) eigenSdkTypes.QuorumNums {
+	sorted := slices.Clone(quorums)
+	slices.Sort(sorted)
+
+	quorumNumbers := make(eigenSdkTypes.QuorumNums, 0, len(sorted))
+	for _, q := range sorted {
+		quorumNumbers = append(quorumNumbers, eigenSdkTypes.QuorumNum(q))
+	}
+	return quorumNumbers
+}
@@ -0,0 +1,35 @@
+package chainio
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestValidateQuorums(t *testing.T) {
+	if err := ValidateQuorums([]uint8{0, 1}, 2); err != nil {
+		t.Fatalf("expected valid quorums, got %v", err)
+	}
+	if err := ValidateQuorums([]uint8{0, 2}, 2); err == nil {
+		t.Errorf("expected error for quorum out of range")
+	}
+	if err := ValidateQuorums([]uint8{1, 1}, 2); err == nil {
+		t.Errorf("expected error for duplicated quorum")
+	}
+	if err := ValidateQuorums(nil, 2); err == nil {
+		t.Errorf("expected error for empty quorums")
+	}
+}
+
+func TestQuorumsToJoinAndLeave(t *testing.T) {
+	current := []uint8{0, 2}
+
+	if join := QuorumsToJoin([]uint8{2, 1, 0}, current); !reflect.DeepEqual(join, []uint8{1}) {
+		t.Errorf("expected to join [1], got %v", join)
+	}
+	if leave := QuorumsToLeave([]uint8{2, 1}, current); !reflect.DeepEqual(leave, []uint8{2}) {
+		t.Errorf("expected to leave [2], got %v", leave)
+	}
+	if quorumNumbers := ToQuorumNums([]uint8{2, 0}); !reflect.DeepEqual(quorumNumbers.UnderlyingType(), []byte{0, 2}) {
+		t.Errorf("expected sorted quorum numbers, got %v", quorumNumbers)
+	}
+}
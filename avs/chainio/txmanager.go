@@ -0,0 +1,282 @@
+package chainio
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/Layr-Labs/eigensdk-go/chainio/clients/eth"
+	"github.com/Layr-Labs/eigensdk-go/chainio/txmgr"
+	"github.com/Layr-Labs/eigensdk-go/logging"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	gethtypes "github.com/ethereum/go-ethereum/core/types"
+	"goplus/shared/pkg/signature"
+	"math/big"
+	"time"
+)
+
+const (
+	feeBumpPercent     = 20 // 重发交易时手续费提高的比例，节点要求替换交易至少提高 10%
+	gasLimitMultiplier = 1.2
+	receiptPollPeriod  = 2 * time.Second
+)
+
+var (
+	ErrGasPriceTooHigh = errors.New("base fee exceeds max fee per gas")
+	ErrTxReverted      = errors.New("tx reverted")
+	ErrTxNotMined      = errors.New("tx is not mined before timeout")
+
+	errResendTimeout = errors.New("tx is not mined before resend")
+)
+
+// TxParams 是发送交易的参数
+type TxParams struct {
+	MaxFeePerGas   *big.Int      // 手续费上限，nil 表示不限制
+	Confirmations  uint64        // 交易所在区块之后需要等待的确认数，包括交易所在的区块
+	ResendInterval time.Duration // 交易在这段时间内没有上链时提高手续费重发，0 表示不重发
+	Timeout        time.Duration // 交易在这段时间内没有上链时放弃等待，0 表示一直等待到 ctx 结束
+}
+
+// TxManager 实现 eigensdk 的 txmgr.TxManager。和 SimpleTxManager 不同，它限制手续费上限，
+// 交易长时间没有上链时使用相同的 nonce 提高手续费重发，手续费达到上限后不再重发，并等待指定的确认数
+type TxManager struct {
+	logger    logging.Logger
+	ethClient eth.Client
+	signer    signature.ECDSASigner
+	chainId   *big.Int
+	params    TxParams
+
+	pollPeriod time.Duration
+}
+
+func NewTxManager(ethClient eth.Client, signer signature.ECDSASigner, chainId *big.Int, params TxParams, logger logging.Logger) *TxManager {
+	if params.Confirmations == 0 {
+		params.Confirmations = 1
+	}
+	return &TxManager{
+		logger:    logger,
+		ethClient: ethClient,
+		signer:    signer,
+		chainId:   chainId,
+		params:    params,
+
+		pollPeriod: receiptPollPeriod,
+	}
+}
+
+func (m *TxManager) GetNoSendTxOpts() (*bind.TransactOpts, error) {
+	return &bind.TransactOpts{
+		From:   m.signer.Address(),
+		NoSend: true,
+		Signer: txmgr.NoopSigner,
+	}, nil
+}
+
+// SuggestFees 获取建议的小费和手续费上限，并限制在 maxFeePerGas 之内
+func SuggestFees(ctx context.Context, ethClient eth.Client, maxFeePerGas *big.Int) (*big.Int, *big.Int, error) {
+	gasTipCap, err := ethClient.SuggestGasTipCap(ctx)
+	if err != nil {
+		gasTipCap = new(big.Int).Set(txmgr.FallbackGasTipCap)
+	}
+	header, err := ethClient.HeaderByNumber(ctx, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	baseFee := header.BaseFee
+	if baseFee == nil {
+		baseFee = big.NewInt(0)
+	}
+	if maxFeePerGas != nil && baseFee.Cmp(maxFeePerGas) > 0 {
+		return nil, nil, fmt.Errorf("%w: base fee %s, max fee per gas %s", ErrGasPriceTooHigh, baseFee, maxFeePerGas)
+	}
+
+	// 和 geth 的默认值一致，手续费上限为 2 倍的 base fee 加上小费
+	gasFeeCap := new(big.Int).Add(gasTipCap, new(big.Int).Mul(baseFee, big.NewInt(2)))
+	gasTipCap, gasFeeCap = capFees(gasTipCap, gasFeeCap, maxFeePerGas)
+	return gasTipCap, gasFeeCap, nil
+}
+
+func capFees(gasTipCap *big.Int, gasFeeCap *big.Int, maxFeePerGas *big.Int) (*big.Int, *big.Int) {
+	if maxFeePerGas != nil && gasFeeCap.Cmp(maxFeePerGas) > 0 {
+		gasFeeCap = new(big.Int).Set(maxFeePerGas)
+	}
+	if gasTipCap.Cmp(gasFeeCap) > 0 {
+		gasTipCap = new(big.Int).Set(gasFeeCap)
+	}
+	return gasTipCap, gasFeeCap
+}
+
+func bumpFee(fee *big.Int) *big.Int {
+	bumped := new(big.Int).Mul(fee, big.NewInt(100+feeBumpPercent))
+	bumped.Div(bumped, big.NewInt(100))
+	// 手续费很低时按比例提高可能不变
+	if bumped.Cmp(fee) <= 0 {
+		bumped.Add(fee, big.NewInt(1))
+	}
+	return bumped
+}
+
+// Send 签名并发送交易，返回确认后的 receipt。交易执行失败时同时返回 receipt 和 ErrTxReverted，
+// 超过 Timeout 没有上链时返回 ErrTxNotMined，已发送的交易之后仍可能上链
+func (m *TxManager) Send(ctx context.Context, tx *gethtypes.Transaction) (*gethtypes.Receipt, error) {
+	from := m.signer.Address()
+
+	// Timeout 只限制等待上链的时间，上链之后等待确认数使用 ctx
+	sendCtx := ctx
+	if m.params.Timeout > 0 {
+		var cancel context.CancelFunc
+		sendCtx, cancel = context.WithTimeout(ctx, m.params.Timeout)
+		defer cancel()
+	}
+
+	nonce, err := m.ethClient.PendingNonceAt(ctx, from)
+	if err != nil {
+		return nil, err
+	}
+	gasTipCap, gasFeeCap, err := SuggestFees(ctx, m.ethClient, m.params.MaxFeePerGas)
+	if err != nil {
+		return nil, err
+	}
+	gasLimit := tx.Gas()
+	if gasLimit == 0 {
+		gasLimit, err = m.ethClient.EstimateGas(ctx, ethereum.CallMsg{
+			From:      from,
+			To:        tx.To(),
+			GasTipCap: gasTipCap,
+			GasFeeCap: gasFeeCap,
+			Value:     tx.Value(),
+			Data:      tx.Data(),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to estimate gas: %w", err)
+		}
+	}
+	gasLimit = uint64(float64(gasLimit) * gasLimitMultiplier)
+
+	sentTxs := make([]common.Hash, 0)
+	for {
+		signedTx, err := signature.TxSignerFn(m.signer, m.chainId)(from, gethtypes.NewTx(&gethtypes.DynamicFeeTx{
+			ChainID:   m.chainId,
+			Nonce:     nonce,
+			GasTipCap: gasTipCap,
+			GasFeeCap: gasFeeCap,
+			Gas:       gasLimit,
+			To:        tx.To(),
+			Value:     tx.Value(),
+			Data:      tx.Data(),
+		}))
+		if err != nil {
+			return nil, err
+		}
+
+		err = m.ethClient.SendTransaction(ctx, signedTx)
+		if err != nil && len(sentTxs) == 0 {
+			return nil, fmt.Errorf("failed to send tx: %w", err)
+		}
+		if err != nil {
+			// 之前的交易可能已经上链，继续等待已发送的交易
+			m.logger.Warn("failed to resend tx with bumped fee", "txHash", signedTx.Hash().Hex(), "err", err)
+		} else {
+			sentTxs = append(sentTxs, signedTx.Hash())
+			m.logger.Info("sent tx", "txHash", signedTx.Hash().Hex(), "nonce", nonce, "gasTipCap", gasTipCap, "gasFeeCap", gasFeeCap)
+		}
+
+		resendInterval := m.params.ResendInterval
+		newTipCap, newFeeCap := capFees(bumpFee(gasTipCap), bumpFee(gasFeeCap), m.params.MaxFeePerGas)
+		if resendInterval > 0 && (newFeeCap.Cmp(gasFeeCap) <= 0 || newTipCap.Cmp(gasTipCap) <= 0) {
+			// 手续费已经达到上限，重发相同的交易没有意义，只等待已发送的交易
+			m.logger.Warn("fee reached max fee per gas, waiting for sent txs without resending", "maxFeePerGas", m.params.MaxFeePerGas)
+			resendInterval = 0
+		}
+
+		receipt, err := m.waitMined(sendCtx, sentTxs, resendInterval)
+		if err == nil {
+			return m.waitConfirmations(ctx, receipt)
+		}
+		if !errors.Is(err, errResendTimeout) {
+			if ctx.Err() == nil && sendCtx.Err() != nil {
+				return nil, fmt.Errorf("%w: nonce %d, sent txs %v", ErrTxNotMined, nonce, sentTxs)
+			}
+			return nil, err
+		}
+
+		m.logger.Info("tx is not mined yet, resending with bumped fee", "nonce", nonce)
+		gasTipCap, gasFeeCap = newTipCap, newFeeCap
+	}
+}
+
+// WaitMined 等待已发送的交易上链并达到确认数
+func (m *TxManager) WaitMined(ctx context.Context, txHash common.Hash) (*gethtypes.Receipt, error) {
+	receipt, err := m.waitMined(ctx, []common.Hash{txHash}, 0)
+	if err != nil {
+		return nil, err
+	}
+	return m.waitConfirmations(ctx, receipt)
+}
+
+// waitMined 等待任意一笔交易上链，timeout 为 0 时一直等待到 ctx 结束
+func (m *TxManager) waitMined(ctx context.Context, txHashes []common.Hash, timeout time.Duration) (*gethtypes.Receipt, error) {
+	var deadline <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		deadline = timer.C
+	}
+
+	ticker := time.NewTicker(m.pollPeriod)
+	defer ticker.Stop()
+	for {
+		for _, txHash := range txHashes {
+			receipt, err := m.ethClient.TransactionReceipt(ctx, txHash)
+			if err == nil && receipt != nil {
+				return receipt, nil
+			}
+			if err != nil && !errors.Is(err, ethereum.NotFound) {
+				m.logger.Warn("failed to get tx receipt", "txHash", txHash.Hex(), "err", err)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-deadline:
+			return nil, errResendTimeout
+		case <-ticker.C:
+		}
+	}
+}
+
+// waitConfirmations 等待交易所在区块之后产生足够的区块，期间交易被重组移出时重新等待上链
+func (m *TxManager) waitConfirmations(ctx context.Context, receipt *gethtypes.Receipt) (*gethtypes.Receipt, error) {
+	ticker := time.NewTicker(m.pollPeriod)
+	defer ticker.Stop()
+	for {
+		head, err := m.ethClient.BlockNumber(ctx)
+		if err != nil {
+			m.logger.Warn("failed to get block number", "err", err)
+		} else if head+1 >= receipt.BlockNumber.Uint64()+m.params.Confirmations {
+			confirmed, err := m.ethClient.TransactionReceipt(ctx, receipt.TxHash)
+			if err == nil && confirmed != nil {
+				if confirmed.Status != gethtypes.ReceiptStatusSuccessful {
+					return confirmed, ErrTxReverted
+				}
+				return confirmed, nil
+			}
+			m.logger.Warn("tx receipt disappeared, waiting for it to be mined again", "txHash", receipt.TxHash.Hex())
+			receipt, err = m.waitMined(ctx, []common.Hash{receipt.TxHash}, 0)
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+var _ txmgr.TxManager = (*TxManager)(nil)
@@ -0,0 +1,185 @@
+package chainio
+
+import (
+	"context"
+	"errors"
+	"github.com/Layr-Labs/eigensdk-go/chainio/clients/eth"
+	"github.com/Layr-Labs/eigensdk-go/logging"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	gethtypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"goplus/shared/pkg/signature"
+	"math/big"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeEthClient 只实现 TxManager 用到的方法
+type fakeEthClient struct {
+	eth.Client
+
+	lock    sync.Mutex
+	baseFee *big.Int
+	head    uint64
+	sent    []*gethtypes.Transaction
+	// 第几笔发送的交易会上链，从 0 开始
+	minedIndex int
+	mined      map[common.Hash]*gethtypes.Receipt
+}
+
+func (c *fakeEthClient) PendingNonceAt(ctx context.Context, account common.Address) (uint64, error) {
+	return 7, nil
+}
+
+func (c *fakeEthClient) SuggestGasTipCap(ctx context.Context) (*big.Int, error) {
+	return big.NewInt(100), nil
+}
+
+func (c *fakeEthClient) HeaderByNumber(ctx context.Context, number *big.Int) (*gethtypes.Header, error) {
+	return &gethtypes.Header{BaseFee: c.baseFee}, nil
+}
+
+func (c *fakeEthClient) EstimateGas(ctx context.Context, msg ethereum.CallMsg) (uint64, error) {
+	return 100_000, nil
+}
+
+func (c *fakeEthClient) SendTransaction(ctx context.Context, tx *gethtypes.Transaction) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if len(c.sent) == c.minedIndex {
+		c.mined[tx.Hash()] = &gethtypes.Receipt{
+			TxHash:      tx.Hash(),
+			BlockNumber: new(big.Int).SetUint64(c.head),
+			Status:      gethtypes.ReceiptStatusSuccessful,
+		}
+	}
+	c.sent = append(c.sent, tx)
+	return nil
+}
+
+func (c *fakeEthClient) TransactionReceipt(ctx context.Context, txHash common.Hash) (*gethtypes.Receipt, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if receipt, ok := c.mined[txHash]; ok {
+		return receipt, nil
+	}
+	return nil, ethereum.NotFound
+}
+
+// BlockNumber 每次查询产生一个新的区块
+func (c *fakeEthClient) BlockNumber(ctx context.Context) (uint64, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.head++
+	return c.head, nil
+}
+
+func newTestTxManager(t *testing.T, client *fakeEthClient, params TxParams) *TxManager {
+	privateKey, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := signature.NewPrivateKeySigner(privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger, _ := logging.NewZapLogger(logging.Development)
+
+	m := NewTxManager(client, signer, big.NewInt(17000), params, logger)
+	m.pollPeriod = 10 * time.Millisecond
+	return m
+}
+
+func newTestTx() *gethtypes.Transaction {
+	to := common.HexToAddress("0x1234")
+	return gethtypes.NewTx(&gethtypes.DynamicFeeTx{To: &to, Data: []byte{1, 2, 3}})
+}
+
+func TestTxManagerBumpFee(t *testing.T) {
+	client := &fakeEthClient{baseFee: big.NewInt(1000), head: 10, minedIndex: 1, mined: map[common.Hash]*gethtypes.Receipt{}}
+	m := newTestTxManager(t, client, TxParams{
+		MaxFeePerGas:   big.NewInt(2500),
+		Confirmations:  3,
+		ResendInterval: 50 * time.Millisecond,
+	})
+
+	receipt, err := m.Send(context.Background(), newTestTx())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(client.sent) != 2 {
+		t.Fatalf("expected 2 txs sent, got %d", len(client.sent))
+	}
+	first, second := client.sent[0], client.sent[1]
+	if receipt.TxHash != second.Hash() {
+		t.Errorf("expected receipt of the resent tx")
+	}
+	if first.Nonce() != 7 || second.Nonce() != 7 {
+		t.Errorf("resent tx must reuse the nonce")
+	}
+	if first.GasFeeCap().Cmp(big.NewInt(2100)) != 0 || first.Gas() != 120_000 {
+		t.Errorf("unexpected first tx fee cap %s gas %d", first.GasFeeCap(), first.Gas())
+	}
+	// 提高后的手续费不超过上限
+	if second.GasFeeCap().Cmp(big.NewInt(2500)) != 0 || second.GasTipCap().Cmp(big.NewInt(120)) != 0 {
+		t.Errorf("unexpected bumped fee cap %s tip cap %s", second.GasFeeCap(), second.GasTipCap())
+	}
+	if client.head+1 < receipt.BlockNumber.Uint64()+3 {
+		t.Errorf("returned before 3 confirmations, head %d, tx block %d", client.head, receipt.BlockNumber)
+	}
+}
+
+func TestTxManagerGasPriceTooHigh(t *testing.T) {
+	client := &fakeEthClient{baseFee: big.NewInt(3000), mined: map[common.Hash]*gethtypes.Receipt{}}
+	m := newTestTxManager(t, client, TxParams{MaxFeePerGas: big.NewInt(2500)})
+
+	_, err := m.Send(context.Background(), newTestTx())
+	if !errors.Is(err, ErrGasPriceTooHigh) {
+		t.Fatalf("expected ErrGasPriceTooHigh, got %v", err)
+	}
+	if len(client.sent) != 0 {
+		t.Errorf("expected no tx sent")
+	}
+}
+
+func TestTxManagerStopResendAtMaxFee(t *testing.T) {
+	// 交易一直不上链
+	client := &fakeEthClient{baseFee: big.NewInt(1000), head: 10, minedIndex: -1, mined: map[common.Hash]*gethtypes.Receipt{}}
+	m := newTestTxManager(t, client, TxParams{
+		MaxFeePerGas:   big.NewInt(2500),
+		ResendInterval: 20 * time.Millisecond,
+		Timeout:        300 * time.Millisecond,
+	})
+
+	_, err := m.Send(context.Background(), newTestTx())
+	if !errors.Is(err, ErrTxNotMined) {
+		t.Fatalf("expected ErrTxNotMined, got %v", err)
+	}
+	// 第二笔交易的手续费已经达到上限，之后不再重发
+	if len(client.sent) != 2 {
+		t.Fatalf("expected 2 txs sent, got %d", len(client.sent))
+	}
+}
+
+func TestTxManagerNoResend(t *testing.T) {
+	client := &fakeEthClient{baseFee: big.NewInt(1000), head: 10, minedIndex: -1, mined: map[common.Hash]*gethtypes.Receipt{}}
+	m := newTestTxManager(t, client, TxParams{Timeout: 100 * time.Millisecond})
+
+	_, err := m.Send(context.Background(), newTestTx())
+	if !errors.Is(err, ErrTxNotMined) {
+		t.Fatalf("expected ErrTxNotMined, got %v", err)
+	}
+	if len(client.sent) != 1 {
+		t.Fatalf("expected 1 tx sent, got %d", len(client.sent))
+	}
+
+	// 调用方取消时返回 ctx 的错误
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	m.params.Timeout = time.Minute
+	if _, err := m.Send(ctx, newTestTx()); !errors.Is(err, context.DeadlineExceeded) || errors.Is(err, ErrTxNotMined) {
+		t.Fatalf("expected context.DeadlineExceeded, got %v", err)
+	}
+}
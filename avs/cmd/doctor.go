@@ -0,0 +1,316 @@
+// doctor 命令逐项检查 operator 的配置和运行环境，输出检查结果
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/Layr-Labs/eigensdk-go/chainio/clients/eth"
+	sdklogging "github.com/Layr-Labs/eigensdk-go/logging"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/urfave/cli/v2"
+	"go.uber.org/zap"
+	"goplus/avs/chainio"
+	"goplus/avs/config"
+	"goplus/avs/secwaremanager"
+	"goplus/shared/pkg/signature"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+	"time"
+)
+
+const (
+	checkPass = "PASS"
+	checkFail = "FAIL"
+	checkSkip = "SKIP"
+
+	doctorTimeout = 10 * time.Second
+)
+
+type doctorCheck struct {
+	Name   string
+	Result string
+	Detail string
+}
+
+type doctor struct {
+	checks []doctorCheck
+}
+
+// run 执行一项检查，返回检查是否通过
+func (d *doctor) run(name string, fn func() (string, error)) bool {
+	detail, err := fn()
+	if err != nil {
+		d.checks = append(d.checks, doctorCheck{Name: name, Result: checkFail, Detail: err.Error()})
+		return false
+	}
+	d.checks = append(d.checks, doctorCheck{Name: name, Result: checkPass, Detail: detail})
+	return true
+}
+
+func (d *doctor) skip(name string, reason string) {
+	d.checks = append(d.checks, doctorCheck{Name: name, Result: checkSkip, Detail: reason})
+}
+
+func (d *doctor) failed() int {
+	num := 0
+	for _, check := range d.checks {
+		if check.Result == checkFail {
+			num++
+		}
+	}
+	return num
+}
+
+func (d *doctor) print() {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "CHECK\tRESULT\tDETAIL")
+	for _, check := range d.checks {
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%s\n", check.Name, check.Result, check.Detail)
+	}
+	_ = w.Flush()
+}
+
+// callWithContext 在 ctx 结束时提前返回，用于包装不接受 ctx 的调用。
+// 超时后 fn 仍在后台运行，doctor 随后退出，不需要等待它
+func callWithContext[T any](ctx context.Context, fn func() (T, error)) (T, error) {
+	type result struct {
+		value T
+		err   error
+	}
+	done := make(chan result, 1)
+	go func() {
+		value, err := fn()
+		done <- result{value, err}
+	}()
+	select {
+	case r := <-done:
+		return r.value, r.err
+	case <-ctx.Done():
+		var zero T
+		return zero, ctx.Err()
+	}
+}
+
+// checkWritable 检查目录存在并且可以写入文件。mayCreate 为 true 时允许目录不存在，
+// 这时检查 AVS 启动时能否在最近的上级目录中创建它。doctor 不会创建目录
+func checkWritable(dir string, mayCreate bool) (string, error) {
+	info, err := os.Stat(dir)
+	if err == nil {
+		if !info.IsDir() {
+			return "", fmt.Errorf("%s is not a directory", dir)
+		}
+		return dir, checkDirWritable(dir)
+	}
+	if !os.IsNotExist(err) || !mayCreate {
+		return "", err
+	}
+
+	parent := filepath.Dir(dir)
+	for {
+		if _, err := os.Stat(parent); err == nil {
+			break
+		} else if !os.IsNotExist(err) {
+			return "", err
+		}
+		parent = filepath.Dir(parent)
+	}
+	if err := checkDirWritable(parent); err != nil {
+		return "", fmt.Errorf("%s does not exist and cannot be created: %w", dir, err)
+	}
+	return fmt.Sprintf("%s does not exist, will be created in %s", dir, parent), nil
+}
+
+// checkDirWritable 在目录中创建并删除一个临时文件
+func checkDirWritable(dir string) error {
+	f, err := os.CreateTemp(dir, ".doctor-*")
+	if err != nil {
+		return err
+	}
+	_ = f.Close()
+	return os.Remove(f.Name())
+}
+
+// checkChainId 检查 ETH_RPC 连接的链和 RegistryCoordinator 所在的链一致，
+// 无法识别的部署只输出 chain id
+func checkChainId(chainId uint64, regCoordinatorAddr common.Address) (string, error) {
+	network, ok := config.KnownNetworks[regCoordinatorAddr]
+	if !ok {
+		return fmt.Sprintf("chain id %d, unknown registry coordinator, network not checked", chainId), nil
+	}
+	if chainId != network.ChainId {
+		return "", fmt.Errorf("eth rpc is on chain id %d, registry coordinator %s is on %s (chain id %d)", chainId, regCoordinatorAddr.Hex(), network.Name, network.ChainId)
+	}
+	return fmt.Sprintf("chain id %d (%s)", chainId, network.Name), nil
+}
+
+// checkContract 检查地址上部署了合约
+func checkContract(ctx context.Context, ethClient eth.Client, address common.Address) (string, error) {
+	code, err := ethClient.CodeAt(ctx, address, nil)
+	if err != nil {
+		return "", err
+	}
+	if len(code) == 0 {
+		return "", fmt.Errorf("no contract at %s", address.Hex())
+	}
+	return address.Hex(), nil
+}
+
+func runDoctor(cliCtx *cli.Context) error {
+	// 只输出警告以上的日志，避免干扰检查结果
+	zapConfig := zap.NewProductionConfig()
+	zapConfig.Level = zap.NewAtomicLevelAt(zap.WarnLevel)
+	logger, err := sdklogging.NewZapLoggerByConfig(zapConfig, zap.AddCallerSkip(1))
+	if err != nil {
+		return err
+	}
+
+	d := &doctor{}
+	defer func() {
+		d.print()
+	}()
+
+	ctx, cancel := context.WithTimeout(cliCtx.Context, doctorTimeout)
+	defer cancel()
+
+	var rawConfig config.RawConfig
+	if !d.run("config", func() (string, error) {
+		rawConfig, err = config.LoadRawConfig(cliCtx.String(config.ConfigFileFlag))
+		return "valid", err
+	}) {
+		return cli.Exit("doctor: config is invalid", 1)
+	}
+	addressOperator := common.HexToAddress(rawConfig.AddressOperator)
+
+	var blsSigner signature.BLSSigner
+	d.run("bls key", func() (string, error) {
+		blsSigner, err = config.NewBLSSigner(&rawConfig, logger)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("g1 public key %x", blsSigner.PubKeyG1().Serialize()), nil
+	})
+
+	ecdsaKeyStorePath, _ := config.GetOperatorECDSAKeyStorePath()
+	if ecdsaKeyStorePath == "" && !rawConfig.ECDSARemoteSigner {
+		d.skip("ecdsa key", "not configured, only required by registration commands")
+	} else {
+		d.run("ecdsa key", func() (string, error) {
+			ecdsaSigner, err := config.NewECDSASigner(config.Config{
+				Logger:            logger,
+				AddressOperator:   addressOperator,
+				RemoteSignerUrl:   rawConfig.RemoteSignerUrl,
+				ECDSARemoteSigner: rawConfig.ECDSARemoteSigner,
+
+				RemoteSignerOptions: rawConfig.GetRemoteSignerOptions(),
+			}, ecdsaKeyStorePath)
+			if err != nil {
+				return "", err
+			}
+			return ecdsaSigner.Address().Hex(), nil
+		})
+	}
+
+	d.run("compose file path", func() (string, error) {
+		return checkWritable(rawConfig.ComposeFilePath, false)
+	})
+	d.run("data path", func() (string, error) {
+		return checkWritable(rawConfig.GetDataPath(), true)
+	})
+	d.run("secware runner", func() (string, error) {
+		runner, err := secwaremanager.NewSecwareRunner(config.Config{
+			Logger:              logger,
+			SecwareRunner:       rawConfig.GetSecwareRunner(),
+			SecwareEngineSocket: rawConfig.GetSecwareEngineSocket(),
+		}, secwaremanager.NewSecwareAccessorImpl(nil), nil)
+		if err != nil {
+			return "", err
+		}
+		backend, err := runner.CheckBackend()
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("%s runner, %s", rawConfig.GetSecwareRunner(), backend), nil
+	})
+
+	var ethClient eth.Client
+	if !d.run("eth rpc", func() (string, error) {
+		ethClient, err = eth.NewClient(rawConfig.ETHRpc)
+		if err != nil {
+			return "", err
+		}
+		chainId, err := ethClient.ChainID(ctx)
+		if err != nil {
+			return "", err
+		}
+		return checkChainId(chainId.Uint64(), common.HexToAddress(rawConfig.RegCoordinatorAddr))
+	}) {
+		for _, name := range []string{"registry coordinator", "operator state retriever", "gateway config", "gateway", "registration"} {
+			d.skip(name, "eth rpc unavailable")
+		}
+		return cli.Exit(fmt.Sprintf("doctor: %d checks failed", d.failed()), 1)
+	}
+
+	regCoordinatorAddr := common.HexToAddress(rawConfig.RegCoordinatorAddr)
+	d.run("registry coordinator", func() (string, error) {
+		return checkContract(ctx, ethClient, regCoordinatorAddr)
+	})
+	d.run("operator state retriever", func() (string, error) {
+		return checkContract(ctx, ethClient, common.HexToAddress(rawConfig.OperatorStateRetrieverAddr))
+	})
+
+	var avsReader *chainio.AvsReader
+	var gatewayUrl string
+	gatewayOk := d.run("gateway config", func() (string, error) {
+		avsReader, err = chainio.NewAvsReader(regCoordinatorAddr, ethClient)
+		if err != nil {
+			return "", err
+		}
+		var gatewayAddr common.Address
+		gatewayAddr, gatewayUrl, err = avsReader.GatewayConfig(ctx)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("%s %s", gatewayAddr.Hex(), gatewayUrl), nil
+	})
+
+	if gatewayOk && blsSigner != nil {
+		d.run("gateway", func() (string, error) {
+			gatewayAccessor := &secwaremanager.GatewayAccessorImpl{
+				AddressOperator: addressOperator,
+				BLSSigner:       blsSigner,
+				GatewayUrl:      gatewayUrl,
+			}
+			secwares, err := callWithContext(ctx, gatewayAccessor.GetSecwareConfig)
+			if err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("%d secwares assigned", len(secwares)), nil
+		})
+	} else {
+		d.skip("gateway", "gateway config or bls key unavailable")
+	}
+
+	if avsReader != nil {
+		// 未注册不算失败，doctor 也用于注册前的检查
+		status, err := avsReader.OperatorStatus(ctx, addressOperator)
+		if err == nil && status != chainio.OperatorRegistered {
+			d.skip("registration", fmt.Sprintf("operator %s is %s, register it with reg-with-avs before starting AVS",
+				addressOperator.Hex(), chainio.OperatorStatusName(status)))
+		} else {
+			d.run("registration", func() (string, error) {
+				if err != nil {
+					return "", err
+				}
+				return chainio.OperatorStatusName(status), nil
+			})
+		}
+	} else {
+		d.skip("registration", "registry coordinator unavailable")
+	}
+
+	if num := d.failed(); num > 0 {
+		return cli.Exit(fmt.Sprintf("doctor: %d checks failed", num), 1)
+	}
+	return nil
+}
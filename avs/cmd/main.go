@@ -14,6 +14,10 @@ var (
 		Aliases: []string{"c"},
 		Usage:   "Config file path",
 	}
+	QuorumsFlag = cli.IntSliceFlag{
+		Name:  "quorums",
+		Usage: "Quorum numbers to register in or deregister from, overrides QUORUM_NUMS in config",
+	}
 )
 
 func main() {
@@ -35,12 +39,42 @@ func main() {
 				Name:   "register-with-avs",
 				Usage:  "Register current operator to GoPlusAVS",
 				Action: registerWithAVS,
-				Flags:  flags,
+				Flags:  append([]cli.Flag{&QuorumsFlag, &OfflineTxFlag, &GasLimitFlag}, flags...),
 			},
 			{
 				Name:   "deregister-with-avs",
 				Usage:  "Deregister current operator from GoPlusAVS",
 				Action: deregisterWithAVS,
+				Flags:  append([]cli.Flag{&QuorumsFlag, &OfflineTxFlag}, flags...),
+			},
+			{
+				Name:   "sign-offline-tx",
+				Usage:  "Sign the tx written by --offline-tx with the operator ECDSA key, no network is required",
+				Action: signOfflineTx,
+				Flags:  []cli.Flag{&TxFileFlag, &RawTxFileFlag, &RegistryCoordinatorFlag, &YesFlag},
+			},
+			{
+				Name:   "broadcast-tx",
+				Usage:  "Broadcast a signed raw tx to the registry coordinator",
+				Action: broadcastTx,
+				Flags:  append([]cli.Flag{&RawTxFileFlag}, flags...),
+			},
+			{
+				Name:   "update-socket",
+				Usage:  "Update the socket of current operator on chain with the node class and operator url in config",
+				Action: updateSocket,
+				Flags:  flags,
+			},
+			{
+				Name:   "status",
+				Usage:  "Show the registration status of current operator on chain",
+				Action: operatorStatus,
+				Flags:  append([]cli.Flag{&JSONOutputFlag}, flags...),
+			},
+			{
+				Name:   "doctor",
+				Usage:  "Check the config, keys, chain, gateway and docker before starting the operator",
+				Action: runDoctor,
 				Flags:  flags,
 			},
 		},
@@ -0,0 +1,248 @@
+// 离线交易：在联网的机器上生成未签名的交易，在没有网络的机器上签名，再回到联网的机器上广播
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"github.com/Layr-Labs/eigensdk-go/chainio/clients/eth"
+	regcoord "github.com/Layr-Labs/eigensdk-go/contracts/bindings/RegistryCoordinator"
+	sdklogging "github.com/Layr-Labs/eigensdk-go/logging"
+	eigenSdkTypes "github.com/Layr-Labs/eigensdk-go/types"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	gethtypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/urfave/cli/v2"
+	"goplus/avs/chainio"
+	"goplus/avs/config"
+	"goplus/avs/signer"
+	"log"
+	"math/big"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+const broadcastTimeout = 30 * time.Minute
+
+var (
+	OfflineTxFlag = cli.StringFlag{
+		Name:  "offline-tx",
+		Usage: "Write the unsigned tx to this file instead of signing and sending it, sign it with sign-offline-tx",
+	}
+	GasLimitFlag = cli.Uint64Flag{
+		Name:  "gas-limit",
+		Usage: "Gas limit of the offline registration tx",
+		Value: chainio.DefaultRegisterGasLimit,
+	}
+	TxFileFlag = cli.StringFlag{
+		Name:     "tx-file",
+		Usage:    "Unsigned tx file written by --offline-tx",
+		Required: true,
+	}
+	RawTxFileFlag = cli.StringFlag{
+		Name:     "raw-tx",
+		Usage:    "File of the signed raw tx in hex",
+		Required: true,
+	}
+	RegistryCoordinatorFlag = cli.StringFlag{
+		Name:     "registry-coordinator",
+		Usage:    "Address of the registry coordinator, same as REGISTRY_COORDINATOR_ADDR, the tx must be sent to it",
+		Required: true,
+	}
+	YesFlag = cli.BoolFlag{
+		Name:  "yes",
+		Usage: "Sign without asking for confirmation",
+	}
+)
+
+func newOfflineAvsWriter(cfg config.Config) (*chainio.AvsWriter, error) {
+	avsWriter, err := chainio.NewAvsWriter(cfg.RegCoordinatorAddr, cfg.EthHttpClient, nil, cfg.Logger)
+	if err != nil {
+		return nil, err
+	}
+	avsWriter.MaxFeePerGas = cfg.TxParams.MaxFeePerGas
+	return avsWriter, nil
+}
+
+func writeOfflineRegisterTx(
+	cliCtx *cli.Context,
+	cfg config.Config,
+	salt [32]byte,
+	expiry *big.Int,
+	quorumNumbers eigenSdkTypes.QuorumNums,
+	socket string,
+) error {
+	avsWriter, err := newOfflineAvsWriter(cfg)
+	if err != nil {
+		return err
+	}
+	tx, err := avsWriter.BuildOfflineRegisterTx(cliCtx.Context, cfg.AddressOperator, cfg.BLSSigner, salt, expiry, quorumNumbers, socket, cliCtx.Uint64(GasLimitFlag.Name))
+	if err != nil {
+		cfg.Logger.Errorf("Unable to build offline registration tx")
+		return err
+	}
+	return saveOfflineTx(cliCtx, cfg, tx)
+}
+
+func writeOfflineDeregisterTx(cliCtx *cli.Context, cfg config.Config, quorumNumbers eigenSdkTypes.QuorumNums) error {
+	avsWriter, err := newOfflineAvsWriter(cfg)
+	if err != nil {
+		return err
+	}
+	tx, err := avsWriter.BuildOfflineDeregisterTx(cliCtx.Context, cfg.AddressOperator, quorumNumbers)
+	if err != nil {
+		cfg.Logger.Errorf("Unable to build offline deregistration tx")
+		return err
+	}
+	return saveOfflineTx(cliCtx, cfg, tx)
+}
+
+func saveOfflineTx(cliCtx *cli.Context, cfg config.Config, tx *chainio.OfflineTx) error {
+	path := cliCtx.String(OfflineTxFlag.Name)
+	if err := chainio.WriteOfflineTx(path, tx); err != nil {
+		return err
+	}
+	if tx.Registration != nil {
+		cfg.Logger.Infof("AVS registration signature digest %s, expires at %s", tx.Registration.Digest.Hex(), tx.Registration.Expiry.ToInt())
+	}
+	cfg.Logger.Infof("Unsigned %s tx with nonce %d written to %s, sign it with sign-offline-tx on the machine holding the operator key.", tx.Method, tx.Nonce, path)
+	return nil
+}
+
+// signOfflineTx 在没有网络的机器上运行，只需要 operator 的 ECDSA keystore。
+// 签名前检查交易发往 RegistryCoordinator，并展示解码后的调用供确认
+func signOfflineTx(cliCtx *cli.Context) error {
+	tx, err := chainio.ReadOfflineTx(cliCtx.String(TxFileFlag.Name))
+	if err != nil {
+		return fmt.Errorf("failed to read offline tx: %w", err)
+	}
+
+	registryCoordinator := cliCtx.String(RegistryCoordinatorFlag.Name)
+	if !common.IsHexAddress(registryCoordinator) {
+		return fmt.Errorf("invalid registry coordinator address %s", registryCoordinator)
+	}
+	registryCoordinatorAddr := common.HexToAddress(registryCoordinator)
+	call, err := tx.Decode(registryCoordinatorAddr)
+	if err != nil {
+		return fmt.Errorf("refuse to sign offline tx: %w", err)
+	}
+	if network, ok := config.KnownNetworks[registryCoordinatorAddr]; ok && tx.ChainId.ToInt().Uint64() != network.ChainId {
+		return fmt.Errorf("refuse to sign offline tx: chain id %s, registry coordinator is on %s (chain id %d)", tx.ChainId.ToInt(), network.Name, network.ChainId)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprint(w, tx.Describe(call))
+	_ = w.Flush()
+	if !cliCtx.Bool(YesFlag.Name) && !confirm("Sign this tx?") {
+		return cli.Exit("offline tx is not signed", 1)
+	}
+
+	ecdsaKeyStorePath, _ := config.GetOperatorECDSAKeyStorePath()
+	if ecdsaKeyStorePath == "" {
+		return fmt.Errorf("operator ecdsa key store path not provided")
+	}
+	ecdsaKeyPassword, _ := config.GetOperatorECDSAKeyPassword()
+	ecdsaSigner, err := signer.NewKeystoreECDSASigner(ecdsaKeyStorePath, ecdsaKeyPassword)
+	if err != nil {
+		return err
+	}
+
+	signedTx, err := tx.Sign(ecdsaSigner, registryCoordinatorAddr)
+	if err != nil {
+		return err
+	}
+	rawTx, err := signedTx.MarshalBinary()
+	if err != nil {
+		return err
+	}
+
+	path := cliCtx.String(RawTxFileFlag.Name)
+	if err := os.WriteFile(path, []byte(hexutil.Encode(rawTx)), 0644); err != nil {
+		return err
+	}
+	log.Printf("Signed %s tx %s written to %s, broadcast it with broadcast-tx.", tx.Method, signedTx.Hash().Hex(), path)
+	return nil
+}
+
+// confirm 在终端询问 operator，输入 y 或 yes 时返回 true
+func confirm(question string) bool {
+	fmt.Printf("%s [y/N]: ", question)
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil {
+		return false
+	}
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
+
+// broadcastTx 广播已签名的交易，只接受 operator 发往 RegistryCoordinator 的交易
+func broadcastTx(cliCtx *cli.Context) error {
+	rawConfig, err := config.LoadRawConfig(cliCtx.String(config.ConfigFileFlag))
+	if err != nil {
+		return err
+	}
+
+	data, err := os.ReadFile(cliCtx.String(RawTxFileFlag.Name))
+	if err != nil {
+		return err
+	}
+	rawTx, err := hexutil.Decode(strings.TrimSpace(string(data)))
+	if err != nil {
+		return fmt.Errorf("invalid raw tx: %w", err)
+	}
+	tx := &gethtypes.Transaction{}
+	if err := tx.UnmarshalBinary(rawTx); err != nil {
+		return fmt.Errorf("invalid raw tx: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(cliCtx.Context, broadcastTimeout)
+	defer cancel()
+
+	ethClient, err := eth.NewClient(rawConfig.ETHRpc)
+	if err != nil {
+		return fmt.Errorf("failed to connect eth rpc: %w", err)
+	}
+	chainId, err := ethClient.ChainID(ctx)
+	if err != nil {
+		return err
+	}
+	if tx.ChainId().Cmp(chainId) != 0 {
+		return fmt.Errorf("tx is signed for chain %s, eth rpc is on chain %s", tx.ChainId(), chainId)
+	}
+	sender, err := gethtypes.Sender(gethtypes.LatestSignerForChainID(chainId), tx)
+	if err != nil {
+		return err
+	}
+	if sender != common.HexToAddress(rawConfig.AddressOperator) {
+		return fmt.Errorf("tx is signed by %s, not operator %s", sender.Hex(), rawConfig.AddressOperator)
+	}
+	if tx.To() == nil || *tx.To() != common.HexToAddress(rawConfig.RegCoordinatorAddr) {
+		return fmt.Errorf("tx is not sent to registry coordinator %s", rawConfig.RegCoordinatorAddr)
+	}
+
+	// 重复广播同一笔交易时，只等待已发送的交易
+	if _, err := ethClient.TransactionReceipt(ctx, tx.Hash()); err == nil {
+		log.Printf("Tx %s is already mined.", tx.Hash().Hex())
+	} else if err := ethClient.SendTransaction(ctx, tx); err != nil && !strings.Contains(err.Error(), "already known") {
+		return fmt.Errorf("failed to send tx: %w", err)
+	} else {
+		log.Printf("Sent tx %s, waiting for receipt...", tx.Hash().Hex())
+	}
+
+	logger, err := sdklogging.NewZapLogger(sdklogging.Production)
+	if err != nil {
+		return err
+	}
+	registryCoordinator, err := regcoord.NewContractRegistryCoordinator(*tx.To(), ethClient)
+	if err != nil {
+		return err
+	}
+	txMgr := chainio.NewTxManager(ethClient, nil, chainId, rawConfig.GetTxParams(), logger)
+	receipt, err := txMgr.WaitMined(ctx, tx.Hash())
+	if receipt != nil {
+		printTxReceipt(registryCoordinator, receipt)
+	}
+	return err
+}
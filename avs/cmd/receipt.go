@@ -0,0 +1,39 @@
+// 输出注册相关交易的结果
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	regcoord "github.com/Layr-Labs/eigensdk-go/contracts/bindings/RegistryCoordinator"
+	gethtypes "github.com/ethereum/go-ethereum/core/types"
+	"os"
+	"text/tabwriter"
+)
+
+// printTxReceipt 输出交易哈希、区块、gas 用量，以及 RegistryCoordinator 中 operator 相关的事件
+func printTxReceipt(registryCoordinator *regcoord.ContractRegistryCoordinator, receipt *gethtypes.Receipt) {
+	status := "SUCCESS"
+	if receipt.Status != gethtypes.ReceiptStatusSuccessful {
+		status = "REVERTED"
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintf(w, "Tx hash:\t%s\n", receipt.TxHash.Hex())
+	_, _ = fmt.Fprintf(w, "Status:\t%s\n", status)
+	_, _ = fmt.Fprintf(w, "Block:\t%s (%s)\n", receipt.BlockNumber, receipt.BlockHash.Hex())
+	_, _ = fmt.Fprintf(w, "Gas used:\t%d\n", receipt.GasUsed)
+	if receipt.EffectiveGasPrice != nil {
+		_, _ = fmt.Fprintf(w, "Effective gas price:\t%s wei\n", receipt.EffectiveGasPrice)
+	}
+
+	for _, log := range receipt.Logs {
+		if event, err := registryCoordinator.ParseOperatorRegistered(*log); err == nil {
+			_, _ = fmt.Fprintf(w, "Event:\tOperatorRegistered(operator %s, operator id 0x%s)\n", event.Operator.Hex(), hex.EncodeToString(event.OperatorId[:]))
+		} else if event, err := registryCoordinator.ParseOperatorDeregistered(*log); err == nil {
+			_, _ = fmt.Fprintf(w, "Event:\tOperatorDeregistered(operator %s, operator id 0x%s)\n", event.Operator.Hex(), hex.EncodeToString(event.OperatorId[:]))
+		} else if event, err := registryCoordinator.ParseOperatorSocketUpdate(*log); err == nil {
+			_, _ = fmt.Fprintf(w, "Event:\tOperatorSocketUpdate(operator id 0x%s, socket %s)\n", hex.EncodeToString(event.OperatorId[:]), event.Socket)
+		}
+	}
+	_ = w.Flush()
+}
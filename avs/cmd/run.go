@@ -3,26 +3,16 @@ package main
 
 import (
 	"context"
-	"crypto/ecdsa"
 	"crypto/rand"
-	"encoding/json"
-	"github.com/Layr-Labs/eigensdk-go/chainio/clients/avsregistry"
-	"github.com/Layr-Labs/eigensdk-go/chainio/clients/wallet"
-	"github.com/Layr-Labs/eigensdk-go/chainio/txmgr"
-	regcoord "github.com/Layr-Labs/eigensdk-go/contracts/bindings/RegistryCoordinator"
-	sdkecdsa "github.com/Layr-Labs/eigensdk-go/crypto/ecdsa"
-	"github.com/Layr-Labs/eigensdk-go/signerv2"
-	eigenSdkTypes "github.com/Layr-Labs/eigensdk-go/types"
-	"github.com/ethereum/go-ethereum/accounts/abi/bind"
-	"github.com/ethereum/go-ethereum/common"
+	"fmt"
 	"github.com/urfave/cli/v2"
+	"goplus/avs/chainio"
 	"goplus/avs/config"
 	"goplus/avs/metrics"
 	"goplus/avs/secwaremanager"
 	"goplus/avs/server"
 	"goplus/avs/state"
 	"goplus/shared/pkg/signature"
-	"goplus/shared/pkg/types"
 	"log"
 	"math/big"
 	"os"
@@ -32,72 +22,88 @@ import (
 	"time"
 )
 
-func getOperatorECDSAKey() (*ecdsa.PrivateKey, error) {
+func getOperatorECDSASigner(cfg config.Config) (signature.ECDSASigner, error) {
 	ecdsaKeyStorePath, _ := config.GetOperatorECDSAKeyStorePath()
-	if ecdsaKeyStorePath == "" {
-		log.Fatal("Operator ECDSA Key Store Path not provided")
-	}
-	ecdsaKeyPassword, _ := config.GetOperatorECDSAKeyPassword()
+	return config.NewECDSASigner(cfg, ecdsaKeyStorePath)
+}
 
-	skOperator, err := sdkecdsa.ReadKey(ecdsaKeyStorePath, ecdsaKeyPassword)
+// newTxManager 创建使用 operator ECDSA signer 签名交易的 txmgr，手续费上限、确认数和重发间隔来自配置
+func newTxManager(cliCtx *cli.Context, cfg config.Config, ecdsaSigner signature.ECDSASigner) (*chainio.TxManager, error) {
+	chainId, err := cfg.EthHttpClient.ChainID(cliCtx.Context)
 	if err != nil {
-		log.Fatalf("Failed to read operator ECDSA key: %v", err)
+		cfg.Logger.Error("Failed to get ChainID.")
 		return nil, err
 	}
-	return skOperator, nil
+
+	return chainio.NewTxManager(cfg.EthHttpClient, ecdsaSigner, chainId, cfg.TxParams, cfg.Logger), nil
 }
 
-func registerWithAVS(cliCtx *cli.Context) error {
-	cfg, err := config.NewConfig(cliCtx)
-	if err != nil {
-		log.Fatal(err)
+// getQuorums 获取命令要操作的 quorum，命令行参数优先于配置
+func getQuorums(cliCtx *cli.Context, cfg config.Config) ([]uint8, error) {
+	quorumNums := cfg.QuorumNums
+	if cliCtx.IsSet(QuorumsFlag.Name) {
+		quorumNums = cliCtx.IntSlice(QuorumsFlag.Name)
 	}
 
-	skOperator, err := getOperatorECDSAKey()
-	if err != nil {
-		cfg.Logger.Fatalf("Failed to read operator ECDSA key: %v", err)
-		return err
+	quorums := make([]uint8, 0, len(quorumNums))
+	for _, q := range quorumNums {
+		if q < 0 || q > 255 {
+			return nil, fmt.Errorf("quorum number %d is out of range", q)
+		}
+		quorums = append(quorums, uint8(q))
 	}
+	return quorums, nil
+}
 
-	opAddr, err := signature.GetAddressFromPrivateKey(skOperator)
+// getOperatorQuorums 检查 quorum 在链上存在，并读取 operator 当前的注册信息
+func getOperatorQuorums(cliCtx *cli.Context, cfg config.Config) ([]uint8, *chainio.OperatorInfo, error) {
+	quorums, err := getQuorums(cliCtx, cfg)
 	if err != nil {
-		cfg.Logger.Fatal("Failed to calculate operator address.")
-		return err
+		return nil, nil, err
 	}
 
-	chainId, err := cfg.EthHttpClient.ChainID(cliCtx.Context)
+	avsReader, err := chainio.NewAvsReader(cfg.RegCoordinatorAddr, cfg.EthHttpClient)
 	if err != nil {
-		cfg.Logger.Fatal("Failed to get ChainID.")
-		return err
+		return nil, nil, err
 	}
-
-	signerV2 := func(ctx context.Context, address common.Address) (bind.SignerFn, error) {
-		return signerv2.PrivateKeySignerFn(skOperator, chainId)
+	quorumCount, err := avsReader.QuorumCount(cliCtx.Context)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := chainio.ValidateQuorums(quorums, quorumCount); err != nil {
+		return nil, nil, err
 	}
 
-	skWallet, err := wallet.NewPrivateKeyWallet(cfg.EthHttpClient, signerV2, opAddr, cfg.Logger)
+	info, err := avsReader.OperatorInfo(cliCtx.Context, cfg.AddressOperator)
 	if err != nil {
-		panic(err)
+		return nil, nil, err
 	}
+	return quorums, info, nil
+}
 
-	txMgr := txmgr.NewSimpleTxManager(skWallet, cfg.EthHttpClient, cfg.Logger, opAddr)
-
-	var quorumNumbers eigenSdkTypes.QuorumNums
-	for _, q := range cfg.QuorumNums {
-		quorumNumbers = append(quorumNumbers, eigenSdkTypes.QuorumNum(q))
+func registerWithAVS(cliCtx *cli.Context) error {
+	cfg, err := config.NewConfig(cliCtx)
+	if err != nil {
+		log.Fatal(err)
 	}
 
-	if len(quorumNumbers) != 1 || quorumNumbers[0] != 0 {
-		panic("Only quorum[0] is available now.")
+	quorums, info, err := getOperatorQuorums(cliCtx, cfg)
+	if err != nil {
+		cfg.Logger.Errorf("Unable to check quorums: %v", err)
+		return err
 	}
-
-	socket := types.OperatorSocket{
-		NodeClass: cfg.NodeClass,
-		URL:       cfg.OperatorURL,
+	// 已经加入的 quorum 不能重复注册，只注册还没有加入的 quorum
+	quorumsToJoin := chainio.QuorumsToJoin(quorums, info.Quorums)
+	if len(quorumsToJoin) == 0 {
+		cfg.Logger.Infof("Operator is already registered in quorums %v.", quorums)
+		return nil
 	}
-	socketBytes, err := json.Marshal(socket)
+	quorumNumbers := chainio.ToQuorumNums(quorumsToJoin)
+	cfg.Logger.Infof("Registering operator in quorums %v, currently in quorums %v.", quorumNumbers, info.Quorums)
+
+	socket, err := operatorSocketFromConfig(cfg)
 	if err != nil {
-		cfg.Logger.Fatalf("Failed to json dump socket: %#v", socket)
+		cfg.Logger.Fatalf("Failed to json dump socket: %v", err)
 		return err
 	}
 
@@ -117,27 +123,43 @@ func registerWithAVS(cliCtx *cli.Context) error {
 		cfg.Logger.Errorf("Unable to get current block")
 		return err
 	}
-	sigValidForSeconds := int64(1_000_000)
+	sigValidForSeconds := int64(cfg.RegistrationSigExpiry / time.Second)
 	operatorToAvsRegistrationSigExpiry := big.NewInt(int64(curBlock.Time) + sigValidForSeconds)
 
-	avsRegistryWriter, err := avsregistry.NewWriterFromConfig(avsregistry.Config{
-		RegistryCoordinatorAddress:    cfg.RegCoordinatorAddr,
-		OperatorStateRetrieverAddress: cfg.OperatorStateRetrieverAddr,
-	}, cfg.EthHttpClient, txMgr, cfg.Logger)
+	if cliCtx.IsSet(OfflineTxFlag.Name) {
+		return writeOfflineRegisterTx(cliCtx, cfg, operatorToAvsRegistrationSigSalt, operatorToAvsRegistrationSigExpiry, quorumNumbers, socket)
+	}
+
+	ecdsaSigner, err := getOperatorECDSASigner(cfg)
+	if err != nil {
+		cfg.Logger.Fatalf("Failed to read operator ECDSA key: %v", err)
+		return err
+	}
+
+	txMgr, err := newTxManager(cliCtx, cfg, ecdsaSigner)
+	if err != nil {
+		cfg.Logger.Fatalf("Failed to create tx manager: %v", err)
+		return err
+	}
+
+	avsWriter, err := chainio.NewAvsWriter(cfg.RegCoordinatorAddr, cfg.EthHttpClient, txMgr, cfg.Logger)
 	if err != nil {
-		cfg.Logger.Fatal("Failed to crete avsRegistryWriter")
+		cfg.Logger.Fatal("Failed to crete avsWriter")
 		return err
 	}
 
-	_, err = avsRegistryWriter.RegisterOperatorInQuorumWithAVSRegistryCoordinator(
-		context.Background(),
-		skOperator,
+	receipt, err := avsWriter.RegisterOperator(
+		cliCtx.Context,
+		ecdsaSigner,
+		cfg.BLSSigner,
 		operatorToAvsRegistrationSigSalt,
 		operatorToAvsRegistrationSigExpiry,
-		cfg.BLSKeypair,
 		quorumNumbers,
-		string(socketBytes),
+		socket,
 	)
+	if receipt != nil {
+		printTxReceipt(avsWriter.RegistryCoordinator, receipt)
+	}
 	if err != nil {
 		cfg.Logger.Errorf("Unable to register operator with avs registry coordinator")
 		return err
@@ -153,60 +175,46 @@ func deregisterWithAVS(cliCtx *cli.Context) error {
 		log.Fatal(err)
 	}
 
-	skOperator, err := getOperatorECDSAKey()
+	quorums, info, err := getOperatorQuorums(cliCtx, cfg)
 	if err != nil {
-		cfg.Logger.Fatalf("Failed to read operator ECDSA key: %v", err)
+		cfg.Logger.Errorf("Unable to check quorums: %v", err)
 		return err
 	}
-
-	opAddr, err := signature.GetAddressFromPrivateKey(skOperator)
-	if err != nil {
-		cfg.Logger.Fatal("Failed to calculate operator address.")
-		return err
-	}
-	chainId, err := cfg.EthHttpClient.ChainID(cliCtx.Context)
-	if err != nil {
-		cfg.Logger.Fatal("Failed to get ChainID.")
-		return err
+	// 只注销 operator 已经加入的 quorum，其他 quorum 保持注册
+	quorumsToLeave := chainio.QuorumsToLeave(quorums, info.Quorums)
+	if len(quorumsToLeave) == 0 {
+		cfg.Logger.Infof("Operator is not registered in quorums %v.", quorums)
+		return nil
 	}
+	quorumNumbers := chainio.ToQuorumNums(quorumsToLeave)
+	cfg.Logger.Infof("Deregistering operator from quorums %v, currently in quorums %v.", quorumNumbers, info.Quorums)
 
-	signerV2 := func(ctx context.Context, address common.Address) (bind.SignerFn, error) {
-		return signerv2.PrivateKeySignerFn(skOperator, chainId)
+	if cliCtx.IsSet(OfflineTxFlag.Name) {
+		return writeOfflineDeregisterTx(cliCtx, cfg, quorumNumbers)
 	}
 
-	skWallet, err := wallet.NewPrivateKeyWallet(cfg.EthHttpClient, signerV2, opAddr, cfg.Logger)
+	ecdsaSigner, err := getOperatorECDSASigner(cfg)
 	if err != nil {
-		panic(err)
+		cfg.Logger.Fatalf("Failed to read operator ECDSA key: %v", err)
+		return err
 	}
 
-	txMgr := txmgr.NewSimpleTxManager(skWallet, cfg.EthHttpClient, cfg.Logger, opAddr)
-
-	avsRegistryWriter, err := avsregistry.NewWriterFromConfig(avsregistry.Config{
-		RegistryCoordinatorAddress:    cfg.RegCoordinatorAddr,
-		OperatorStateRetrieverAddress: cfg.OperatorStateRetrieverAddr,
-	}, cfg.EthHttpClient, txMgr, cfg.Logger)
+	txMgr, err := newTxManager(cliCtx, cfg, ecdsaSigner)
 	if err != nil {
-		cfg.Logger.Fatal("Failed to crete avsRegistryWriter")
+		cfg.Logger.Fatalf("Failed to create tx manager: %v", err)
 		return err
 	}
 
-	var quorumNumbers eigenSdkTypes.QuorumNums
-	for _, q := range cfg.QuorumNums {
-		quorumNumbers = append(quorumNumbers, eigenSdkTypes.QuorumNum(q))
+	avsWriter, err := chainio.NewAvsWriter(cfg.RegCoordinatorAddr, cfg.EthHttpClient, txMgr, cfg.Logger)
+	if err != nil {
+		cfg.Logger.Fatal("Failed to crete avsWriter")
+		return err
 	}
 
-	g1Point := cfg.BLSKeypair.GetPubKeyG1()
-	bn254G1Point := regcoord.BN254G1Point{
-		X: g1Point.X.BigInt(big.NewInt(0)),
-		Y: g1Point.Y.BigInt(big.NewInt(0)),
+	receipt, err := avsWriter.DeregisterOperator(cliCtx.Context, quorumNumbers)
+	if receipt != nil {
+		printTxReceipt(avsWriter.RegistryCoordinator, receipt)
 	}
-
-	_, err = avsRegistryWriter.DeregisterOperator(
-		context.Background(),
-		quorumNumbers,
-		bn254G1Point,
-	)
-
 	if err != nil {
 		cfg.Logger.Errorf("Unable to deregister operator with avs registry coordinator")
 		return err
@@ -231,8 +239,9 @@ func start(cliCtx *cli.Context) error {
 	if err != nil {
 		log.Fatal(err)
 	}
+	defer st.Close()
 
-	manager, err := secwaremanager.NewSecwareManager(cfg, mt)
+	manager, err := secwaremanager.NewSecwareManager(cfg, mt, st)
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -252,18 +261,56 @@ func start(cliCtx *cli.Context) error {
 		log.Fatal(err)
 	}
 
+	avsReader, err := chainio.NewAvsReader(cfg.RegCoordinatorAddr, cfg.EthHttpClient)
+	if err != nil {
+		log.Fatal(err)
+	}
+	warnSocketDiverged(cliCtx.Context, cfg, avsReader)
+
+	gatewayWatcher := chainio.NewGatewayWatcher(cfg.Logger, avsReader, cfg.AddressGateway, cfg.GatewayUrl, cfg.GatewayConfirmations)
+	gatewayWatcher.Subscribe(manager.SetGateway)
+	gatewayWatcher.Subscribe(svr.SetGateway)
+
+	reloader := config.NewReloader(cfg)
+	reloader.Subscribe(manager.ApplyConfig)
+	reloader.Subscribe(svr.ApplyConfig)
+	reloader.Subscribe(func(cfg config.Config) {
+		reader, err := chainio.NewAvsReader(cfg.RegCoordinatorAddr, cfg.EthHttpClient)
+		if err != nil {
+			cfg.Logger.Errorf("Failed to switch eth rpc for gateway watcher: %v", err)
+			return
+		}
+		gatewayWatcher.SetReader(reader)
+	})
+
 	ctx, cancel := context.WithCancel(cliCtx.Context)
 	var wg sync.WaitGroup
+	wg.Add(1)
 	go func() {
-		wg.Add(1)
 		defer wg.Done()
 		if err := manager.Start(ctx); err != nil {
 			cancel()
 		}
 	}()
 
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		if err := gatewayWatcher.Start(ctx); err != nil {
+			cancel()
+		}
+	}()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		if err := reloader.Start(ctx); err != nil {
+			cfg.Logger.Errorf("Config reloader exit: %v", err)
+		}
+	}()
+
+	wg.Add(1)
 	go func() {
-		wg.Add(1)
 		defer wg.Done()
 		if err := svr.Start(ctx); err != nil {
 			cancel()
@@ -0,0 +1,115 @@
+// 维护 operator 在链上注册的 socket
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/urfave/cli/v2"
+	"goplus/avs/chainio"
+	"goplus/avs/config"
+	"goplus/shared/pkg/types"
+	"log"
+	"time"
+)
+
+// operatorSocketFromConfig 使用配置中的 node class 和 operator URL 生成注册时写入链上的 socket
+func operatorSocketFromConfig(cfg config.Config) (string, error) {
+	socket := types.OperatorSocket{
+		NodeClass: cfg.NodeClass,
+		URL:       cfg.OperatorURL,
+	}
+	socketBytes, err := json.Marshal(socket)
+	if err != nil {
+		return "", err
+	}
+	return string(socketBytes), nil
+}
+
+// socketDiverged 比较配置生成的 socket 和链上的 socket，链上的 socket 无法解析时视为不一致
+func socketDiverged(cfg config.Config, onChainSocket string) bool {
+	socket := types.OperatorSocket{}
+	if err := json.Unmarshal([]byte(onChainSocket), &socket); err != nil {
+		return true
+	}
+	return socket.NodeClass != cfg.NodeClass || socket.URL != cfg.OperatorURL
+}
+
+// warnSocketDiverged 在启动时检查链上的 socket 是否和配置一致，不一致时只输出警告
+func warnSocketDiverged(ctx context.Context, cfg config.Config, avsReader *chainio.AvsReader) {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	info, err := avsReader.OperatorInfo(ctx, cfg.AddressOperator)
+	if err != nil {
+		cfg.Logger.Warnf("Failed to read operator socket on chain: %v", err)
+		return
+	}
+	if info.Status != chainio.OperatorRegistered {
+		cfg.Logger.Warnf("Operator %s is %s on chain", cfg.AddressOperator.Hex(), chainio.OperatorStatusName(info.Status))
+		return
+	}
+	if socketDiverged(cfg, info.Socket) {
+		cfg.Logger.Warnf("Operator socket on chain %q differs from config (node class %s, url %s), run update-socket to update it",
+			info.Socket, cfg.NodeClass, cfg.OperatorURL)
+	}
+}
+
+func updateSocket(cliCtx *cli.Context) error {
+	cfg, err := config.NewConfig(cliCtx)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	socket, err := operatorSocketFromConfig(cfg)
+	if err != nil {
+		return err
+	}
+
+	avsReader, err := chainio.NewAvsReader(cfg.RegCoordinatorAddr, cfg.EthHttpClient)
+	if err != nil {
+		return err
+	}
+	info, err := avsReader.OperatorInfo(cliCtx.Context, cfg.AddressOperator)
+	if err != nil {
+		return err
+	}
+	if info.Status != chainio.OperatorRegistered {
+		return fmt.Errorf("operator %s is %s, register it first", cfg.AddressOperator.Hex(), chainio.OperatorStatusName(info.Status))
+	}
+	if !socketDiverged(cfg, info.Socket) {
+		cfg.Logger.Infof("Operator socket on chain is up to date: %s", info.Socket)
+		return nil
+	}
+	cfg.Logger.Infof("Updating operator socket from %q to %q", info.Socket, socket)
+
+	ecdsaSigner, err := getOperatorECDSASigner(cfg)
+	if err != nil {
+		cfg.Logger.Fatalf("Failed to read operator ECDSA key: %v", err)
+		return err
+	}
+
+	txMgr, err := newTxManager(cliCtx, cfg, ecdsaSigner)
+	if err != nil {
+		cfg.Logger.Fatalf("Failed to create tx manager: %v", err)
+		return err
+	}
+
+	avsWriter, err := chainio.NewAvsWriter(cfg.RegCoordinatorAddr, cfg.EthHttpClient, txMgr, cfg.Logger)
+	if err != nil {
+		cfg.Logger.Fatal("Failed to crete avsWriter")
+		return err
+	}
+
+	receipt, err := avsWriter.UpdateSocket(cliCtx.Context, socket)
+	if receipt != nil {
+		printTxReceipt(avsWriter.RegistryCoordinator, receipt)
+	}
+	if err != nil {
+		cfg.Logger.Errorf("Unable to update operator socket with avs registry coordinator")
+		return err
+	}
+	cfg.Logger.Infof("Updated operator socket with avs registry coordinator.")
+
+	return nil
+}
@@ -0,0 +1,151 @@
+// status 命令从链上读取 operator 的注册信息
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/Layr-Labs/eigensdk-go/chainio/clients/eth"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/urfave/cli/v2"
+	"goplus/avs/chainio"
+	"goplus/avs/config"
+	"goplus/shared/pkg/types"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+const statusTimeout = 30 * time.Second
+
+var JSONOutputFlag = cli.BoolFlag{
+	Name:  "json",
+	Usage: "Print the output as JSON",
+}
+
+type operatorGatewayView struct {
+	Address string `json:"address"`
+	URL     string `json:"url"`
+}
+
+type operatorChainStatus struct {
+	Operator           string                `json:"operator"`
+	OperatorId         string                `json:"operator_id"`
+	Status             string                `json:"status"`
+	Quorums            []int                 `json:"quorums"`      // 使用 []int，避免 []uint8 被编码为 base64
+	QuorumCount        uint8                 `json:"quorum_count"` // RegistryCoordinator 中已创建的 quorum 数量
+	Socket             *types.OperatorSocket `json:"socket"`
+	RawSocket          string                `json:"raw_socket"`
+	SocketError        string                `json:"socket_error,omitempty"` // socket 不是合法的 OperatorSocket JSON 时的解析错误
+	RestakedStrategies []string              `json:"restaked_strategies"`
+	Gateway            operatorGatewayView   `json:"gateway"`
+}
+
+// getOperatorChainStatus 读取 operator 的链上注册信息和当前的 Gateway
+func getOperatorChainStatus(ctx context.Context, avsReader *chainio.AvsReader, operator common.Address) (*operatorChainStatus, error) {
+	info, err := avsReader.OperatorInfo(ctx, operator)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read operator info: %w", err)
+	}
+	quorumCount, err := avsReader.QuorumCount(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read quorum count: %w", err)
+	}
+	gatewayAddr, gatewayUrl, err := avsReader.GatewayConfig(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read gateway config: %w", err)
+	}
+
+	status := &operatorChainStatus{
+		Operator:           info.Operator.Hex(),
+		OperatorId:         "0x" + hex.EncodeToString(info.OperatorId[:]),
+		Status:             chainio.OperatorStatusName(info.Status),
+		Quorums:            make([]int, 0, len(info.Quorums)),
+		QuorumCount:        quorumCount,
+		RawSocket:          info.Socket,
+		RestakedStrategies: make([]string, 0, len(info.RestakedStrategies)),
+		Gateway: operatorGatewayView{
+			Address: gatewayAddr.Hex(),
+			URL:     gatewayUrl,
+		},
+	}
+	for _, q := range info.Quorums {
+		status.Quorums = append(status.Quorums, int(q))
+	}
+	for _, strategy := range info.RestakedStrategies {
+		status.RestakedStrategies = append(status.RestakedStrategies, strategy.Hex())
+	}
+	if info.Socket != "" {
+		socket := &types.OperatorSocket{}
+		if err := json.Unmarshal([]byte(info.Socket), socket); err != nil {
+			status.SocketError = err.Error()
+		} else {
+			status.Socket = socket
+		}
+	}
+	return status, nil
+}
+
+func (s *operatorChainStatus) print() {
+	quorums := make([]string, 0, len(s.Quorums))
+	for _, q := range s.Quorums {
+		quorums = append(quorums, fmt.Sprintf("%d", q))
+	}
+
+	socket := "-"
+	if s.Socket != nil {
+		socket = fmt.Sprintf("node class %s, url %s", s.Socket.NodeClass, s.Socket.URL)
+	} else if s.RawSocket != "" {
+		socket = fmt.Sprintf("%q (%s)", s.RawSocket, s.SocketError)
+	}
+
+	strategies := "-"
+	if len(s.RestakedStrategies) > 0 {
+		strategies = strings.Join(s.RestakedStrategies, ", ")
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintf(w, "Operator:\t%s\n", s.Operator)
+	_, _ = fmt.Fprintf(w, "Operator ID:\t%s\n", s.OperatorId)
+	_, _ = fmt.Fprintf(w, "Status:\t%s\n", s.Status)
+	_, _ = fmt.Fprintf(w, "Quorums:\t[%s] (%d quorums available)\n", strings.Join(quorums, ", "), s.QuorumCount)
+	_, _ = fmt.Fprintf(w, "Socket:\t%s\n", socket)
+	_, _ = fmt.Fprintf(w, "Restaked strategies:\t%s\n", strategies)
+	_, _ = fmt.Fprintf(w, "Gateway:\t%s %s\n", s.Gateway.Address, s.Gateway.URL)
+	_ = w.Flush()
+}
+
+// operatorStatus 只需要 ETH_RPC、合约地址和 operator 地址，不读取密钥
+func operatorStatus(cliCtx *cli.Context) error {
+	rawConfig, err := config.LoadRawConfig(cliCtx.String(config.ConfigFileFlag))
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(cliCtx.Context, statusTimeout)
+	defer cancel()
+
+	ethClient, err := eth.NewClient(rawConfig.ETHRpc)
+	if err != nil {
+		return fmt.Errorf("failed to connect eth rpc: %w", err)
+	}
+	avsReader, err := chainio.NewAvsReader(common.HexToAddress(rawConfig.RegCoordinatorAddr), ethClient)
+	if err != nil {
+		return fmt.Errorf("failed to create avs reader: %w", err)
+	}
+
+	status, err := getOperatorChainStatus(ctx, avsReader, common.HexToAddress(rawConfig.AddressOperator))
+	if err != nil {
+		return err
+	}
+
+	if cliCtx.Bool(JSONOutputFlag.Name) {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(status)
+	}
+	status.print()
+	return nil
+}
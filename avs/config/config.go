@@ -1,17 +1,28 @@
 package config
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"github.com/Layr-Labs/eigensdk-go/chainio/clients/eth"
-	"github.com/Layr-Labs/eigensdk-go/crypto/bls"
 	sdklogging "github.com/Layr-Labs/eigensdk-go/logging"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/spf13/viper"
 	"github.com/urfave/cli/v2"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
 	"goplus/avs/chainio"
+	"goplus/avs/signer"
+	"goplus/shared/pkg/signature"
+	"goplus/shared/pkg/types"
+	"math/big"
+	"net"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 )
 
 var (
@@ -19,29 +30,118 @@ var (
 	EcdsaKeyStorePathFlag = "ecdsa-key-store-path"
 )
 
+const (
+	DefaultTaskClockSkew     = 5 // 秒
+	DefaultSeenTaskCacheSize = 100000
+	DefaultSyncInterval      = 300 // 秒
+	DefaultHeartbeatInterval = 60  // 秒
+
+	DefaultGatewayConfirmations = 12
+
+	DefaultTxConfirmations       = 1
+	DefaultTxResendInterval      = 60    // 秒
+	DefaultTxTimeout             = 1800  // 秒
+	DefaultRegistrationSigExpiry = 86400 // 秒
+
+	DefaultSecwareMaxConcurrency = 8
+	DefaultSecwareQueueDepth     = 32
+	DefaultSecwareDrainTimeout   = 600 // 秒
+)
+
+// AVS 访问 secware 的方式
+const (
+	SecwareTransportTCP  = "tcp"  // 通过 docker 映射到本机的端口访问
+	SecwareTransportUnix = "unix" // 通过挂载到 secware 容器中的 unix socket 访问
+)
+
+// 启动时对 docker 中存在但没有记录的 secware project 的处理方式
+const (
+	SecwareOrphanAdopt  = "adopt"  // 根据 project 的名字接管
+	SecwareOrphanRemove = "remove" // 关闭并删除
+)
+
+// 启停 secware 的方式
+const (
+	SecwareRunnerCompose = "compose" // 调用 docker compose 命令
+	SecwareRunnerEngine  = "engine"  // 解析 compose 文件，通过 unix socket 调用 Docker Engine API
+	SecwareRunnerPodman  = "podman"  // 与 engine 相同，调用 rootless podman 兼容 Docker 的 API
+)
+
+const DefaultSecwareEngineSocket = "/var/run/docker.sock"
+
+// Network 是 GoPlus AVS 部署所在的链
+type Network struct {
+	Name    string
+	ChainId uint64
+}
+
+// KnownNetworks 是已知的 GoPlus AVS 部署，key 为 RegistryCoordinator 的地址
+var KnownNetworks = map[common.Address]Network{
+	common.HexToAddress("0x91228C6361997a5a4da1a01EdDB2F6B604536A32"): {Name: "mainnet", ChainId: 1},
+	common.HexToAddress("0x61AA80e5891DbfCebD0B78a704F3de996E449FdE"): {Name: "holesky", ChainId: 17000},
+}
+
 type RawConfig struct {
-	ComposeFilePath            string `mapstructure:"COMPOSE_FILE_PATH"`
-	AddressOperator            string `mapstructure:"OPERATOR_ADDRESS"`
-	BLSKeyStorePath            string `mapstructure:"BLS_KEY_STORE_PATH"`
-	APIPort                    int    `mapstructure:"API_PORT"`
-	OperatorURL                string `mapstructure:"OPERATOR_URL"`
-	NodeClass                  string `mapstructure:"NODE_CLASS"`
-	ETHRpc                     string `mapstructure:"ETH_RPC"`
-	RegCoordinatorAddr         string `mapstructure:"REGISTRY_COORDINATOR_ADDR"`
-	OperatorStateRetrieverAddr string `mapstructure:"OPERATOR_STATE_RETRIEVER"`
-	QuorumNums                 []int  `mapstructure:"QUORUM_NUMS"`
+	ComposeFilePath            string  `mapstructure:"COMPOSE_FILE_PATH"`
+	AddressOperator            string  `mapstructure:"OPERATOR_ADDRESS"`
+	BLSKeyStorePath            string  `mapstructure:"BLS_KEY_STORE_PATH"`
+	APIPort                    int     `mapstructure:"API_PORT"`
+	OperatorURL                string  `mapstructure:"OPERATOR_URL"`
+	NodeClass                  string  `mapstructure:"NODE_CLASS"`
+	ETHRpc                     string  `mapstructure:"ETH_RPC"`
+	RegCoordinatorAddr         string  `mapstructure:"REGISTRY_COORDINATOR_ADDR"`
+	OperatorStateRetrieverAddr string  `mapstructure:"OPERATOR_STATE_RETRIEVER"`
+	QuorumNums                 []int   `mapstructure:"QUORUM_NUMS"`
+	DataPath                   string  `mapstructure:"DATA_PATH"`
+	TaskClockSkew              int     `mapstructure:"TASK_CLOCK_SKEW"`
+	SeenTaskCacheSize          int     `mapstructure:"SEEN_TASK_CACHE_SIZE"`
+	SecwareKeyFilePath         string  `mapstructure:"SECWARE_KEY_FILE_PATH"`
+	SecwareCPUs                float64 `mapstructure:"SECWARE_CPUS"`
+	SecwareMemory              string  `mapstructure:"SECWARE_MEMORY"`
+	AdminListen                string  `mapstructure:"ADMIN_LISTEN"`
+	AdminToken                 string  `mapstructure:"ADMIN_TOKEN"`
+	LogLevel                   string  `mapstructure:"LOG_LEVEL"`
+	SyncInterval               int     `mapstructure:"SYNC_INTERVAL"`
+	HeartbeatInterval          int     `mapstructure:"HEARTBEAT_INTERVAL"`
+	RemoteSignerUrl            string  `mapstructure:"REMOTE_SIGNER_URL"`
+	BLSRemoteSignerKey         string  `mapstructure:"BLS_REMOTE_SIGNER_KEY"`
+	ECDSARemoteSigner          bool    `mapstructure:"ECDSA_REMOTE_SIGNER"`
+	RemoteSignerToken          string  `mapstructure:"REMOTE_SIGNER_TOKEN"`
+	RemoteSignerCACert         string  `mapstructure:"REMOTE_SIGNER_CA_CERT"`
+	TxMaxFeePerGasGwei         float64 `mapstructure:"TX_MAX_FEE_PER_GAS_GWEI"`
+	TxConfirmations            int     `mapstructure:"TX_CONFIRMATIONS"`
+	TxResendInterval           *int    `mapstructure:"TX_RESEND_INTERVAL"` // nil 表示未设定，0 表示不重发
+	TxTimeout                  int     `mapstructure:"TX_TIMEOUT"`
+	RegistrationSigExpiry      int     `mapstructure:"REGISTRATION_SIG_EXPIRY"`
+	GatewayConfirmations       int     `mapstructure:"GATEWAY_CONFIRMATIONS"`
+	SecwareMaxConcurrency      int     `mapstructure:"SECWARE_MAX_CONCURRENCY"`
+	SecwareQueueDepth          int     `mapstructure:"SECWARE_QUEUE_DEPTH"`
+	SecwareDrainTimeout        int     `mapstructure:"SECWARE_DRAIN_TIMEOUT"`
+	SecwareTransport           string  `mapstructure:"SECWARE_TRANSPORT"`
+	SecwareOrphanPolicy        string  `mapstructure:"SECWARE_ORPHAN_POLICY"`
+	SecwareRunner              string  `mapstructure:"SECWARE_RUNNER"`
+	SecwareEngineSocket        string  `mapstructure:"SECWARE_ENGINE_SOCKET"`
 }
 
 func (r *RawConfig) isValid() error {
 	if r.ComposeFilePath == "" {
 		return fmt.Errorf("compose file path is required")
 	}
+	if !filepath.IsAbs(r.ComposeFilePath) {
+		return fmt.Errorf("compose file path must be absolute")
+	}
+	if r.DataPath != "" && !filepath.IsAbs(r.DataPath) {
+		return fmt.Errorf("data path must be absolute")
+	}
 	if r.AddressOperator == "" {
 		return fmt.Errorf("operator address is required")
 	}
-	if r.BLSKeyStorePath == "" {
+	if r.BLSKeyStorePath == "" && r.BLSRemoteSignerKey == "" {
 		return fmt.Errorf("operator bls key store path is required")
 	}
+	if (r.BLSRemoteSignerKey != "" || r.ECDSARemoteSigner) && r.RemoteSignerUrl == "" {
+		return fmt.Errorf("remote signer url is required when using remote signer")
+	}
 	if r.APIPort == 0 {
 		return fmt.Errorf("api port is required")
 	}
@@ -69,6 +169,80 @@ func (r *RawConfig) isValid() error {
 	if len(r.QuorumNums) == 0 {
 		return fmt.Errorf("quorum nums is required")
 	}
+	seenQuorums := make(map[int]bool)
+	for _, q := range r.QuorumNums {
+		if q < 0 || q > 255 {
+			return fmt.Errorf("quorum number %d is out of range", q)
+		}
+		if seenQuorums[q] {
+			return fmt.Errorf("quorum number %d is duplicated", q)
+		}
+		seenQuorums[q] = true
+	}
+	if r.TaskClockSkew < 0 {
+		return fmt.Errorf("task clock skew must not be negative")
+	}
+	if r.SeenTaskCacheSize < 0 {
+		return fmt.Errorf("seen task cache size must not be negative")
+	}
+	if r.SecwareCPUs < 0 {
+		return fmt.Errorf("secware cpus must not be negative")
+	}
+	if r.SecwareMaxConcurrency < 0 {
+		return fmt.Errorf("secware max concurrency must not be negative")
+	}
+	if r.SecwareQueueDepth < 0 {
+		return fmt.Errorf("secware queue depth must not be negative")
+	}
+	if r.SecwareDrainTimeout < 0 {
+		return fmt.Errorf("secware drain timeout must not be negative")
+	}
+	if r.SecwareTransport != "" && r.SecwareTransport != SecwareTransportTCP && r.SecwareTransport != SecwareTransportUnix {
+		return fmt.Errorf("secware transport must be one of tcp, unix")
+	}
+	if r.SecwareOrphanPolicy != "" && r.SecwareOrphanPolicy != SecwareOrphanAdopt && r.SecwareOrphanPolicy != SecwareOrphanRemove {
+		return fmt.Errorf("secware orphan policy must be one of adopt, remove")
+	}
+	if r.SecwareRunner != "" && r.SecwareRunner != SecwareRunnerCompose && r.SecwareRunner != SecwareRunnerEngine && r.SecwareRunner != SecwareRunnerPodman {
+		return fmt.Errorf("secware runner must be one of compose, engine, podman")
+	}
+	if r.LogLevel != "" {
+		if _, err := zapcore.ParseLevel(r.LogLevel); err != nil {
+			return fmt.Errorf("invalid log level %q", r.LogLevel)
+		}
+	}
+	if r.SyncInterval < 0 {
+		return fmt.Errorf("sync interval must not be negative")
+	}
+	if r.HeartbeatInterval < 0 {
+		return fmt.Errorf("heartbeat interval must not be negative")
+	}
+	if r.TxMaxFeePerGasGwei < 0 {
+		return fmt.Errorf("tx max fee per gas must not be negative")
+	}
+	if r.TxConfirmations < 0 {
+		return fmt.Errorf("tx confirmations must not be negative")
+	}
+	if r.TxResendInterval != nil && *r.TxResendInterval < 0 {
+		return fmt.Errorf("tx resend interval must not be negative")
+	}
+	if r.TxTimeout < 0 {
+		return fmt.Errorf("tx timeout must not be negative")
+	}
+	if r.RegistrationSigExpiry < 0 {
+		return fmt.Errorf("registration signature expiry must not be negative")
+	}
+	if r.GatewayConfirmations < 0 {
+		return fmt.Errorf("gateway confirmations must not be negative")
+	}
+	if r.AdminListen != "" {
+		if err := checkAdminListen(r.AdminListen); err != nil {
+			return err
+		}
+		if r.AdminToken == "" {
+			return fmt.Errorf("admin token is required when admin api is enabled")
+		}
+	}
 
 	return nil
 }
@@ -76,14 +250,16 @@ func (r *RawConfig) isValid() error {
 type Config struct {
 	Logger                     sdklogging.Logger
 	ComposeFilePath            string
+	DataPath                   string
 	GatewayUrl                 string
 	RegCoordinatorAddr         common.Address
 	OperatorStateRetrieverAddr common.Address
 
 	ETHRpc        string
 	EthHttpClient eth.Client
+	ChainId       *big.Int // 启动时 ETH_RPC 所在的链，热加载的 ETH_RPC 必须在同一条链上
 
-	BLSKeypair      *bls.KeyPair
+	BLSSigner       signature.BLSSigner
 	AddressGateway  common.Address
 	AddressOperator common.Address
 
@@ -92,6 +268,43 @@ type Config struct {
 	APIPort     int
 
 	QuorumNums []int
+
+	TaskClockSkew     time.Duration // 校验 task 有效期时允许的时钟误差
+	SeenTaskCacheSize int           // 用于防重放的已处理 task 缓存的容量
+
+	SecwareKeys map[string]types.HexBytes // 各个 secware 版本用于校验结果 HMAC 的密钥，key 为 <id>-<version>
+
+	SecwareResources ResourceProfile // 单个 secware project 的资源上限
+
+	SecwareMaxConcurrency int           // 单个 secware 同时处理的 task 数量上限
+	SecwareQueueDepth     int           // 单个 secware 等待处理的 task 数量上限，队列已满时立即返回 busy
+	SecwareDrainTimeout   time.Duration // 关停 secware 前等待进行中的 task 结束的最长时间
+
+	SecwareTransport    string // 访问 secware 的方式，tcp 或 unix
+	SecwareOrphanPolicy string // 启动时对没有记录的 secware project 的处理方式，adopt 或 remove
+	SecwareRunner       string // 启停 secware 的方式，compose, engine 或 podman
+	SecwareEngineSocket string // engine 和 podman runner 访问 API 的 unix socket
+
+	AdminListen string // 管理接口的监听地址，为空时不启用
+	AdminToken  string
+
+	RemoteSignerUrl   string // 远程签名服务的地址
+	ECDSARemoteSigner bool   // 注册相关的命令是否使用远程签名服务的 ECDSA 私钥
+
+	RemoteSignerOptions signer.RemoteOptions // 访问远程签名服务的 token 和 CA 证书
+
+	ConfigFilePath    string          // 为空时配置从环境变量读取
+	LogLevel          zap.AtomicLevel // 修改后对所有使用 Logger 的组件立即生效
+	SyncInterval      time.Duration   // 从 Gateway 同步 secware 配置的间隔
+	HeartbeatInterval time.Duration   // 向 Gateway 汇报 secware 健康状态的间隔
+
+	TxParams              chainio.TxParams // 注册相关交易的手续费上限、确认数和重发间隔
+	RegistrationSigExpiry time.Duration    // operator 注册到 AVSDirectory 的签名有效期
+
+	GatewayConfirmations uint64 // Gateway 变更事件需要的确认区块数
+
+	rawConfig       RawConfig // 生成 Config 的原始配置，用于热加载时比较变化
+	secwareKeysHash string    // 密钥文件内容的 sha256，用于热加载时比较密钥的变化
 }
 
 func getRawConfigFromFile(filePath string) (RawConfig, error) {
@@ -155,6 +368,122 @@ func getRawConfigFromEnv() (RawConfig, error) {
 	if err != nil {
 		return RawConfig{}, err
 	}
+	err = viper.BindEnv("DATA_PATH")
+	if err != nil {
+		return RawConfig{}, err
+	}
+	err = viper.BindEnv("TASK_CLOCK_SKEW")
+	if err != nil {
+		return RawConfig{}, err
+	}
+	err = viper.BindEnv("SEEN_TASK_CACHE_SIZE")
+	if err != nil {
+		return RawConfig{}, err
+	}
+	err = viper.BindEnv("SECWARE_KEY_FILE_PATH")
+	if err != nil {
+		return RawConfig{}, err
+	}
+	err = viper.BindEnv("SECWARE_CPUS")
+	if err != nil {
+		return RawConfig{}, err
+	}
+	err = viper.BindEnv("SECWARE_MEMORY")
+	if err != nil {
+		return RawConfig{}, err
+	}
+	err = viper.BindEnv("ADMIN_LISTEN")
+	if err != nil {
+		return RawConfig{}, err
+	}
+	err = viper.BindEnv("ADMIN_TOKEN")
+	if err != nil {
+		return RawConfig{}, err
+	}
+	err = viper.BindEnv("LOG_LEVEL")
+	if err != nil {
+		return RawConfig{}, err
+	}
+	err = viper.BindEnv("SYNC_INTERVAL")
+	if err != nil {
+		return RawConfig{}, err
+	}
+	err = viper.BindEnv("HEARTBEAT_INTERVAL")
+	if err != nil {
+		return RawConfig{}, err
+	}
+	err = viper.BindEnv("REMOTE_SIGNER_URL")
+	if err != nil {
+		return RawConfig{}, err
+	}
+	err = viper.BindEnv("BLS_REMOTE_SIGNER_KEY")
+	if err != nil {
+		return RawConfig{}, err
+	}
+	err = viper.BindEnv("ECDSA_REMOTE_SIGNER")
+	if err != nil {
+		return RawConfig{}, err
+	}
+	err = viper.BindEnv("REMOTE_SIGNER_TOKEN")
+	if err != nil {
+		return RawConfig{}, err
+	}
+	err = viper.BindEnv("REMOTE_SIGNER_CA_CERT")
+	if err != nil {
+		return RawConfig{}, err
+	}
+	err = viper.BindEnv("TX_MAX_FEE_PER_GAS_GWEI")
+	if err != nil {
+		return RawConfig{}, err
+	}
+	err = viper.BindEnv("TX_CONFIRMATIONS")
+	if err != nil {
+		return RawConfig{}, err
+	}
+	err = viper.BindEnv("TX_RESEND_INTERVAL")
+	if err != nil {
+		return RawConfig{}, err
+	}
+	err = viper.BindEnv("TX_TIMEOUT")
+	if err != nil {
+		return RawConfig{}, err
+	}
+	err = viper.BindEnv("REGISTRATION_SIG_EXPIRY")
+	if err != nil {
+		return RawConfig{}, err
+	}
+	err = viper.BindEnv("GATEWAY_CONFIRMATIONS")
+	if err != nil {
+		return RawConfig{}, err
+	}
+	err = viper.BindEnv("SECWARE_MAX_CONCURRENCY")
+	if err != nil {
+		return RawConfig{}, err
+	}
+	err = viper.BindEnv("SECWARE_QUEUE_DEPTH")
+	if err != nil {
+		return RawConfig{}, err
+	}
+	err = viper.BindEnv("SECWARE_DRAIN_TIMEOUT")
+	if err != nil {
+		return RawConfig{}, err
+	}
+	err = viper.BindEnv("SECWARE_TRANSPORT")
+	if err != nil {
+		return RawConfig{}, err
+	}
+	err = viper.BindEnv("SECWARE_ORPHAN_POLICY")
+	if err != nil {
+		return RawConfig{}, err
+	}
+	err = viper.BindEnv("SECWARE_RUNNER")
+	if err != nil {
+		return RawConfig{}, err
+	}
+	err = viper.BindEnv("SECWARE_ENGINE_SOCKET")
+	if err != nil {
+		return RawConfig{}, err
+	}
 
 	err = viper.Unmarshal(&rawConfig)
 	if err != nil {
@@ -164,28 +493,144 @@ func getRawConfigFromEnv() (RawConfig, error) {
 	return rawConfig, nil
 }
 
-func NewConfig(ctx *cli.Context) (Config, error) {
-	configFilePath := ctx.String(ConfigFileFlag)
+// GetDataPath 返回状态数据的目录，未设定时默认保存在 compose file 目录下
+func (r *RawConfig) GetDataPath() string {
+	if r.DataPath == "" {
+		return filepath.Join(r.ComposeFilePath, "data")
+	}
+	return r.DataPath
+}
+
+// GetSecwareTransport 返回访问 secware 的方式，未设定时通过端口访问
+func (r *RawConfig) GetSecwareTransport() string {
+	if r.SecwareTransport == "" {
+		return SecwareTransportTCP
+	}
+	return r.SecwareTransport
+}
+
+// GetSecwareOrphanPolicy 返回启动时对没有记录的 secware project 的处理方式，默认接管
+func (r *RawConfig) GetSecwareOrphanPolicy() string {
+	if r.SecwareOrphanPolicy == "" {
+		return SecwareOrphanAdopt
+	}
+	return r.SecwareOrphanPolicy
+}
+
+// GetSecwareRunner 返回启停 secware 的方式，默认调用 docker compose 命令
+func (r *RawConfig) GetSecwareRunner() string {
+	if r.SecwareRunner == "" {
+		return SecwareRunnerCompose
+	}
+	return r.SecwareRunner
+}
+
+// GetSecwareEngineSocket 返回 engine 和 podman runner 访问 API 的 unix socket，
+// podman 默认使用当前用户的 rootless socket
+func (r *RawConfig) GetSecwareEngineSocket() string {
+	if r.SecwareEngineSocket == "" && r.SecwareRunner == SecwareRunnerPodman {
+		runtimeDir := os.Getenv("XDG_RUNTIME_DIR")
+		if runtimeDir == "" {
+			runtimeDir = fmt.Sprintf("/run/user/%d", os.Getuid())
+		}
+		return filepath.Join(runtimeDir, "podman", "podman.sock")
+	}
+	if r.SecwareEngineSocket == "" {
+		return DefaultSecwareEngineSocket
+	}
+	return r.SecwareEngineSocket
+}
+
+// GetRemoteSignerOptions 获取访问远程签名服务的 token 和 CA 证书
+func (r *RawConfig) GetRemoteSignerOptions() signer.RemoteOptions {
+	return signer.RemoteOptions{
+		Token:      r.RemoteSignerToken,
+		CACertPath: r.RemoteSignerCACert,
+	}
+}
 
+// LoadRawConfig 从配置文件读取配置，未指定配置文件时从环境变量读取
+func LoadRawConfig(configFilePath string) (RawConfig, error) {
 	var rawConfig RawConfig
 	var err error
 	if configFilePath != "" {
 		rawConfig, err = getRawConfigFromFile(configFilePath)
-		if err != nil {
-			return Config{}, err
-		}
 	} else {
 		rawConfig, err = getRawConfigFromEnv()
-		if err != nil {
-			return Config{}, err
-		}
+	}
+	if err != nil {
+		return RawConfig{}, err
 	}
 
 	if err := rawConfig.isValid(); err != nil {
+		return RawConfig{}, err
+	}
+	return rawConfig, nil
+}
+
+// GetTxParams 获取发送注册相关交易的参数。TX_RESEND_INTERVAL 设为 0 时不重发交易
+func (r *RawConfig) GetTxParams() chainio.TxParams {
+	confirmations := r.TxConfirmations
+	if confirmations == 0 {
+		confirmations = DefaultTxConfirmations
+	}
+	resendInterval := time.Duration(DefaultTxResendInterval) * time.Second
+	if r.TxResendInterval != nil {
+		resendInterval = time.Duration(*r.TxResendInterval) * time.Second
+	}
+	return chainio.TxParams{
+		MaxFeePerGas:   gweiToWei(r.TxMaxFeePerGasGwei),
+		Confirmations:  uint64(confirmations),
+		ResendInterval: resendInterval,
+		Timeout:        secondsOrDefault(r.TxTimeout, DefaultTxTimeout),
+	}
+}
+
+// gweiToWei 把以 gwei 为单位的手续费转换为 wei，0 表示不限制，返回 nil
+func gweiToWei(gwei float64) *big.Int {
+	if gwei <= 0 {
+		return nil
+	}
+	wei, _ := new(big.Float).Mul(big.NewFloat(gwei), big.NewFloat(1e9)).Int(nil)
+	return wei
+}
+
+// intOrDefault 未设定时使用默认值
+func intOrDefault(value int, defaultValue int) int {
+	if value == 0 {
+		return defaultValue
+	}
+	return value
+}
+
+// secondsOrDefault 把以秒为单位的配置转换为 time.Duration，未设定时使用默认值
+func secondsOrDefault(seconds int, defaultSeconds int) time.Duration {
+	if seconds == 0 {
+		seconds = defaultSeconds
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+func parseLogLevel(level string) zapcore.Level {
+	if level == "" {
+		return zapcore.InfoLevel
+	}
+	l, _ := zapcore.ParseLevel(level)
+	return l
+}
+
+func NewConfig(ctx *cli.Context) (Config, error) {
+	configFilePath := ctx.String(ConfigFileFlag)
+
+	rawConfig, err := LoadRawConfig(configFilePath)
+	if err != nil {
 		return Config{}, err
 	}
 
-	logger, err := sdklogging.NewZapLogger(sdklogging.Production)
+	logLevel := zap.NewAtomicLevelAt(parseLogLevel(rawConfig.LogLevel))
+	zapConfig := zap.NewProductionConfig()
+	zapConfig.Level = logLevel
+	logger, err := sdklogging.NewZapLoggerByConfig(zapConfig, zap.AddCallerSkip(1))
 	if err != nil {
 		return Config{}, err
 	}
@@ -194,12 +639,12 @@ func NewConfig(ctx *cli.Context) (Config, error) {
 	if err != nil {
 		return Config{}, err
 	}
-
-	blsKeyPassword, ok := GetOperatorBLSKeyPassword()
-	if !ok {
-		logger.Infof("BLS key password not set. using empty string")
+	chainId, err := ethRpcClient.ChainID(ctx.Context)
+	if err != nil {
+		return Config{}, fmt.Errorf("failed to read chain id: %w", err)
 	}
-	blsKeyPair, err := bls.ReadPrivateKeyFromFile(rawConfig.BLSKeyStorePath, blsKeyPassword)
+
+	blsSigner, err := NewBLSSigner(&rawConfig, logger)
 	if err != nil {
 		return Config{}, fmt.Errorf("failed to read bls key pair: %w", err)
 	}
@@ -210,7 +655,8 @@ func NewConfig(ctx *cli.Context) (Config, error) {
 		return Config{}, err
 	}
 
-	gatewayAddr, gatewayUrl, err := avsReader.GatewayConfig()
+	gatewayConfirmations := uint64(intOrDefault(rawConfig.GatewayConfirmations, DefaultGatewayConfirmations))
+	gatewayAddr, gatewayUrl, err := chainio.ConfirmedGatewayConfig(ctx.Context, avsReader, gatewayConfirmations)
 	if err != nil {
 		return Config{}, err
 	}
@@ -222,33 +668,186 @@ func NewConfig(ctx *cli.Context) (Config, error) {
 	addressOperatorString := addressOperator.Hex()
 	logger.Infof("Operator address: %s", addressOperatorString)
 
-	if !filepath.IsAbs(rawConfig.ComposeFilePath) {
-		return Config{}, fmt.Errorf("compose file path must be absolute")
+	seenTaskCacheSize := rawConfig.SeenTaskCacheSize
+	if seenTaskCacheSize == 0 {
+		seenTaskCacheSize = DefaultSeenTaskCacheSize
+	}
+
+	secwareKeys, secwareKeysHash, err := loadSecwareKeys(&rawConfig)
+	if err != nil {
+		return Config{}, err
+	}
+	if len(secwareKeys) == 0 {
+		logger.Warn("No secware keys loaded, results of all secwares will be rejected")
 	}
+	logger.Infof("Secware keys loaded: %d", len(secwareKeys))
+
+	secwareResources, err := getResourceProfile(&rawConfig)
+	if err != nil {
+		return Config{}, err
+	}
+	logger.Infof("Secware resource limits: cpus %.2f, memory %d bytes", secwareResources.CPUs, secwareResources.Memory)
 
 	return Config{
 		Logger:          logger,
 		ComposeFilePath: rawConfig.ComposeFilePath,
+		DataPath:        rawConfig.GetDataPath(),
 
 		RegCoordinatorAddr:         common.HexToAddress(rawConfig.RegCoordinatorAddr),
 		OperatorStateRetrieverAddr: common.HexToAddress(rawConfig.OperatorStateRetrieverAddr),
 
 		ETHRpc:        rawConfig.ETHRpc,
 		EthHttpClient: ethRpcClient,
+		ChainId:       chainId,
 
 		GatewayUrl:      gatewayUrl,
 		AddressGateway:  gatewayAddr,
 		AddressOperator: addressOperator,
-		BLSKeypair:      blsKeyPair,
+		BLSSigner:       blsSigner,
 
 		NodeClass:   rawConfig.NodeClass,
 		OperatorURL: rawConfig.OperatorURL,
 		APIPort:     rawConfig.APIPort,
 
 		QuorumNums: rawConfig.QuorumNums,
+
+		TaskClockSkew:     secondsOrDefault(rawConfig.TaskClockSkew, DefaultTaskClockSkew),
+		SeenTaskCacheSize: seenTaskCacheSize,
+
+		SecwareKeys:      secwareKeys,
+		secwareKeysHash:  secwareKeysHash,
+		SecwareResources: secwareResources,
+
+		SecwareMaxConcurrency: intOrDefault(rawConfig.SecwareMaxConcurrency, DefaultSecwareMaxConcurrency),
+		SecwareQueueDepth:     intOrDefault(rawConfig.SecwareQueueDepth, DefaultSecwareQueueDepth),
+		SecwareDrainTimeout:   secondsOrDefault(rawConfig.SecwareDrainTimeout, DefaultSecwareDrainTimeout),
+
+		SecwareTransport:    rawConfig.GetSecwareTransport(),
+		SecwareOrphanPolicy: rawConfig.GetSecwareOrphanPolicy(),
+		SecwareRunner:       rawConfig.GetSecwareRunner(),
+		SecwareEngineSocket: rawConfig.GetSecwareEngineSocket(),
+
+		AdminListen: rawConfig.AdminListen,
+		AdminToken:  rawConfig.AdminToken,
+
+		RemoteSignerUrl:   rawConfig.RemoteSignerUrl,
+		ECDSARemoteSigner: rawConfig.ECDSARemoteSigner,
+
+		RemoteSignerOptions: rawConfig.GetRemoteSignerOptions(),
+
+		ConfigFilePath:    configFilePath,
+		LogLevel:          logLevel,
+		SyncInterval:      secondsOrDefault(rawConfig.SyncInterval, DefaultSyncInterval),
+		HeartbeatInterval: secondsOrDefault(rawConfig.HeartbeatInterval, DefaultHeartbeatInterval),
+
+		TxParams:              rawConfig.GetTxParams(),
+		RegistrationSigExpiry: secondsOrDefault(rawConfig.RegistrationSigExpiry, DefaultRegistrationSigExpiry),
+
+		GatewayConfirmations: gatewayConfirmations,
+
+		rawConfig: rawConfig,
 	}, nil
 }
 
+// checkAdminListen 管理接口只能监听 unix socket (unix:///path/to/admin.sock) 或本机地址
+func checkAdminListen(listen string) error {
+	if strings.HasPrefix(listen, "unix://") {
+		if !filepath.IsAbs(strings.TrimPrefix(listen, "unix://")) {
+			return fmt.Errorf("admin unix socket path must be absolute")
+		}
+		return nil
+	}
+
+	host, _, err := net.SplitHostPort(listen)
+	if err != nil {
+		return fmt.Errorf("invalid admin listen address: %w", err)
+	}
+	if host == "localhost" {
+		return nil
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || !ip.IsLoopback() {
+		return fmt.Errorf("admin api must listen on localhost or a unix socket")
+	}
+	return nil
+}
+
+// loadSecwareKeys 读取 SECWARE_KEY_FILE_PATH 中的密钥，同时返回文件内容的 sha256。没有配置密钥文件时返回空的密钥
+func loadSecwareKeys(rawConfig *RawConfig) (map[string]types.HexBytes, string, error) {
+	if rawConfig.SecwareKeyFilePath == "" {
+		return make(map[string]types.HexBytes), "", nil
+	}
+	data, err := os.ReadFile(rawConfig.SecwareKeyFilePath)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read secware keys: %w", err)
+	}
+	keys, err := parseSecwareKeys(data)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read secware keys: %w", err)
+	}
+	hash := sha256.Sum256(data)
+	return keys, hex.EncodeToString(hash[:]), nil
+}
+
+// parseSecwareKeys 解析 secware 的 HMAC 密钥文件，格式为 {"<secware id>-<secware version>": "0x<key>"}
+func parseSecwareKeys(data []byte) (map[string]types.HexBytes, error) {
+	var rawKeys map[string]types.HexBytes
+	err := json.Unmarshal(data, &rawKeys)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]types.HexBytes)
+	for name, key := range rawKeys {
+		id, version, found := strings.Cut(name, "-")
+		secwareId, idErr := strconv.Atoi(id)
+		secwareVersion, versionErr := strconv.Atoi(version)
+		if !found || idErr != nil || versionErr != nil {
+			return nil, fmt.Errorf("invalid secware %s, expect <id>-<version>", name)
+		}
+		if len(key) == 0 {
+			return nil, fmt.Errorf("empty key for secware %s", name)
+		}
+		keys[fmt.Sprintf("%d-%d", secwareId, secwareVersion)] = key
+	}
+	return keys, nil
+}
+
+// NewBLSSigner 配置了 BLS_REMOTE_SIGNER_KEY 时使用远程签名服务，否则从 keystore 文件读取 BLS 私钥
+func NewBLSSigner(rawConfig *RawConfig, logger sdklogging.Logger) (signature.BLSSigner, error) {
+	if rawConfig.BLSRemoteSignerKey != "" {
+		logger.Infof("Using remote BLS signer %s", rawConfig.RemoteSignerUrl)
+		return signer.NewRemoteBLSSigner(rawConfig.RemoteSignerUrl, rawConfig.BLSRemoteSignerKey, rawConfig.GetRemoteSignerOptions())
+	}
+
+	blsKeyPassword, ok := GetOperatorBLSKeyPassword()
+	if !ok {
+		logger.Infof("BLS key password not set. using empty string")
+	}
+	return signer.NewKeystoreBLSSigner(rawConfig.BLSKeyStorePath, blsKeyPassword)
+}
+
+// NewECDSASigner 配置了 ECDSA_REMOTE_SIGNER 时使用远程签名服务，否则从 keystore 文件读取 ECDSA 私钥
+func NewECDSASigner(cfg Config, keyStorePath string) (signature.ECDSASigner, error) {
+	if cfg.ECDSARemoteSigner {
+		cfg.Logger.Infof("Using remote ECDSA signer %s", cfg.RemoteSignerUrl)
+		return signer.NewRemoteECDSASigner(cfg.RemoteSignerUrl, cfg.AddressOperator, cfg.RemoteSignerOptions)
+	}
+
+	if keyStorePath == "" {
+		return nil, fmt.Errorf("operator ecdsa key store path not provided")
+	}
+	keyPassword, _ := GetOperatorECDSAKeyPassword()
+	ecdsaSigner, err := signer.NewKeystoreECDSASigner(keyStorePath, keyPassword)
+	if err != nil {
+		return nil, err
+	}
+	if ecdsaSigner.Address() != cfg.AddressOperator {
+		return nil, fmt.Errorf("ecdsa key address %s does not match operator address %s", ecdsaSigner.Address().Hex(), cfg.AddressOperator.Hex())
+	}
+	return ecdsaSigner, nil
+}
+
 func GetOperatorBLSKeyPassword() (string, bool) {
 	return os.LookupEnv("BLS_KEY_PASSWORD")
 }
@@ -0,0 +1,35 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestGetTxParams(t *testing.T) {
+	cases := []struct {
+		config         string
+		resendInterval time.Duration
+		timeout        time.Duration
+	}{
+		{"", DefaultTxResendInterval * time.Second, DefaultTxTimeout * time.Second},
+		// 0 表示不重发
+		{"TX_RESEND_INTERVAL=0\n", 0, DefaultTxTimeout * time.Second},
+		{"TX_RESEND_INTERVAL=30\nTX_TIMEOUT=600\n", 30 * time.Second, 600 * time.Second},
+	}
+	for _, c := range cases {
+		path := filepath.Join(t.TempDir(), ".env")
+		if err := os.WriteFile(path, []byte(testConfigFile+c.config), 0600); err != nil {
+			t.Fatal(err)
+		}
+		rawConfig, err := LoadRawConfig(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		params := rawConfig.GetTxParams()
+		if params.ResendInterval != c.resendInterval || params.Timeout != c.timeout {
+			t.Errorf("%q: unexpected resend interval %s, timeout %s", c.config, params.ResendInterval, params.Timeout)
+		}
+	}
+}
@@ -0,0 +1,280 @@
+// Package config: Reloader 在配置文件变化或收到 SIGHUP 时重新加载配置，
+// 可以在线生效的配置会通知各个组件，其余的变化需要重启后才生效。
+package config
+
+import (
+	"context"
+	"fmt"
+	"github.com/Layr-Labs/eigensdk-go/chainio/clients/eth"
+	"github.com/fsnotify/fsnotify"
+	"math/big"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// liveConfigKeys 是修改后无需重启即可生效的配置项
+var liveConfigKeys = map[string]bool{
+	"ETH_RPC":            true,
+	"LOG_LEVEL":          true,
+	"SYNC_INTERVAL":      true,
+	"HEARTBEAT_INTERVAL": true,
+	"TASK_CLOCK_SKEW":    true,
+	"SECWARE_CPUS":       true,
+	"SECWARE_MEMORY":     true,
+
+	"SECWARE_MAX_CONCURRENCY": true,
+	"SECWARE_QUEUE_DEPTH":     true,
+	"SECWARE_KEY_FILE_PATH":   true, // 密钥文件的内容变化时也会重新加载
+}
+
+const (
+	reloadDebounce = time.Second
+	reloadTimeout  = 10 * time.Second
+)
+
+// ReloadReport 是一次重新加载配置的结果
+type ReloadReport struct {
+	Applied         []string `json:"applied"`          // 已经生效的配置项
+	RestartRequired []string `json:"restart_required"` // 需要重启才能生效的配置项
+}
+
+type Reloader struct {
+	lock        sync.Mutex
+	config      Config
+	subscribers []func(cfg Config)
+}
+
+func NewReloader(cfg Config) *Reloader {
+	return &Reloader{config: cfg}
+}
+
+// Subscribe 注册配置变化的回调，回调在 Reload 中按注册顺序同步执行
+func (r *Reloader) Subscribe(fn func(cfg Config)) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.subscribers = append(r.subscribers, fn)
+}
+
+// Config 返回当前生效的配置
+func (r *Reloader) Config() Config {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.config
+}
+
+// diffRawConfig 按 mapstructure 的 key 返回两份配置中不同的配置项
+func diffRawConfig(oldConfig RawConfig, newConfig RawConfig) []string {
+	changed := make([]string, 0)
+	oldValue := reflect.ValueOf(oldConfig)
+	newValue := reflect.ValueOf(newConfig)
+	for i := 0; i < oldValue.NumField(); i++ {
+		if !reflect.DeepEqual(oldValue.Field(i).Interface(), newValue.Field(i).Interface()) {
+			changed = append(changed, oldValue.Type().Field(i).Tag.Get("mapstructure"))
+		}
+	}
+	return changed
+}
+
+// mergeLiveConfig 把新配置中可以在线生效的配置项合并到旧配置中
+func mergeLiveConfig(oldConfig RawConfig, newConfig RawConfig, keys []string) RawConfig {
+	merged := reflect.ValueOf(&oldConfig).Elem()
+	newValue := reflect.ValueOf(newConfig)
+	for i := 0; i < merged.NumField(); i++ {
+		key := merged.Type().Field(i).Tag.Get("mapstructure")
+		for _, k := range keys {
+			if k == key {
+				merged.Field(i).Set(newValue.Field(i))
+			}
+		}
+	}
+	return oldConfig
+}
+
+// expectedChainId 返回 ETH_RPC 应该所在的链，已知的部署使用其所在的链，否则使用启动时 ETH_RPC 所在的链
+func expectedChainId(cfg Config) *big.Int {
+	if network, ok := KnownNetworks[cfg.RegCoordinatorAddr]; ok {
+		return new(big.Int).SetUint64(network.ChainId)
+	}
+	return cfg.ChainId
+}
+
+// applyLiveConfig 根据合并后的原始配置生成新的 Config，切换 ETH RPC 时要求新的 RPC 在预期的链上，无法确认时拒绝切换
+func applyLiveConfig(cfg Config, rawConfig RawConfig) (Config, error) {
+	if rawConfig.ETHRpc != cfg.ETHRpc {
+		expected := expectedChainId(cfg)
+		if expected == nil {
+			return Config{}, fmt.Errorf("cannot confirm the chain of the new eth rpc")
+		}
+		ethRpcClient, err := eth.NewClient(rawConfig.ETHRpc)
+		if err != nil {
+			return Config{}, err
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), reloadTimeout)
+		defer cancel()
+		newChainId, err := ethRpcClient.ChainID(ctx)
+		if err != nil {
+			return Config{}, fmt.Errorf("new eth rpc is unavailable: %w", err)
+		}
+		if expected.Cmp(newChainId) != 0 {
+			return Config{}, fmt.Errorf("new eth rpc is on chain %s, expected %s", newChainId, expected)
+		}
+
+		cfg.ETHRpc = rawConfig.ETHRpc
+		cfg.EthHttpClient = ethRpcClient
+	}
+
+	secwareResources, err := getResourceProfile(&rawConfig)
+	if err != nil {
+		return Config{}, err
+	}
+
+	cfg.SecwareResources = secwareResources
+	cfg.SecwareMaxConcurrency = intOrDefault(rawConfig.SecwareMaxConcurrency, DefaultSecwareMaxConcurrency)
+	cfg.SecwareQueueDepth = intOrDefault(rawConfig.SecwareQueueDepth, DefaultSecwareQueueDepth)
+	cfg.TaskClockSkew = secondsOrDefault(rawConfig.TaskClockSkew, DefaultTaskClockSkew)
+	cfg.SyncInterval = secondsOrDefault(rawConfig.SyncInterval, DefaultSyncInterval)
+	cfg.HeartbeatInterval = secondsOrDefault(rawConfig.HeartbeatInterval, DefaultHeartbeatInterval)
+	cfg.rawConfig = rawConfig
+	return cfg, nil
+}
+
+// Reload 重新读取并校验配置，在线生效可以热加载的配置项，并返回需要重启才能生效的配置项
+func (r *Reloader) Reload() (ReloadReport, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	report := ReloadReport{Applied: make([]string, 0), RestartRequired: make([]string, 0)}
+	rawConfig, err := LoadRawConfig(r.config.ConfigFilePath)
+	if err != nil {
+		return report, err
+	}
+
+	secwareKeys, secwareKeysHash, err := loadSecwareKeys(&rawConfig)
+	if err != nil {
+		return report, err
+	}
+
+	for _, key := range diffRawConfig(r.config.rawConfig, rawConfig) {
+		if liveConfigKeys[key] {
+			report.Applied = append(report.Applied, key)
+		} else {
+			report.RestartRequired = append(report.RestartRequired, key)
+		}
+	}
+	// Gateway 发布新的 secware 版本后，只更新密钥文件的内容，路径不变
+	if secwareKeysHash != r.config.secwareKeysHash && rawConfig.SecwareKeyFilePath == r.config.rawConfig.SecwareKeyFilePath {
+		report.Applied = append(report.Applied, "SECWARE_KEY_FILE_PATH")
+	}
+	if len(report.Applied) == 0 {
+		return report, nil
+	}
+
+	cfg, err := applyLiveConfig(r.config, mergeLiveConfig(r.config.rawConfig, rawConfig, report.Applied))
+	if err != nil {
+		report.Applied = report.Applied[:0]
+		return report, err
+	}
+	cfg.SecwareKeys = secwareKeys
+	cfg.secwareKeysHash = secwareKeysHash
+	cfg.LogLevel.SetLevel(parseLogLevel(cfg.rawConfig.LogLevel))
+
+	r.config = cfg
+	for _, fn := range r.subscribers {
+		fn(cfg)
+	}
+	return report, nil
+}
+
+func (r *Reloader) reload() {
+	logger := r.Config().Logger
+	report, err := r.Reload()
+	if err != nil {
+		logger.Errorf("Failed to reload config, keep the current config: %v", err)
+	}
+	if len(report.Applied) > 0 {
+		logger.Infof("Config reloaded: %v", report.Applied)
+	}
+	if len(report.RestartRequired) > 0 {
+		logger.Warnf("Config changes require restart to take effect: %v", report.RestartRequired)
+	}
+}
+
+// watchedFiles 返回需要监听变化的配置文件和 secware 密钥文件
+func (r *Reloader) watchedFiles() []string {
+	cfg := r.Config()
+	var files []string
+	for _, file := range []string{cfg.ConfigFilePath, cfg.rawConfig.SecwareKeyFilePath} {
+		if file != "" {
+			files = append(files, file)
+		}
+	}
+	return files
+}
+
+// Start 监听配置文件和 secware 密钥文件所在目录的变化和 SIGHUP，触发重新加载配置
+func (r *Reloader) Start(ctx context.Context) error {
+	cfg := r.Config()
+	cfg.Logger.Info("Config Reloader Start")
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	// 监听目录而不是文件，以便处理编辑器和 k8s ConfigMap 通过替换文件的方式更新配置
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer watcher.Close()
+	watched := make(map[string]bool)
+	watch := func() error {
+		for _, file := range r.watchedFiles() {
+			dir := filepath.Dir(file)
+			if watched[dir] {
+				continue
+			}
+			if err := watcher.Add(dir); err != nil {
+				return err
+			}
+			watched[dir] = true
+		}
+		return nil
+	}
+	if err := watch(); err != nil {
+		return err
+	}
+
+	// 文件变化时往往会连续产生多个事件，等待一段时间后再重新加载
+	debounce := time.NewTimer(reloadDebounce)
+	debounce.Stop()
+	defer debounce.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			cfg.Logger.Info("Config Reloader Exit")
+			return nil
+		case <-hup:
+			cfg.Logger.Info("Received SIGHUP, reloading config")
+			r.reload()
+		case <-watcher.Events:
+			debounce.Reset(reloadDebounce)
+			continue
+		case err := <-watcher.Errors:
+			cfg.Logger.Errorf("Config watcher error: %v", err)
+			continue
+		case <-debounce.C:
+			r.reload()
+		}
+		// 修改了 SECWARE_KEY_FILE_PATH 时监听新的密钥文件
+		if err := watch(); err != nil {
+			cfg.Logger.Errorf("Failed to watch config files: %v", err)
+		}
+	}
+}
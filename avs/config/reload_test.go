@@ -0,0 +1,208 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testConfigFile = `COMPOSE_FILE_PATH=/tmp/secware
+OPERATOR_ADDRESS=0x0000000000000000000000000000000000000001
+BLS_KEY_STORE_PATH=/tmp/bls.json
+NODE_CLASS=s
+API_PORT=7776
+OPERATOR_URL=http://127.0.0.1:7776
+ETH_RPC=http://127.0.0.1:8545
+QUORUM_NUMS=0
+REGISTRY_COORDINATOR_ADDR=0x0000000000000000000000000000000000000002
+OPERATOR_STATE_RETRIEVER=0x0000000000000000000000000000000000000003
+`
+
+func TestReload(t *testing.T) {
+	configFilePath := filepath.Join(t.TempDir(), "avs.env")
+	if err := os.WriteFile(configFilePath, []byte(testConfigFile), 0600); err != nil {
+		t.Fatal(err)
+	}
+	rawConfig, err := LoadRawConfig(configFilePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := Config{
+		ConfigFilePath: configFilePath,
+		ETHRpc:         rawConfig.ETHRpc,
+		LogLevel:       zap.NewAtomicLevelAt(zapcore.InfoLevel),
+		SyncInterval:   DefaultSyncInterval * time.Second,
+		APIPort:        rawConfig.APIPort,
+		rawConfig:      rawConfig,
+	}
+	reloader := NewReloader(cfg)
+	var applied Config
+	reloader.Subscribe(func(cfg Config) { applied = cfg })
+
+	changed := strings.Replace(testConfigFile, "API_PORT=7776", "API_PORT=7777", 1) +
+		"LOG_LEVEL=debug\nSYNC_INTERVAL=30\nSECWARE_MEMORY=512m\n"
+	if err := os.WriteFile(configFilePath, []byte(changed), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := reloader.Reload()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(report.Applied, []string{"SECWARE_MEMORY", "LOG_LEVEL", "SYNC_INTERVAL"}) {
+		t.Errorf("unexpected applied %v", report.Applied)
+	}
+	if !reflect.DeepEqual(report.RestartRequired, []string{"API_PORT"}) {
+		t.Errorf("unexpected restart required %v", report.RestartRequired)
+	}
+	if applied.SyncInterval != 30*time.Second || applied.SecwareResources.Memory != 512<<20 || applied.APIPort != 7776 {
+		t.Errorf("unexpected applied config %#v", applied)
+	}
+	if cfg.LogLevel.Level() != zapcore.DebugLevel {
+		t.Errorf("expect debug log level, got %s", cfg.LogLevel.Level())
+	}
+
+	// 无法通过校验的配置不会生效
+	if err := os.WriteFile(configFilePath, []byte(changed+"NODE_CLASS=xxl\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := reloader.Reload(); err == nil {
+		t.Fatal("expect invalid config error")
+	}
+	if reloader.Config().SyncInterval != 30*time.Second {
+		t.Errorf("config should be kept after invalid reload")
+	}
+}
+
+func TestReloadSecwareKeys(t *testing.T) {
+	dir := t.TempDir()
+	keyFilePath := filepath.Join(dir, "secware-keys.json")
+	if err := os.WriteFile(keyFilePath, []byte(`{"1-1": "0x01"}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	configFilePath := filepath.Join(dir, "avs.env")
+	if err := os.WriteFile(configFilePath, []byte(testConfigFile+"SECWARE_KEY_FILE_PATH="+keyFilePath+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	rawConfig, err := LoadRawConfig(configFilePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys, keysHash, err := loadSecwareKeys(&rawConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reloader := NewReloader(Config{
+		ConfigFilePath:  configFilePath,
+		ETHRpc:          rawConfig.ETHRpc,
+		LogLevel:        zap.NewAtomicLevelAt(zapcore.InfoLevel),
+		SecwareKeys:     keys,
+		rawConfig:       rawConfig,
+		secwareKeysHash: keysHash,
+	})
+	var applied Config
+	reloader.Subscribe(func(cfg Config) { applied = cfg })
+
+	// 只修改密钥文件的内容也会重新加载密钥
+	if err := os.WriteFile(keyFilePath, []byte(`{"1-1": "0x01", "1-2": "0x02"}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	report, err := reloader.Reload()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(report.Applied, []string{"SECWARE_KEY_FILE_PATH"}) {
+		t.Errorf("unexpected applied %v", report.Applied)
+	}
+	if len(applied.SecwareKeys) != 2 || applied.SecwareKeys["1-2"].String() != "0x02" {
+		t.Errorf("expect new secware keys, got %v", applied.SecwareKeys)
+	}
+
+	// 内容不变时不会重新加载
+	if report, err := reloader.Reload(); err != nil || len(report.Applied) != 0 {
+		t.Errorf("expect nothing applied, got %v, %v", report.Applied, err)
+	}
+
+	// 无法解析的密钥文件不会生效
+	if err := os.WriteFile(keyFilePath, []byte(`{"1-3": ""}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := reloader.Reload(); err == nil {
+		t.Fatal("expect invalid secware keys error")
+	}
+	if len(reloader.Config().SecwareKeys) != 2 {
+		t.Errorf("secware keys should be kept after invalid reload")
+	}
+}
+
+// newChainIdServer 返回一个只响应 eth_chainId 的 JSON-RPC 服务
+func newChainIdServer(t *testing.T, chainId uint64) string {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Id json.RawMessage `json:"id"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		_, _ = fmt.Fprintf(w, `{"jsonrpc":"2.0","id":%s,"result":"0x%x"}`, req.Id, chainId)
+	}))
+	t.Cleanup(server.Close)
+	return server.URL
+}
+
+func TestReloadEthRpcChainId(t *testing.T) {
+	configFilePath := filepath.Join(t.TempDir(), "avs.env")
+	if err := os.WriteFile(configFilePath, []byte(testConfigFile), 0600); err != nil {
+		t.Fatal(err)
+	}
+	rawConfig, err := LoadRawConfig(configFilePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newConfig := func(chainId *big.Int) Config {
+		return Config{
+			ConfigFilePath: configFilePath,
+			ETHRpc:         rawConfig.ETHRpc,
+			ChainId:        chainId,
+			LogLevel:       zap.NewAtomicLevelAt(zapcore.InfoLevel),
+			rawConfig:      rawConfig,
+		}
+	}
+	switchRpc := func(reloader *Reloader, url string) error {
+		changed := strings.Replace(testConfigFile, "ETH_RPC=http://127.0.0.1:8545", "ETH_RPC="+url, 1)
+		if err := os.WriteFile(configFilePath, []byte(changed), 0600); err != nil {
+			t.Fatal(err)
+		}
+		_, err := reloader.Reload()
+		return err
+	}
+
+	// 旧的 RPC 不可用时仍然检查新的 RPC 是否在启动时的链上
+	reloader := NewReloader(newConfig(big.NewInt(5)))
+	if err := switchRpc(reloader, newChainIdServer(t, 6)); err == nil {
+		t.Fatal("expect eth rpc on another chain to be rejected")
+	}
+	url := newChainIdServer(t, 5)
+	if err := switchRpc(reloader, url); err != nil {
+		t.Fatal(err)
+	}
+	if reloader.Config().ETHRpc != url {
+		t.Errorf("expect eth rpc switched to %s, got %s", url, reloader.Config().ETHRpc)
+	}
+
+	// 无法确认预期的链时拒绝切换
+	reloader = NewReloader(newConfig(nil))
+	if err := switchRpc(reloader, newChainIdServer(t, 5)); err == nil {
+		t.Fatal("expect eth rpc to be rejected without a known chain id")
+	}
+}
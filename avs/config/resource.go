@@ -0,0 +1,73 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ResourceProfile 是单个 secware project 可以使用的资源上限，零值表示不限制
+type ResourceProfile struct {
+	CPUs   float64
+	Memory int64 // 字节
+}
+
+func (p ResourceProfile) IsZero() bool {
+	return p.CPUs == 0 && p.Memory == 0
+}
+
+// NodeClassProfiles 各个 node class 默认的 secware 资源上限
+var NodeClassProfiles = map[string]ResourceProfile{
+	"s":  {CPUs: 1, Memory: 1 << 30},
+	"m":  {CPUs: 2, Memory: 4 << 30},
+	"l":  {CPUs: 4, Memory: 8 << 30},
+	"xl": {CPUs: 8, Memory: 16 << 30},
+}
+
+var memoryUnits = []struct {
+	suffix string
+	size   int64
+}{
+	{"kb", 1 << 10},
+	{"mb", 1 << 20},
+	{"gb", 1 << 30},
+	{"k", 1 << 10},
+	{"m", 1 << 20},
+	{"g", 1 << 30},
+	{"b", 1},
+}
+
+// ParseMemorySize 解析 docker compose 格式的内存大小，如 "512m", "2g", "1024"
+func ParseMemorySize(s string) (int64, error) {
+	str := strings.ToLower(strings.TrimSpace(s))
+	unit := int64(1)
+	for _, u := range memoryUnits {
+		if strings.HasSuffix(str, u.suffix) {
+			str = strings.TrimSuffix(str, u.suffix)
+			unit = u.size
+			break
+		}
+	}
+
+	num, err := strconv.ParseFloat(strings.TrimSpace(str), 64)
+	if err != nil || num < 0 {
+		return 0, fmt.Errorf("invalid memory size %q", s)
+	}
+	return int64(num * float64(unit)), nil
+}
+
+// getResourceProfile 获取 node class 对应的资源上限，并使用配置中的值覆盖
+func getResourceProfile(rawConfig *RawConfig) (ResourceProfile, error) {
+	profile := NodeClassProfiles[rawConfig.NodeClass]
+	if rawConfig.SecwareCPUs != 0 {
+		profile.CPUs = rawConfig.SecwareCPUs
+	}
+	if rawConfig.SecwareMemory != "" {
+		memory, err := ParseMemorySize(rawConfig.SecwareMemory)
+		if err != nil {
+			return ResourceProfile{}, err
+		}
+		profile.Memory = memory
+	}
+	return profile, nil
+}
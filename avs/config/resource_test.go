@@ -0,0 +1,48 @@
+package config
+
+import "testing"
+
+func TestParseMemorySize(t *testing.T) {
+	cases := map[string]int64{
+		"1024":  1024,
+		"512m":  512 << 20,
+		"512MB": 512 << 20,
+		"2g":    2 << 30,
+		"1.5g":  3 << 29,
+		"64k":   64 << 10,
+		"100b":  100,
+	}
+	for s, expect := range cases {
+		actual, err := ParseMemorySize(s)
+		if err != nil {
+			t.Fatalf("ParseMemorySize(%q) error = %v", s, err)
+		}
+		if actual != expect {
+			t.Fatalf("ParseMemorySize(%q) = %d, want %d", s, actual, expect)
+		}
+	}
+
+	for _, s := range []string{"", "abc", "-1g", "1x"} {
+		if _, err := ParseMemorySize(s); err == nil {
+			t.Fatalf("ParseMemorySize(%q) expect error", s)
+		}
+	}
+}
+
+func TestGetResourceProfile(t *testing.T) {
+	profile, err := getResourceProfile(&RawConfig{NodeClass: "s"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if profile != NodeClassProfiles["s"] {
+		t.Fatalf("expect %#v, got %#v", NodeClassProfiles["s"], profile)
+	}
+
+	profile, err = getResourceProfile(&RawConfig{NodeClass: "s", SecwareCPUs: 0.5, SecwareMemory: "256m"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if profile.CPUs != 0.5 || profile.Memory != 256<<20 {
+		t.Fatalf("unexpected profile %#v", profile)
+	}
+}
@@ -14,6 +14,11 @@ type AvsMetricsInterface interface {
 	IncHealthReported()
 	IncSecwareSynced()
 	SetSecwareNum(int)
+	IncSecwareResultRejected()
+	IncTaskBusy()
+	SetSecwareQueueDepth(string, int)
+	ObserveSecwareQueueWait(string, float64)
+	ObserveSecwareCall(secware string, method string, result string, seconds float64)
 }
 
 const (
@@ -29,6 +34,11 @@ type AvsMetrics struct {
 	numHealthReported   *prometheus.CounterVec
 	numSecwareSynced    *prometheus.CounterVec
 	secwareNum          *prometheus.GaugeVec
+	numResultRejected   *prometheus.CounterVec
+	numTaskBusy         *prometheus.CounterVec
+	secwareQueueDepth   *prometheus.GaugeVec
+	secwareQueueWait    *prometheus.HistogramVec
+	secwareCallDuration *prometheus.HistogramVec
 }
 
 func NewAvsMetrics(cfg config.Config) (*AvsMetrics, error) {
@@ -72,6 +82,38 @@ func NewAvsMetrics(cfg config.Config) (*AvsMetrics, error) {
 				Name:      "secware_num",
 				Help:      "The number of secwares managed by the avs operator",
 			}, []string{"operator_pk"}),
+		numResultRejected: promauto.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: PromNamespace,
+				Name:      "num_secware_result_rejected",
+				Help:      "The number of secware results rejected by the avs operator",
+			}, []string{"operator_pk"}),
+		numTaskBusy: promauto.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: PromNamespace,
+				Name:      "num_task_busy",
+				Help:      "The number of tasks rejected because the secware queue is full",
+			}, []string{"operator_pk"}),
+		secwareQueueDepth: promauto.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: PromNamespace,
+				Name:      "secware_queue_depth",
+				Help:      "The number of tasks waiting for a secware",
+			}, []string{"operator_pk", "secware"}),
+		secwareQueueWait: promauto.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Namespace: PromNamespace,
+				Name:      "secware_queue_wait_seconds",
+				Help:      "The time tasks wait for a secware before being handled",
+				Buckets:   []float64{0.001, 0.01, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10},
+			}, []string{"operator_pk", "secware"}),
+		secwareCallDuration: promauto.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Namespace: PromNamespace,
+				Name:      "secware_call_duration_seconds",
+				Help:      "The duration of calls from the avs operator to secwares",
+				Buckets:   []float64{0.005, 0.01, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10},
+			}, []string{"operator_pk", "secware", "method", "result"}),
 	}, nil
 }
 
@@ -99,4 +141,24 @@ func (m *AvsMetrics) SetSecwareNum(num int) {
 	m.secwareNum.WithLabelValues(m.addressOperatorStr).Set(float64(num))
 }
 
+func (m *AvsMetrics) IncSecwareResultRejected() {
+	m.numResultRejected.WithLabelValues(m.addressOperatorStr).Inc()
+}
+
+func (m *AvsMetrics) IncTaskBusy() {
+	m.numTaskBusy.WithLabelValues(m.addressOperatorStr).Inc()
+}
+
+func (m *AvsMetrics) SetSecwareQueueDepth(secware string, depth int) {
+	m.secwareQueueDepth.WithLabelValues(m.addressOperatorStr, secware).Set(float64(depth))
+}
+
+func (m *AvsMetrics) ObserveSecwareQueueWait(secware string, seconds float64) {
+	m.secwareQueueWait.WithLabelValues(m.addressOperatorStr, secware).Observe(seconds)
+}
+
+func (m *AvsMetrics) ObserveSecwareCall(secware string, method string, result string, seconds float64) {
+	m.secwareCallDuration.WithLabelValues(m.addressOperatorStr, secware, method, result).Observe(seconds)
+}
+
 var _ AvsMetricsInterface = (*AvsMetrics)(nil)
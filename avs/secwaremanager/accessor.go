@@ -3,27 +3,80 @@ package secwaremanager
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"github.com/Layr-Labs/eigensdk-go/crypto/bls"
 	"github.com/avast/retry-go/v4"
 	"github.com/ethereum/go-ethereum/common"
 	"goplus/avs/config"
+	"goplus/avs/metrics"
 	"goplus/shared/pkg/signature"
 	"goplus/shared/pkg/types"
 	"io"
+	"net"
 	"net/http"
+	"sync"
+	"syscall"
 	"time"
 )
 
+const (
+	// DefaultSecwareCallTimeout 是调用方没有设定截止时间时，单次调用 secware 的超时时间
+	DefaultSecwareCallTimeout = 10 * time.Second
+
+	secwareDialTimeout     = 5 * time.Second
+	secwareIdleConnTimeout = 90 * time.Second
+	secwareMaxIdleConns    = 16
+	maxErrorBodySize       = 4096
+)
+
 // SecwareAccessorInterface 对Secware的统一交互界面
 type SecwareAccessorInterface interface {
-	GetSecwareMeta(*SecwareStatus) (SecwareMeta, error)
-	GetSecwareHealth(*SecwareStatus) (SecwareHealth, error)
-	HandleTask(*SecwareStatus, *types.SignedSecwareTask) (types.SignedSecwareResult, error)
+	GetSecwareMeta(context.Context, *SecwareStatus) (SecwareMeta, error)
+	GetSecwareHealth(context.Context, *SecwareStatus) (SecwareHealth, error)
+	HandleTask(context.Context, *SecwareStatus, *types.SignedSecwareTask) (types.SignedSecwareResult, error)
+	CloseConnections(*SecwareStatus)
 }
 
+// SecwareAccessorImpl 为每个 secware 端口或 unix socket 保留一个 keep-alive 的 http.Client，所有组件共用同一个实例
 type SecwareAccessorImpl struct {
+	metricsIntf metrics.AvsMetricsInterface
+
+	clients     map[string]*http.Client // key 为 SecwareStatus.Endpoint
+	clientsLock sync.Mutex
+}
+
+func NewSecwareAccessorImpl(metricsIntf metrics.AvsMetricsInterface) *SecwareAccessorImpl {
+	return &SecwareAccessorImpl{
+		metricsIntf: metricsIntf,
+		clients:     make(map[string]*http.Client),
+	}
+}
+
+// SecwareStatusError 表示 secware 返回了非 2xx 的状态码
+type SecwareStatusError struct {
+	Path       string
+	StatusCode int
+	Body       string
+}
+
+func (e *SecwareStatusError) Error() string {
+	return fmt.Sprintf("secware %s returned status %d: %s", e.Path, e.StatusCode, e.Body)
+}
+
+// SecwareDecodeError 表示 secware 的响应无法解析
+type SecwareDecodeError struct {
+	Path string
+	Err  error
+}
+
+func (e *SecwareDecodeError) Error() string {
+	return fmt.Sprintf("failed to decode secware %s response: %v", e.Path, e.Err)
+}
+
+func (e *SecwareDecodeError) Unwrap() error {
+	return e.Err
 }
 
 type SecwareMeta struct {
@@ -53,31 +106,9 @@ type secwareMetaResponse struct {
 }
 
 // GetSecwareMeta 获取 secware 的描述信息
-func (s *SecwareAccessorImpl) GetSecwareMeta(state *SecwareStatus) (SecwareMeta, error) {
-
-	host := "localhost"
-	url := fmt.Sprintf("http://%s:%d/meta", host, state.Port)
-
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		return SecwareMeta{}, err
-	}
-
-	client := http.Client{Timeout: time.Second * 10}
-	resp, err := client.Do(req)
-	if err != nil {
-		return SecwareMeta{}, err
-	}
-
-	defer resp.Body.Close()
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return SecwareMeta{}, err
-	}
-
+func (s *SecwareAccessorImpl) GetSecwareMeta(ctx context.Context, state *SecwareStatus) (SecwareMeta, error) {
 	var metaResp secwareMetaResponse
-	err = json.Unmarshal(body, &metaResp)
-	if err != nil {
+	if err := s.call(ctx, state, "meta", http.MethodGet, "/meta", nil, &metaResp); err != nil {
 		return SecwareMeta{}, err
 	}
 
@@ -92,71 +123,162 @@ type secwareHealthResponse struct {
 }
 
 // GetSecwareHealth 获取 Secware 的健康状况
-func (s *SecwareAccessorImpl) GetSecwareHealth(state *SecwareStatus) (SecwareHealth, error) {
-	host := "localhost"
-	url := fmt.Sprintf("http://%s:%d/health", host, state.Port)
-
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
+func (s *SecwareAccessorImpl) GetSecwareHealth(ctx context.Context, state *SecwareStatus) (SecwareHealth, error) {
+	var healthResp secwareHealthResponse
+	if err := s.call(ctx, state, "health", http.MethodGet, "/health", nil, &healthResp); err != nil {
 		return SecwareHealth{}, err
 	}
 
-	client := http.Client{Timeout: time.Second * 10}
-	resp, err := client.Do(req)
-	if err != nil {
-		return SecwareHealth{}, err
-	}
+	return SecwareHealth{Health: healthResp.Health}, nil
+}
 
-	defer resp.Body.Close()
-	body, err := io.ReadAll(resp.Body)
+// HandleTask 处理具体的交易安全检测任务，ctx 结束时放弃等待 secware 的结果
+func (s *SecwareAccessorImpl) HandleTask(ctx context.Context, state *SecwareStatus, signTask *types.SignedSecwareTask) (types.SignedSecwareResult, error) {
+	data, err := json.Marshal(signTask)
 	if err != nil {
-		return SecwareHealth{}, err
+		return types.SignedSecwareResult{}, err
 	}
 
-	var healthResp secwareHealthResponse
-	err = json.Unmarshal(body, &healthResp)
-	if err != nil {
-		return SecwareHealth{}, err
+	result := types.SignedSecwareResult{}
+	if err := s.call(ctx, state, "task", http.MethodPost, "/secware", data, &result); err != nil {
+		return types.SignedSecwareResult{}, err
 	}
 
-	return SecwareHealth{Health: healthResp.Health}, nil
+	return result, nil
 }
 
-// HandleTask 处理具体的交易安全检测任务
-func (s *SecwareAccessorImpl) HandleTask(state *SecwareStatus, signTask *types.SignedSecwareTask) (types.SignedSecwareResult, error) {
-	data, err := json.Marshal(signTask)
-	if err != nil {
-		return types.SignedSecwareResult{}, err
+// CloseConnections 关闭到 secware 的空闲连接，在 secware 停止后调用，避免端口被复用时沿用旧的连接
+func (s *SecwareAccessorImpl) CloseConnections(state *SecwareStatus) {
+	s.clientsLock.Lock()
+	client, ok := s.clients[state.Endpoint()]
+	delete(s.clients, state.Endpoint())
+	s.clientsLock.Unlock()
+
+	if ok {
+		client.CloseIdleConnections()
 	}
+}
 
-	host := "localhost"
-	url := fmt.Sprintf("http://%s:%d/secware", host, state.Port)
+func (s *SecwareAccessorImpl) getClient(state *SecwareStatus) *http.Client {
+	s.clientsLock.Lock()
+	defer s.clientsLock.Unlock()
+	if s.clients == nil {
+		s.clients = make(map[string]*http.Client)
+	}
+	endpoint := state.Endpoint()
+	if client, ok := s.clients[endpoint]; ok {
+		return client
+	}
 
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(data))
-	if err != nil {
-		return types.SignedSecwareResult{}, err
+	dialer := &net.Dialer{Timeout: secwareDialTimeout, KeepAlive: 30 * time.Second}
+	dialContext := dialer.DialContext
+	if state.SocketPath != "" {
+		socketPath := state.SocketPath
+		dialContext = func(ctx context.Context, _ string, _ string) (net.Conn, error) {
+			return dialer.DialContext(ctx, "unix", socketPath)
+		}
 	}
 
-	client := http.Client{Timeout: time.Second * 10}
-	resp, err := client.Do(req)
+	// 超时由每次调用的 ctx 控制
+	client := &http.Client{
+		Transport: &http.Transport{
+			DialContext:         dialContext,
+			MaxIdleConns:        secwareMaxIdleConns,
+			MaxIdleConnsPerHost: secwareMaxIdleConns,
+			IdleConnTimeout:     secwareIdleConnTimeout,
+		},
+	}
+	s.clients[endpoint] = client
+	return client
+}
 
+// call 请求 secware 的接口并把 2xx 的响应解析到 out 中，同时记录调用的耗时
+func (s *SecwareAccessorImpl) call(ctx context.Context, state *SecwareStatus, method string, httpMethod string, path string, body []byte, out interface{}) error {
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, DefaultSecwareCallTimeout)
+		defer cancel()
+	}
+
+	start := time.Now()
+	err := s.doCall(ctx, state, httpMethod, path, body, out)
+	if s.metricsIntf != nil {
+		s.metricsIntf.ObserveSecwareCall(fmt.Sprintf("%d-%d", state.SecwareId, state.SecwareVersion), method, callResult(err), time.Since(start).Seconds())
+	}
+	return err
+}
+
+func (s *SecwareAccessorImpl) doCall(ctx context.Context, state *SecwareStatus, httpMethod string, path string, body []byte, out interface{}) error {
+	// 通过 unix socket 访问时 URL 中的 host 只用于 Host 头
+	url := fmt.Sprintf("http://localhost:%d%s", state.Port, path)
+	if state.SocketPath != "" {
+		url = "http://secware" + path
+	}
+
+	var reqBody io.Reader
+	if body != nil {
+		reqBody = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, httpMethod, url, reqBody)
 	if err != nil {
-		return types.SignedSecwareResult{}, err
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
 	}
 
-	defer resp.Body.Close()
-	body, err := io.ReadAll(resp.Body)
+	resp, err := s.getClient(state).Do(req)
 	if err != nil {
-		return types.SignedSecwareResult{}, err
+		return err
 	}
+	defer resp.Body.Close()
 
-	result := types.SignedSecwareResult{}
-	err = json.Unmarshal(body, &result)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		errBody, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBodySize))
+		return &SecwareStatusError{Path: path, StatusCode: resp.StatusCode, Body: string(bytes.TrimSpace(errBody))}
+	}
+
+	respBody, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return types.SignedSecwareResult{}, err
+		return err
+	}
+	if err := json.Unmarshal(respBody, out); err != nil {
+		return &SecwareDecodeError{Path: path, Err: err}
 	}
+	return nil
+}
 
-	return result, nil
+// callResult 是调用耗时指标中的调用结果
+func callResult(err error) string {
+	var statusErr *SecwareStatusError
+	var decodeErr *SecwareDecodeError
+	switch {
+	case err == nil:
+		return "ok"
+	case errors.As(err, &statusErr):
+		return "bad_status"
+	case errors.As(err, &decodeErr):
+		return "decode_error"
+	case errors.Is(err, context.DeadlineExceeded):
+		return "timeout"
+	default:
+		return "error"
+	}
+}
+
+// IsSecwareFault 判断调用 secware 的错误是否由 secware 造成：返回了非 2xx 的状态码或无法解析的响应，
+// 或者拒绝、中断了连接(容器已经退出)。ctx 的取消和超时，以及 operator 本地的错误都不属于 secware 的错误
+func IsSecwareFault(err error) bool {
+	var statusErr *SecwareStatusError
+	var decodeErr *SecwareDecodeError
+	if errors.As(err, &statusErr) || errors.As(err, &decodeErr) {
+		return true
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	return errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.EPIPE) ||
+		errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
 }
 
 // GatewayAccessorInterface 对Gateway的统一交互界面
@@ -167,18 +289,33 @@ type GatewayAccessorInterface interface {
 
 type GatewayAccessorImpl struct {
 	AddressOperator common.Address
-	BLSKeypair      *bls.KeyPair
+	BLSSigner       signature.BLSSigner
 	GatewayUrl      string
+
+	urlLock sync.RWMutex // Gateway 被更换时 GatewayUrl 会被修改
 }
 
 func NewGatewayAccessorImpl(cfg config.Config) (*GatewayAccessorImpl, error) {
 	return &GatewayAccessorImpl{
 		AddressOperator: cfg.AddressOperator,
-		BLSKeypair:      cfg.BLSKeypair,
+		BLSSigner:       cfg.BLSSigner,
 		GatewayUrl:      cfg.GatewayUrl,
 	}, nil
 }
 
+// SetGatewayUrl 更换 Gateway 的 URL，之后的请求发往新的 Gateway
+func (g *GatewayAccessorImpl) SetGatewayUrl(url string) {
+	g.urlLock.Lock()
+	defer g.urlLock.Unlock()
+	g.GatewayUrl = url
+}
+
+func (g *GatewayAccessorImpl) getGatewayUrl() string {
+	g.urlLock.RLock()
+	defer g.urlLock.RUnlock()
+	return g.GatewayUrl
+}
+
 type secwareConfigRequest struct {
 	Time     int64          `json:"time"`
 	Operator types.HexBytes `json:"operator"`
@@ -201,7 +338,7 @@ func (g *GatewayAccessorImpl) GetSecwareConfig() ([]SecwareConfig, error) {
 		Operator: g.AddressOperator[:],
 	}
 
-	signedSc, err := signSecwareConfigRequest(&sc, g.BLSKeypair)
+	signedSc, err := signSecwareConfigRequest(&sc, g.BLSSigner)
 	if err != nil {
 		return nil, err
 	}
@@ -213,7 +350,7 @@ func (g *GatewayAccessorImpl) GetSecwareConfig() ([]SecwareConfig, error) {
 
 	var body []byte
 	err = retry.Do(func() error {
-		configUrl := fmt.Sprintf("%s/pull/operator-config", g.GatewayUrl)
+		configUrl := fmt.Sprintf("%s/pull/operator-config", g.getGatewayUrl())
 		req, err := http.NewRequest("POST", configUrl, bytes.NewBuffer(signedScBytes))
 		if err != nil {
 			return err
@@ -256,13 +393,16 @@ func (g *GatewayAccessorImpl) GetSecwareConfig() ([]SecwareConfig, error) {
 	return result, nil
 }
 
-func signSecwareConfigRequest(req *secwareConfigRequest, blsKeyPair *bls.KeyPair) (*signedSecwareConfigRequest, error) {
+func signSecwareConfigRequest(req *secwareConfigRequest, blsSigner signature.BLSSigner) (*signedSecwareConfigRequest, error) {
 	hashReq, err := signature.HashJSON(req)
 	if err != nil {
 		return nil, err
 	}
 
-	sigReq := blsKeyPair.SignMessage(hashReq)
+	sigReq, err := blsSigner.SignMessage(hashReq)
+	if err != nil {
+		return nil, err
+	}
 
 	return &signedSecwareConfigRequest{
 		Args:        *req,
@@ -288,7 +428,7 @@ func (g *GatewayAccessorImpl) ReportHealth(health []SecwareHealthResult) error {
 		Secware:  health,
 	}
 
-	srh, err := signReportHealthRequest(&rh, g.BLSKeypair)
+	srh, err := signReportHealthRequest(&rh, g.BLSSigner)
 	if err != nil {
 		return err
 	}
@@ -298,7 +438,7 @@ func (g *GatewayAccessorImpl) ReportHealth(health []SecwareHealthResult) error {
 		return err
 	}
 
-	healthUrl := fmt.Sprintf("%s/report/heartbeat", g.GatewayUrl)
+	healthUrl := fmt.Sprintf("%s/report/heartbeat", g.getGatewayUrl())
 	req, err := http.NewRequest("POST", healthUrl, bytes.NewBuffer(srhBytes))
 	if err != nil {
 		return err
@@ -328,13 +468,16 @@ func (g *GatewayAccessorImpl) ReportHealth(health []SecwareHealthResult) error {
 
 }
 
-func signReportHealthRequest(req *ReportHealthRequest, blsKeyPair *bls.KeyPair) (*SignedReportHealthRequest, error) {
+func signReportHealthRequest(req *ReportHealthRequest, blsSigner signature.BLSSigner) (*SignedReportHealthRequest, error) {
 	hashReq, err := signature.HashJSON(req)
 	if err != nil {
 		return nil, err
 	}
 
-	sigReq := blsKeyPair.SignMessage(hashReq)
+	sigReq, err := blsSigner.SignMessage(hashReq)
+	if err != nil {
+		return nil, err
+	}
 	return &SignedReportHealthRequest{
 		Heartbeat:   *req,
 		SigOperator: sigReq.Marshal(),
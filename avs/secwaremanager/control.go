@@ -0,0 +1,294 @@
+// Package secwaremanager: 供管理接口使用的 secware 启停控制
+package secwaremanager
+
+import (
+	"errors"
+	"fmt"
+	"github.com/ethereum/go-ethereum/common"
+	"goplus/avs/config"
+	"goplus/avs/state"
+	"time"
+)
+
+var ErrSecwareProjectNotFound = errors.New("secware project not found")
+
+// ErrSecwareProjectDraining 表示 secware project 正在等待进行中的 task 结束后关停
+var ErrSecwareProjectDraining = errors.New("secware project is draining")
+
+// SyncReport 是最近一次同步 secware 的结果
+type SyncReport struct {
+	Time   int64              `json:"time"`
+	Error  string             `json:"error,omitempty"` // 同步整体失败的原因
+	Failed []SecwareSyncError `json:"failed"`          // 启动失败的 secware
+}
+
+type SecwareSyncError struct {
+	SecwareId      int    `json:"id"`
+	SecwareVersion int    `json:"version"`
+	Reason         string `json:"reason"`
+}
+
+// SyncSecware 立即同步 secware，并记录同步的结果
+func (mgr *SecwareManager) SyncSecware() ([]SecwareConfig, error) {
+	mgr.syncLock.Lock()
+	defer mgr.syncLock.Unlock()
+
+	report := SyncReport{
+		Time:   time.Now().Unix(),
+		Failed: make([]SecwareSyncError, 0),
+	}
+	errSecwares, err := mgr.syncSecware(&report)
+	if err != nil {
+		report.Error = err.Error()
+	} else {
+		mgr.lastSyncTime.Store(report.Time)
+	}
+
+	mgr.rwLock.Lock()
+	mgr.lastSyncReport = report
+	mgr.rwLock.Unlock()
+
+	return errSecwares, err
+}
+
+func (mgr *SecwareManager) GetLastSyncReport() SyncReport {
+	mgr.rwLock.RLock()
+	defer mgr.rwLock.RUnlock()
+	return mgr.lastSyncReport
+}
+
+// GetLastSyncTime 返回最近一次成功同步的时间(unix 秒)
+func (mgr *SecwareManager) GetLastSyncTime() int64 {
+	return mgr.lastSyncTime.Load()
+}
+
+// GetLastHeartbeatTime 返回最近一次成功向 Gateway 汇报健康状态的时间(unix 秒)
+func (mgr *SecwareManager) GetLastHeartbeatTime() int64 {
+	return mgr.lastHeartbeatTime.Load()
+}
+
+// IsAlive 同步循环正在运行，并且 monitor 最近仍在执行检查时，认为 secware 的管理是存活的
+func (mgr *SecwareManager) IsAlive() bool {
+	if !mgr.running.Load() {
+		return false
+	}
+	lastMonitorTime := time.Unix(mgr.lastMonitorTime.Load(), 0)
+	return time.Since(lastMonitorTime) <= 3*mgr.GetHeartbeatInterval()
+}
+
+func (mgr *SecwareManager) GetSyncInterval() time.Duration {
+	if interval := time.Duration(mgr.syncInterval.Load()); interval > 0 {
+		return interval
+	}
+	return config.DefaultSyncInterval * time.Second
+}
+
+func (mgr *SecwareManager) GetHeartbeatInterval() time.Duration {
+	if interval := time.Duration(mgr.heartbeatInterval.Load()); interval > 0 {
+		return interval
+	}
+	return config.DefaultHeartbeatInterval * time.Second
+}
+
+// gatewayUrlSetter 是可以更换 Gateway URL 的组件
+type gatewayUrlSetter interface {
+	SetGatewayUrl(url string)
+}
+
+// SetGateway 更换 Gateway，之后下载的 compose 文件使用新的 Gateway 地址验签，请求发往新的 Gateway URL
+func (mgr *SecwareManager) SetGateway(address common.Address, url string) {
+	mgr.rwLock.Lock()
+	mgr.addressGateway = address
+	mgr.rwLock.Unlock()
+
+	if accessor, ok := mgr.GatewayAccessorIntf.(gatewayUrlSetter); ok {
+		accessor.SetGatewayUrl(url)
+	}
+}
+
+func (mgr *SecwareManager) getAddressGateway() common.Address {
+	mgr.rwLock.RLock()
+	defer mgr.rwLock.RUnlock()
+	return mgr.addressGateway
+}
+
+// configurable 是可以在线更新配置的组件
+type configurable interface {
+	ApplyConfig(cfg config.Config)
+}
+
+// ApplyConfig 应用热加载的配置。同步间隔和汇报间隔从下一个周期开始生效，
+// secware 的资源上限在下一次启动 secware 时生效
+func (mgr *SecwareManager) ApplyConfig(cfg config.Config) {
+	mgr.syncInterval.Store(int64(cfg.SyncInterval))
+	mgr.heartbeatInterval.Store(int64(cfg.HeartbeatInterval))
+
+	if runner, ok := mgr.DockerRunnerIntf.(configurable); ok {
+		mgr.syncLock.Lock()
+		runner.ApplyConfig(cfg)
+		mgr.syncLock.Unlock()
+	}
+}
+
+// ListSecwares 获取所有可用的、被手动停止的以及重启失败的 secware
+func (mgr *SecwareManager) ListSecwares() []*SecwareStatus {
+	mgr.rwLock.RLock()
+	defer mgr.rwLock.RUnlock()
+
+	secwares := make([]*SecwareStatus, 0, len(mgr.availableSecwares)+len(mgr.stoppedSecwares)+len(mgr.failedSecwares))
+	secwares = append(secwares, mgr.availableSecwares...)
+	for _, s := range mgr.stoppedSecwares {
+		secwares = append(secwares, s)
+	}
+	for _, s := range mgr.failedSecwares {
+		secwares = append(secwares, s)
+	}
+	return secwares
+}
+
+// ListSecwareProjects 获取记录中所有的 secware project，包括已经停止的版本
+func (mgr *SecwareManager) ListSecwareProjects() ([]*state.SecwareProject, error) {
+	if mgr.registry == nil {
+		return []*state.SecwareProject{}, nil
+	}
+	return mgr.registry.ListSecwareProjects()
+}
+
+// InspectSecware 获取 secware project 中各个容器的状态，runner 不支持时返回 ErrContainerInspectUnsupported
+func (mgr *SecwareManager) InspectSecware(projectName string) ([]ContainerStatus, error) {
+	inspector, ok := mgr.DockerRunnerIntf.(ContainerInspectorInterface)
+	if !ok {
+		return nil, ErrContainerInspectUnsupported
+	}
+	return inspector.ProjectContainers(projectName)
+}
+
+// SecwareLogs 获取 secware project 中一个 service 最后 tail 行的日志，runner 不支持时返回 ErrContainerInspectUnsupported
+func (mgr *SecwareManager) SecwareLogs(projectName string, service string, tail int) (string, error) {
+	inspector, ok := mgr.DockerRunnerIntf.(ContainerInspectorInterface)
+	if !ok {
+		return "", ErrContainerInspectUnsupported
+	}
+	return inspector.ProjectLogs(projectName, service, tail)
+}
+
+// removeSecware 把 secware 从可用列表中移除，之后的 task 不会再交给它处理
+func (mgr *SecwareManager) removeSecware(projectName string) (*SecwareStatus, bool) {
+	mgr.rwLock.Lock()
+	defer mgr.rwLock.Unlock()
+
+	for idx, s := range mgr.availableSecwares {
+		if s.ComposeProjectName != projectName {
+			continue
+		}
+		mgr.availableSecwares = append(mgr.availableSecwares[:idx:idx], mgr.availableSecwares[idx+1:]...)
+		delete(mgr.availableSecwaresMap, fmt.Sprintf("%d-%d", s.SecwareId, s.SecwareVersion))
+		return s, true
+	}
+	return nil, false
+}
+
+// StopSecware 停止指定的 secware project，在 RestartSecware 之前同步时不会再启动它。
+// 等待进行中的 task 时不持有 syncLock
+func (mgr *SecwareManager) StopSecware(projectName string) (*SecwareStatus, error) {
+	mgr.syncLock.Lock()
+	status, ok := mgr.removeSecware(projectName)
+	if !ok {
+		mgr.syncLock.Unlock()
+		return nil, ErrSecwareProjectNotFound
+	}
+	mgr.markDraining(status)
+	mgr.rwLock.Lock()
+	mgr.stoppedSecwares[fmt.Sprintf("%d-%d", status.SecwareId, status.SecwareVersion)] = status
+	mgr.rwLock.Unlock()
+	mgr.syncLock.Unlock()
+
+	err := mgr.drainAndDown(status)
+	if err != nil {
+		return status, err
+	}
+	mgr.logger.Infof("secware %d-%d stopped manually", status.SecwareId, status.SecwareVersion)
+	return status, nil
+}
+
+// RestartSecware 使用已下载的 compose 文件重新启动指定的 secware project，包括被手动停止的和重启失败的。
+// 重启失败时 secware 被记录为 StateFailed，直到再次启动成功
+func (mgr *SecwareManager) RestartSecware(projectName string) (*SecwareStatus, error) {
+	mgr.syncLock.Lock()
+	defer mgr.syncLock.Unlock()
+
+	status, ok := mgr.removeSecware(projectName)
+	if ok {
+		mgr.drainForRestart(status)
+	} else {
+		mgr.rwLock.Lock()
+		if mgr.drainingProjects[projectName] {
+			mgr.rwLock.Unlock()
+			return nil, ErrSecwareProjectDraining
+		}
+		for _, secwares := range []map[string]*SecwareStatus{mgr.stoppedSecwares, mgr.failedSecwares} {
+			for name, s := range secwares {
+				if s.ComposeProjectName == projectName {
+					status = s
+					delete(secwares, name)
+					break
+				}
+			}
+		}
+		mgr.rwLock.Unlock()
+		if status == nil {
+			return nil, ErrSecwareProjectNotFound
+		}
+		_, _ = mgr.DockerRunnerIntf.ComposeDown(status)
+	}
+
+	newState, err := mgr.DockerRunnerIntf.ComposeUp(status.SecwareId, status.SecwareVersion, mgr.getComposeFilePath(status.SecwareId, status.SecwareVersion))
+	if err != nil {
+		mgr.markFailed(status)
+		return status, err
+	}
+	if s := newState.GetState(); s != StateAvailable {
+		_, _ = mgr.DockerRunnerIntf.ComposeDown(newState)
+		mgr.markFailed(newState)
+		return newState, fmt.Errorf("secware is %s after restart", s)
+	}
+
+	mgr.rwLock.Lock()
+	mgr.availableSecwares = append(mgr.availableSecwares, newState)
+	mgr.availableSecwaresMap[fmt.Sprintf("%d-%d", newState.SecwareId, newState.SecwareVersion)] = newState
+	mgr.rwLock.Unlock()
+
+	mgr.logger.Infof("secware %d-%d restarted manually", newState.SecwareId, newState.SecwareVersion)
+	return newState, nil
+}
+
+// drainForRestart 等待正在运行的 secware 处理完进行中的 task 后关停，调用前需要持有 syncLock，等待时释放。
+// 在此期间 secware 被记录为已停止，同步时不会启动它，再次重启时返回 ErrSecwareProjectDraining
+func (mgr *SecwareManager) drainForRestart(status *SecwareStatus) {
+	name := fmt.Sprintf("%d-%d", status.SecwareId, status.SecwareVersion)
+	mgr.markDraining(status)
+	mgr.rwLock.Lock()
+	mgr.stoppedSecwares[name] = status
+	mgr.rwLock.Unlock()
+	mgr.syncLock.Unlock()
+
+	mgr.drainSecware(status)
+	_, _ = mgr.DockerRunnerIntf.ComposeDown(status)
+
+	mgr.syncLock.Lock()
+	mgr.rwLock.Lock()
+	delete(mgr.drainingProjects, status.ComposeProjectName)
+	if mgr.stoppedSecwares[name] == status {
+		delete(mgr.stoppedSecwares, name)
+	}
+	mgr.rwLock.Unlock()
+}
+
+// markFailed 记录重启失败的 secware，同步时仍会尝试启动它
+func (mgr *SecwareManager) markFailed(status *SecwareStatus) {
+	status.SetState(StateFailed)
+	mgr.rwLock.Lock()
+	mgr.failedSecwares[fmt.Sprintf("%d-%d", status.SecwareId, status.SecwareVersion)] = status
+	mgr.rwLock.Unlock()
+	mgr.logger.Errorf("secware %d-%d failed to restart", status.SecwareId, status.SecwareVersion)
+}
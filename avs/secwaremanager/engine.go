@@ -0,0 +1,413 @@
+// Package secwaremanager: 通过 unix socket 调用 Docker Engine API 的客户端，只包含 engine runner 用到的接口
+package secwaremanager
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// engineAPIVersion 是使用的 Docker Engine API 版本，Docker 20.10 及以上支持
+const engineAPIVersion = "v1.41"
+
+// EngineError 是 Docker Engine API 返回的错误
+type EngineError struct {
+	Method     string
+	Path       string
+	StatusCode int
+	Message    string
+}
+
+func (e *EngineError) Error() string {
+	return fmt.Sprintf("docker engine %s %s: status %d: %s", e.Method, e.Path, e.StatusCode, e.Message)
+}
+
+func isEngineStatus(err error, statusCode int) bool {
+	var engineErr *EngineError
+	return errors.As(err, &engineErr) && engineErr.StatusCode == statusCode
+}
+
+// EngineVersion 是 engine 的版本，podman 在 Components 中包含 Podman Engine
+type EngineVersion struct {
+	Version    string `json:"Version"`
+	ApiVersion string `json:"ApiVersion"`
+	Components []struct {
+		Name    string `json:"Name"`
+		Version string `json:"Version"`
+	} `json:"Components"`
+}
+
+// Component 返回组件的版本，没有这个组件时返回空字符串
+func (v *EngineVersion) Component(name string) string {
+	for _, c := range v.Components {
+		if c.Name == name {
+			return c.Version
+		}
+	}
+	return ""
+}
+
+// EngineInfo 是 engine 的系统信息
+type EngineInfo struct {
+	SecurityOptions []string `json:"SecurityOptions"`
+}
+
+// Rootless 判断 engine 是否以非 root 用户运行，docker 和 podman 都通过 name=rootless 表示
+func (i *EngineInfo) Rootless() bool {
+	for _, opt := range i.SecurityOptions {
+		if opt == "name=rootless" {
+			return true
+		}
+	}
+	return false
+}
+
+// EngineContainer 是列出容器时返回的摘要
+type EngineContainer struct {
+	Id     string            `json:"Id"`
+	Names  []string          `json:"Names"`
+	Image  string            `json:"Image"`
+	State  string            `json:"State"`
+	Labels map[string]string `json:"Labels"`
+}
+
+// EngineContainerInfo 是容器的详细信息
+type EngineContainerInfo struct {
+	Id     string `json:"Id"`
+	Name   string `json:"Name"`
+	State  EngineContainerState
+	Config struct {
+		Labels map[string]string `json:"Labels"`
+	} `json:"Config"`
+	HostConfig struct {
+		RestartPolicy engineRestartPolicy `json:"RestartPolicy"`
+	} `json:"HostConfig"`
+}
+
+// EngineContainerState 是容器的运行状态
+type EngineContainerState struct {
+	Status     string `json:"Status"` // created, running, restarting, exited, dead ...
+	Running    bool   `json:"Running"`
+	Restarting bool   `json:"Restarting"`
+	OOMKilled  bool   `json:"OOMKilled"`
+	ExitCode   int    `json:"ExitCode"`
+	Error      string `json:"Error"`
+	Health     *struct {
+		Status        string `json:"Status"` // starting, healthy, unhealthy
+		FailingStreak int    `json:"FailingStreak"`
+	} `json:"Health,omitempty"`
+}
+
+// EngineNetwork 是列出网络时返回的摘要
+type EngineNetwork struct {
+	Id     string            `json:"Id"`
+	Name   string            `json:"Name"`
+	Labels map[string]string `json:"Labels"`
+}
+
+// engineContainerSpec 是创建容器的参数
+type engineContainerSpec struct {
+	Image            string                 `json:"Image"`
+	Cmd              []string               `json:"Cmd,omitempty"`
+	Entrypoint       []string               `json:"Entrypoint,omitempty"`
+	Env              []string               `json:"Env,omitempty"`
+	User             string                 `json:"User,omitempty"`
+	WorkingDir       string                 `json:"WorkingDir,omitempty"`
+	Labels           map[string]string      `json:"Labels,omitempty"`
+	ExposedPorts     map[string]struct{}    `json:"ExposedPorts,omitempty"`
+	Volumes          map[string]struct{}    `json:"Volumes,omitempty"`
+	Healthcheck      *engineHealthConfig    `json:"Healthcheck,omitempty"`
+	HostConfig       engineHostConfig       `json:"HostConfig"`
+	NetworkingConfig engineNetworkingConfig `json:"NetworkingConfig"`
+}
+
+type engineHostConfig struct {
+	Binds         []string                       `json:"Binds,omitempty"`
+	PortBindings  map[string][]enginePortBinding `json:"PortBindings,omitempty"`
+	NanoCpus      int64                          `json:"NanoCpus,omitempty"`
+	Memory        int64                          `json:"Memory,omitempty"`
+	RestartPolicy engineRestartPolicy            `json:"RestartPolicy"`
+	NetworkMode   string                         `json:"NetworkMode,omitempty"`
+}
+
+type enginePortBinding struct {
+	HostIp   string `json:"HostIp"`
+	HostPort string `json:"HostPort"`
+}
+
+type engineRestartPolicy struct {
+	Name              string `json:"Name"`
+	MaximumRetryCount int    `json:"MaximumRetryCount,omitempty"`
+}
+
+type engineHealthConfig struct {
+	Test        []string `json:"Test"`
+	Interval    int64    `json:"Interval,omitempty"` // 纳秒
+	Timeout     int64    `json:"Timeout,omitempty"`
+	StartPeriod int64    `json:"StartPeriod,omitempty"`
+	Retries     int      `json:"Retries,omitempty"`
+}
+
+type engineNetworkingConfig struct {
+	EndpointsConfig map[string]engineEndpointConfig `json:"EndpointsConfig,omitempty"`
+}
+
+type engineEndpointConfig struct {
+	Aliases []string `json:"Aliases,omitempty"`
+}
+
+// EngineClient 通过 unix socket 调用 Docker Engine API。
+// 拉取镜像等耗时的请求没有统一的超时，由调用方通过 ctx 控制
+type EngineClient struct {
+	SocketPath string
+
+	client *http.Client
+}
+
+func NewEngineClient(socketPath string) *EngineClient {
+	transport := &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var dialer net.Dialer
+			return dialer.DialContext(ctx, "unix", socketPath)
+		},
+	}
+	return &EngineClient{
+		SocketPath: socketPath,
+		client:     &http.Client{Transport: transport},
+	}
+}
+
+// do 发送请求，返回的状态码不小于 400 时把响应转换为 EngineError
+func (c *EngineClient) do(ctx context.Context, method string, path string, query url.Values, body any) (*http.Response, error) {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	u := "http://docker/" + engineAPIVersion + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, reader)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 400 {
+		defer resp.Body.Close()
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		engineErr := &EngineError{Method: method, Path: path, StatusCode: resp.StatusCode, Message: strings.TrimSpace(string(data))}
+		var message struct {
+			Message string `json:"message"`
+		}
+		if json.Unmarshal(data, &message) == nil && message.Message != "" {
+			engineErr.Message = message.Message
+		}
+		return nil, engineErr
+	}
+	return resp, nil
+}
+
+// doJSON 发送请求并把响应解析到 out 中，out 为 nil 时丢弃响应
+func (c *EngineClient) doJSON(ctx context.Context, method string, path string, query url.Values, body any, out any) error {
+	resp, err := c.do(ctx, method, path, query, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if out == nil {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("docker engine %s %s: %w", method, path, err)
+	}
+	return nil
+}
+
+// apiVersionAtLeast 比较 major.minor 格式的 API 版本
+func apiVersionAtLeast(version string, min string) bool {
+	parse := func(v string) (int, int, bool) {
+		major, minor, ok := strings.Cut(v, ".")
+		x, err1 := strconv.Atoi(major)
+		y, err2 := strconv.Atoi(minor)
+		return x, y, ok && err1 == nil && err2 == nil
+	}
+	major, minor, ok := parse(version)
+	minMajor, minMinor, _ := parse(min)
+	return ok && (major > minMajor || (major == minMajor && minor >= minMinor))
+}
+
+func labelFilter(label string) url.Values {
+	filters, _ := json.Marshal(map[string][]string{"label": {label}})
+	return url.Values{"filters": {string(filters)}}
+}
+
+func (c *EngineClient) Version(ctx context.Context) (*EngineVersion, error) {
+	version := &EngineVersion{}
+	if err := c.doJSON(ctx, http.MethodGet, "/version", nil, nil, version); err != nil {
+		return nil, err
+	}
+	return version, nil
+}
+
+func (c *EngineClient) Info(ctx context.Context) (*EngineInfo, error) {
+	info := &EngineInfo{}
+	if err := c.doJSON(ctx, http.MethodGet, "/info", nil, nil, info); err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+// PullImage 拉取镜像。拉取的进度以 JSON 流返回，拉取失败时状态码仍然是 200，错误在流中返回
+func (c *EngineClient) PullImage(ctx context.Context, image string) error {
+	query := url.Values{"fromImage": {image}}
+	// 不指定 tag 时 engine 会拉取所有的 tag
+	if !strings.Contains(image, "@") {
+		name := image
+		tag := "latest"
+		if idx := strings.LastIndex(image, ":"); idx > strings.LastIndex(image, "/") {
+			name, tag = image[:idx], image[idx+1:]
+		}
+		query = url.Values{"fromImage": {name}, "tag": {tag}}
+	}
+
+	resp, err := c.do(ctx, http.MethodPost, "/images/create", query, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	decoder := json.NewDecoder(bufio.NewReader(resp.Body))
+	for {
+		var progress struct {
+			Error string `json:"error"`
+		}
+		err := decoder.Decode(&progress)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("docker engine pull %s: %w", image, err)
+		}
+		if progress.Error != "" {
+			return &EngineError{Method: http.MethodPost, Path: "/images/create", StatusCode: resp.StatusCode, Message: progress.Error}
+		}
+	}
+}
+
+// CreateNetwork 创建网络，同名的网络已经存在时返回状态码为 409 的 EngineError
+func (c *EngineClient) CreateNetwork(ctx context.Context, name string, labels map[string]string) error {
+	body := map[string]any{"Name": name, "Labels": labels, "CheckDuplicate": true}
+	return c.doJSON(ctx, http.MethodPost, "/networks/create", nil, body, nil)
+}
+
+// ListNetworks 列出带有 label 的网络，label 的格式为 key 或 key=value
+func (c *EngineClient) ListNetworks(ctx context.Context, label string) ([]EngineNetwork, error) {
+	var networks []EngineNetwork
+	err := c.doJSON(ctx, http.MethodGet, "/networks", labelFilter(label), nil, &networks)
+	return networks, err
+}
+
+func (c *EngineClient) RemoveNetwork(ctx context.Context, id string) error {
+	return c.doJSON(ctx, http.MethodDelete, "/networks/"+url.PathEscape(id), nil, nil, nil)
+}
+
+// CreateContainer 创建容器并返回其 id
+func (c *EngineClient) CreateContainer(ctx context.Context, name string, spec *engineContainerSpec) (string, error) {
+	var created struct {
+		Id string `json:"Id"`
+	}
+	err := c.doJSON(ctx, http.MethodPost, "/containers/create", url.Values{"name": {name}}, spec, &created)
+	return created.Id, err
+}
+
+func (c *EngineClient) StartContainer(ctx context.Context, id string) error {
+	return c.doJSON(ctx, http.MethodPost, "/containers/"+url.PathEscape(id)+"/start", nil, nil, nil)
+}
+
+// StopContainer 停止容器，超过 timeout 秒没有退出时强制停止
+func (c *EngineClient) StopContainer(ctx context.Context, id string, timeout int) error {
+	query := url.Values{"t": {strconv.Itoa(timeout)}}
+	return c.doJSON(ctx, http.MethodPost, "/containers/"+url.PathEscape(id)+"/stop", query, nil, nil)
+}
+
+func (c *EngineClient) RemoveContainer(ctx context.Context, id string) error {
+	query := url.Values{"force": {"true"}}
+	return c.doJSON(ctx, http.MethodDelete, "/containers/"+url.PathEscape(id), query, nil, nil)
+}
+
+// ListContainers 列出带有 label 的容器，包括已经退出的容器，label 的格式为 key 或 key=value
+func (c *EngineClient) ListContainers(ctx context.Context, label string) ([]EngineContainer, error) {
+	query := labelFilter(label)
+	query.Set("all", "true")
+	var containers []EngineContainer
+	err := c.doJSON(ctx, http.MethodGet, "/containers/json", query, nil, &containers)
+	return containers, err
+}
+
+func (c *EngineClient) InspectContainer(ctx context.Context, id string) (*EngineContainerInfo, error) {
+	info := &EngineContainerInfo{}
+	err := c.doJSON(ctx, http.MethodGet, "/containers/"+url.PathEscape(id)+"/json", nil, nil, info)
+	if err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+// ContainerLogs 返回容器最后 tail 行的 stdout 和 stderr
+func (c *EngineClient) ContainerLogs(ctx context.Context, id string, tail int) (string, error) {
+	query := url.Values{"stdout": {"true"}, "stderr": {"true"}, "tail": {strconv.Itoa(tail)}}
+	resp, err := c.do(ctx, http.MethodGet, "/containers/"+url.PathEscape(id)+"/logs", query, nil)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	return demuxLogs(data), nil
+}
+
+// demuxLogs 合并没有 tty 的容器的日志流。每一帧以 8 字节的头开始: 流的类型, 3 字节的 0, 4 字节的长度。
+// 不符合这个格式时认为是 tty 容器的原始输出
+func demuxLogs(data []byte) string {
+	var out strings.Builder
+	rest := data
+	for len(rest) > 0 {
+		if len(rest) < 8 || rest[0] > 2 || rest[1] != 0 || rest[2] != 0 || rest[3] != 0 {
+			return string(data)
+		}
+		size := int(binary.BigEndian.Uint32(rest[4:8]))
+		if len(rest) < 8+size {
+			return string(data)
+		}
+		out.Write(rest[8 : 8+size])
+		rest = rest[8+size:]
+	}
+	return out.String()
+}
@@ -0,0 +1,478 @@
+// Package secwaremanager: engine runner 把 compose 文件解析为创建各个容器的参数，只支持 secware 常用的字段
+package secwaremanager
+
+import (
+	"errors"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 与 docker compose 相同的 label，两种 runner 启动的 project 可以互相识别
+const (
+	composeProjectLabel       = "com.docker.compose.project"
+	composeServiceLabel       = "com.docker.compose.service"
+	composeNetworkLabel       = "com.docker.compose.network"
+	composeNumberLabel        = "com.docker.compose.container-number"
+	composeOneoffLabel        = "com.docker.compose.oneoff"
+	composeConfigFilesLabel   = "com.docker.compose.project.config_files"
+	composeWorkingDirLabel    = "com.docker.compose.project.working_dir"
+	composeDefaultNetworkName = "default"
+)
+
+// engineServiceKeys 是 engine runner 支持的 service 字段，compose 文件中有其他字段时拒绝启动
+var engineServiceKeys = map[string]bool{
+	"image":       true,
+	"command":     true,
+	"entrypoint":  true,
+	"environment": true,
+	"ports":       true,
+	"volumes":     true,
+	"user":        true,
+	"working_dir": true,
+	"restart":     true,
+	"depends_on":  true,
+	"healthcheck": true,
+	"deploy":      true, // 只使用 deploy.resources 检查资源需求和设定资源上限
+}
+
+// engineProject 是 engine runner 从 compose 文件中解析出的 project
+type engineProject struct {
+	Name          string
+	Network       string
+	NetworkLabels map[string]string
+	Services      []*engineService // 按照 depends_on 排序，被依赖的 service 在前
+}
+
+type engineService struct {
+	Name          string
+	ContainerName string
+	Spec          *engineContainerSpec
+}
+
+type engineComposeFile struct {
+	Services map[string]engineComposeService `yaml:"services"`
+	Networks map[string]struct {
+		Name string `yaml:"name"`
+	} `yaml:"networks"`
+}
+
+type engineComposeService struct {
+	Image       string              `yaml:"image"`
+	Command     composeCommand      `yaml:"command"`
+	Entrypoint  composeCommand      `yaml:"entrypoint"`
+	Environment composeEnvironment  `yaml:"environment"`
+	Ports       []string            `yaml:"ports"`
+	Volumes     []string            `yaml:"volumes"`
+	User        string              `yaml:"user"`
+	WorkingDir  string              `yaml:"working_dir"`
+	Restart     string              `yaml:"restart"`
+	DependsOn   composeDependsOn    `yaml:"depends_on"`
+	Healthcheck *composeHealthcheck `yaml:"healthcheck"`
+}
+
+// composeCommand 可以是字符串或者列表，字符串按空白分割
+type composeCommand []string
+
+func (c *composeCommand) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		*c = strings.Fields(value.Value)
+		return nil
+	}
+	var list []string
+	if err := value.Decode(&list); err != nil {
+		return err
+	}
+	*c = list
+	return nil
+}
+
+type composeEnvVar struct {
+	Name  string
+	Value *string // 为 nil 时使用启动 secware 时的同名变量
+}
+
+// composeEnvironment 可以是 KEY=VALUE 的列表或者 KEY: VALUE 的映射
+type composeEnvironment []composeEnvVar
+
+func (e *composeEnvironment) UnmarshalYAML(value *yaml.Node) error {
+	switch value.Kind {
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(value.Content); i += 2 {
+			v := &value.Content[i+1].Value
+			if value.Content[i+1].Tag == "!!null" {
+				v = nil
+			}
+			*e = append(*e, composeEnvVar{Name: value.Content[i].Value, Value: v})
+		}
+		return nil
+	case yaml.SequenceNode:
+		var list []string
+		if err := value.Decode(&list); err != nil {
+			return err
+		}
+		for _, item := range list {
+			name, v, ok := strings.Cut(item, "=")
+			if ok {
+				*e = append(*e, composeEnvVar{Name: name, Value: &v})
+			} else {
+				*e = append(*e, composeEnvVar{Name: name})
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("invalid environment at line %d", value.Line)
+}
+
+// composeDependsOn 可以是 service 的列表或者以 service 为 key 的映射
+type composeDependsOn []string
+
+func (d *composeDependsOn) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.MappingNode {
+		for i := 0; i < len(value.Content); i += 2 {
+			*d = append(*d, value.Content[i].Value)
+		}
+		return nil
+	}
+	var list []string
+	if err := value.Decode(&list); err != nil {
+		return err
+	}
+	*d = list
+	return nil
+}
+
+type composeHealthcheck struct {
+	Test        composeHealthTest `yaml:"test"`
+	Interval    string            `yaml:"interval"`
+	Timeout     string            `yaml:"timeout"`
+	StartPeriod string            `yaml:"start_period"`
+	Retries     int               `yaml:"retries"`
+	Disable     bool              `yaml:"disable"`
+}
+
+// composeHealthTest 是字符串时在 shell 中执行
+type composeHealthTest []string
+
+func (t *composeHealthTest) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		*t = []string{"CMD-SHELL", value.Value}
+		return nil
+	}
+	var list []string
+	if err := value.Decode(&list); err != nil {
+		return err
+	}
+	*t = list
+	return nil
+}
+
+// interpolate 替换 compose 文件中的变量，支持 $VAR, ${VAR}, ${VAR:-default}, ${VAR-default},
+// ${VAR:?message} 和 ${VAR?message}，$$ 表示 $。与 docker compose runner 相同，只能引用启动 secware 时的变量
+func interpolate(data string, env map[string]string) (string, error) {
+	var firstErr error
+	result := os.Expand(data, func(name string) string {
+		if name == "$" {
+			return "$"
+		}
+		for _, sep := range []string{":-", ":?", "-", "?"} {
+			key, arg, ok := strings.Cut(name, sep)
+			if !ok || strings.ContainsAny(key, ":-?") {
+				continue
+			}
+			value, set := env[key]
+			missing := !set || (strings.HasPrefix(sep, ":") && value == "")
+			if !missing {
+				return value
+			}
+			if strings.HasSuffix(sep, "?") {
+				if firstErr == nil {
+					firstErr = fmt.Errorf("variable %s is required: %s", key, arg)
+				}
+				return ""
+			}
+			return arg
+		}
+		return env[name]
+	})
+	return result, firstErr
+}
+
+// loadEngineProject 读取 compose 文件并生成 project 中各个容器的参数，env 是启动 secware 时的变量
+func loadEngineProject(composeFilePath string, projectName string, env []string) (*engineProject, error) {
+	data, err := os.ReadFile(composeFilePath)
+	if err != nil {
+		return nil, err
+	}
+
+	vars := make(map[string]string)
+	for _, item := range env {
+		name, value, _ := strings.Cut(item, "=")
+		vars[name] = value
+	}
+	content, err := interpolate(string(data), vars)
+	if err != nil {
+		return nil, err
+	}
+
+	var keys struct {
+		Services map[string]map[string]any `yaml:"services"`
+	}
+	if err := yaml.Unmarshal([]byte(content), &keys); err != nil {
+		return nil, err
+	}
+	for name, service := range keys.Services {
+		for key := range service {
+			if !engineServiceKeys[key] {
+				return nil, fmt.Errorf("service %s: %s is not supported by the engine runner", name, key)
+			}
+		}
+	}
+
+	cf := &engineComposeFile{}
+	if err := yaml.Unmarshal([]byte(content), cf); err != nil {
+		return nil, err
+	}
+	if len(cf.Services) == 0 {
+		return nil, fmt.Errorf("no services in compose file")
+	}
+
+	project := &engineProject{
+		Name:    projectName,
+		Network: projectName + "_" + composeDefaultNetworkName,
+		NetworkLabels: map[string]string{
+			composeProjectLabel: projectName,
+			composeNetworkLabel: composeDefaultNetworkName,
+		},
+	}
+	if network, ok := cf.Networks[composeDefaultNetworkName]; ok && network.Name != "" {
+		project.Network = network.Name
+	}
+
+	order, err := sortServices(cf.Services)
+	if err != nil {
+		return nil, err
+	}
+	workingDir, err := filepath.Abs(filepath.Dir(composeFilePath))
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range order {
+		spec, err := newContainerSpec(project, name, cf.Services[name], vars, workingDir)
+		if err != nil {
+			return nil, fmt.Errorf("service %s: %w", name, err)
+		}
+		spec.Labels[composeConfigFilesLabel] = composeFilePath
+		spec.Labels[composeWorkingDirLabel] = workingDir
+		project.Services = append(project.Services, &engineService{
+			Name:          name,
+			ContainerName: fmt.Sprintf("%s-%s-1", projectName, name),
+			Spec:          spec,
+		})
+	}
+	return project, nil
+}
+
+// sortServices 按照 depends_on 排序 service，被依赖的 service 在前
+func sortServices(services map[string]engineComposeService) ([]string, error) {
+	names := make([]string, 0, len(services))
+	for name := range services {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	const (
+		visiting = 1
+		visited  = 2
+	)
+	marks := make(map[string]int)
+	var order []string
+	var visit func(name string) error
+	visit = func(name string) error {
+		switch marks[name] {
+		case visiting:
+			return fmt.Errorf("circular depends_on at service %s", name)
+		case visited:
+			return nil
+		}
+		marks[name] = visiting
+		for _, dep := range services[name].DependsOn {
+			if _, ok := services[dep]; !ok {
+				return fmt.Errorf("service %s depends on undefined service %s", name, dep)
+			}
+			if err := visit(dep); err != nil {
+				return err
+			}
+		}
+		marks[name] = visited
+		order = append(order, name)
+		return nil
+	}
+	for _, name := range names {
+		if err := visit(name); err != nil {
+			return nil, err
+		}
+	}
+	return order, nil
+}
+
+func newContainerSpec(project *engineProject, name string, service engineComposeService, vars map[string]string, workingDir string) (*engineContainerSpec, error) {
+	if service.Image == "" {
+		return nil, errors.New("image is required")
+	}
+
+	spec := &engineContainerSpec{
+		Image:      service.Image,
+		Cmd:        service.Command,
+		Entrypoint: service.Entrypoint,
+		User:       service.User,
+		WorkingDir: service.WorkingDir,
+		Labels: map[string]string{
+			composeProjectLabel: project.Name,
+			composeServiceLabel: name,
+			composeNumberLabel:  "1",
+			composeOneoffLabel:  "False",
+		},
+		HostConfig: engineHostConfig{NetworkMode: project.Network},
+		NetworkingConfig: engineNetworkingConfig{
+			EndpointsConfig: map[string]engineEndpointConfig{project.Network: {Aliases: []string{name}}},
+		},
+	}
+
+	for _, v := range service.Environment {
+		if v.Value != nil {
+			spec.Env = append(spec.Env, v.Name+"="+*v.Value)
+		} else if value, ok := vars[v.Name]; ok {
+			spec.Env = append(spec.Env, v.Name+"="+value)
+		}
+	}
+
+	for _, port := range service.Ports {
+		containerPort, binding, err := parsePort(port)
+		if err != nil {
+			return nil, err
+		}
+		if spec.ExposedPorts == nil {
+			spec.ExposedPorts = make(map[string]struct{})
+			spec.HostConfig.PortBindings = make(map[string][]enginePortBinding)
+		}
+		spec.ExposedPorts[containerPort] = struct{}{}
+		spec.HostConfig.PortBindings[containerPort] = append(spec.HostConfig.PortBindings[containerPort], binding)
+	}
+
+	for _, volume := range service.Volumes {
+		parts := strings.Split(volume, ":")
+		if len(parts) == 1 {
+			if spec.Volumes == nil {
+				spec.Volumes = make(map[string]struct{})
+			}
+			spec.Volumes[parts[0]] = struct{}{}
+			continue
+		}
+		if len(parts) > 3 || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf("invalid volume %q", volume)
+		}
+		source := parts[0]
+		switch {
+		case filepath.IsAbs(source):
+		case strings.HasPrefix(source, "."):
+			source = filepath.Join(workingDir, source)
+		default:
+			// 与 docker compose 相同，命名的 volume 以 project 的名字为前缀
+			source = project.Name + "_" + source
+		}
+		parts[0] = source
+		spec.HostConfig.Binds = append(spec.HostConfig.Binds, strings.Join(parts, ":"))
+	}
+
+	restartPolicy, err := parseRestartPolicy(service.Restart)
+	if err != nil {
+		return nil, err
+	}
+	spec.HostConfig.RestartPolicy = restartPolicy
+
+	if service.Healthcheck != nil {
+		spec.Healthcheck, err = newHealthConfig(service.Healthcheck)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return spec, nil
+}
+
+// parsePort 解析短格式的端口 [[ip:]host:]container[/protocol]，没有指定本机端口时由 docker 随机分配
+func parsePort(port string) (string, enginePortBinding, error) {
+	protocol := "tcp"
+	if idx := strings.LastIndex(port, "/"); idx >= 0 {
+		port, protocol = port[:idx], port[idx+1:]
+	}
+
+	binding := enginePortBinding{}
+	parts := strings.Split(port, ":")
+	switch len(parts) {
+	case 1:
+	case 2:
+		binding.HostPort = parts[0]
+	case 3:
+		binding.HostIp, binding.HostPort = parts[0], parts[1]
+	default:
+		return "", binding, fmt.Errorf("invalid port %q", port)
+	}
+	containerPort := parts[len(parts)-1]
+	if _, err := strconv.Atoi(containerPort); err != nil {
+		return "", binding, fmt.Errorf("invalid port %q", port)
+	}
+	return containerPort + "/" + protocol, binding, nil
+}
+
+func parseRestartPolicy(restart string) (engineRestartPolicy, error) {
+	name, count, _ := strings.Cut(restart, ":")
+	switch name {
+	case "", "no":
+		return engineRestartPolicy{Name: "no"}, nil
+	case "always", "unless-stopped":
+		return engineRestartPolicy{Name: name}, nil
+	case "on-failure":
+		policy := engineRestartPolicy{Name: name}
+		if count != "" {
+			n, err := strconv.Atoi(count)
+			if err != nil {
+				return policy, fmt.Errorf("invalid restart %q", restart)
+			}
+			policy.MaximumRetryCount = n
+		}
+		return policy, nil
+	}
+	return engineRestartPolicy{}, fmt.Errorf("invalid restart %q", restart)
+}
+
+func newHealthConfig(healthcheck *composeHealthcheck) (*engineHealthConfig, error) {
+	if healthcheck.Disable {
+		return &engineHealthConfig{Test: []string{"NONE"}}, nil
+	}
+
+	config := &engineHealthConfig{Test: healthcheck.Test, Retries: healthcheck.Retries}
+	for _, d := range []struct {
+		value string
+		out   *int64
+	}{
+		{healthcheck.Interval, &config.Interval},
+		{healthcheck.Timeout, &config.Timeout},
+		{healthcheck.StartPeriod, &config.StartPeriod},
+	} {
+		if d.value == "" {
+			continue
+		}
+		duration, err := time.ParseDuration(d.value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid healthcheck duration %q", d.value)
+		}
+		*d.out = int64(duration)
+	}
+	return config, nil
+}
@@ -0,0 +1,368 @@
+// Package secwaremanager: 不依赖 docker compose 命令，通过 Docker Engine API 启停 secware 的 runner
+package secwaremanager
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"goplus/avs/config"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	engineCallTimeout    = 30 * time.Second
+	enginePullTimeout    = 10 * time.Minute
+	containerStopTimeout = 10 // 秒
+	containerLogTail     = 20
+)
+
+// ErrContainerInspectUnsupported 表示当前的 runner 无法查看 secware 的容器
+var ErrContainerInspectUnsupported = errors.New("container inspection is not supported by the secware runner")
+
+// ContainerStatus 是 secware project 中一个容器的状态
+type ContainerStatus struct {
+	Service   string `json:"service"`
+	Name      string `json:"name"`
+	State     string `json:"state"`            // created, running, restarting, exited ...
+	Health    string `json:"health,omitempty"` // 声明了 healthcheck 时为 starting, healthy 或 unhealthy
+	ExitCode  int    `json:"exit_code"`
+	OOMKilled bool   `json:"oom_killed,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// failed 判断容器是否已经退出并且不会再被重启
+func (c ContainerStatus) failed() bool {
+	return c.State == "exited" || c.State == "dead"
+}
+
+// ContainerInspectorInterface 由可以查看 secware 容器状态和日志的 runner 实现
+type ContainerInspectorInterface interface {
+	ProjectContainers(projectName string) ([]ContainerStatus, error)
+	ProjectLogs(projectName string, service string, tail int) (string, error)
+}
+
+// EngineRunnerImpl 解析 secware 的 compose 文件，通过 Docker Engine API 启停其中各个 service 的容器。
+// project 的命名、记录以及 socket 目录与 DockerRunnerImpl 相同，切换 runner 后可以继续管理已经启动的 secware
+type EngineRunnerImpl struct {
+	*DockerRunnerImpl
+
+	Engine        *EngineClient
+	QualifyImages bool // 启动前为没有 registry 的镜像补全 docker.io，podman 不会默认从 docker.io 拉取
+}
+
+func NewEngineRunnerImpl(cfg config.Config, base *DockerRunnerImpl) *EngineRunnerImpl {
+	return &EngineRunnerImpl{
+		DockerRunnerImpl: base,
+		Engine:           NewEngineClient(cfg.SecwareEngineSocket),
+	}
+}
+
+// CheckBackend 检查 engine 是否可用，并且支持 runner 使用的 API 版本
+func (e *EngineRunnerImpl) CheckBackend() (*BackendInfo, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), engineCallTimeout)
+	defer cancel()
+
+	version, err := e.Engine.Version(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("docker engine not available at %s: %w", e.Engine.SocketPath, err)
+	}
+	if !apiVersionAtLeast(version.ApiVersion, strings.TrimPrefix(engineAPIVersion, "v")) {
+		return nil, fmt.Errorf("docker engine api version %s is not supported, %s or later is required", version.ApiVersion, strings.TrimPrefix(engineAPIVersion, "v"))
+	}
+	info, err := e.Engine.Info(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	backend := &BackendInfo{Name: "docker engine", Version: version.Version, Rootless: info.Rootless()}
+	if podmanVersion := version.Component("Podman Engine"); podmanVersion != "" {
+		backend.Name, backend.Version = "podman", podmanVersion
+	}
+	return backend, nil
+}
+
+// ListAvailableSecware 从容器的 label 中获取所有 project，并检查 secware 的状态
+func (e *EngineRunnerImpl) ListAvailableSecware() ([]*SecwareStatus, error) {
+	names, err := e.listProjects()
+	if err != nil {
+		return nil, err
+	}
+	return e.listAvailable(names, e.ComposeDown)
+}
+
+func (e *EngineRunnerImpl) Reconcile() error {
+	if e.Registry == nil {
+		return nil
+	}
+
+	names, err := e.listProjects()
+	if err != nil {
+		return err
+	}
+	return e.reconcile(names, e.removeProject)
+}
+
+// listProjects 返回有容器的 project，包括容器都已经退出的 project
+func (e *EngineRunnerImpl) listProjects() ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), engineCallTimeout)
+	defer cancel()
+
+	containers, err := e.Engine.ListContainers(ctx, composeProjectLabel)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	seen := make(map[string]bool)
+	for _, c := range containers {
+		name := c.Labels[composeProjectLabel]
+		if name != "" && !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
+
+// ComposeUp 拉取镜像，按照 depends_on 的顺序创建并启动各个 service 的容器，然后等待 secware 可用。
+// 各个容器的资源上限之和不超过 ResourceProfile。启动失败时删除已经创建的容器
+func (e *EngineRunnerImpl) ComposeUp(id int, version int, composeFilePath string) (*SecwareStatus, error) {
+	if err := e.checkPublishedPorts(composeFilePath); err != nil {
+		return nil, err
+	}
+	cf, err := readComposeFile(composeFilePath)
+	if err != nil {
+		return nil, err
+	}
+	if !e.ResourceProfile.IsZero() {
+		if err := checkResourceProfile(cf, e.ResourceProfile); err != nil {
+			return nil, err
+		}
+	}
+	limits, err := serviceResourceLimits(cf, e.ResourceProfile)
+	if err != nil {
+		return nil, err
+	}
+
+	state, err := e.newSecwareStatus(id, version)
+	if err != nil {
+		return nil, err
+	}
+	project, err := loadEngineProject(composeFilePath, state.ComposeProjectName, e.composeEnv(state))
+	if err == nil {
+		err = e.startProject(project, limits)
+	}
+	if err != nil {
+		if removeErr := e.removeProject(state.ComposeProjectName); removeErr != nil {
+			e.Logger.Warnf("Failed to clean up secware project %s: %v", state.ComposeProjectName, removeErr)
+		}
+		if state.SocketPath != "" {
+			_ = os.RemoveAll(filepath.Dir(state.SocketPath))
+		}
+		return nil, err
+	}
+
+	// 等待服务完全启动，进入待命状态
+	state.SetState(e.waitForStabled(state))
+	detail := ""
+	if state.GetState() != StateAvailable {
+		detail = e.describeProject(state.ComposeProjectName)
+		e.Logger.Warnf("Secware %d-%d is %s after start: %s", id, version, state.GetState(), detail)
+	}
+	e.saveProject(state, composeFilePath, detail)
+	e.Logger.Info(fmt.Sprintf("Secware %d-%d Up Endpoint:%s", id, version, state.Endpoint()))
+	return state, nil
+}
+
+// startProject 创建并启动 project 的容器，limits 是各个 service 的资源上限
+func (e *EngineRunnerImpl) startProject(project *engineProject, limits map[string]config.ResourceProfile) error {
+	for _, service := range project.Services {
+		if e.QualifyImages {
+			service.Spec.Image = qualifyImage(service.Spec.Image)
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), enginePullTimeout)
+		err := e.Engine.PullImage(ctx, service.Spec.Image)
+		cancel()
+		if err != nil {
+			return fmt.Errorf("pull image of service %s: %w", service.Name, err)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), engineCallTimeout)
+	defer cancel()
+
+	// compose 文件指定了网络的名字时，同一个 secware 的不同 project 共用一个网络
+	err := e.Engine.CreateNetwork(ctx, project.Network, project.NetworkLabels)
+	if err != nil && !isEngineStatus(err, 409) {
+		return fmt.Errorf("create network %s: %w", project.Network, err)
+	}
+
+	for _, service := range project.Services {
+		spec := service.Spec
+		spec.HostConfig.NanoCpus = int64(limits[service.Name].CPUs * 1e9)
+		spec.HostConfig.Memory = limits[service.Name].Memory
+
+		containerId, err := e.Engine.CreateContainer(ctx, service.ContainerName, spec)
+		if err != nil {
+			return fmt.Errorf("create container of service %s: %w", service.Name, err)
+		}
+		if err := e.Engine.StartContainer(ctx, containerId); err != nil {
+			return fmt.Errorf("start container of service %s: %w", service.Name, err)
+		}
+	}
+	return nil
+}
+
+// waitForStabled 等待 secware 可用，有容器退出时不再等待
+func (e *EngineRunnerImpl) waitForStabled(status *SecwareStatus) string {
+	timeout := 10
+	var s string
+	for i := 0; i < timeout; i++ {
+		s = e.checkSecwareAvailable(status)
+		if s == StateAvailable {
+			return s
+		}
+		containers, err := e.ProjectContainers(status.ComposeProjectName)
+		if err == nil {
+			for _, c := range containers {
+				if c.failed() {
+					return s
+				}
+			}
+		}
+		time.Sleep(1 * time.Second)
+	}
+	return s
+}
+
+// describeProject 汇总 project 中异常的容器的状态和最后一行日志，用于记录 secware 不可用的原因
+func (e *EngineRunnerImpl) describeProject(projectName string) string {
+	containers, err := e.ProjectContainers(projectName)
+	if err != nil {
+		return err.Error()
+	}
+
+	var details []string
+	for _, c := range containers {
+		var detail string
+		switch {
+		case c.failed():
+			detail = fmt.Sprintf("service %s exited with code %d", c.Service, c.ExitCode)
+			if c.OOMKilled {
+				detail += " (oom killed)"
+			}
+		case c.State != "running":
+			detail = fmt.Sprintf("service %s is %s", c.Service, c.State)
+		case c.Health == "unhealthy":
+			detail = fmt.Sprintf("service %s is unhealthy", c.Service)
+		default:
+			continue
+		}
+		if c.Error != "" {
+			detail += ": " + c.Error
+		}
+		if logs, err := e.ProjectLogs(projectName, c.Service, containerLogTail); err == nil {
+			e.Logger.Warnf("Last logs of service %s in secware project %s:\n%s", c.Service, projectName, logs)
+			lines := strings.Split(strings.TrimSpace(logs), "\n")
+			if last := strings.TrimSpace(lines[len(lines)-1]); last != "" {
+				detail += ": " + last
+			}
+		}
+		details = append(details, detail)
+	}
+	return strings.Join(details, "; ")
+}
+
+// ComposeDown 停止并删除 secware project 的容器和网络
+func (e *EngineRunnerImpl) ComposeDown(status *SecwareStatus) (*SecwareStatus, error) {
+	if err := e.removeProject(status.ComposeProjectName); err != nil {
+		return nil, err
+	}
+	e.afterDown(status)
+	return status, nil
+}
+
+// removeProject 删除 project 的所有容器。网络可能仍被同一个 secware 的其他 project 使用，删除失败时只记录日志
+func (e *EngineRunnerImpl) removeProject(projectName string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), engineCallTimeout)
+	defer cancel()
+
+	label := composeProjectLabel + "=" + projectName
+	containers, err := e.Engine.ListContainers(ctx, label)
+	if err != nil {
+		return err
+	}
+	for _, c := range containers {
+		if err := e.Engine.StopContainer(ctx, c.Id, containerStopTimeout); err != nil && !isEngineStatus(err, 404) {
+			return err
+		}
+		if err := e.Engine.RemoveContainer(ctx, c.Id); err != nil && !isEngineStatus(err, 404) {
+			return err
+		}
+	}
+
+	networks, err := e.Engine.ListNetworks(ctx, label)
+	if err != nil {
+		return err
+	}
+	for _, n := range networks {
+		if err := e.Engine.RemoveNetwork(ctx, n.Id); err != nil && !isEngineStatus(err, 404) {
+			e.Logger.Warnf("Failed to remove network %s of secware project %s: %v", n.Name, projectName, err)
+		}
+	}
+	return nil
+}
+
+// ProjectContainers 返回 project 中各个容器的状态
+func (e *EngineRunnerImpl) ProjectContainers(projectName string) ([]ContainerStatus, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), engineCallTimeout)
+	defer cancel()
+
+	containers, err := e.Engine.ListContainers(ctx, composeProjectLabel+"="+projectName)
+	if err != nil {
+		return nil, err
+	}
+	if len(containers) == 0 {
+		return nil, ErrSecwareProjectNotFound
+	}
+
+	result := make([]ContainerStatus, 0, len(containers))
+	for _, c := range containers {
+		info, err := e.Engine.InspectContainer(ctx, c.Id)
+		if err != nil {
+			return nil, err
+		}
+		status := ContainerStatus{
+			Service:   info.Config.Labels[composeServiceLabel],
+			Name:      strings.TrimPrefix(info.Name, "/"),
+			State:     info.State.Status,
+			ExitCode:  info.State.ExitCode,
+			OOMKilled: info.State.OOMKilled,
+			Error:     info.State.Error,
+		}
+		if info.State.Health != nil {
+			status.Health = info.State.Health.Status
+		}
+		result = append(result, status)
+	}
+	return result, nil
+}
+
+// ProjectLogs 返回 project 中一个 service 的容器最后 tail 行的日志
+func (e *EngineRunnerImpl) ProjectLogs(projectName string, service string, tail int) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), engineCallTimeout)
+	defer cancel()
+
+	containers, err := e.Engine.ListContainers(ctx, composeProjectLabel+"="+projectName)
+	if err != nil {
+		return "", err
+	}
+	for _, c := range containers {
+		if c.Labels[composeServiceLabel] == service {
+			return e.Engine.ContainerLogs(ctx, c.Id, tail)
+		}
+	}
+	return "", ErrSecwareProjectNotFound
+}
@@ -0,0 +1,45 @@
+package secwaremanager
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"github.com/ethereum/go-ethereum/common"
+	"goplus/shared/pkg/signature"
+	"goplus/shared/pkg/types"
+	"strings"
+)
+
+// VerifyComposeFile 在使用 compose 文件之前校验其完整性:
+//   - 内容的 sha256 必须与 SecwareConfig.ComposeFileHash 一致
+//   - 如果有 Gateway 签名，签名必须来自 gatewayAddr
+//   - 所有 service 的 image 都必须以 digest 固定版本
+func VerifyComposeFile(data []byte, cfg *SecwareConfig, gatewayAddr common.Address) error {
+	if cfg.ComposeFileHash == "" {
+		return errors.New("compose file hash not provided")
+	}
+	expectHash, err := types.NewHexBytesFromString(cfg.ComposeFileHash)
+	if err != nil {
+		return fmt.Errorf("invalid compose file hash: %w", err)
+	}
+
+	actualHash := sha256.Sum256(data)
+	if !strings.EqualFold(common.Bytes2Hex(actualHash[:]), common.Bytes2Hex(expectHash)) {
+		return fmt.Errorf("compose file hash mismatch, expect %s, got 0x%x", cfg.ComposeFileHash, actualHash)
+	}
+
+	if len(cfg.ComposeFileSig) > 0 && !signature.VerifySignatureWithAddress(actualHash[:], cfg.ComposeFileSig, gatewayAddr) {
+		return errors.New("bad gateway signature of compose file")
+	}
+
+	cf, err := parseComposeFile(data)
+	if err != nil {
+		return err
+	}
+	for name, service := range cf.Services {
+		if !strings.Contains(service.Image, "@sha256:") {
+			return fmt.Errorf("image of service %s is not pinned by digest", name)
+		}
+	}
+	return nil
+}
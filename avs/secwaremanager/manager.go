@@ -9,61 +9,100 @@ import (
 	"github.com/ethereum/go-ethereum/common"
 	"goplus/avs/config"
 	"goplus/avs/metrics"
+	"goplus/shared/pkg/types"
 	"io"
 	"net/http"
 	"os"
 	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
+// drainGrace 是 task 到了截止时间后等待其释放 secware 的时间
+const drainGrace = time.Second
+
 // SecwareManager 是 AVS 后台的组织者，用于管理各个内部组件。 包括 DockerRunner 和 SecwareMonitorImpl
 type SecwareManager struct {
 	logger             logging.Logger
 	metricsIntf        metrics.AvsMetricsInterface
 	composeFileDirPath string
 	addressOperator    common.Address
+	addressGateway     common.Address
+	registry           SecwareRegistryInterface
 
 	availableSecwares    []*SecwareStatus
 	availableSecwaresMap map[string]*SecwareStatus
+	stoppedSecwares      map[string]*SecwareStatus // 被手动停止的 secware，同步时不会再启动
+	drainingProjects     map[string]bool           // 正在等待进行中的 task 结束后关停的 secware project，同步时跳过
+	failedSecwares       map[string]*SecwareStatus // 重启失败的 secware，再次启动成功之前保留，以便在管理接口中查看
+	lastSyncReport       SyncReport
 	rwLock               sync.RWMutex
 
+	lastSyncTime      atomic.Int64 // 最近一次成功同步的时间
+	lastHeartbeatTime atomic.Int64 // 最近一次成功向 Gateway 汇报健康状态的时间
+	lastMonitorTime   atomic.Int64 // monitor 最近一次执行检查的时间
+	running           atomic.Bool  // Start 的同步循环是否在运行
+
+	drainTimeout      time.Duration // 关停 secware 前等待进行中的 task 结束的最长时间
+	syncInterval      atomic.Int64  // 同步 secware 配置的间隔，可以热加载
+	heartbeatInterval atomic.Int64  // monitor 检查并汇报健康状态的间隔，可以热加载
+
+	// syncLock 保证同一时间只有一个操作在启停 secware
+	syncLock sync.Mutex
+
 	GatewayAccessorIntf GatewayAccessorInterface
 	DockerRunnerIntf    DockerRunnerInterface
 	SecwareMonitorIntf  SecwareMonitorInterface
+	SecwareAccessorIntf SecwareAccessorInterface // 和 DockerRunner、SecwareMonitorImpl 以及 server 共用连接池
 }
 
 type SecwareConfig struct {
-	SecwareId      int    `json:"id"`
-	SecwareVersion int    `json:"version"`
-	ComposeFileUrl string `json:"docker_compose_file"`
-	Name           string `json:"name"`
+	SecwareId       int            `json:"id"`
+	SecwareVersion  int            `json:"version"`
+	ComposeFileUrl  string         `json:"docker_compose_file"`
+	ComposeFileHash string         `json:"docker_compose_hash"`          // compose 文件内容的 sha256
+	ComposeFileSig  types.HexBytes `json:"docker_compose_sig,omitempty"` // Gateway 对 ComposeFileHash 的签名
+	Name            string         `json:"name"`
 }
 
-func NewSecwareManager(cfg config.Config, metrics metrics.AvsMetricsInterface) (*SecwareManager, error) {
+// registry 为 nil 时不持久化 secware project，重启后从 project 的名字恢复
+func NewSecwareManager(cfg config.Config, metrics metrics.AvsMetricsInterface, registry SecwareRegistryInterface) (*SecwareManager, error) {
 	manager := &SecwareManager{
 		logger:             cfg.Logger,
 		metricsIntf:        metrics,
 		composeFileDirPath: cfg.ComposeFilePath,
 		addressOperator:    cfg.AddressOperator,
+		addressGateway:     cfg.AddressGateway,
+		registry:           registry,
 
 		availableSecwares:    make([]*SecwareStatus, 0),
 		availableSecwaresMap: make(map[string]*SecwareStatus),
+		stoppedSecwares:      make(map[string]*SecwareStatus),
+		drainingProjects:     make(map[string]bool),
+		failedSecwares:       make(map[string]*SecwareStatus),
+		drainTimeout:         cfg.SecwareDrainTimeout,
 
 		DockerRunnerIntf:    nil,
 		SecwareMonitorIntf:  nil,
 		GatewayAccessorIntf: nil,
 	}
+	if manager.drainTimeout <= 0 {
+		manager.drainTimeout = config.DefaultSecwareDrainTimeout * time.Second
+	}
+	manager.syncInterval.Store(int64(cfg.SyncInterval))
+	manager.heartbeatInterval.Store(int64(cfg.HeartbeatInterval))
 
 	gatewayAccessor, err := NewGatewayAccessorImpl(cfg)
 	if err != nil {
 		return nil, err
 	}
-	runner, err := NewDockerRunnerImpl(cfg)
+	secwareAccessor := NewSecwareAccessorImpl(metrics)
+	runner, err := NewSecwareRunner(cfg, secwareAccessor, registry)
 	if err != nil {
 		return nil, err
 	}
-	monitor, err := NewSecwareMonitorImpl(cfg, manager, gatewayAccessor, metrics)
+	monitor, err := NewSecwareMonitorImpl(cfg, manager, gatewayAccessor, secwareAccessor, metrics)
 	if err != nil {
 		return nil, err
 	}
@@ -71,13 +110,20 @@ func NewSecwareManager(cfg config.Config, metrics metrics.AvsMetricsInterface) (
 	manager.DockerRunnerIntf = runner
 	manager.SecwareMonitorIntf = monitor
 	manager.GatewayAccessorIntf = gatewayAccessor
+	manager.SecwareAccessorIntf = secwareAccessor
 
 	return manager, nil
 }
 
 func (mgr *SecwareManager) Init() error {
 	mgr.logger.Info("Starting SecwareManager Init...")
-	err := mgr.DockerRunnerIntf.CheckDockerCompose()
+	backend, err := mgr.DockerRunnerIntf.CheckBackend()
+	if err != nil {
+		return err
+	}
+	mgr.logger.Infof("Secware runner backend: %s", backend)
+
+	err = mgr.DockerRunnerIntf.Reconcile()
 	if err != nil {
 		return err
 	}
@@ -87,7 +133,7 @@ func (mgr *SecwareManager) Init() error {
 		return err
 	}
 
-	errSecware, err := mgr.syncSecware()
+	errSecware, err := mgr.SyncSecware()
 	if err != nil {
 		return err
 	}
@@ -102,6 +148,8 @@ func (mgr *SecwareManager) Init() error {
 
 func (mgr *SecwareManager) Start(ctx context.Context) error {
 	mgr.logger.Info("SecwareManager Start")
+	mgr.running.Store(true)
+	defer mgr.running.Store(false)
 
 	monitorDone := make(chan struct{})
 	go func() {
@@ -112,7 +160,7 @@ func (mgr *SecwareManager) Start(ctx context.Context) error {
 	}()
 
 	// 启动定时器，定期同步各个 secware 的 docker compose
-	ticker := time.NewTicker(300 * time.Second)
+	ticker := time.NewTicker(mgr.GetSyncInterval())
 	defer ticker.Stop()
 
 	for {
@@ -123,12 +171,14 @@ func (mgr *SecwareManager) Start(ctx context.Context) error {
 		case <-monitorDone:
 			return errors.New("SecwareMonitorImpl is exiting with error")
 		case <-ticker.C:
-			if errSecware, err := mgr.syncSecware(); err != nil {
+			if errSecware, err := mgr.SyncSecware(); err != nil {
 				mgr.logger.Error(err.Error())
 				for _, i := range errSecware {
 					mgr.logger.Errorf("secware %d-%d failed to start", i.SecwareId, i.SecwareVersion)
 				}
 			}
+			// 同步间隔可能被热加载修改，从下一次同步开始生效
+			ticker.Reset(mgr.GetSyncInterval())
 		}
 	}
 }
@@ -159,10 +209,15 @@ func (mgr *SecwareManager) GetAvailableSecwareList() []*SecwareStatus {
 	return runningSecwares
 }
 
-func (mgr *SecwareManager) downloadComposeFile(secwareId int, secwareVersion int, composeFileUrl string) (string, error) {
+func (mgr *SecwareManager) getComposeFilePath(secwareId int, secwareVersion int) string {
+	return fmt.Sprintf("%s/%s/secware-%d-%d.yml", mgr.composeFileDirPath, mgr.addressOperator.String(), secwareId, secwareVersion)
+}
+
+// downloadComposeFile 下载 secware 的 compose 文件，校验通过后才写入磁盘
+func (mgr *SecwareManager) downloadComposeFile(cfg *SecwareConfig) (string, error) {
 	var body []byte
 	err := retry.Do(func() error {
-		req, err := http.NewRequest("GET", composeFileUrl, nil)
+		req, err := http.NewRequest("GET", cfg.ComposeFileUrl, nil)
 		if err != nil {
 			return err
 		}
@@ -173,6 +228,9 @@ func (mgr *SecwareManager) downloadComposeFile(secwareId int, secwareVersion int
 			return err
 		}
 		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("download compose file bad status code %d", resp.StatusCode)
+		}
 		body, err = io.ReadAll(resp.Body)
 		if err != nil {
 			return err
@@ -180,9 +238,22 @@ func (mgr *SecwareManager) downloadComposeFile(secwareId int, secwareVersion int
 		return nil
 
 	}, retry.Attempts(3), retry.Delay(2*time.Second))
+	if err != nil {
+		return "", err
+	}
 
-	path := fmt.Sprintf("%s/%s/secware-%d-%d.yml", mgr.composeFileDirPath, mgr.addressOperator.String(), secwareId, secwareVersion)
-	err = os.WriteFile(path, body, 0644)
+	err = VerifyComposeFile(body, cfg, mgr.getAddressGateway())
+	if err != nil {
+		return "", err
+	}
+
+	path := mgr.getComposeFilePath(cfg.SecwareId, cfg.SecwareVersion)
+	tmpPath := path + ".tmp"
+	err = os.WriteFile(tmpPath, body, 0644)
+	if err != nil {
+		return "", err
+	}
+	err = os.Rename(tmpPath, path)
 	if err != nil {
 		return "", err
 	}
@@ -190,8 +261,10 @@ func (mgr *SecwareManager) downloadComposeFile(secwareId int, secwareVersion int
 	return path, nil
 }
 
-// syncSecware 用于同步 secware docker compose 的设定
-func (mgr *SecwareManager) syncSecware() ([]SecwareConfig, error) {
+// syncSecware 用于同步 secware docker compose 的设定。
+// secware 升级时先启动新版本，新版本可用后再切换，旧版本处理完进行中的 task 后关停。
+// 新版本始终不可用时关停新版本，保留旧版本。
+func (mgr *SecwareManager) syncSecware(report *SyncReport) ([]SecwareConfig, error) {
 	secwareCfg, err := mgr.GatewayAccessorIntf.GetSecwareConfig()
 	mgr.logger.Infof("secware config length: %d", len(secwareCfg))
 
@@ -204,7 +277,16 @@ func (mgr *SecwareManager) syncSecware() ([]SecwareConfig, error) {
 		return []SecwareConfig{}, err
 	}
 
+	mgr.rwLock.RLock()
+	stoppedSecwares := make(map[string]bool)
+	for name := range mgr.stoppedSecwares {
+		stoppedSecwares[name] = true
+	}
+	mgr.rwLock.RUnlock()
+
+	secwareState = mgr.skipDrainingSecware(secwareState)
 	secwareState = mgr.downDuplicateSecware(secwareState)
+	secwareState = mgr.reuseSecwareStatus(secwareState)
 
 	secwareStateMap := make(map[string]*SecwareStatus)
 	secwareConfigMap := make(map[string]SecwareConfig)
@@ -221,13 +303,31 @@ func (mgr *SecwareManager) syncSecware() ([]SecwareConfig, error) {
 
 	var availableSecwares []*SecwareStatus
 	var errSecwares []SecwareConfig
+	// 启动失败的 secware id，其正在运行的其他版本会被保留
+	failedSecwareIds := make(map[int]bool)
+	fail := func(cfg SecwareConfig, reason string) {
+		errSecwares = append(errSecwares, cfg)
+		failedSecwareIds[cfg.SecwareId] = true
+		report.Failed = append(report.Failed, SecwareSyncError{
+			SecwareId:      cfg.SecwareId,
+			SecwareVersion: cfg.SecwareVersion,
+			Reason:         reason,
+		})
+		mgr.logger.Errorf("secware %d-%d failed to start. reason: %s", cfg.SecwareId, cfg.SecwareVersion, reason)
+	}
+
 	// 遍历所有需要使用的 secware，把还没启动的启动，已经启动的就不管
 	for name, i := range secwareConfigMap {
+		if stoppedSecwares[name] {
+			mgr.logger.Infof("secware %d-%d is stopped manually, skip it", i.SecwareId, i.SecwareVersion)
+			continue
+		}
+
 		s, ok := secwareStateMap[name]
 		isAvailable := false
 
 		// 如果所需的 secware 已经存在而且运转正常，就跳过
-		if ok && s.State == StateAvailable {
+		if ok && s.GetState() == StateAvailable {
 			isAvailable = true
 		}
 
@@ -242,28 +342,40 @@ func (mgr *SecwareManager) syncSecware() ([]SecwareConfig, error) {
 			_, _ = mgr.DockerRunnerIntf.ComposeDown(s)
 		}
 
-		composeFilePath, err := mgr.downloadComposeFile(i.SecwareId, i.SecwareVersion, i.ComposeFileUrl)
+		composeFilePath, err := mgr.downloadComposeFile(&i)
 		if err != nil {
-			mgr.logger.Errorf("secware %d-%d download compose file failed. reason: %s", i.SecwareId, i.SecwareVersion, err.Error())
+			fail(i, fmt.Sprintf("download compose file failed: %s", err.Error()))
 			continue
 		}
 
 		newState, err := mgr.DockerRunnerIntf.ComposeUp(i.SecwareId, i.SecwareVersion, composeFilePath)
 		if err != nil {
-			errSecwares = append(errSecwares, i)
-			mgr.logger.Errorf("secware %d-%d failed to start. reason: %s", i.SecwareId, i.SecwareVersion, err.Error())
+			fail(i, err.Error())
 			continue
 		}
-		if newState.State == StateAvailable {
-			availableSecwares = append(availableSecwares, newState)
+
+		// 新启动的 secware 没有通过 meta 和健康检查，回滚
+		if s := newState.GetState(); s != StateAvailable {
+			_, _ = mgr.DockerRunnerIntf.ComposeDown(newState)
+			fail(i, fmt.Sprintf("secware is %s after start, rolled back", s))
+			continue
 		}
+		availableSecwares = append(availableSecwares, newState)
 	}
 
-	// 把已经废弃的 secware 关停
+	// 不再需要的 secware，包括被新版本替换的旧版本，在切换之后关停。
+	// 新版本启动失败时，保留正在运行的旧版本
+	var retiredSecwares []*SecwareStatus
 	for name, i := range secwareStateMap {
-		if _, ok := secwareConfigMap[name]; !ok {
-			_, _ = mgr.DockerRunnerIntf.ComposeDown(i)
+		if _, ok := secwareConfigMap[name]; ok && !stoppedSecwares[name] {
+			continue
+		}
+		if failedSecwareIds[i.SecwareId] && i.GetState() == StateAvailable {
+			availableSecwares = append(availableSecwares, i)
+			mgr.logger.Infof("secware %d-%d keeps running since new version failed", i.SecwareId, i.SecwareVersion)
+			continue
 		}
+		retiredSecwares = append(retiredSecwares, i)
 	}
 
 	availableSecwaresMap := make(map[string]*SecwareStatus)
@@ -273,16 +385,29 @@ func (mgr *SecwareManager) syncSecware() ([]SecwareConfig, error) {
 	}
 
 	mgr.rwLock.Lock()
-	defer mgr.rwLock.Unlock()
 	mgr.availableSecwaresMap = availableSecwaresMap
 	mgr.availableSecwares = availableSecwares
+	for name := range availableSecwaresMap {
+		delete(mgr.failedSecwares, name)
+	}
+	mgr.rwLock.Unlock()
+
+	// 在后台等待旧版本处理完进行中的 task，不阻塞之后的同步和管理接口
+	for _, i := range retiredSecwares {
+		if mgr.markDraining(i) {
+			go func(status *SecwareStatus) {
+				_ = mgr.drainAndDown(status)
+			}(i)
+		}
+	}
 
 	mgr.metricsIntf.IncSecwareSynced()
 	return errSecwares, nil
 
 }
 
-// downDuplicateSecware 用于关闭重复的 secware
+// downDuplicateSecware 用于关闭重复的 secware，同一个版本只保留一个。
+// 同一个 secware 的不同版本可以同时运行，以便升级时不中断服务
 func (mgr *SecwareManager) downDuplicateSecware(statusList []*SecwareStatus) []*SecwareStatus {
 	copyStatusList := make([]*SecwareStatus, len(statusList))
 	copy(copyStatusList, statusList)
@@ -291,21 +416,124 @@ func (mgr *SecwareManager) downDuplicateSecware(statusList []*SecwareStatus) []*
 		return copyStatusList[i].Port < copyStatusList[j].Port
 	})
 
-	existsMap := make(map[int]bool)
+	existsMap := make(map[string]bool)
 	var newStatusList []*SecwareStatus
 	for _, i := range copyStatusList {
-		if _, ok := existsMap[i.SecwareId]; ok {
+		name := fmt.Sprintf("%d-%d", i.SecwareId, i.SecwareVersion)
+		if _, ok := existsMap[name]; ok {
 			_, _ = mgr.DockerRunnerIntf.ComposeDown(i)
 			mgr.logger.Infof("secware %d-%d is duplicated, drop it", i.SecwareId, i.SecwareVersion)
 			continue
 		}
-		existsMap[i.SecwareId] = true
+		existsMap[name] = true
 		newStatusList = append(newStatusList, i)
 	}
 
 	return newStatusList
 }
 
+// skipDrainingSecware 去掉正在关停的 secware project，它们由 drainAndDown 处理
+func (mgr *SecwareManager) skipDrainingSecware(statusList []*SecwareStatus) []*SecwareStatus {
+	mgr.rwLock.RLock()
+	defer mgr.rwLock.RUnlock()
+
+	var newStatusList []*SecwareStatus
+	for _, i := range statusList {
+		if !mgr.drainingProjects[i.ComposeProjectName] {
+			newStatusList = append(newStatusList, i)
+		}
+	}
+	return newStatusList
+}
+
+// reuseSecwareStatus 对于已经在使用中的 secware，沿用原来的 SecwareStatus，以保留其进行中的 task 计数。
+// 使用中的 SecwareStatus 会被并发读取，新的状态通过 SetState 写入
+func (mgr *SecwareManager) reuseSecwareStatus(statusList []*SecwareStatus) []*SecwareStatus {
+	mgr.rwLock.RLock()
+	defer mgr.rwLock.RUnlock()
+
+	inUse := make(map[string]*SecwareStatus)
+	for _, i := range mgr.availableSecwares {
+		inUse[i.ComposeProjectName] = i
+	}
+
+	newStatusList := make([]*SecwareStatus, len(statusList))
+	for idx, i := range statusList {
+		if s, ok := inUse[i.ComposeProjectName]; ok {
+			s.SetState(i.GetState())
+			newStatusList[idx] = s
+		} else {
+			newStatusList[idx] = i
+		}
+	}
+	return newStatusList
+}
+
+// markDraining 标记 secware project 正在关停，已经被标记时返回 false
+func (mgr *SecwareManager) markDraining(status *SecwareStatus) bool {
+	mgr.rwLock.Lock()
+	defer mgr.rwLock.Unlock()
+	if mgr.drainingProjects[status.ComposeProjectName] {
+		return false
+	}
+	mgr.drainingProjects[status.ComposeProjectName] = true
+	return true
+}
+
+// drainAndDown 等待 secware 处理完进行中的 task 后关停，调用前需要 markDraining，不需要持有 syncLock
+func (mgr *SecwareManager) drainAndDown(status *SecwareStatus) error {
+	defer func() {
+		mgr.rwLock.Lock()
+		delete(mgr.drainingProjects, status.ComposeProjectName)
+		mgr.rwLock.Unlock()
+	}()
+
+	mgr.drainSecware(status)
+	_, err := mgr.DockerRunnerIntf.ComposeDown(status)
+	return err
+}
+
+// drainSecware 等待 secware 处理完进行中的 task，最多等到进行中的 task 最晚的截止时间，并且不超过 drainTimeout
+func (mgr *SecwareManager) drainSecware(status *SecwareStatus) {
+	limit := time.Now().Add(mgr.drainTimeout)
+	for status.InFlight() > 0 {
+		deadline := time.Unix(status.lastDeadline.Load(), 0).Add(drainGrace)
+		if deadline.After(limit) {
+			deadline = limit
+		}
+		if !time.Now().Before(deadline) {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	if n := status.InFlight(); n > 0 {
+		mgr.logger.Warnf("secware %d-%d still has %d tasks in flight after drain timeout", status.SecwareId, status.SecwareVersion, n)
+	}
+}
+
+// AcquireSecware 获取可用的 secware 并增加其进行中的 task 计数，处理完 task 后需要调用 ReleaseSecware。
+// deadline 是 task 的截止时间，关停 secware 时最多等到进行中的 task 最晚的截止时间
+func (mgr *SecwareManager) AcquireSecware(secwareId int, secwareVersion int, deadline time.Time) (*SecwareStatus, error) {
+	mgr.rwLock.RLock()
+	defer mgr.rwLock.RUnlock()
+	name := fmt.Sprintf("%d-%d", secwareId, secwareVersion)
+	if s, ok := mgr.availableSecwaresMap[name]; ok {
+		for {
+			last := s.lastDeadline.Load()
+			if deadline.Unix() <= last || s.lastDeadline.CompareAndSwap(last, deadline.Unix()) {
+				break
+			}
+		}
+		s.inFlight.Add(1)
+		return s, nil
+	}
+	return nil, errors.New("secware not found")
+}
+
+func (mgr *SecwareManager) ReleaseSecware(status *SecwareStatus) {
+	status.inFlight.Add(-1)
+}
+
 func (mgr *SecwareManager) GetSecwareState(secwareId int, secwareVersion int) (*SecwareStatus, error) {
 	mgr.rwLock.RLock()
 	defer mgr.rwLock.RUnlock()
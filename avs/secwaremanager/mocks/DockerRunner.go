@@ -0,0 +1,166 @@
+// Code generated by mockery v2.45.0. DO NOT EDIT.
+
+package mocks
+
+import (
+	secwaremanager "goplus/avs/secwaremanager"
+
+	mock "github.com/stretchr/testify/mock"
+)
+
+// DockerRunner is an autogenerated mock type for the DockerRunner type
+type DockerRunner struct {
+	mock.Mock
+}
+
+// CheckBackend provides a mock function with given fields:
+func (_m *DockerRunner) CheckBackend() (*secwaremanager.BackendInfo, error) {
+	ret := _m.Called()
+
+	if len(ret) == 0 {
+		panic("no return value specified for CheckBackend")
+	}
+
+	var r0 *secwaremanager.BackendInfo
+	var r1 error
+	if rf, ok := ret.Get(0).(func() (*secwaremanager.BackendInfo, error)); ok {
+		return rf()
+	}
+	if rf, ok := ret.Get(0).(func() *secwaremanager.BackendInfo); ok {
+		r0 = rf()
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*secwaremanager.BackendInfo)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func() error); ok {
+		r1 = rf()
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// ComposeDown provides a mock function with given fields: status
+func (_m *DockerRunner) ComposeDown(status *secwaremanager.SecwareStatus) (*secwaremanager.SecwareStatus, error) {
+	ret := _m.Called(status)
+
+	if len(ret) == 0 {
+		panic("no return value specified for ComposeDown")
+	}
+
+	var r0 *secwaremanager.SecwareStatus
+	var r1 error
+	if rf, ok := ret.Get(0).(func(*secwaremanager.SecwareStatus) (*secwaremanager.SecwareStatus, error)); ok {
+		return rf(status)
+	}
+	if rf, ok := ret.Get(0).(func(*secwaremanager.SecwareStatus) *secwaremanager.SecwareStatus); ok {
+		r0 = rf(status)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*secwaremanager.SecwareStatus)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(*secwaremanager.SecwareStatus) error); ok {
+		r1 = rf(status)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// ComposeUp provides a mock function with given fields: id, version, composeFilePath
+func (_m *DockerRunner) ComposeUp(id int, version int, composeFilePath string) (*secwaremanager.SecwareStatus, error) {
+	ret := _m.Called(id, version, composeFilePath)
+
+	if len(ret) == 0 {
+		panic("no return value specified for ComposeUp")
+	}
+
+	var r0 *secwaremanager.SecwareStatus
+	var r1 error
+	if rf, ok := ret.Get(0).(func(int, int, string) (*secwaremanager.SecwareStatus, error)); ok {
+		return rf(id, version, composeFilePath)
+	}
+	if rf, ok := ret.Get(0).(func(int, int, string) *secwaremanager.SecwareStatus); ok {
+		r0 = rf(id, version, composeFilePath)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*secwaremanager.SecwareStatus)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(int, int, string) error); ok {
+		r1 = rf(id, version, composeFilePath)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// ListAvailableSecware provides a mock function with given fields:
+func (_m *DockerRunner) ListAvailableSecware() ([]*secwaremanager.SecwareStatus, error) {
+	ret := _m.Called()
+
+	if len(ret) == 0 {
+		panic("no return value specified for ListAvailableSecware")
+	}
+
+	var r0 []*secwaremanager.SecwareStatus
+	var r1 error
+	if rf, ok := ret.Get(0).(func() ([]*secwaremanager.SecwareStatus, error)); ok {
+		return rf()
+	}
+	if rf, ok := ret.Get(0).(func() []*secwaremanager.SecwareStatus); ok {
+		r0 = rf()
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]*secwaremanager.SecwareStatus)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func() error); ok {
+		r1 = rf()
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// Reconcile provides a mock function with given fields:
+func (_m *DockerRunner) Reconcile() error {
+	ret := _m.Called()
+
+	if len(ret) == 0 {
+		panic("no return value specified for Reconcile")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func() error); ok {
+		r0 = rf()
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// NewDockerRunner creates a new instance of DockerRunner. It also registers a testing interface on the mock and a cleanup function to assert the mocks expectations.
+// The first argument is typically a *testing.T value.
+func NewDockerRunner(t interface {
+	mock.TestingT
+	Cleanup(func())
+}) *DockerRunner {
+	mock := &DockerRunner{}
+	mock.Mock.Test(t)
+
+	t.Cleanup(func() { mock.AssertExpectations(t) })
+
+	return mock
+}
@@ -0,0 +1,76 @@
+// Code generated by mockery v2.45.0. DO NOT EDIT.
+
+package mocks
+
+import (
+	secwaremanager "goplus/avs/secwaremanager"
+
+	mock "github.com/stretchr/testify/mock"
+)
+
+// GatewayAccessor is an autogenerated mock type for the GatewayAccessor type
+type GatewayAccessor struct {
+	mock.Mock
+}
+
+// GetSecwareConfig provides a mock function with given fields:
+func (_m *GatewayAccessor) GetSecwareConfig() ([]secwaremanager.SecwareConfig, error) {
+	ret := _m.Called()
+
+	if len(ret) == 0 {
+		panic("no return value specified for GetSecwareConfig")
+	}
+
+	var r0 []secwaremanager.SecwareConfig
+	var r1 error
+	if rf, ok := ret.Get(0).(func() ([]secwaremanager.SecwareConfig, error)); ok {
+		return rf()
+	}
+	if rf, ok := ret.Get(0).(func() []secwaremanager.SecwareConfig); ok {
+		r0 = rf()
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]secwaremanager.SecwareConfig)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func() error); ok {
+		r1 = rf()
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// ReportHealth provides a mock function with given fields: _a0
+func (_m *GatewayAccessor) ReportHealth(_a0 []secwaremanager.SecwareHealthResult) error {
+	ret := _m.Called(_a0)
+
+	if len(ret) == 0 {
+		panic("no return value specified for ReportHealth")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func([]secwaremanager.SecwareHealthResult) error); ok {
+		r0 = rf(_a0)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// NewGatewayAccessor creates a new instance of GatewayAccessor. It also registers a testing interface on the mock and a cleanup function to assert the mocks expectations.
+// The first argument is typically a *testing.T value.
+func NewGatewayAccessor(t interface {
+	mock.TestingT
+	Cleanup(func())
+}) *GatewayAccessor {
+	mock := &GatewayAccessor{}
+	mock.Mock.Test(t)
+
+	t.Cleanup(func() { mock.AssertExpectations(t) })
+
+	return mock
+}
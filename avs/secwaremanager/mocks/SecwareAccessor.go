@@ -3,6 +3,7 @@
 package mocks
 
 import (
+	context "context"
 	secwaremanager "goplus/avs/secwaremanager"
 
 	mock "github.com/stretchr/testify/mock"
@@ -15,9 +16,14 @@ type SecwareAccessor struct {
 	mock.Mock
 }
 
-// GetSecwareHealth provides a mock function with given fields: _a0
-func (_m *SecwareAccessor) GetSecwareHealth(_a0 *secwaremanager.SecwareStatus) (secwaremanager.SecwareHealth, error) {
-	ret := _m.Called(_a0)
+// CloseConnections provides a mock function with given fields: _a0
+func (_m *SecwareAccessor) CloseConnections(_a0 *secwaremanager.SecwareStatus) {
+	_m.Called(_a0)
+}
+
+// GetSecwareHealth provides a mock function with given fields: _a0, _a1
+func (_m *SecwareAccessor) GetSecwareHealth(_a0 context.Context, _a1 *secwaremanager.SecwareStatus) (secwaremanager.SecwareHealth, error) {
+	ret := _m.Called(_a0, _a1)
 
 	if len(ret) == 0 {
 		panic("no return value specified for GetSecwareHealth")
@@ -25,17 +31,17 @@ func (_m *SecwareAccessor) GetSecwareHealth(_a0 *secwaremanager.SecwareStatus) (
 
 	var r0 secwaremanager.SecwareHealth
 	var r1 error
-	if rf, ok := ret.Get(0).(func(*secwaremanager.SecwareStatus) (secwaremanager.SecwareHealth, error)); ok {
-		return rf(_a0)
+	if rf, ok := ret.Get(0).(func(context.Context, *secwaremanager.SecwareStatus) (secwaremanager.SecwareHealth, error)); ok {
+		return rf(_a0, _a1)
 	}
-	if rf, ok := ret.Get(0).(func(*secwaremanager.SecwareStatus) secwaremanager.SecwareHealth); ok {
-		r0 = rf(_a0)
+	if rf, ok := ret.Get(0).(func(context.Context, *secwaremanager.SecwareStatus) secwaremanager.SecwareHealth); ok {
+		r0 = rf(_a0, _a1)
 	} else {
 		r0 = ret.Get(0).(secwaremanager.SecwareHealth)
 	}
 
-	if rf, ok := ret.Get(1).(func(*secwaremanager.SecwareStatus) error); ok {
-		r1 = rf(_a0)
+	if rf, ok := ret.Get(1).(func(context.Context, *secwaremanager.SecwareStatus) error); ok {
+		r1 = rf(_a0, _a1)
 	} else {
 		r1 = ret.Error(1)
 	}
@@ -43,9 +49,9 @@ func (_m *SecwareAccessor) GetSecwareHealth(_a0 *secwaremanager.SecwareStatus) (
 	return r0, r1
 }
 
-// GetSecwareMeta provides a mock function with given fields: _a0
-func (_m *SecwareAccessor) GetSecwareMeta(_a0 *secwaremanager.SecwareStatus) (secwaremanager.SecwareMeta, error) {
-	ret := _m.Called(_a0)
+// GetSecwareMeta provides a mock function with given fields: _a0, _a1
+func (_m *SecwareAccessor) GetSecwareMeta(_a0 context.Context, _a1 *secwaremanager.SecwareStatus) (secwaremanager.SecwareMeta, error) {
+	ret := _m.Called(_a0, _a1)
 
 	if len(ret) == 0 {
 		panic("no return value specified for GetSecwareMeta")
@@ -53,17 +59,17 @@ func (_m *SecwareAccessor) GetSecwareMeta(_a0 *secwaremanager.SecwareStatus) (se
 
 	var r0 secwaremanager.SecwareMeta
 	var r1 error
-	if rf, ok := ret.Get(0).(func(*secwaremanager.SecwareStatus) (secwaremanager.SecwareMeta, error)); ok {
-		return rf(_a0)
+	if rf, ok := ret.Get(0).(func(context.Context, *secwaremanager.SecwareStatus) (secwaremanager.SecwareMeta, error)); ok {
+		return rf(_a0, _a1)
 	}
-	if rf, ok := ret.Get(0).(func(*secwaremanager.SecwareStatus) secwaremanager.SecwareMeta); ok {
-		r0 = rf(_a0)
+	if rf, ok := ret.Get(0).(func(context.Context, *secwaremanager.SecwareStatus) secwaremanager.SecwareMeta); ok {
+		r0 = rf(_a0, _a1)
 	} else {
 		r0 = ret.Get(0).(secwaremanager.SecwareMeta)
 	}
 
-	if rf, ok := ret.Get(1).(func(*secwaremanager.SecwareStatus) error); ok {
-		r1 = rf(_a0)
+	if rf, ok := ret.Get(1).(func(context.Context, *secwaremanager.SecwareStatus) error); ok {
+		r1 = rf(_a0, _a1)
 	} else {
 		r1 = ret.Error(1)
 	}
@@ -71,9 +77,9 @@ func (_m *SecwareAccessor) GetSecwareMeta(_a0 *secwaremanager.SecwareStatus) (se
 	return r0, r1
 }
 
-// HandleTask provides a mock function with given fields: _a0, _a1
-func (_m *SecwareAccessor) HandleTask(_a0 *secwaremanager.SecwareStatus, _a1 *types.SignedSecwareTask) (types.SignedSecwareResult, error) {
-	ret := _m.Called(_a0, _a1)
+// HandleTask provides a mock function with given fields: _a0, _a1, _a2
+func (_m *SecwareAccessor) HandleTask(_a0 context.Context, _a1 *secwaremanager.SecwareStatus, _a2 *types.SignedSecwareTask) (types.SignedSecwareResult, error) {
+	ret := _m.Called(_a0, _a1, _a2)
 
 	if len(ret) == 0 {
 		panic("no return value specified for HandleTask")
@@ -81,17 +87,17 @@ func (_m *SecwareAccessor) HandleTask(_a0 *secwaremanager.SecwareStatus, _a1 *ty
 
 	var r0 types.SignedSecwareResult
 	var r1 error
-	if rf, ok := ret.Get(0).(func(*secwaremanager.SecwareStatus, *types.SignedSecwareTask) (types.SignedSecwareResult, error)); ok {
-		return rf(_a0, _a1)
+	if rf, ok := ret.Get(0).(func(context.Context, *secwaremanager.SecwareStatus, *types.SignedSecwareTask) (types.SignedSecwareResult, error)); ok {
+		return rf(_a0, _a1, _a2)
 	}
-	if rf, ok := ret.Get(0).(func(*secwaremanager.SecwareStatus, *types.SignedSecwareTask) types.SignedSecwareResult); ok {
-		r0 = rf(_a0, _a1)
+	if rf, ok := ret.Get(0).(func(context.Context, *secwaremanager.SecwareStatus, *types.SignedSecwareTask) types.SignedSecwareResult); ok {
+		r0 = rf(_a0, _a1, _a2)
 	} else {
 		r0 = ret.Get(0).(types.SignedSecwareResult)
 	}
 
-	if rf, ok := ret.Get(1).(func(*secwaremanager.SecwareStatus, *types.SignedSecwareTask) error); ok {
-		r1 = rf(_a0, _a1)
+	if rf, ok := ret.Get(1).(func(context.Context, *secwaremanager.SecwareStatus, *types.SignedSecwareTask) error); ok {
+		r1 = rf(_a0, _a1, _a2)
 	} else {
 		r1 = ret.Error(1)
 	}
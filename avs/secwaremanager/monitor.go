@@ -23,12 +23,12 @@ type SecwareMonitorImpl struct {
 	secwareAccessorIntf SecwareAccessorInterface
 }
 
-func NewSecwareMonitorImpl(cfg config.Config, manager *SecwareManager, gatewayAccessor *GatewayAccessorImpl, metricsIntf metrics.AvsMetricsInterface) (*SecwareMonitorImpl, error) {
+func NewSecwareMonitorImpl(cfg config.Config, manager *SecwareManager, gatewayAccessor *GatewayAccessorImpl, secwareAccessor SecwareAccessorInterface, metricsIntf metrics.AvsMetricsInterface) (*SecwareMonitorImpl, error) {
 	return &SecwareMonitorImpl{
 		logger:              cfg.Logger,
 		manager:             manager,
 		gatewayAccessorIntf: gatewayAccessor,
-		secwareAccessorIntf: &SecwareAccessorImpl{},
+		secwareAccessorIntf: secwareAccessor,
 		metricsIntf:         metricsIntf,
 	}, nil
 }
@@ -41,17 +41,19 @@ func (m *SecwareMonitorImpl) Init() error {
 func (m *SecwareMonitorImpl) Start(ctx context.Context) error {
 	m.logger.Info("SecwareMonitorImpl Start")
 
-	ticker := time.NewTicker(60 * time.Second)
+	ticker := time.NewTicker(m.manager.GetHeartbeatInterval())
 	defer ticker.Stop()
 
 	for {
-		healthyResult := m.checkRunningSecware()
+		m.manager.lastMonitorTime.Store(time.Now().Unix())
+		healthyResult := m.checkRunningSecware(ctx)
 		m.reportToGateway(healthyResult)
 		select {
 		case <-ctx.Done():
 			m.logger.Info("SecwareMonitorImpl Exit")
 			return nil
 		case <-ticker.C:
+			ticker.Reset(m.manager.GetHeartbeatInterval())
 		}
 	}
 }
@@ -63,17 +65,20 @@ type SecwareHealthResult struct {
 }
 
 // checkRunningSecware 获取所有 secware 的健康情况，返回汇总的结果。
-func (m *SecwareMonitorImpl) checkRunningSecware() []SecwareHealthResult {
+func (m *SecwareMonitorImpl) checkRunningSecware(ctx context.Context) []SecwareHealthResult {
 	availableSecwares := m.manager.GetAvailableSecwareList()
 	healthyResult := make([]SecwareHealthResult, len(availableSecwares))
 
 	// 遍历每一个 secware，查询健康情况
 	for idx, secware := range availableSecwares {
-		health, err := m.secwareAccessorIntf.GetSecwareHealth(secware)
+		checkCtx, cancel := context.WithTimeout(ctx, DefaultSecwareCallTimeout)
+		health, err := m.secwareAccessorIntf.GetSecwareHealth(checkCtx, secware)
+		cancel()
 
 		healthy := false
 		if err == nil && health.IsHealthy() {
 			healthy = true
+			secware.lastHealthTime.Store(time.Now().Unix())
 		}
 
 		result := SecwareHealthResult{
@@ -100,6 +105,7 @@ func (m *SecwareMonitorImpl) reportToGateway(results []SecwareHealthResult) {
 		m.logger.Error("Failed to report health to gateway", err)
 	} else {
 		m.metricsIntf.IncHealthReported()
+		m.manager.lastHeartbeatTime.Store(time.Now().Unix())
 		m.logger.Info("Reported health to gateway successfully")
 	}
 }
@@ -0,0 +1,47 @@
+// Package secwaremanager: 通过 rootless podman 兼容 Docker 的 API 启停 secware 的 runner，不需要把 docker socket 挂载到 AVS 中
+package secwaremanager
+
+import (
+	"fmt"
+	"goplus/avs/config"
+	"strings"
+)
+
+// PodmanRunnerImpl 与 EngineRunnerImpl 相同，通过 podman 的 socket 启停 secware 的容器。
+// rootless 的 podman 以普通用户运行，secware 和 AVS 都不会获得宿主机的 root 权限
+type PodmanRunnerImpl struct {
+	*EngineRunnerImpl
+}
+
+func NewPodmanRunnerImpl(cfg config.Config, base *DockerRunnerImpl) *PodmanRunnerImpl {
+	runner := NewEngineRunnerImpl(cfg, base)
+	runner.QualifyImages = true
+	return &PodmanRunnerImpl{EngineRunnerImpl: runner}
+}
+
+// CheckBackend 检查 socket 是否属于 podman，并且 podman 以 rootless 模式运行
+func (p *PodmanRunnerImpl) CheckBackend() (*BackendInfo, error) {
+	backend, err := p.EngineRunnerImpl.CheckBackend()
+	if err != nil {
+		return nil, err
+	}
+	if backend.Name != "podman" {
+		return nil, fmt.Errorf("%s at %s is not podman", backend.Name, p.Engine.SocketPath)
+	}
+	if !backend.Rootless {
+		return nil, fmt.Errorf("podman at %s is not running rootless", p.Engine.SocketPath)
+	}
+	return backend, nil
+}
+
+// qualifyImage 为没有 registry 的镜像补全 docker.io，与 docker 解析镜像名字的方式相同
+func qualifyImage(image string) string {
+	first, _, found := strings.Cut(image, "/")
+	if !found {
+		return "docker.io/library/" + image
+	}
+	if strings.ContainsAny(first, ".:") || first == "localhost" {
+		return image
+	}
+	return "docker.io/" + image
+}
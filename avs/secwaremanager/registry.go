@@ -0,0 +1,223 @@
+// Package secwaremanager: runner 把管理的 secware compose project 记录在 AVS 的状态中，重启后据此恢复
+package secwaremanager
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"goplus/avs/config"
+	"goplus/avs/state"
+	"os"
+	"time"
+)
+
+// registryRetention 是已停止的 secware 版本的记录保留的时间，超过后在启动时删除
+const registryRetention = 30 * 24 * time.Hour
+
+// SecwareRegistryInterface 持久化 runner 管理的 secware compose project，由 state.AvsDbState 实现
+type SecwareRegistryInterface interface {
+	SaveSecwareProject(project *state.SecwareProject) error
+	GetSecwareProject(secwareId int, secwareVersion int) (*state.SecwareProject, error)
+	ListSecwareProjects() ([]*state.SecwareProject, error)
+	DeleteSecwareProject(secwareId int, secwareVersion int) error
+}
+
+func statusFromProject(project *state.SecwareProject) *SecwareStatus {
+	status := &SecwareStatus{
+		SecwareId:          project.SecwareId,
+		SecwareVersion:     project.SecwareVersion,
+		Port:               project.Port,
+		SocketPath:         project.SocketPath,
+		ComposeProjectName: project.ProjectName,
+	}
+	status.SetState(StateRunning)
+	return status
+}
+
+// runningProjects 返回记录中正在运行的 project，key 为 project 的名字
+func (d *DockerRunnerImpl) runningProjects() (map[string]*state.SecwareProject, error) {
+	projects, err := d.Registry.ListSecwareProjects()
+	if err != nil {
+		return nil, err
+	}
+	running := make(map[string]*state.SecwareProject)
+	for _, p := range projects {
+		if p.State != StateDown {
+			running[p.ProjectName] = p
+		}
+	}
+	return running, nil
+}
+
+// Reconcile 在启动时比较记录和 docker 中的 project。
+// 有记录的 project 继续由 runner 管理，没有记录的 project 按 OrphanPolicy 接管或删除，
+// 记录为运行中但已经不存在的 project 标记为已停止
+func (d *DockerRunnerImpl) Reconcile() error {
+	if d.Registry == nil {
+		return nil
+	}
+
+	names, err := d.listComposeProjects()
+	if err != nil {
+		return err
+	}
+	return d.reconcile(names, d.composeDownProject)
+}
+
+// reconcile 根据当前存在的 project 更新记录，需要删除的 orphan 通过 down 删除
+func (d *DockerRunnerImpl) reconcile(names []string, down func(name string) error) error {
+	projects, err := d.Registry.ListSecwareProjects()
+	if err != nil {
+		return err
+	}
+
+	recorded := make(map[string]*state.SecwareProject) // key 为 <id>-<version>
+	managed := make(map[string]bool)                   // 有记录的 project 的名字
+	for _, p := range projects {
+		recorded[fmt.Sprintf("%d-%d", p.SecwareId, p.SecwareVersion)] = p
+		if p.State != StateDown {
+			managed[p.ProjectName] = true
+		}
+	}
+	existing := make(map[string]bool)
+	for _, name := range names {
+		existing[name] = true
+	}
+
+	for _, name := range names {
+		if managed[name] {
+			continue
+		}
+		status, err := d.parseProjectName(name)
+		if err != nil {
+			continue
+		}
+
+		key := fmt.Sprintf("%d-%d", status.SecwareId, status.SecwareVersion)
+		record := recorded[key]
+		duplicated := record != nil && record.State != StateDown && existing[record.ProjectName]
+		if d.OrphanPolicy == config.SecwareOrphanRemove || duplicated {
+			d.Logger.Warnf("Removing orphan secware project %s", name)
+			if err := down(name); err != nil {
+				d.Logger.Errorf("Failed to remove orphan secware project %s: %v", name, err)
+			}
+			continue
+		}
+
+		d.Logger.Warnf("Adopting orphan secware project %s", name)
+		project := &state.SecwareProject{
+			SecwareId:      status.SecwareId,
+			SecwareVersion: status.SecwareVersion,
+			ProjectName:    name,
+			Port:           status.Port,
+			SocketPath:     status.SocketPath,
+			State:          StateRunning,
+			Adopted:        true,
+			StartedAt:      time.Now().Unix(),
+		}
+		if record != nil {
+			project.RestartCount = record.RestartCount
+		}
+		if err := d.Registry.SaveSecwareProject(project); err != nil {
+			return err
+		}
+		recorded[key] = project
+	}
+
+	// 接管 orphan 时可能覆盖了同一版本的记录
+	projects, err = d.Registry.ListSecwareProjects()
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	for _, p := range projects {
+		if p.State == StateDown {
+			if now.Sub(time.Unix(p.StoppedAt, 0)) > registryRetention {
+				if err := d.Registry.DeleteSecwareProject(p.SecwareId, p.SecwareVersion); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		if existing[p.ProjectName] {
+			continue
+		}
+		d.Logger.Warnf("Secware project %s is not running, mark it down", p.ProjectName)
+		p.State = StateDown
+		p.StoppedAt = now.Unix()
+		p.LastError = "project is not running at startup"
+		if err := d.Registry.SaveSecwareProject(p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// saveProject 记录新启动的 secware，同一个版本再次启动时累加重启次数。
+// secware 不可用时 detail 是 runner 检查到的原因，可以为空
+func (d *DockerRunnerImpl) saveProject(status *SecwareStatus, composeFilePath string, detail string) {
+	if d.Registry == nil {
+		return
+	}
+
+	project := &state.SecwareProject{
+		SecwareId:       status.SecwareId,
+		SecwareVersion:  status.SecwareVersion,
+		ProjectName:     status.ComposeProjectName,
+		Port:            status.Port,
+		SocketPath:      status.SocketPath,
+		ComposeFilePath: composeFilePath,
+		State:           StateRunning,
+		StartedAt:       time.Now().Unix(),
+	}
+	if content, err := os.ReadFile(composeFilePath); err == nil {
+		hash := sha256.Sum256(content)
+		project.ComposeHash = hex.EncodeToString(hash[:])
+	}
+	if s := status.GetState(); s != StateAvailable {
+		project.LastError = fmt.Sprintf("secware is %s after start", s)
+		if detail != "" {
+			project.LastError += ": " + detail
+		}
+	}
+
+	old, err := d.Registry.GetSecwareProject(status.SecwareId, status.SecwareVersion)
+	if err == nil {
+		project.RestartCount = old.RestartCount + 1
+	} else if !errors.Is(err, state.ErrSecwareProjectNotFound) {
+		d.Logger.Warnf("Failed to read record of secware %d-%d: %v", status.SecwareId, status.SecwareVersion, err)
+	}
+
+	if err := d.Registry.SaveSecwareProject(project); err != nil {
+		d.Logger.Errorf("Failed to save record of secware project %s: %v", project.ProjectName, err)
+	}
+}
+
+// markProjectDown 记录 secware 已停止，以及停止前检查到的错误
+func (d *DockerRunnerImpl) markProjectDown(status *SecwareStatus, lastError string) {
+	if d.Registry == nil {
+		return
+	}
+
+	project, err := d.Registry.GetSecwareProject(status.SecwareId, status.SecwareVersion)
+	if err != nil {
+		if !errors.Is(err, state.ErrSecwareProjectNotFound) {
+			d.Logger.Warnf("Failed to read record of secware %d-%d: %v", status.SecwareId, status.SecwareVersion, err)
+		}
+		return
+	}
+	// 记录已经属于同一版本新启动的 project
+	if project.ProjectName != status.ComposeProjectName {
+		return
+	}
+
+	project.State = StateDown
+	project.StoppedAt = time.Now().Unix()
+	if lastError != "" {
+		project.LastError = lastError
+	}
+	if err := d.Registry.SaveSecwareProject(project); err != nil {
+		d.Logger.Errorf("Failed to save record of secware project %s: %v", project.ProjectName, err)
+	}
+}
@@ -0,0 +1,251 @@
+package secwaremanager
+
+import (
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"goplus/avs/config"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// composeFile 是 docker compose 文件中与资源和端口相关的部分
+type composeFile struct {
+	Services map[string]composeService `yaml:"services"`
+}
+
+type composeService struct {
+	Image  string `yaml:"image"`
+	Ports  []any  `yaml:"ports"`
+	Deploy struct {
+		Resources struct {
+			Limits       composeResources `yaml:"limits"`
+			Reservations composeResources `yaml:"reservations"`
+		} `yaml:"resources"`
+	} `yaml:"deploy"`
+}
+
+type composeResources struct {
+	CPUs   string `yaml:"cpus"`
+	Memory string `yaml:"memory"`
+}
+
+type resourceLimitsService struct {
+	CPUs     float64 `yaml:"cpus,omitempty"`
+	MemLimit int64   `yaml:"mem_limit,omitempty"`
+}
+
+type resourceLimitsFile struct {
+	Services map[string]resourceLimitsService `yaml:"services"`
+}
+
+func readComposeFile(composeFilePath string) (*composeFile, error) {
+	data, err := os.ReadFile(composeFilePath)
+	if err != nil {
+		return nil, err
+	}
+	return parseComposeFile(data)
+}
+
+func parseComposeFile(data []byte) (*composeFile, error) {
+	cf := &composeFile{}
+	err := yaml.Unmarshal(data, cf)
+	if err != nil {
+		return nil, err
+	}
+	if len(cf.Services) == 0 {
+		return nil, fmt.Errorf("no services in compose file")
+	}
+	return cf, nil
+}
+
+// parse 解析 service 声明的资源，没有声明的资源为 0
+func (r composeResources) parse(service string) (config.ResourceProfile, error) {
+	resources := config.ResourceProfile{}
+	if r.CPUs != "" {
+		cpus, err := strconv.ParseFloat(strings.TrimSpace(r.CPUs), 64)
+		if err != nil || cpus < 0 {
+			return config.ResourceProfile{}, fmt.Errorf("service %s: invalid cpus %q", service, r.CPUs)
+		}
+		resources.CPUs = cpus
+	}
+	if r.Memory != "" {
+		memory, err := config.ParseMemorySize(r.Memory)
+		if err != nil {
+			return config.ResourceProfile{}, fmt.Errorf("service %s: %w", service, err)
+		}
+		resources.Memory = memory
+	}
+	return resources, nil
+}
+
+// getDeclaredResources 汇总 compose 文件中各个 service 声明的资源需求 (deploy.resources.reservations)
+func getDeclaredResources(cf *composeFile) (config.ResourceProfile, error) {
+	declared := config.ResourceProfile{}
+	for name, service := range cf.Services {
+		reservations, err := service.Deploy.Resources.Reservations.parse(name)
+		if err != nil {
+			return config.ResourceProfile{}, err
+		}
+		declared.CPUs += reservations.CPUs
+		declared.Memory += reservations.Memory
+	}
+	return declared, nil
+}
+
+// checkResourceProfile 检查 secware 声明的资源需求是否超出上限，并且各个 service 的上限可以分配
+func checkResourceProfile(cf *composeFile, profile config.ResourceProfile) error {
+	declared, err := getDeclaredResources(cf)
+	if err != nil {
+		return err
+	}
+	if profile.CPUs > 0 && declared.CPUs > profile.CPUs {
+		return fmt.Errorf("secware requires %.2f cpus, exceeds node class limit %.2f", declared.CPUs, profile.CPUs)
+	}
+	if profile.Memory > 0 && declared.Memory > profile.Memory {
+		return fmt.Errorf("secware requires %d bytes memory, exceeds node class limit %d", declared.Memory, profile.Memory)
+	}
+	_, err = splitResourceProfile(cf, profile)
+	return err
+}
+
+// splitResourceProfile 把 secware project 的资源上限分给其中的各个 service，使得所有 service 的上限之和不超过 profile。
+// compose 文件中声明了 deploy.resources.limits 的 service 保留其上限，其余的 service 在各自的 reservation 之外平分剩余的资源。
+// 返回值中为 0 的资源表示不需要为该 service 设定上限
+func splitResourceProfile(cf *composeFile, profile config.ResourceProfile) (map[string]config.ResourceProfile, error) {
+	names := make([]string, 0, len(cf.Services))
+	cpuLimits, cpuReservations := make(map[string]float64), make(map[string]float64)
+	memLimits, memReservations := make(map[string]float64), make(map[string]float64)
+	for name, service := range cf.Services {
+		names = append(names, name)
+		limits, err := service.Deploy.Resources.Limits.parse(name)
+		if err != nil {
+			return nil, err
+		}
+		reservations, err := service.Deploy.Resources.Reservations.parse(name)
+		if err != nil {
+			return nil, err
+		}
+		if limits.CPUs > 0 {
+			cpuLimits[name] = limits.CPUs
+		}
+		if limits.Memory > 0 {
+			memLimits[name] = float64(limits.Memory)
+		}
+		cpuReservations[name] = reservations.CPUs
+		memReservations[name] = float64(reservations.Memory)
+	}
+	sort.Strings(names)
+
+	cpuShares, err := splitBudget("cpus", profile.CPUs, names, cpuLimits, cpuReservations)
+	if err != nil {
+		return nil, err
+	}
+	memShares, err := splitBudget("memory", float64(profile.Memory), names, memLimits, memReservations)
+	if err != nil {
+		return nil, err
+	}
+
+	split := make(map[string]config.ResourceProfile)
+	for _, name := range names {
+		split[name] = config.ResourceProfile{
+			CPUs:   math.Floor(cpuShares[name]*1000) / 1000,
+			Memory: int64(memShares[name]),
+		}
+	}
+	return split, nil
+}
+
+// serviceResourceLimits 返回各个 service 的资源上限，声明了 deploy.resources.limits 的 service 使用声明的上限，
+// 其余的 service 使用 splitResourceProfile 分到的资源。返回值中为 0 的资源表示不限制
+func serviceResourceLimits(cf *composeFile, profile config.ResourceProfile) (map[string]config.ResourceProfile, error) {
+	split, err := splitResourceProfile(cf, profile)
+	if err != nil {
+		return nil, err
+	}
+	limits := make(map[string]config.ResourceProfile)
+	for name, service := range cf.Services {
+		declared, err := service.Deploy.Resources.Limits.parse(name)
+		if err != nil {
+			return nil, err
+		}
+		resources := split[name]
+		if declared.CPUs > 0 {
+			resources.CPUs = declared.CPUs
+		}
+		if declared.Memory > 0 {
+			resources.Memory = declared.Memory
+		}
+		limits[name] = resources
+	}
+	return limits, nil
+}
+
+// splitBudget 分配一项资源，budget 为 0 时不限制
+func splitBudget(resource string, budget float64, names []string, limits map[string]float64, reservations map[string]float64) (map[string]float64, error) {
+	shares := make(map[string]float64)
+	if budget <= 0 {
+		return shares, nil
+	}
+
+	remaining := budget
+	var unlimited []string
+	for _, name := range names {
+		if limit, ok := limits[name]; ok {
+			remaining -= limit
+			continue
+		}
+		remaining -= reservations[name]
+		unlimited = append(unlimited, name)
+	}
+	if remaining < 0 {
+		return nil, fmt.Errorf("secware %s limits and reservations exceed node class limit %v", resource, budget)
+	}
+
+	for _, name := range unlimited {
+		share := reservations[name] + remaining/float64(len(unlimited))
+		if share <= 0 {
+			return nil, fmt.Errorf("no %s left for service %s within node class limit %v", resource, name, budget)
+		}
+		shares[name] = share
+	}
+	return shares, nil
+}
+
+// writeResourceLimitsFile 检查 secware 声明的资源需求是否超出上限，
+// 然后在 compose 文件旁边生成一个 override 文件，为没有声明上限的 service 设定分到的资源上限
+func writeResourceLimitsFile(composeFilePath string, profile config.ResourceProfile) (string, error) {
+	cf, err := readComposeFile(composeFilePath)
+	if err != nil {
+		return "", err
+	}
+	if err := checkResourceProfile(cf, profile); err != nil {
+		return "", err
+	}
+	split, err := splitResourceProfile(cf, profile)
+	if err != nil {
+		return "", err
+	}
+
+	limits := resourceLimitsFile{Services: make(map[string]resourceLimitsService)}
+	for name, resources := range split {
+		limits.Services[name] = resourceLimitsService{
+			CPUs:     resources.CPUs,
+			MemLimit: resources.Memory,
+		}
+	}
+
+	data, err := yaml.Marshal(limits)
+	if err != nil {
+		return "", err
+	}
+
+	overrideFilePath := strings.TrimSuffix(composeFilePath, ".yml") + ".resources.yml"
+	err = os.WriteFile(overrideFilePath, data, 0644)
+	if err != nil {
+		return "", err
+	}
+	return overrideFilePath, nil
+}
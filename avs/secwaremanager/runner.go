@@ -1,16 +1,21 @@
 package secwaremanager
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/Layr-Labs/eigensdk-go/logging"
 	"goplus/avs/config"
+	"goplus/avs/state"
 	"net"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 )
 
@@ -21,6 +26,14 @@ const (
 	StateMetaError = "MetaError"
 	StateAvailable = "Available"
 	StateUnhealthy = "Unhealthy"
+	StateFailed    = "Failed" // 通过管理接口重启失败
+)
+
+const (
+	// SecwareSocketName 是 secware 在 SECWARE_SOCKET_DIR 目录中监听的 unix socket 的文件名
+	SecwareSocketName = "secware.sock"
+
+	socketDirName = "sockets" // compose file 目录下存放各个 project 的 socket 目录的目录
 )
 
 type PortProviderInterface interface {
@@ -54,50 +67,140 @@ func (c *CommandExecutorImpl) ExecCommand(name string, arg ...string) *exec.Cmd
 type SecwareStatus struct {
 	SecwareId          int
 	SecwareVersion     int
-	Port               int
-	State              string
+	Port               int    // 通过 unix socket 访问时为 0
+	SocketPath         string // 不为空时通过 unix socket 访问 secware
 	ComposeProjectName string
+
+	state          atomic.Value // string，secware 的状态，server 和 monitor 会并发读取
+	inFlight       atomic.Int64 // 正在处理中的 task 数量
+	lastDeadline   atomic.Int64 // 交给 secware 的 task 中最晚的截止时间(unix 秒)
+	lastHealthTime atomic.Int64 // 最近一次健康检查通过的时间
+}
+
+// GetState 返回 secware 的状态，如 StateAvailable
+func (s *SecwareStatus) GetState() string {
+	state, _ := s.state.Load().(string)
+	return state
+}
+
+func (s *SecwareStatus) SetState(state string) {
+	s.state.Store(state)
+}
+
+// Endpoint 返回 secware 的访问地址，用于日志和区分连接池
+func (s *SecwareStatus) Endpoint() string {
+	if s.SocketPath != "" {
+		return "unix:" + s.SocketPath
+	}
+	return fmt.Sprintf("localhost:%d", s.Port)
+}
+
+// InFlight 返回 secware 正在处理中的 task 数量
+func (s *SecwareStatus) InFlight() int64 {
+	return s.inFlight.Load()
+}
+
+// LastHealthTime 返回最近一次健康检查通过的时间(unix 秒)，从未通过时为 0
+func (s *SecwareStatus) LastHealthTime() int64 {
+	return s.lastHealthTime.Load()
+}
+
+// BackendInfo 是 runner 使用的容器后端，由 CheckBackend 检查
+type BackendInfo struct {
+	Name     string `json:"name"` // docker compose, docker engine 或 podman
+	Version  string `json:"version"`
+	Rootless bool   `json:"rootless"`
+}
+
+func (b *BackendInfo) String() string {
+	s := fmt.Sprintf("%s %s", b.Name, b.Version)
+	if b.Rootless {
+		s += " (rootless)"
+	}
+	return s
 }
 
 type DockerRunnerInterface interface {
-	CheckDockerCompose() error
+	// CheckBackend 检查容器后端是否可用，并且具备 runner 需要的能力
+	CheckBackend() (*BackendInfo, error)
 	ListAvailableSecware() ([]*SecwareStatus, error)
 	ComposeUp(id int, version int, composeFilePath string) (*SecwareStatus, error)
 	ComposeDown(status *SecwareStatus) (*SecwareStatus, error)
+	Reconcile() error
 }
 
 // DockerRunnerImpl 处理各个 secware 对应的 docker compose 的启停
 type DockerRunnerImpl struct {
 	Logger            logging.Logger
 	ProjectNamePrefix string
+	ResourceProfile   config.ResourceProfile   // 每个 secware project 的资源上限，零值表示不限制
+	SocketDirPath     string                   // 不为空时通过 unix socket 访问 secware，每个 project 使用其中的一个子目录
+	OrphanPolicy      string                   // 启动时如何处理没有记录的 project
+	Registry          SecwareRegistryInterface // 为 nil 时不持久化，从 project 的名字恢复 secware
 
 	PortProviderIntf    PortProviderInterface
 	CommandExecutorIntf CommandExecutorInterface
 	SecwareAccessorIntf SecwareAccessorInterface
 }
 
+// ApplyConfig 更新 secware 的资源上限，调用方需要持有 SecwareManager 的 syncLock，避免和 ComposeUp 同时执行
+func (d *DockerRunnerImpl) ApplyConfig(cfg config.Config) {
+	d.ResourceProfile = cfg.SecwareResources
+}
+
 func NewDockerRunnerImpl(cfg config.Config) (*DockerRunnerImpl, error) {
-	return &DockerRunnerImpl{
+	runner := &DockerRunnerImpl{
 		Logger:              cfg.Logger,
 		ProjectNamePrefix:   "secware",
+		ResourceProfile:     cfg.SecwareResources,
+		OrphanPolicy:        cfg.SecwareOrphanPolicy,
 		PortProviderIntf:    &PortProviderImpl{},
 		CommandExecutorIntf: &CommandExecutorImpl{},
-		SecwareAccessorIntf: &SecwareAccessorImpl{},
-	}, nil
+		SecwareAccessorIntf: NewSecwareAccessorImpl(nil),
+	}
+	// compose file 目录在 AVS 容器和宿主机上的路径相同，secware 容器可以直接挂载其中的目录
+	if cfg.SecwareTransport == config.SecwareTransportUnix {
+		runner.SocketDirPath = filepath.Join(cfg.ComposeFilePath, socketDirName)
+	}
+	return runner, nil
 }
 
-func (d *DockerRunnerImpl) CheckDockerCompose() error {
-	cmd := exec.Command("docker", "compose", "version")
-	_, err := cmd.Output()
+// NewSecwareRunner 根据配置创建启停 secware 的 runner，registry 为 nil 时不持久化 secware project
+func NewSecwareRunner(cfg config.Config, secwareAccessor SecwareAccessorInterface, registry SecwareRegistryInterface) (DockerRunnerInterface, error) {
+	runner, err := NewDockerRunnerImpl(cfg)
 	if err != nil {
-		return errors.New("docker compose not found")
+		return nil, err
+	}
+	runner.SecwareAccessorIntf = secwareAccessor
+	runner.Registry = registry
+
+	switch cfg.SecwareRunner {
+	case config.SecwareRunnerEngine:
+		return NewEngineRunnerImpl(cfg, runner), nil
+	case config.SecwareRunnerPodman:
+		return NewPodmanRunnerImpl(cfg, runner), nil
 	}
+	return runner, nil
+}
 
-	return nil
+// CheckBackend 检查 docker compose 命令，runner 使用的 ls --format json 需要 v2 及以上的版本
+func (d *DockerRunnerImpl) CheckBackend() (*BackendInfo, error) {
+	cmd := d.CommandExecutorIntf.ExecCommand("docker", "compose", "version", "--short")
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, errors.New("docker compose not found")
+	}
+
+	version := strings.TrimPrefix(strings.TrimSpace(string(out)), "v")
+	major, _, _ := strings.Cut(version, ".")
+	if n, err := strconv.Atoi(major); err != nil || n < 2 {
+		return nil, fmt.Errorf("docker compose %s is not supported, v2 or later is required", version)
+	}
+	return &BackendInfo{Name: "docker compose", Version: version}, nil
 }
 
 // secware project 的名字有特定的规范，使得其不仅仅是标识，还可以被解析为单独的字段
-// <project_name>-<id>_<version>_<http_port>
+// <project_name>-<id>_<version>_<http_port>，通过 unix socket 访问的 secware 的端口为 0
 func (d *DockerRunnerImpl) getProjectName(id int, version int, port int) string {
 	name := fmt.Sprintf("%s-%d-%d-%d", d.ProjectNamePrefix, id, version, port)
 	return name
@@ -132,23 +235,30 @@ func (d *DockerRunnerImpl) parseProjectName(name string) (*SecwareStatus, error)
 		SecwareId:          checkerId,
 		SecwareVersion:     checkerVersion,
 		Port:               port,
-		State:              StateRunning,
 		ComposeProjectName: name,
 	}
+	state.SetState(StateRunning)
+	// 切换为 tcp 后，之前通过 unix socket 启动的 secware 无法访问，会被当作不可用的 secware 关闭
+	if port == 0 && d.SocketDirPath != "" {
+		state.SocketPath = d.getSocketPath(name)
+	}
 
 	return &state, nil
 }
 
 // checkSecwareAvailable 通过调用 secware 的一个简单接口来检测其是否可用
 func (d *DockerRunnerImpl) checkSecwareAvailable(status *SecwareStatus) string {
-	meta, err := d.SecwareAccessorIntf.GetSecwareMeta(status)
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultSecwareCallTimeout)
+	defer cancel()
+
+	meta, err := d.SecwareAccessorIntf.GetSecwareMeta(ctx, status)
 	if err != nil {
 		return StateUnknown
 	}
 	if meta.SecwareId != status.SecwareId || meta.SecwareVersion != status.SecwareVersion {
 		return StateMetaError
 	}
-	health, err := d.SecwareAccessorIntf.GetSecwareHealth(status)
+	health, err := d.SecwareAccessorIntf.GetSecwareHealth(ctx, status)
 	if err != nil {
 		return StateUnknown
 	}
@@ -160,10 +270,55 @@ func (d *DockerRunnerImpl) checkSecwareAvailable(status *SecwareStatus) string {
 
 // ListSecware 使用 docker compose 命令获取当前所有运行的Secware, 并检查其状态
 func (d *DockerRunnerImpl) ListAvailableSecware() ([]*SecwareStatus, error) {
+	names, err := d.listComposeProjects()
+	if err != nil {
+		return nil, err
+	}
+	return d.listAvailable(names, d.ComposeDown)
+}
 
+// listAvailable 从 project 的名字中恢复 secware 并检查其状态，不可用的 secware 通过 down 关停
+func (d *DockerRunnerImpl) listAvailable(names []string, down func(*SecwareStatus) (*SecwareStatus, error)) ([]*SecwareStatus, error) {
+	var err error
+	// 有记录时只恢复记录中的 project，没有记录的 project 已经在 Reconcile 中处理
+	var running map[string]*state.SecwareProject
+	if d.Registry != nil {
+		running, err = d.runningProjects()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var secwareStatus []*SecwareStatus
+	for _, name := range names {
+		if running != nil {
+			if project, ok := running[name]; ok {
+				secwareStatus = append(secwareStatus, statusFromProject(project))
+			}
+			continue
+		}
+		state, err := d.parseProjectName(name)
+		if err != nil {
+			continue
+		}
+		secwareStatus = append(secwareStatus, state)
+	}
+
+	for _, s := range secwareStatus {
+		// 关停前记录检查到的状态，ComposeDown 据此记录停止的原因
+		s.SetState(d.checkSecwareAvailable(s))
+		if s.GetState() != StateAvailable {
+			_, _ = down(s)
+		}
+	}
+
+	return secwareStatus, nil
+}
+
+// listComposeProjects 返回 docker 中所有 compose project 的名字
+func (d *DockerRunnerImpl) listComposeProjects() ([]string, error) {
 	cmd := d.CommandExecutorIntf.ExecCommand("docker", "compose", "ls", "--format", "json")
 	out, err := cmd.Output()
-
 	if err != nil {
 		return nil, err
 	}
@@ -178,47 +333,45 @@ func (d *DockerRunnerImpl) ListAvailableSecware() ([]*SecwareStatus, error) {
 		return nil, err
 	}
 
-	var secwareStatus []*SecwareStatus
+	var names []string
 	for _, status := range dockerComposeStatus {
-		state, err := d.parseProjectName(status.Name)
-		if err != nil {
-			continue
-		}
-		secwareStatus = append(secwareStatus, state)
-	}
-
-	for _, s := range secwareStatus {
-		state := d.checkSecwareAvailable(s)
-		if state != StateAvailable {
-			_, _ = d.ComposeDown(s)
-		} else {
-			s.State = state
-		}
+		names = append(names, status.Name)
 	}
+	return names, nil
+}
 
-	return secwareStatus, nil
+func (d *DockerRunnerImpl) composeDownProject(name string) error {
+	cmd := d.CommandExecutorIntf.ExecCommand("docker", "compose", "-p", name, "down")
+	_, err := cmd.Output()
+	return err
 }
 
 // ComposeUp 启动Secware, 并等待其可用
 func (d *DockerRunnerImpl) ComposeUp(id int, version int, composeFilePath string) (*SecwareStatus, error) {
-	cmd := d.CommandExecutorIntf.ExecCommand("docker", "compose", "-f", composeFilePath, "pull")
+	if err := d.checkPublishedPorts(composeFilePath); err != nil {
+		return nil, err
+	}
+	composeFileArgs, err := d.getComposeFileArgs(composeFilePath)
+	if err != nil {
+		return nil, err
+	}
+
+	cmd := d.CommandExecutorIntf.ExecCommand("docker", append(append([]string{"compose"}, composeFileArgs...), "pull")...)
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
 
-	err := cmd.Run()
+	err = cmd.Run()
 	if err != nil {
 		return nil, err
 	}
 
-	port, err := d.PortProviderIntf.GetAvailablePort()
+	state, err := d.newSecwareStatus(id, version)
 	if err != nil {
 		return nil, err
 	}
-	projectName := d.getProjectName(id, version, port)
 
-	cmd = d.CommandExecutorIntf.ExecCommand("docker", "compose", "-f", composeFilePath, "up", "-d")
-	cmd.Env = append(cmd.Env, fmt.Sprintf("SECWARE_PORT=%s:%d", "127.0.0.1", port))
-	cmd.Env = append(cmd.Env, fmt.Sprintf("COMPOSE_PROJECT_NAME=%s", projectName))
+	cmd = d.CommandExecutorIntf.ExecCommand("docker", append(append([]string{"compose"}, composeFileArgs...), "up", "-d")...)
+	cmd.Env = append(cmd.Env, d.composeEnv(state)...)
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
 
@@ -227,18 +380,111 @@ func (d *DockerRunnerImpl) ComposeUp(id int, version int, composeFilePath string
 		return nil, err
 	}
 
-	state := &SecwareStatus{
+	// 等待服务完全启动，进入待命状态
+	state.SetState(d.waitForStabled(state))
+	d.saveProject(state, composeFilePath, "")
+	d.Logger.Info(fmt.Sprintf("Secware %d-%d Up Endpoint:%s", id, version, state.Endpoint()))
+	return state, nil
+}
+
+// newSecwareStatus 为即将启动的 secware 分配访问地址，通过 unix socket 访问时同时准备好 socket 目录
+func (d *DockerRunnerImpl) newSecwareStatus(id int, version int) (*SecwareStatus, error) {
+	// 通过 unix socket 访问时不再分配端口
+	port := 0
+	if d.SocketDirPath == "" {
+		var err error
+		port, err = d.PortProviderIntf.GetAvailablePort()
+		if err != nil {
+			return nil, err
+		}
+	}
+	projectName := d.getProjectName(id, version, port)
+
+	socketPath := ""
+	if d.SocketDirPath != "" {
+		socketPath = d.getSocketPath(projectName)
+		if err := prepareSocketDir(filepath.Dir(socketPath)); err != nil {
+			return nil, err
+		}
+	}
+
+	status := &SecwareStatus{
 		SecwareId:          id,
 		SecwareVersion:     version,
 		Port:               port,
-		State:              StateRunning,
+		SocketPath:         socketPath,
 		ComposeProjectName: projectName,
 	}
+	status.SetState(StateRunning)
+	return status, nil
+}
 
-	// 等待服务完全启动，进入待命状态
-	state.State = d.waitForStabled(state)
-	d.Logger.Info(fmt.Sprintf("Secware %d-%d Up Port:%d", id, version, port))
-	return state, nil
+// composeEnv 返回启动 secware 时 compose 文件可以引用的变量，通过 unix socket 访问时没有 SECWARE_PORT
+func (d *DockerRunnerImpl) composeEnv(status *SecwareStatus) []string {
+	env := []string{fmt.Sprintf("COMPOSE_PROJECT_NAME=%s", status.ComposeProjectName)}
+	if status.Port != 0 {
+		env = append(env, fmt.Sprintf("SECWARE_PORT=%s:%d", "127.0.0.1", status.Port))
+	}
+	if status.SocketPath != "" {
+		env = append(env, fmt.Sprintf("SECWARE_SOCKET_DIR=%s", filepath.Dir(status.SocketPath)))
+	}
+	return env
+}
+
+// checkPublishedPorts 通过 unix socket 访问 secware 时拒绝发布端口的 compose 文件，secware 只能通过 socket 访问
+func (d *DockerRunnerImpl) checkPublishedPorts(composeFilePath string) error {
+	if d.SocketDirPath == "" {
+		return nil
+	}
+	cf, err := readComposeFile(composeFilePath)
+	if err != nil {
+		return err
+	}
+	names := make([]string, 0, len(cf.Services))
+	for name := range cf.Services {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if len(cf.Services[name].Ports) > 0 {
+			return fmt.Errorf("service %s publishes ports, which is not allowed with unix socket transport", name)
+		}
+	}
+	return nil
+}
+
+func (d *DockerRunnerImpl) getSocketPath(projectName string) string {
+	return filepath.Join(d.SocketDirPath, projectName, SecwareSocketName)
+}
+
+// prepareSocketDir 创建 project 的 socket 目录，并删除上次运行留下的 socket。
+// 上层目录只允许 AVS 访问，project 的目录挂载到容器中，需要允许容器中的任何用户创建 socket
+func prepareSocketDir(dir string) error {
+	if err := os.MkdirAll(filepath.Dir(dir), 0700); err != nil {
+		return err
+	}
+	if err := os.RemoveAll(dir); err != nil {
+		return err
+	}
+	if err := os.Mkdir(dir, 0777); err != nil {
+		return err
+	}
+	return os.Chmod(dir, 0777)
+}
+
+// getComposeFileArgs 生成 docker compose 的 -f 参数。
+// 设定了资源上限时，检查 secware 声明的资源需求，并生成限制资源的 override 文件
+func (d *DockerRunnerImpl) getComposeFileArgs(composeFilePath string) ([]string, error) {
+	args := []string{"-f", composeFilePath}
+	if d.ResourceProfile.IsZero() {
+		return args, nil
+	}
+
+	overrideFilePath, err := writeResourceLimitsFile(composeFilePath, d.ResourceProfile)
+	if err != nil {
+		return nil, err
+	}
+	return append(args, "-f", overrideFilePath), nil
 }
 
 func (d *DockerRunnerImpl) waitForStabled(status *SecwareStatus) string {
@@ -256,13 +502,26 @@ func (d *DockerRunnerImpl) waitForStabled(status *SecwareStatus) string {
 
 // ComposeDown 关闭Secware, 不检查其是否存在直接关闭
 func (d *DockerRunnerImpl) ComposeDown(status *SecwareStatus) (*SecwareStatus, error) {
-	cmd := d.CommandExecutorIntf.ExecCommand("docker", "compose", "-p", status.ComposeProjectName, "down")
-	_, err := cmd.Output()
-	if err != nil {
+	if err := d.composeDownProject(status.ComposeProjectName); err != nil {
 		return nil, err
 	}
-
-	status.State = StateDown
-	d.Logger.Info(fmt.Sprintf("Secware %d-%d Down Port:%d", status.SecwareId, status.SecwareVersion, status.Port))
+	d.afterDown(status)
 	return status, nil
 }
+
+// afterDown 在 secware 的 project 删除后更新记录，并释放其连接和 socket 目录
+func (d *DockerRunnerImpl) afterDown(status *SecwareStatus) {
+	lastError := ""
+	if s := status.GetState(); s != StateAvailable && s != StateRunning {
+		lastError = fmt.Sprintf("secware is %s", s)
+	}
+	status.SetState(StateDown)
+	d.markProjectDown(status, lastError)
+	d.SecwareAccessorIntf.CloseConnections(status)
+	if status.SocketPath != "" {
+		if err := os.RemoveAll(filepath.Dir(status.SocketPath)); err != nil {
+			d.Logger.Warnf("Failed to remove socket dir of secware %d-%d: %v", status.SecwareId, status.SecwareVersion, err)
+		}
+	}
+	d.Logger.Info(fmt.Sprintf("Secware %d-%d Down Endpoint:%s", status.SecwareId, status.SecwareVersion, status.Endpoint()))
+}
@@ -2,18 +2,23 @@ package tests
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"goplus/avs/secwaremanager"
 	"goplus/shared/pkg/types"
 	"net"
 	"net/http"
 	"net/http/httptest"
+	"path/filepath"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 func newSecwareAccessorImpl() *secwaremanager.SecwareAccessorImpl {
-	return &secwaremanager.SecwareAccessorImpl{}
+	return secwaremanager.NewSecwareAccessorImpl(nil)
 }
 
 func TestSecwareAccessorImpl_HandleTask(t *testing.T) {
@@ -68,12 +73,12 @@ func TestSecwareAccessorImpl_HandleTask(t *testing.T) {
 		SecwareId:          1,
 		SecwareVersion:     1,
 		Port:               testServerPort,
-		State:              "Available",
 		ComposeProjectName: fmt.Sprintf("testsecware-%d-%d-%d", 1, 1, testServerPort),
 	}
+	mockState.SetState("Available")
 
 	sa := newSecwareAccessorImpl()
-	result, err := sa.HandleTask(&mockState, &signTask)
+	result, err := sa.HandleTask(context.Background(), &mockState, &signTask)
 	if err != nil {
 		t.Errorf("HandleTask() error = %v", err)
 		return
@@ -87,3 +92,129 @@ func TestSecwareAccessorImpl_HandleTask(t *testing.T) {
 		t.Errorf("HandleTask() = %v, want %v", result.SigSecware, sigSecware)
 	}
 }
+
+func newTestSecwareStatus(server *httptest.Server) *secwaremanager.SecwareStatus {
+	port := server.Listener.Addr().(*net.TCPAddr).Port
+	status := &secwaremanager.SecwareStatus{
+		SecwareId:          1,
+		SecwareVersion:     1,
+		Port:               port,
+		ComposeProjectName: fmt.Sprintf("testsecware-%d-%d-%d", 1, 1, port),
+	}
+	status.SetState("Available")
+	return status
+}
+
+func TestSecwareAccessorImpl_Errors(t *testing.T) {
+	testSecware := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/health":
+			w.WriteHeader(http.StatusServiceUnavailable)
+			fmt.Fprintln(w, "starting")
+		case "/meta":
+			fmt.Fprintln(w, "not json")
+		}
+	}))
+	defer testSecware.Close()
+
+	sa := newSecwareAccessorImpl()
+	state := newTestSecwareStatus(testSecware)
+
+	_, err := sa.GetSecwareHealth(context.Background(), state)
+	var statusErr *secwaremanager.SecwareStatusError
+	if !errors.As(err, &statusErr) {
+		t.Fatalf("expect SecwareStatusError, got %v", err)
+	}
+	if statusErr.StatusCode != http.StatusServiceUnavailable || statusErr.Body != "starting" {
+		t.Errorf("unexpected status error %#v", statusErr)
+	}
+
+	_, err = sa.GetSecwareMeta(context.Background(), state)
+	var decodeErr *secwaremanager.SecwareDecodeError
+	if !errors.As(err, &decodeErr) {
+		t.Fatalf("expect SecwareDecodeError, got %v", err)
+	}
+}
+
+func TestSecwareAccessorImpl_KeepAlive(t *testing.T) {
+	testSecware := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, `{"health": true}`)
+	}))
+	var newConns atomic.Int32
+	testSecware.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			newConns.Add(1)
+		}
+	}
+	testSecware.Start()
+	defer testSecware.Close()
+
+	sa := newSecwareAccessorImpl()
+	state := newTestSecwareStatus(testSecware)
+	for i := 0; i < 3; i++ {
+		health, err := sa.GetSecwareHealth(context.Background(), state)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !health.IsHealthy() {
+			t.Fatal("expect secware to be healthy")
+		}
+	}
+	if n := newConns.Load(); n != 1 {
+		t.Errorf("expect 1 connection to be reused, got %d connections", n)
+	}
+
+	sa.CloseConnections(state)
+	if _, err := sa.GetSecwareHealth(context.Background(), state); err != nil {
+		t.Fatal(err)
+	}
+	if n := newConns.Load(); n != 2 {
+		t.Errorf("expect a new connection after CloseConnections, got %d connections", n)
+	}
+}
+
+func TestSecwareAccessorImpl_Context(t *testing.T) {
+	testSecware := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(3 * time.Second):
+		}
+	}))
+	defer testSecware.Close()
+
+	sa := newSecwareAccessorImpl()
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := sa.HandleTask(ctx, newTestSecwareStatus(testSecware), &types.SignedSecwareTask{})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expect context.DeadlineExceeded, got %v", err)
+	}
+	if time.Since(start) > time.Second {
+		t.Fatal("expect HandleTask to return when ctx is done")
+	}
+}
+
+func TestSecwareAccessorImpl_UnixSocket(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), secwaremanager.SecwareSocketName)
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testSecware := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, `{"secware_id": 1, "secware_version": 2}`)
+	}))
+	testSecware.Listener = listener
+	testSecware.Start()
+	defer testSecware.Close()
+
+	sa := newSecwareAccessorImpl()
+	meta, err := sa.GetSecwareMeta(context.Background(), &secwaremanager.SecwareStatus{SecwareId: 1, SecwareVersion: 2, SocketPath: socketPath})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if meta.SecwareId != 1 || meta.SecwareVersion != 2 {
+		t.Errorf("unexpected meta %+v", meta)
+	}
+}
@@ -0,0 +1,604 @@
+package tests
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/stretchr/testify/mock"
+	"goplus/avs/config"
+	mgr "goplus/avs/secwaremanager"
+	"goplus/avs/secwaremanager/mocks"
+	"goplus/avs/state"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+type fakeContainerSpec struct {
+	Image       string
+	Env         []string
+	Labels      map[string]string
+	Healthcheck *struct {
+		Test []string
+	}
+	HostConfig struct {
+		Binds        []string
+		PortBindings map[string][]struct {
+			HostIp   string
+			HostPort string
+		}
+		NanoCpus      int64
+		Memory        int64
+		NetworkMode   string
+		RestartPolicy struct {
+			Name string
+		}
+	}
+}
+
+type fakeContainer struct {
+	Id       string
+	Name     string
+	Spec     fakeContainerSpec
+	State    string
+	ExitCode int
+}
+
+// fakeEngine 在内存中模拟 engine runner 用到的 Docker Engine API
+type fakeEngine struct {
+	lock       sync.Mutex
+	pulled     []string
+	networks   map[string]map[string]string // 网络的名字 -> label
+	containers map[string]*fakeContainer
+	created    []string // 按创建顺序排列的容器名字
+
+	apiVersion string // 为空时为 1.43
+	podman     bool   // 在 /version 中返回 Podman Engine
+	rootless   bool
+
+	pullError string         // 不为空时拉取镜像失败
+	exitCodes map[string]int // service -> 启动后立即退出的退出码
+	logs      string
+}
+
+func newFakeEngine(t *testing.T) (*fakeEngine, string) {
+	engine := &fakeEngine{
+		networks:   make(map[string]map[string]string),
+		containers: make(map[string]*fakeContainer),
+		exitCodes:  make(map[string]int),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /v1.41/version", engine.version)
+	mux.HandleFunc("GET /v1.41/info", engine.info)
+	mux.HandleFunc("POST /v1.41/images/create", engine.pullImage)
+	mux.HandleFunc("POST /v1.41/networks/create", engine.createNetwork)
+	mux.HandleFunc("GET /v1.41/networks", engine.listNetworks)
+	mux.HandleFunc("DELETE /v1.41/networks/{id}", engine.removeNetwork)
+	mux.HandleFunc("POST /v1.41/containers/create", engine.createContainer)
+	mux.HandleFunc("GET /v1.41/containers/json", engine.listContainers)
+	mux.HandleFunc("POST /v1.41/containers/{id}/start", engine.startContainer)
+	mux.HandleFunc("POST /v1.41/containers/{id}/stop", engine.stopContainer)
+	mux.HandleFunc("DELETE /v1.41/containers/{id}", engine.removeContainer)
+	mux.HandleFunc("GET /v1.41/containers/{id}/json", engine.inspectContainer)
+	mux.HandleFunc("GET /v1.41/containers/{id}/logs", engine.containerLogs)
+
+	socketPath := filepath.Join(t.TempDir(), "docker.sock")
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewUnstartedServer(mux)
+	server.Listener = listener
+	server.Start()
+	t.Cleanup(server.Close)
+	return engine, socketPath
+}
+
+func writeEngineError(w http.ResponseWriter, code int, message string) {
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(map[string]string{"message": message})
+}
+
+// matchLabel 检查 label 是否满足 filters 中的 label 条件，条件的格式为 key 或 key=value
+func matchLabel(r *http.Request, labels map[string]string) bool {
+	var filters map[string][]string
+	_ = json.Unmarshal([]byte(r.URL.Query().Get("filters")), &filters)
+	for _, f := range filters["label"] {
+		key, value, hasValue := strings.Cut(f, "=")
+		v, ok := labels[key]
+		if !ok || (hasValue && v != value) {
+			return false
+		}
+	}
+	return true
+}
+
+func (f *fakeEngine) version(w http.ResponseWriter, r *http.Request) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	version := map[string]any{"Version": "24.0.7", "ApiVersion": "1.43", "Components": []map[string]string{{"Name": "Engine", "Version": "24.0.7"}}}
+	if f.podman {
+		version = map[string]any{"Version": "4.9.3", "ApiVersion": "1.41", "Components": []map[string]string{{"Name": "Podman Engine", "Version": "4.9.3"}}}
+	}
+	if f.apiVersion != "" {
+		version["ApiVersion"] = f.apiVersion
+	}
+	_ = json.NewEncoder(w).Encode(version)
+}
+
+func (f *fakeEngine) info(w http.ResponseWriter, r *http.Request) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	options := []string{"name=seccomp,profile=default"}
+	if f.rootless {
+		options = append(options, "name=rootless")
+	}
+	_ = json.NewEncoder(w).Encode(map[string]any{"SecurityOptions": options})
+}
+
+func (f *fakeEngine) pullImage(w http.ResponseWriter, r *http.Request) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	query := r.URL.Query()
+	_, _ = fmt.Fprintln(w, `{"status":"Pulling"}`)
+	if f.pullError != "" {
+		_, _ = fmt.Fprintf(w, "{\"error\":%q}\n", f.pullError)
+		return
+	}
+	f.pulled = append(f.pulled, query.Get("fromImage")+":"+query.Get("tag"))
+}
+
+func (f *fakeEngine) createNetwork(w http.ResponseWriter, r *http.Request) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	var body struct {
+		Name   string
+		Labels map[string]string
+	}
+	_ = json.NewDecoder(r.Body).Decode(&body)
+	if _, ok := f.networks[body.Name]; ok {
+		writeEngineError(w, http.StatusConflict, "network with name "+body.Name+" already exists")
+		return
+	}
+	f.networks[body.Name] = body.Labels
+	w.WriteHeader(http.StatusCreated)
+	_, _ = fmt.Fprintf(w, "{\"Id\":%q}", body.Name)
+}
+
+func (f *fakeEngine) listNetworks(w http.ResponseWriter, r *http.Request) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	result := make([]map[string]any, 0)
+	for name, labels := range f.networks {
+		if matchLabel(r, labels) {
+			result = append(result, map[string]any{"Id": name, "Name": name, "Labels": labels})
+		}
+	}
+	_ = json.NewEncoder(w).Encode(result)
+}
+
+func (f *fakeEngine) removeNetwork(w http.ResponseWriter, r *http.Request) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if _, ok := f.networks[r.PathValue("id")]; !ok {
+		writeEngineError(w, http.StatusNotFound, "network not found")
+		return
+	}
+	delete(f.networks, r.PathValue("id"))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (f *fakeEngine) createContainer(w http.ResponseWriter, r *http.Request) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	name := r.URL.Query().Get("name")
+	for _, c := range f.containers {
+		if c.Name == name {
+			writeEngineError(w, http.StatusConflict, "container name "+name+" is already in use")
+			return
+		}
+	}
+	c := &fakeContainer{Id: fmt.Sprintf("c%d", len(f.created)), Name: name, State: "created"}
+	_ = json.NewDecoder(r.Body).Decode(&c.Spec)
+	f.containers[c.Id] = c
+	f.created = append(f.created, name)
+	w.WriteHeader(http.StatusCreated)
+	_, _ = fmt.Fprintf(w, "{\"Id\":%q}", c.Id)
+}
+
+func (f *fakeEngine) listContainers(w http.ResponseWriter, r *http.Request) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	result := make([]map[string]any, 0)
+	for _, c := range f.containers {
+		if matchLabel(r, c.Spec.Labels) {
+			result = append(result, map[string]any{"Id": c.Id, "Names": []string{"/" + c.Name}, "State": c.State, "Labels": c.Spec.Labels})
+		}
+	}
+	_ = json.NewEncoder(w).Encode(result)
+}
+
+func (f *fakeEngine) container(w http.ResponseWriter, r *http.Request) *fakeContainer {
+	c, ok := f.containers[r.PathValue("id")]
+	if !ok {
+		writeEngineError(w, http.StatusNotFound, "no such container: "+r.PathValue("id"))
+	}
+	return c
+}
+
+func (f *fakeEngine) startContainer(w http.ResponseWriter, r *http.Request) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if c := f.container(w, r); c != nil {
+		c.State = "running"
+		if code, ok := f.exitCodes[c.Spec.Labels["com.docker.compose.service"]]; ok {
+			c.State, c.ExitCode = "exited", code
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func (f *fakeEngine) stopContainer(w http.ResponseWriter, r *http.Request) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if c := f.container(w, r); c != nil {
+		c.State = "exited"
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func (f *fakeEngine) removeContainer(w http.ResponseWriter, r *http.Request) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if c := f.container(w, r); c != nil {
+		delete(f.containers, c.Id)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func (f *fakeEngine) inspectContainer(w http.ResponseWriter, r *http.Request) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if c := f.container(w, r); c != nil {
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"Id":     c.Id,
+			"Name":   "/" + c.Name,
+			"State":  map[string]any{"Status": c.State, "Running": c.State == "running", "ExitCode": c.ExitCode},
+			"Config": map[string]any{"Labels": c.Spec.Labels},
+		})
+	}
+}
+
+// containerLogs 以没有 tty 的容器的格式返回日志，每一帧带有 8 字节的头
+func (f *fakeEngine) containerLogs(w http.ResponseWriter, r *http.Request) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if c := f.container(w, r); c != nil {
+		header := make([]byte, 8)
+		header[0] = 2
+		binary.BigEndian.PutUint32(header[4:], uint32(len(f.logs)))
+		_, _ = w.Write(append(header, f.logs...))
+	}
+}
+
+func newTestEngineRunner(t *testing.T) (*mgr.EngineRunnerImpl, *fakeEngine) {
+	engine, socketPath := newFakeEngine(t)
+	runner := mgr.NewEngineRunnerImpl(config.Config{SecwareEngineSocket: socketPath}, newTestRunner())
+	runner.PortProviderIntf.(*mocks.PortProvider).On("GetAvailablePort").Return(6789, nil)
+	return runner, engine
+}
+
+const engineComposeFile = `
+services:
+  secware-api:
+    image: secware@sha256:1234
+    depends_on:
+      - redis
+    environment:
+      PROJECT: ${COMPOSE_PROJECT_NAME}
+      LOG_LEVEL: ${LOG_LEVEL:-info}
+    ports:
+      - "${SECWARE_PORT}:3333"
+    volumes:
+      - ./data:/data:ro
+    healthcheck:
+      test: curl -f http://localhost:3333/health
+    restart: unless-stopped
+  redis:
+    image: redis:7
+`
+
+func writeEngineComposeFile(t *testing.T, content string) string {
+	composeFile := filepath.Join(t.TempDir(), "testsecware-1-1.yml")
+	if err := os.WriteFile(composeFile, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return composeFile
+}
+
+func TestEngineRunner(t *testing.T) {
+	runner, engine := newTestEngineRunner(t)
+	st, err := state.NewAvsDbState(config.Config{DataPath: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.Close()
+	runner.Registry = st
+	runner.ResourceProfile = config.ResourceProfile{CPUs: 1, Memory: 1 << 30}
+
+	mockSecwareAccessor := runner.SecwareAccessorIntf.(*mocks.SecwareAccessor)
+	mockSecwareAccessor.On("GetSecwareMeta", mock.Anything, mock.Anything).Return(mgr.SecwareMeta{SecwareId: 1, SecwareVersion: 1}, nil)
+	mockSecwareAccessor.On("GetSecwareHealth", mock.Anything, mock.Anything).Return(mgr.SecwareHealth{Health: true}, nil)
+	mockSecwareAccessor.On("CloseConnections", mock.Anything).Return()
+
+	backend, err := runner.CheckBackend()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if backend.Name != "docker engine" || backend.Version != "24.0.7" || backend.Rootless {
+		t.Errorf("unexpected backend %+v", backend)
+	}
+
+	composeFile := writeEngineComposeFile(t, engineComposeFile)
+	status, err := runner.ComposeUp(1, 1, composeFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.GetState() != mgr.StateAvailable || status.ComposeProjectName != "testsecware-1-1-6789" {
+		t.Fatalf("expect available secware, got %+v", status)
+	}
+
+	if strings.Join(engine.pulled, ",") != "redis:7,secware@sha256:1234:" {
+		t.Errorf("expect images of both services to be pulled, got %v", engine.pulled)
+	}
+	if _, ok := engine.networks["testsecware-1-1-6789_default"]; !ok {
+		t.Errorf("expect project network to be created, got %v", engine.networks)
+	}
+	// 被依赖的 service 先创建
+	if strings.Join(engine.created, ",") != "testsecware-1-1-6789-redis-1,testsecware-1-1-6789-secware-api-1" {
+		t.Errorf("expect redis to be created first, got %v", engine.created)
+	}
+
+	var api *fakeContainer
+	for _, c := range engine.containers {
+		if c.State != "running" {
+			t.Errorf("expect container %s to be running, got %s", c.Name, c.State)
+		}
+		// 两个 service 平分 project 的资源上限
+		if c.Spec.HostConfig.NanoCpus != 5e8 || c.Spec.HostConfig.Memory != 1<<29 {
+			t.Errorf("expect half of the resource profile on %s, got %+v", c.Name, c.Spec.HostConfig)
+		}
+		if c.Spec.Labels["com.docker.compose.service"] == "secware-api" {
+			api = c
+		}
+	}
+	if api == nil {
+		t.Fatal("expect secware-api container")
+	}
+	if strings.Join(api.Spec.Env, ",") != "PROJECT=testsecware-1-1-6789,LOG_LEVEL=info" {
+		t.Errorf("expect interpolated environment, got %v", api.Spec.Env)
+	}
+	binding := api.Spec.HostConfig.PortBindings["3333/tcp"]
+	if len(binding) != 1 || binding[0].HostIp != "127.0.0.1" || binding[0].HostPort != "6789" {
+		t.Errorf("expect port 3333 bound to 127.0.0.1:6789, got %+v", binding)
+	}
+	if len(api.Spec.HostConfig.Binds) != 1 || api.Spec.HostConfig.Binds[0] != filepath.Join(filepath.Dir(composeFile), "data")+":/data:ro" {
+		t.Errorf("expect relative bind to be resolved, got %v", api.Spec.HostConfig.Binds)
+	}
+	if api.Spec.Healthcheck == nil || strings.Join(api.Spec.Healthcheck.Test, " ") != "CMD-SHELL curl -f http://localhost:3333/health" {
+		t.Errorf("expect shell healthcheck, got %+v", api.Spec.Healthcheck)
+	}
+	if api.Spec.HostConfig.RestartPolicy.Name != "unless-stopped" || api.Spec.HostConfig.NetworkMode != "testsecware-1-1-6789_default" {
+		t.Errorf("unexpected host config %+v", api.Spec.HostConfig)
+	}
+
+	listed, err := runner.ListAvailableSecware()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(listed) != 1 || listed[0].ComposeProjectName != status.ComposeProjectName || listed[0].GetState() != mgr.StateAvailable {
+		t.Fatalf("expect the started secware to be listed, got %v", listed)
+	}
+
+	containers, err := runner.ProjectContainers(status.ComposeProjectName)
+	if err != nil || len(containers) != 2 {
+		t.Fatalf("expect 2 containers, got %v, %v", containers, err)
+	}
+
+	if _, err := runner.ComposeDown(status); err != nil {
+		t.Fatal(err)
+	}
+	if len(engine.containers) != 0 || len(engine.networks) != 0 {
+		t.Errorf("expect containers and network to be removed, got %v %v", engine.containers, engine.networks)
+	}
+	project, err := st.GetSecwareProject(1, 1)
+	if err != nil || project.State != mgr.StateDown {
+		t.Errorf("expect record to be marked down, got %+v, %v", project, err)
+	}
+}
+
+func TestEngineRunner_ContainerExit(t *testing.T) {
+	runner, engine := newTestEngineRunner(t)
+	st, err := state.NewAvsDbState(config.Config{DataPath: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.Close()
+	runner.Registry = st
+	engine.exitCodes["secware-api"] = 1
+	engine.logs = "starting\nboom: missing config\n"
+
+	mockSecwareAccessor := runner.SecwareAccessorIntf.(*mocks.SecwareAccessor)
+	mockSecwareAccessor.On("GetSecwareMeta", mock.Anything, mock.Anything).Return(mgr.SecwareMeta{}, errors.New("connection refused"))
+
+	status, err := runner.ComposeUp(1, 1, writeEngineComposeFile(t, engineComposeFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.GetState() != mgr.StateUnknown {
+		t.Fatalf("expect unknown secware, got %s", status.GetState())
+	}
+
+	project, err := st.GetSecwareProject(1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(project.LastError, "service secware-api exited with code 1: boom: missing config") {
+		t.Errorf("expect exit code and last log line in record, got %q", project.LastError)
+	}
+
+	logs, err := runner.ProjectLogs(status.ComposeProjectName, "secware-api", 10)
+	if err != nil || logs != engine.logs {
+		t.Errorf("expect demultiplexed logs, got %q, %v", logs, err)
+	}
+	if _, err := runner.ProjectLogs(status.ComposeProjectName, "unknown", 10); !errors.Is(err, mgr.ErrSecwareProjectNotFound) {
+		t.Errorf("expect ErrSecwareProjectNotFound for unknown service, got %v", err)
+	}
+}
+
+func TestEngineRunner_ResourceLimits(t *testing.T) {
+	composeFile := writeEngineComposeFile(t, `
+services:
+  secware-api:
+    image: secware
+    deploy:
+      resources:
+        limits:
+          cpus: "0.25"
+          memory: 256m
+  redis:
+    image: redis:7
+`)
+	cases := []struct {
+		profile config.ResourceProfile
+		limits  map[string][2]int64 // service -> NanoCpus, Memory
+	}{
+		// 没有设定资源上限时仍然使用 compose 文件中声明的上限
+		{config.ResourceProfile{}, map[string][2]int64{"secware-api": {25e7, 256 << 20}, "redis": {0, 0}}},
+		// 其余的 service 分到 project 剩余的资源
+		{config.ResourceProfile{CPUs: 1, Memory: 1 << 30}, map[string][2]int64{"secware-api": {25e7, 256 << 20}, "redis": {75e7, 768 << 20}}},
+	}
+	for _, tc := range cases {
+		runner, engine := newTestEngineRunner(t)
+		runner.ResourceProfile = tc.profile
+		mockSecwareAccessor := runner.SecwareAccessorIntf.(*mocks.SecwareAccessor)
+		mockSecwareAccessor.On("GetSecwareMeta", mock.Anything, mock.Anything).Return(mgr.SecwareMeta{SecwareId: 1, SecwareVersion: 1}, nil)
+		mockSecwareAccessor.On("GetSecwareHealth", mock.Anything, mock.Anything).Return(mgr.SecwareHealth{Health: true}, nil)
+
+		if _, err := runner.ComposeUp(1, 1, composeFile); err != nil {
+			t.Fatal(err)
+		}
+		for _, c := range engine.containers {
+			expect := tc.limits[c.Spec.Labels["com.docker.compose.service"]]
+			if c.Spec.HostConfig.NanoCpus != expect[0] || c.Spec.HostConfig.Memory != expect[1] {
+				t.Errorf("profile %+v: expect limits %v on %s, got %+v", tc.profile, expect, c.Name, c.Spec.HostConfig)
+			}
+		}
+	}
+
+	// compose 文件声明的上限超出 project 的资源上限时拒绝启动
+	runner, engine := newTestEngineRunner(t)
+	runner.ResourceProfile = config.ResourceProfile{CPUs: 0.2}
+	if _, err := runner.ComposeUp(1, 1, composeFile); err == nil || len(engine.containers) != 0 {
+		t.Fatalf("expect limits above the profile to be rejected, got %v", err)
+	}
+}
+
+func TestEngineRunner_StartErrors(t *testing.T) {
+	runner, engine := newTestEngineRunner(t)
+
+	engine.pullError = "manifest unknown"
+	_, err := runner.ComposeUp(1, 1, writeEngineComposeFile(t, engineComposeFile))
+	var engineErr *mgr.EngineError
+	if !errors.As(err, &engineErr) || engineErr.Message != "manifest unknown" {
+		t.Fatalf("expect EngineError from pull, got %v", err)
+	}
+	if len(engine.containers) != 0 {
+		t.Errorf("expect no container left, got %v", engine.containers)
+	}
+
+	engine.pullError = ""
+	_, err = runner.ComposeUp(1, 1, writeEngineComposeFile(t, "services:\n  secware-api:\n    build: .\n"))
+	if err == nil || !strings.Contains(err.Error(), "build is not supported") {
+		t.Fatalf("expect unsupported field error, got %v", err)
+	}
+
+	// 容器名字冲突时删除已经创建的容器
+	engine.containers["existing"] = &fakeContainer{Id: "existing", Name: "testsecware-1-1-6789-secware-api-1"}
+	_, err = runner.ComposeUp(1, 1, writeEngineComposeFile(t, engineComposeFile))
+	if !errors.As(err, &engineErr) || engineErr.StatusCode != http.StatusConflict {
+		t.Fatalf("expect conflict EngineError, got %v", err)
+	}
+	if len(engine.containers) != 1 || len(engine.networks) != 0 {
+		t.Errorf("expect started containers and network to be cleaned up, got %v %v", engine.containers, engine.networks)
+	}
+
+	runner.Engine = mgr.NewEngineClient(filepath.Join(t.TempDir(), "missing.sock"))
+	if _, err := runner.CheckBackend(); err == nil {
+		t.Fatal("expect error when docker engine is not available")
+	}
+}
+
+func TestEngineRunner_OldAPIVersion(t *testing.T) {
+	runner, engine := newTestEngineRunner(t)
+	engine.apiVersion = "1.40"
+	if _, err := runner.CheckBackend(); err == nil || !strings.Contains(err.Error(), "api version 1.40 is not supported") {
+		t.Fatalf("expect unsupported api version error, got %v", err)
+	}
+}
+
+func TestPodmanRunner(t *testing.T) {
+	engine, socketPath := newFakeEngine(t)
+	engine.podman = true
+	runner := mgr.NewPodmanRunnerImpl(config.Config{SecwareEngineSocket: socketPath}, newTestRunner())
+	runner.PortProviderIntf.(*mocks.PortProvider).On("GetAvailablePort").Return(6789, nil)
+
+	// rootful podman 与 docker socket 一样拥有 root 权限
+	if _, err := runner.CheckBackend(); err == nil || !strings.Contains(err.Error(), "not running rootless") {
+		t.Fatalf("expect rootless error, got %v", err)
+	}
+	engine.rootless = true
+	backend, err := runner.CheckBackend()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if backend.String() != "podman 4.9.3 (rootless)" {
+		t.Errorf("unexpected backend %s", backend)
+	}
+
+	mockSecwareAccessor := runner.SecwareAccessorIntf.(*mocks.SecwareAccessor)
+	mockSecwareAccessor.On("GetSecwareMeta", mock.Anything, mock.Anything).Return(mgr.SecwareMeta{SecwareId: 1, SecwareVersion: 1}, nil)
+	mockSecwareAccessor.On("GetSecwareHealth", mock.Anything, mock.Anything).Return(mgr.SecwareHealth{Health: true}, nil)
+
+	composeFile := writeEngineComposeFile(t, engineComposeFile+"  proxy:\n    image: ghcr.io/goplus/proxy:1\n")
+	status, err := runner.ComposeUp(1, 1, composeFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.GetState() != mgr.StateAvailable {
+		t.Fatalf("expect available secware, got %s", status.GetState())
+	}
+	// podman 不会默认从 docker.io 拉取镜像
+	expectPulled := "ghcr.io/goplus/proxy:1,docker.io/library/redis:7,docker.io/library/secware@sha256:1234:"
+	if strings.Join(engine.pulled, ",") != expectPulled {
+		t.Errorf("expect qualified images %s, got %v", expectPulled, engine.pulled)
+	}
+	for _, c := range engine.containers {
+		if !strings.HasPrefix(c.Spec.Image, "docker.io/") && !strings.HasPrefix(c.Spec.Image, "ghcr.io/") {
+			t.Errorf("expect qualified image in container %s, got %s", c.Name, c.Spec.Image)
+		}
+	}
+
+	// docker 的 socket 不能用于 podman runner
+	engine.podman = false
+	if _, err := runner.CheckBackend(); err == nil || !strings.Contains(err.Error(), "is not podman") {
+		t.Fatalf("expect not podman error, got %v", err)
+	}
+}
@@ -0,0 +1,71 @@
+package tests
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/ethereum/go-ethereum/crypto"
+	mgr "goplus/avs/secwaremanager"
+	"testing"
+)
+
+const pinnedComposeFile = `
+services:
+  secware:
+    image: goplus/secware@sha256:0f3e1f6b2c8d7a9e4b5c6d7e8f9a0b1c2d3e4f5a6b7c8d9e0f1a2b3c4d5e6f7a
+    ports:
+      - "${SECWARE_PORT}:8080"
+`
+
+func TestVerifyComposeFile(t *testing.T) {
+	skGateway, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	addrGateway := crypto.PubkeyToAddress(skGateway.PublicKey)
+
+	data := []byte(pinnedComposeFile)
+	hash := sha256.Sum256(data)
+	sig, err := crypto.Sign(hash[:], skGateway)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := mgr.SecwareConfig{
+		SecwareId:       1,
+		SecwareVersion:  1,
+		ComposeFileHash: "0x" + hex.EncodeToString(hash[:]),
+		ComposeFileSig:  sig,
+	}
+	if err := mgr.VerifyComposeFile(data, &cfg, addrGateway); err != nil {
+		t.Fatalf("VerifyComposeFile() error = %v", err)
+	}
+
+	// 未签名时只校验 hash
+	unsigned := cfg
+	unsigned.ComposeFileSig = nil
+	if err := mgr.VerifyComposeFile(data, &unsigned, addrGateway); err != nil {
+		t.Fatalf("VerifyComposeFile() error = %v", err)
+	}
+
+	noHash := cfg
+	noHash.ComposeFileHash = ""
+	if err := mgr.VerifyComposeFile(data, &noHash, addrGateway); err == nil {
+		t.Fatal("VerifyComposeFile() expect error without hash")
+	}
+
+	if err := mgr.VerifyComposeFile(append(data, '\n'), &cfg, addrGateway); err == nil {
+		t.Fatal("VerifyComposeFile() expect error for tampered file")
+	}
+
+	otherGateway, _ := crypto.GenerateKey()
+	if err := mgr.VerifyComposeFile(data, &cfg, crypto.PubkeyToAddress(otherGateway.PublicKey)); err == nil {
+		t.Fatal("VerifyComposeFile() expect error for signature of other gateway")
+	}
+
+	unpinned := []byte("services:\n  secware:\n    image: goplus/secware:latest\n")
+	unpinnedHash := sha256.Sum256(unpinned)
+	unpinnedCfg := mgr.SecwareConfig{ComposeFileHash: hex.EncodeToString(unpinnedHash[:])}
+	if err := mgr.VerifyComposeFile(unpinned, &unpinnedCfg, addrGateway); err == nil {
+		t.Fatal("VerifyComposeFile() expect error for image not pinned by digest")
+	}
+}
@@ -0,0 +1,294 @@
+package tests
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"github.com/Layr-Labs/eigensdk-go/logging"
+	"github.com/stretchr/testify/mock"
+	"goplus/avs/config"
+	mgr "goplus/avs/secwaremanager"
+	"goplus/avs/secwaremanager/mocks"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type nopMetrics struct{}
+
+func (m *nopMetrics) IncTaskHandled()                                    {}
+func (m *nopMetrics) SetTaskDuration(float64)                            {}
+func (m *nopMetrics) IncTaskFailed()                                     {}
+func (m *nopMetrics) IncHealthReported()                                 {}
+func (m *nopMetrics) IncSecwareSynced()                                  {}
+func (m *nopMetrics) SetSecwareNum(int)                                  {}
+func (m *nopMetrics) IncSecwareResultRejected()                          {}
+func (m *nopMetrics) IncTaskBusy()                                       {}
+func (m *nopMetrics) SetSecwareQueueDepth(string, int)                   {}
+func (m *nopMetrics) ObserveSecwareQueueWait(string, float64)            {}
+func (m *nopMetrics) ObserveSecwareCall(string, string, string, float64) {}
+
+func newTestManager(t *testing.T) (*mgr.SecwareManager, *mocks.DockerRunner, *mocks.GatewayAccessor, mgr.SecwareConfig) {
+	logger, _ := logging.NewZapLogger("development")
+	cfg := config.Config{
+		Logger:          logger,
+		ComposeFilePath: t.TempDir(),
+	}
+
+	manager, err := mgr.NewSecwareManager(cfg, &nopMetrics{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	runner := &mocks.DockerRunner{}
+	gateway := &mocks.GatewayAccessor{}
+	manager.DockerRunnerIntf = runner
+	manager.GatewayAccessorIntf = gateway
+	runner.On("CheckBackend").Return(&mgr.BackendInfo{Name: "docker compose", Version: "2.24.0"}, nil)
+	runner.On("Reconcile").Return(nil)
+
+	composeFile := []byte(pinnedComposeFile)
+	composeServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(composeFile)
+	}))
+	t.Cleanup(composeServer.Close)
+
+	hash := sha256.Sum256(composeFile)
+	secwareCfg := mgr.SecwareConfig{
+		SecwareId:       1,
+		ComposeFileUrl:  composeServer.URL,
+		ComposeFileHash: hex.EncodeToString(hash[:]),
+	}
+	return manager, runner, gateway, secwareCfg
+}
+
+func TestSyncSecwareUpgrade(t *testing.T) {
+	manager, runner, gateway, secwareCfg := newTestManager(t)
+
+	cfgV1 := secwareCfg
+	cfgV1.SecwareVersion = 1
+	v1 := &mgr.SecwareStatus{SecwareId: 1, SecwareVersion: 1, Port: 7001, ComposeProjectName: "secware-1-1-7001"}
+	v1.SetState(mgr.StateAvailable)
+
+	gateway.On("GetSecwareConfig").Return([]mgr.SecwareConfig{cfgV1}, nil).Once()
+	runner.On("ListAvailableSecware").Return([]*mgr.SecwareStatus{}, nil).Once()
+	runner.On("ComposeUp", 1, 1, mock.Anything).Return(v1, nil).Once()
+	if err := manager.Init(); err != nil {
+		t.Fatalf("Init() error = %v", err)
+	}
+
+	// 旧版本有一个进行中的 task
+	inUse, err := manager.AcquireSecware(1, 1, time.Now().Add(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfgV2 := secwareCfg
+	cfgV2.SecwareVersion = 2
+	v1Listed := &mgr.SecwareStatus{SecwareId: 1, SecwareVersion: 1, Port: 7001, ComposeProjectName: "secware-1-1-7001"}
+	v1Listed.SetState(mgr.StateAvailable)
+	v2 := &mgr.SecwareStatus{SecwareId: 1, SecwareVersion: 2, Port: 7002, ComposeProjectName: "secware-1-2-7002"}
+	v2.SetState(mgr.StateAvailable)
+
+	released := make(chan struct{})
+	down := make(chan struct{})
+	gateway.On("GetSecwareConfig").Return([]mgr.SecwareConfig{cfgV2}, nil).Once()
+	runner.On("ListAvailableSecware").Return([]*mgr.SecwareStatus{v1Listed}, nil).Once()
+	runner.On("ComposeUp", 1, 2, mock.Anything).Return(v2, nil).Once()
+	runner.On("ComposeDown", v1).Run(func(args mock.Arguments) {
+		select {
+		case <-released:
+		default:
+			t.Error("old version shut down before in-flight task finished")
+		}
+		close(down)
+	}).Return(v1, nil).Once()
+	// 同步不等待旧版本处理完进行中的 task
+	if err := manager.Init(); err != nil {
+		t.Fatalf("Init() error = %v", err)
+	}
+
+	list := manager.GetAvailableSecwareList()
+	if len(list) != 1 || list[0] != v2 {
+		t.Fatalf("expect only version 2 available, got %v", list)
+	}
+
+	// 旧版本在关停前不会被再次同步
+	gateway.On("GetSecwareConfig").Return([]mgr.SecwareConfig{cfgV2}, nil).Once()
+	runner.On("ListAvailableSecware").Return([]*mgr.SecwareStatus{v1Listed, v2}, nil).Once()
+	if _, err := manager.SyncSecware(); err != nil {
+		t.Fatalf("SyncSecware() error = %v", err)
+	}
+
+	close(released)
+	manager.ReleaseSecware(inUse)
+	select {
+	case <-down:
+	case <-time.After(5 * time.Second):
+		t.Fatal("old version not shut down after in-flight task finished")
+	}
+	runner.AssertExpectations(t)
+}
+
+func TestStopSecwareDrainDeadline(t *testing.T) {
+	manager, runner, gateway, secwareCfg := newTestManager(t)
+
+	cfgV1 := secwareCfg
+	cfgV1.SecwareVersion = 1
+	v1 := &mgr.SecwareStatus{SecwareId: 1, SecwareVersion: 1, Port: 7001, ComposeProjectName: "secware-1-1-7001"}
+	v1.SetState(mgr.StateAvailable)
+
+	gateway.On("GetSecwareConfig").Return([]mgr.SecwareConfig{cfgV1}, nil).Once()
+	runner.On("ListAvailableSecware").Return([]*mgr.SecwareStatus{}, nil).Once()
+	runner.On("ComposeUp", 1, 1, mock.Anything).Return(v1, nil).Once()
+	if err := manager.Init(); err != nil {
+		t.Fatalf("Init() error = %v", err)
+	}
+
+	// 进行中的 task 一直没有返回，等到它的截止时间后关停
+	deadline := time.Now().Add(1500 * time.Millisecond)
+	if _, err := manager.AcquireSecware(1, 1, deadline); err != nil {
+		t.Fatal(err)
+	}
+	runner.On("ComposeDown", v1).Return(v1, nil).Once()
+	start := time.Now()
+	if _, err := manager.StopSecware("secware-1-1-7001"); err != nil {
+		t.Fatalf("StopSecware() error = %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 500*time.Millisecond || elapsed > 5*time.Second {
+		t.Fatalf("expect to drain until the task deadline, took %v", elapsed)
+	}
+	runner.AssertExpectations(t)
+}
+
+func TestSyncSecwareUpgradeRollback(t *testing.T) {
+	manager, runner, gateway, secwareCfg := newTestManager(t)
+
+	cfgV2 := secwareCfg
+	cfgV2.SecwareVersion = 2
+	v1 := &mgr.SecwareStatus{SecwareId: 1, SecwareVersion: 1, Port: 7001, ComposeProjectName: "secware-1-1-7001"}
+	v1.SetState(mgr.StateAvailable)
+	v2 := &mgr.SecwareStatus{SecwareId: 1, SecwareVersion: 2, Port: 7002, ComposeProjectName: "secware-1-2-7002"}
+	v2.SetState(mgr.StateUnhealthy)
+
+	gateway.On("GetSecwareConfig").Return([]mgr.SecwareConfig{cfgV2}, nil).Once()
+	runner.On("ListAvailableSecware").Return([]*mgr.SecwareStatus{v1}, nil).Once()
+	runner.On("ComposeUp", 1, 2, mock.Anything).Return(v2, nil).Once()
+	runner.On("ComposeDown", v2).Return(v2, nil).Once()
+	if err := manager.Init(); err == nil {
+		t.Fatal("Init() expect error for failed secware")
+	}
+
+	list := manager.GetAvailableSecwareList()
+	if len(list) != 1 || list[0] != v1 {
+		t.Fatalf("expect version 1 kept available, got %v", list)
+	}
+	runner.AssertExpectations(t)
+}
+
+func TestRestartSecwareDrainUnlocked(t *testing.T) {
+	manager, runner, gateway, secwareCfg := newTestManager(t)
+
+	cfgV1 := secwareCfg
+	cfgV1.SecwareVersion = 1
+	v1 := &mgr.SecwareStatus{SecwareId: 1, SecwareVersion: 1, Port: 7001, ComposeProjectName: "secware-1-1-7001"}
+	v1.SetState(mgr.StateAvailable)
+
+	gateway.On("GetSecwareConfig").Return([]mgr.SecwareConfig{cfgV1}, nil).Once()
+	runner.On("ListAvailableSecware").Return([]*mgr.SecwareStatus{}, nil).Once()
+	runner.On("ComposeUp", 1, 1, mock.Anything).Return(v1, nil).Once()
+	if err := manager.Init(); err != nil {
+		t.Fatalf("Init() error = %v", err)
+	}
+
+	inUse, err := manager.AcquireSecware(1, 1, time.Now().Add(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	v1Restarted := &mgr.SecwareStatus{SecwareId: 1, SecwareVersion: 1, Port: 7003, ComposeProjectName: "secware-1-1-7003"}
+	v1Restarted.SetState(mgr.StateAvailable)
+	runner.On("ComposeDown", v1).Return(v1, nil).Once()
+	runner.On("ComposeUp", 1, 1, mock.Anything).Return(v1Restarted, nil).Once()
+
+	restarted := make(chan error, 1)
+	go func() {
+		_, err := manager.RestartSecware("secware-1-1-7001")
+		restarted <- err
+	}()
+	for len(manager.GetAvailableSecwareList()) != 0 {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// 等待进行中的 task 时不阻塞同步和其他管理操作，同步时不会启动正在重启的 secware
+	if _, err := manager.RestartSecware("secware-1-1-7001"); !errors.Is(err, mgr.ErrSecwareProjectDraining) {
+		t.Fatalf("expect ErrSecwareProjectDraining, got %v", err)
+	}
+	v1Listed := &mgr.SecwareStatus{SecwareId: 1, SecwareVersion: 1, Port: 7001, ComposeProjectName: "secware-1-1-7001"}
+	gateway.On("GetSecwareConfig").Return([]mgr.SecwareConfig{cfgV1}, nil).Once()
+	runner.On("ListAvailableSecware").Return([]*mgr.SecwareStatus{v1Listed}, nil).Once()
+	if _, err := manager.SyncSecware(); err != nil {
+		t.Fatalf("SyncSecware() error = %v", err)
+	}
+
+	manager.ReleaseSecware(inUse)
+	select {
+	case err := <-restarted:
+		if err != nil {
+			t.Fatalf("RestartSecware() error = %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("restart not finished after in-flight task finished")
+	}
+	list := manager.GetAvailableSecwareList()
+	if len(list) != 1 || list[0] != v1Restarted {
+		t.Fatalf("expect restarted secware available, got %v", list)
+	}
+	runner.AssertExpectations(t)
+}
+
+func TestRestartSecwareFailed(t *testing.T) {
+	manager, runner, gateway, secwareCfg := newTestManager(t)
+
+	cfgV1 := secwareCfg
+	cfgV1.SecwareVersion = 1
+	v1 := &mgr.SecwareStatus{SecwareId: 1, SecwareVersion: 1, Port: 7001, ComposeProjectName: "secware-1-1-7001"}
+	v1.SetState(mgr.StateAvailable)
+
+	gateway.On("GetSecwareConfig").Return([]mgr.SecwareConfig{cfgV1}, nil).Once()
+	runner.On("ListAvailableSecware").Return([]*mgr.SecwareStatus{}, nil).Once()
+	runner.On("ComposeUp", 1, 1, mock.Anything).Return(v1, nil).Once()
+	if err := manager.Init(); err != nil {
+		t.Fatalf("Init() error = %v", err)
+	}
+
+	runner.On("ComposeDown", v1).Return(v1, nil).Once()
+	runner.On("ComposeUp", 1, 1, mock.Anything).Return(nil, errors.New("pull failed")).Once()
+	if _, err := manager.RestartSecware("secware-1-1-7001"); err == nil {
+		t.Fatal("RestartSecware() expect error")
+	}
+
+	// 重启失败的 secware 不可用，但仍然可以在列表中看到
+	if _, err := manager.AcquireSecware(1, 1, time.Now().Add(time.Minute)); err == nil {
+		t.Fatal("expect failed secware to be unavailable")
+	}
+	list := manager.ListSecwares()
+	if len(list) != 1 || list[0].ComposeProjectName != "secware-1-1-7001" || list[0].GetState() != mgr.StateFailed {
+		t.Fatalf("expect failed secware to be listed, got %v", list)
+	}
+
+	// 同步时重新启动成功后不再显示为失败
+	v1Restarted := &mgr.SecwareStatus{SecwareId: 1, SecwareVersion: 1, Port: 7003, ComposeProjectName: "secware-1-1-7003"}
+	v1Restarted.SetState(mgr.StateAvailable)
+	gateway.On("GetSecwareConfig").Return([]mgr.SecwareConfig{cfgV1}, nil).Once()
+	runner.On("ListAvailableSecware").Return([]*mgr.SecwareStatus{}, nil).Once()
+	runner.On("ComposeUp", 1, 1, mock.Anything).Return(v1Restarted, nil).Once()
+	if _, err := manager.SyncSecware(); err != nil {
+		t.Fatalf("SyncSecware() error = %v", err)
+	}
+	list = manager.ListSecwares()
+	if len(list) != 1 || list[0] != v1Restarted {
+		t.Fatalf("expect only the restarted secware, got %v", list)
+	}
+	runner.AssertExpectations(t)
+}
@@ -1,14 +1,22 @@
 package tests
 
 import (
+	"errors"
 	"fmt"
 	"github.com/Layr-Labs/eigensdk-go/logging"
+	"github.com/stretchr/testify/mock"
+	"gopkg.in/yaml.v3"
+	"goplus/avs/config"
 	mgr "goplus/avs/secwaremanager"
 	"goplus/avs/secwaremanager/mocks"
+	"goplus/avs/state"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"strconv"
+	"strings"
 	"testing"
+	"time"
 )
 
 func newTestRunner() *mgr.DockerRunnerImpl {
@@ -34,8 +42,9 @@ func mockExecCommand(result string, exitCode int) *exec.Cmd {
 func TestExecCommandHelper(t *testing.T) {
 	result := os.Getenv("EXEC_RESULT")
 	execCodeStr := os.Getenv("EXEC_CODE")
+	// 不是作为 mockExecCommand 的子进程运行时直接返回，测试中调用 os.Exit(0) 会让整个包的测试失败
 	if execCodeStr == "" {
-		os.Exit(0)
+		return
 	}
 
 	execCode, _ := strconv.Atoi(execCodeStr)
@@ -68,13 +77,13 @@ func TestRunnerListing(t *testing.T) {
 		SecwareId:          111,
 		SecwareVersion:     222,
 		Port:               7777,
-		State:              "Running",
 		ComposeProjectName: "testsecware-111-222-7777",
 	}
+	mockState.SetState("Running")
 
 	mockCommandExecutor.On("ExecCommand", "docker", "compose", "ls", "--format", "json").Return(mockExecCommand(`[{"Name":"testsecware-111-222-7777"}]`, 0)).Once()
-	mockSecwareAccessor.On("GetSecwareMeta", &mockState).Return(mgr.SecwareMeta{SecwareId: 111, SecwareVersion: 222}, nil).Once()
-	mockSecwareAccessor.On("GetSecwareHealth", &mockState).Return(mgr.SecwareHealth{Health: true}, nil).Once()
+	mockSecwareAccessor.On("GetSecwareMeta", mock.Anything, &mockState).Return(mgr.SecwareMeta{SecwareId: 111, SecwareVersion: 222}, nil).Once()
+	mockSecwareAccessor.On("GetSecwareHealth", mock.Anything, &mockState).Return(mgr.SecwareHealth{Health: true}, nil).Once()
 	res, err = runner.ListAvailableSecware()
 	if err != nil {
 		t.Errorf("ListAvailableSecware() error = %v", err)
@@ -84,8 +93,33 @@ func TestRunnerListing(t *testing.T) {
 		t.Errorf("ListAvailableSecware() = %v, want %v", res, 1)
 	}
 
-	if res[0].State != "Available" {
-		t.Errorf("ListAvailableSecware() = %v, want %v", res[0].State, "Available")
+	if res[0].GetState() != "Available" {
+		t.Errorf("ListAvailableSecware() = %v, want %v", res[0].GetState(), "Available")
+	}
+}
+
+func TestRunnerCheckBackend(t *testing.T) {
+	runner := newTestRunner()
+
+	mockCommandExecutor := runner.CommandExecutorIntf.(*mocks.CommandExecutor)
+	mockCommandExecutor.On("ExecCommand", "docker", "compose", "version", "--short").Return(mockExecCommand("v2.24.5\n", 0)).Once()
+	backend, err := runner.CheckBackend()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if backend.String() != "docker compose 2.24.5" {
+		t.Errorf("unexpected backend %s", backend)
+	}
+
+	// docker-compose v1 已停止维护，不再支持
+	mockCommandExecutor.On("ExecCommand", "docker", "compose", "version", "--short").Return(mockExecCommand("1.29.2\n", 0)).Once()
+	if _, err := runner.CheckBackend(); err == nil {
+		t.Error("expect error for docker compose v1")
+	}
+
+	mockCommandExecutor.On("ExecCommand", "docker", "compose", "version", "--short").Return(mockExecCommand("unknown command", 1)).Once()
+	if _, err := runner.CheckBackend(); err == nil {
+		t.Error("expect error when docker compose is not installed")
 	}
 }
 
@@ -102,24 +136,24 @@ func TestComposeUp(t *testing.T) {
 		SecwareId:          111,
 		SecwareVersion:     222,
 		Port:               mockPort,
-		State:              "Running",
 		ComposeProjectName: "testsecware-111-222-6789",
 	}
+	mockState.SetState("Running")
 	mockPortProvider.On("GetAvailablePort").Return(mockPort, nil).Once()
 
 	mockCommandExecutor.On("ExecCommand", "docker", "compose", "-f", mockComposeFile, "pull").Return(mockExecCommand("", 0)).Once()
 	mockCommandExecutor.On("ExecCommand", "docker", "compose", "-f", mockComposeFile, "up", "-d").Return(mockExecCommand("", 0)).Once()
 
-	mockSecwareAccessor.On("GetSecwareMeta", &mockState).Return(mgr.SecwareMeta{SecwareId: 111, SecwareVersion: 222}, nil).Once()
-	mockSecwareAccessor.On("GetSecwareHealth", &mockState).Return(mgr.SecwareHealth{Health: true}, nil).Once()
+	mockSecwareAccessor.On("GetSecwareMeta", mock.Anything, &mockState).Return(mgr.SecwareMeta{SecwareId: 111, SecwareVersion: 222}, nil).Once()
+	mockSecwareAccessor.On("GetSecwareHealth", mock.Anything, &mockState).Return(mgr.SecwareHealth{Health: true}, nil).Once()
 
 	state, err := runner.ComposeUp(111, 222, mockComposeFile)
 	if err != nil {
 		t.Errorf("ComposeUp() error = %v", err)
 		return
 	}
-	if state.State != "Available" {
-		t.Errorf("ComposeUp() = %v, want %v", state.State, "Available")
+	if state.GetState() != "Available" {
+		t.Errorf("ComposeUp() = %v, want %v", state.GetState(), "Available")
 	}
 
 	if state.Port != mockPort {
@@ -136,18 +170,414 @@ func TestComposeDown(t *testing.T) {
 		SecwareId:          111,
 		SecwareVersion:     222,
 		Port:               7777,
-		State:              "Running",
 		ComposeProjectName: "testsecware-111-222-7777",
 	}
+	mockState.SetState("Running")
 
 	mockCommandExecutor.On("ExecCommand", "docker", "compose", "-p", "testsecware-111-222-7777", "down").Return(mockExecCommand("", 0)).Once()
+	mockSecwareAccessor := runner.SecwareAccessorIntf.(*mocks.SecwareAccessor)
+	mockSecwareAccessor.On("CloseConnections", &mockState).Return().Once()
 
 	state, err := runner.ComposeDown(&mockState)
 	if err != nil {
 		t.Errorf("ComposeDown() error = %v", err)
 		return
 	}
-	if state.State != "Down" {
-		t.Errorf("ComposeDown() = %v, want %v", state.State, "Down")
+	if state.GetState() != "Down" {
+		t.Errorf("ComposeDown() = %v, want %v", state.GetState(), "Down")
+	}
+	mockSecwareAccessor.AssertExpectations(t)
+}
+
+func TestComposeUpWithUnixSocket(t *testing.T) {
+	runner := newTestRunner()
+	runner.SocketDirPath = filepath.Join(t.TempDir(), "sockets")
+
+	mockCommandExecutor := runner.CommandExecutorIntf.(*mocks.CommandExecutor)
+	mockSecwareAccessor := runner.SecwareAccessorIntf.(*mocks.SecwareAccessor)
+
+	mockComposeFile := filepath.Join(t.TempDir(), "testsecware-111-222.yml")
+	if err := os.WriteFile(mockComposeFile, []byte(unixComposeFile), 0644); err != nil {
+		t.Fatal(err)
+	}
+	socketDir := filepath.Join(runner.SocketDirPath, "testsecware-111-222-0")
+	mockState := mgr.SecwareStatus{
+		SecwareId:          111,
+		SecwareVersion:     222,
+		SocketPath:         filepath.Join(socketDir, mgr.SecwareSocketName),
+		ComposeProjectName: "testsecware-111-222-0",
+	}
+	mockState.SetState("Running")
+
+	// 上次运行留下的 socket 会被删除
+	if err := os.MkdirAll(socketDir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(mockState.SocketPath, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	upCmd := mockExecCommand("", 0)
+	mockCommandExecutor.On("ExecCommand", "docker", "compose", "-f", mockComposeFile, "pull").Return(mockExecCommand("", 0)).Once()
+	mockCommandExecutor.On("ExecCommand", "docker", "compose", "-f", mockComposeFile, "up", "-d").Return(upCmd).Once()
+	mockSecwareAccessor.On("GetSecwareMeta", mock.Anything, &mockState).Return(mgr.SecwareMeta{SecwareId: 111, SecwareVersion: 222}, nil).Once()
+	mockSecwareAccessor.On("GetSecwareHealth", mock.Anything, &mockState).Return(mgr.SecwareHealth{Health: true}, nil).Once()
+
+	state, err := runner.ComposeUp(111, 222, mockComposeFile)
+	if err != nil {
+		t.Fatalf("ComposeUp() error = %v", err)
+	}
+	if state.GetState() != "Available" || state.Port != 0 || state.SocketPath != mockState.SocketPath {
+		t.Errorf("unexpected state %+v", state)
+	}
+
+	env := strings.Join(upCmd.Env, "\n")
+	if !strings.Contains(env, "SECWARE_SOCKET_DIR="+socketDir) || strings.Contains(env, "SECWARE_PORT=") {
+		t.Errorf("unexpected env %v", upCmd.Env)
+	}
+	info, err := os.Stat(socketDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0777 {
+		t.Errorf("socket dir mode = %v, want %v", info.Mode().Perm(), os.FileMode(0777))
+	}
+	if _, err := os.Stat(mockState.SocketPath); !os.IsNotExist(err) {
+		t.Errorf("expect stale socket to be removed, got %v", err)
+	}
+
+	mockCommandExecutor.On("ExecCommand", "docker", "compose", "-p", "testsecware-111-222-0", "down").Return(mockExecCommand("", 0)).Once()
+	mockSecwareAccessor.On("CloseConnections", state).Return().Once()
+	if _, err := runner.ComposeDown(state); err != nil {
+		t.Fatalf("ComposeDown() error = %v", err)
+	}
+	if _, err := os.Stat(socketDir); !os.IsNotExist(err) {
+		t.Errorf("expect socket dir to be removed, got %v", err)
+	}
+}
+
+const unixComposeFile = `
+services:
+  api:
+    image: secware
+    volumes:
+      - "${SECWARE_SOCKET_DIR}:/run/secware"
+`
+
+func TestComposeUpWithUnixSocketRejectsPorts(t *testing.T) {
+	runner := newTestRunner()
+	runner.SocketDirPath = filepath.Join(t.TempDir(), "sockets")
+
+	composeFile := filepath.Join(t.TempDir(), "secware.yml")
+	data := unixComposeFile + `  worker:
+    image: worker
+    ports:
+      - target: 8080
+        published: 8080
+`
+	if err := os.WriteFile(composeFile, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// 发布端口的 compose 文件在拉取镜像之前被拒绝
+	_, err := runner.ComposeUp(111, 222, composeFile)
+	if err == nil || !strings.Contains(err.Error(), "service worker publishes ports") {
+		t.Fatalf("expect published ports to be rejected, got %v", err)
+	}
+	runner.CommandExecutorIntf.(*mocks.CommandExecutor).AssertNotCalled(t, "ExecCommand", mock.Anything)
+}
+
+func TestComposeUpWithResourceLimits(t *testing.T) {
+	runner := newTestRunner()
+	runner.ResourceProfile = config.ResourceProfile{CPUs: 1, Memory: 1 << 30}
+
+	mockPortProvider := runner.PortProviderIntf.(*mocks.PortProvider)
+	mockCommandExecutor := runner.CommandExecutorIntf.(*mocks.CommandExecutor)
+	mockSecwareAccessor := runner.SecwareAccessorIntf.(*mocks.SecwareAccessor)
+
+	dir := t.TempDir()
+	mockComposeFile := filepath.Join(dir, "testsecware-111-222.yml")
+	mockOverrideFile := filepath.Join(dir, "testsecware-111-222.resources.yml")
+	composeContent := `
+services:
+  secware:
+    image: test/secware:latest
+    deploy:
+      resources:
+        reservations:
+          cpus: "0.5"
+          memory: 512m
+`
+	if err := os.WriteFile(mockComposeFile, []byte(composeContent), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	mockPort := 6789
+	mockState := mgr.SecwareStatus{
+		SecwareId:          111,
+		SecwareVersion:     222,
+		Port:               mockPort,
+		ComposeProjectName: "testsecware-111-222-6789",
+	}
+	mockState.SetState("Running")
+	mockPortProvider.On("GetAvailablePort").Return(mockPort, nil).Once()
+	mockCommandExecutor.On("ExecCommand", "docker", "compose", "-f", mockComposeFile, "-f", mockOverrideFile, "pull").Return(mockExecCommand("", 0)).Once()
+	mockCommandExecutor.On("ExecCommand", "docker", "compose", "-f", mockComposeFile, "-f", mockOverrideFile, "up", "-d").Return(mockExecCommand("", 0)).Once()
+	mockSecwareAccessor.On("GetSecwareMeta", mock.Anything, &mockState).Return(mgr.SecwareMeta{SecwareId: 111, SecwareVersion: 222}, nil).Once()
+	mockSecwareAccessor.On("GetSecwareHealth", mock.Anything, &mockState).Return(mgr.SecwareHealth{Health: true}, nil).Once()
+
+	state, err := runner.ComposeUp(111, 222, mockComposeFile)
+	if err != nil {
+		t.Fatalf("ComposeUp() error = %v", err)
+	}
+	if state.GetState() != "Available" {
+		t.Errorf("ComposeUp() = %v, want %v", state.GetState(), "Available")
+	}
+
+	override, err := os.ReadFile(mockOverrideFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(override), "mem_limit: 1073741824") || !strings.Contains(string(override), "cpus: 1") {
+		t.Errorf("unexpected override file: %s", override)
+	}
+}
+
+func TestComposeUpSplitsResourceLimits(t *testing.T) {
+	runner := newTestRunner()
+	runner.ResourceProfile = config.ResourceProfile{CPUs: 2, Memory: 2 << 30}
+
+	mockPortProvider := runner.PortProviderIntf.(*mocks.PortProvider)
+	mockCommandExecutor := runner.CommandExecutorIntf.(*mocks.CommandExecutor)
+	mockSecwareAccessor := runner.SecwareAccessorIntf.(*mocks.SecwareAccessor)
+
+	dir := t.TempDir()
+	mockComposeFile := filepath.Join(dir, "testsecware-111-222.yml")
+	mockOverrideFile := filepath.Join(dir, "testsecware-111-222.resources.yml")
+	composeContent := `
+services:
+  db:
+    image: test/db:latest
+    deploy:
+      resources:
+        limits:
+          cpus: "0.5"
+          memory: 256m
+  secware:
+    image: test/secware:latest
+    deploy:
+      resources:
+        reservations:
+          cpus: "1"
+          memory: 512m
+  worker:
+    image: test/worker:latest
+`
+	if err := os.WriteFile(mockComposeFile, []byte(composeContent), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	mockPortProvider.On("GetAvailablePort").Return(6789, nil).Once()
+	mockCommandExecutor.On("ExecCommand", "docker", "compose", "-f", mockComposeFile, "-f", mockOverrideFile, "pull").Return(mockExecCommand("", 0)).Once()
+	mockCommandExecutor.On("ExecCommand", "docker", "compose", "-f", mockComposeFile, "-f", mockOverrideFile, "up", "-d").Return(mockExecCommand("", 0)).Once()
+	mockSecwareAccessor.On("GetSecwareMeta", mock.Anything, mock.Anything).Return(mgr.SecwareMeta{SecwareId: 111, SecwareVersion: 222}, nil).Once()
+	mockSecwareAccessor.On("GetSecwareHealth", mock.Anything, mock.Anything).Return(mgr.SecwareHealth{Health: true}, nil).Once()
+
+	if _, err := runner.ComposeUp(111, 222, mockComposeFile); err != nil {
+		t.Fatalf("ComposeUp() error = %v", err)
+	}
+
+	data, err := os.ReadFile(mockOverrideFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var override struct {
+		Services map[string]struct {
+			CPUs     float64 `yaml:"cpus"`
+			MemLimit int64   `yaml:"mem_limit"`
+		} `yaml:"services"`
+	}
+	if err := yaml.Unmarshal(data, &override); err != nil {
+		t.Fatal(err)
+	}
+
+	// db 保留 compose 文件中的上限，其余的 service 在 reservation 之外平分剩余的资源，总和不超过 node class 的上限
+	db, secware, worker := override.Services["db"], override.Services["secware"], override.Services["worker"]
+	if db.CPUs != 0 || db.MemLimit != 0 {
+		t.Errorf("expect limits of db to be kept, got %s", data)
+	}
+	if secware.CPUs != 1.25 || secware.MemLimit != 1152<<20 {
+		t.Errorf("unexpected limits of secware: %s", data)
+	}
+	if worker.CPUs != 0.25 || worker.MemLimit != 640<<20 {
+		t.Errorf("unexpected limits of worker: %s", data)
+	}
+}
+
+func TestComposeUpExceedsNodeClass(t *testing.T) {
+	runner := newTestRunner()
+	runner.ResourceProfile = config.ResourceProfile{CPUs: 1, Memory: 1 << 30}
+
+	mockComposeFile := filepath.Join(t.TempDir(), "testsecware-111-222.yml")
+	composeContent := `
+services:
+  secware:
+    image: test/secware:latest
+    deploy:
+      resources:
+        reservations:
+          memory: 2g
+`
+	if err := os.WriteFile(mockComposeFile, []byte(composeContent), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := runner.ComposeUp(111, 222, mockComposeFile)
+	if err == nil {
+		t.Fatal("ComposeUp() expect error for secware exceeding node class")
+	}
+}
+
+func TestComposeUpLimitsExceedNodeClass(t *testing.T) {
+	runner := newTestRunner()
+	runner.ResourceProfile = config.ResourceProfile{CPUs: 1, Memory: 1 << 30}
+
+	mockComposeFile := filepath.Join(t.TempDir(), "testsecware-111-222.yml")
+	composeContent := `
+services:
+  secware:
+    image: test/secware:latest
+    deploy:
+      resources:
+        limits:
+          cpus: "0.8"
+  worker:
+    image: test/worker:latest
+    deploy:
+      resources:
+        reservations:
+          cpus: "0.5"
+`
+	if err := os.WriteFile(mockComposeFile, []byte(composeContent), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := runner.ComposeUp(111, 222, mockComposeFile)
+	if err == nil || !strings.Contains(err.Error(), "exceed node class limit") {
+		t.Fatalf("ComposeUp() expect error for limits exceeding node class, got %v", err)
+	}
+}
+
+func TestRunnerReconcile(t *testing.T) {
+	for _, policy := range []string{config.SecwareOrphanAdopt, config.SecwareOrphanRemove} {
+		t.Run(policy, func(t *testing.T) {
+			st, err := state.NewAvsDbState(config.Config{DataPath: t.TempDir()})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer st.Close()
+
+			runner := newTestRunner()
+			runner.Registry = st
+			runner.OrphanPolicy = policy
+			mockCommandExecutor := runner.CommandExecutorIntf.(*mocks.CommandExecutor)
+
+			expired := time.Now().Add(-31 * 24 * time.Hour).Unix()
+			for _, p := range []*state.SecwareProject{
+				{SecwareId: 1, SecwareVersion: 1, ProjectName: "testsecware-1-1-1001", Port: 1001, State: mgr.StateAvailable},
+				{SecwareId: 2, SecwareVersion: 1, ProjectName: "testsecware-2-1-1002", Port: 1002, State: mgr.StateAvailable},
+				{SecwareId: 4, SecwareVersion: 1, ProjectName: "testsecware-4-1-1004", Port: 1004, State: mgr.StateDown, StoppedAt: expired},
+			} {
+				if err := st.SaveSecwareProject(p); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			// 1-1 有记录，3-1 是 orphan，1-1-1005 和有记录的 1-1 重复，2-1 已经不存在
+			projects := `[{"Name":"testsecware-1-1-1001"},{"Name":"testsecware-3-1-1003"},{"Name":"testsecware-1-1-1005"},{"Name":"other-project"}]`
+			mockCommandExecutor.On("ExecCommand", "docker", "compose", "ls", "--format", "json").Return(mockExecCommand(projects, 0)).Once()
+			mockCommandExecutor.On("ExecCommand", "docker", "compose", "-p", "testsecware-1-1-1005", "down").Return(mockExecCommand("", 0)).Once()
+			if policy == config.SecwareOrphanRemove {
+				mockCommandExecutor.On("ExecCommand", "docker", "compose", "-p", "testsecware-3-1-1003", "down").Return(mockExecCommand("", 0)).Once()
+			}
+
+			if err := runner.Reconcile(); err != nil {
+				t.Fatal(err)
+			}
+			mockCommandExecutor.AssertExpectations(t)
+
+			project, err := st.GetSecwareProject(1, 1)
+			if err != nil || project.ProjectName != "testsecware-1-1-1001" || project.State != mgr.StateAvailable {
+				t.Errorf("expect recorded project to be kept, got %+v, %v", project, err)
+			}
+			project, err = st.GetSecwareProject(2, 1)
+			if err != nil || project.State != mgr.StateDown || project.StoppedAt == 0 {
+				t.Errorf("expect missing project to be marked down, got %+v, %v", project, err)
+			}
+			if _, err := st.GetSecwareProject(4, 1); !errors.Is(err, state.ErrSecwareProjectNotFound) {
+				t.Errorf("expect expired record to be deleted, got %v", err)
+			}
+			project, err = st.GetSecwareProject(3, 1)
+			if policy == config.SecwareOrphanAdopt {
+				if err != nil || !project.Adopted || project.Port != 1003 || project.State != mgr.StateRunning {
+					t.Errorf("expect orphan to be adopted, got %+v, %v", project, err)
+				}
+			} else if !errors.Is(err, state.ErrSecwareProjectNotFound) {
+				t.Errorf("expect removed orphan not to be recorded, got %+v, %v", project, err)
+			}
+		})
+	}
+}
+
+func TestRunnerRegistry(t *testing.T) {
+	st, err := state.NewAvsDbState(config.Config{DataPath: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.Close()
+
+	runner := newTestRunner()
+	runner.Registry = st
+	mockPortProvider := runner.PortProviderIntf.(*mocks.PortProvider)
+	mockCommandExecutor := runner.CommandExecutorIntf.(*mocks.CommandExecutor)
+	mockSecwareAccessor := runner.SecwareAccessorIntf.(*mocks.SecwareAccessor)
+
+	composeFile := filepath.Join(t.TempDir(), "testsecware-111-222.yml")
+	if err := os.WriteFile(composeFile, []byte("services: {}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	mockPortProvider.On("GetAvailablePort").Return(6789, nil)
+	mockSecwareAccessor.On("GetSecwareMeta", mock.Anything, mock.Anything).Return(mgr.SecwareMeta{SecwareId: 111, SecwareVersion: 222}, nil)
+	mockSecwareAccessor.On("GetSecwareHealth", mock.Anything, mock.Anything).Return(mgr.SecwareHealth{Health: true}, nil)
+	mockSecwareAccessor.On("CloseConnections", mock.Anything).Return()
+
+	for i := 0; i < 2; i++ {
+		mockCommandExecutor.On("ExecCommand", "docker", "compose", "-f", composeFile, "pull").Return(mockExecCommand("", 0)).Once()
+		mockCommandExecutor.On("ExecCommand", "docker", "compose", "-f", composeFile, "up", "-d").Return(mockExecCommand("", 0)).Once()
+		mockCommandExecutor.On("ExecCommand", "docker", "compose", "-p", "testsecware-111-222-6789", "down").Return(mockExecCommand("", 0)).Once()
+
+		status, err := runner.ComposeUp(111, 222, composeFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		project, err := st.GetSecwareProject(111, 222)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if project.State != mgr.StateRunning || project.RestartCount != i || project.ComposeHash == "" || project.LastError != "" {
+			t.Errorf("expect running record with restart count %d, got %+v", i, project)
+		}
+
+		status.SetState(mgr.StateUnhealthy)
+		if _, err := runner.ComposeDown(status); err != nil {
+			t.Fatal(err)
+		}
+		project, err = st.GetSecwareProject(111, 222)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if project.State != mgr.StateDown || project.LastError != "secware is Unhealthy" {
+			t.Errorf("expect down record with last error, got %+v", project)
+		}
 	}
 }
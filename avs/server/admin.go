@@ -0,0 +1,188 @@
+// Package server: 管理接口，只监听本机地址或 unix socket，供运维人员查看和控制 secware
+package server
+
+import (
+	"crypto/subtle"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"goplus/avs/secwaremanager"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+type adminSecwareStatus struct {
+	SecwareId          int    `json:"id"`
+	SecwareVersion     int    `json:"version"`
+	Port               int    `json:"port"`
+	Socket             string `json:"socket,omitempty"`
+	State              string `json:"state"`
+	ComposeProjectName string `json:"project"`
+	InFlight           int64  `json:"in_flight"`
+}
+
+func newAdminSecwareStatus(s *secwaremanager.SecwareStatus) adminSecwareStatus {
+	return adminSecwareStatus{
+		SecwareId:          s.SecwareId,
+		SecwareVersion:     s.SecwareVersion,
+		Port:               s.Port,
+		Socket:             s.SocketPath,
+		State:              s.GetState(),
+		ComposeProjectName: s.ComposeProjectName,
+		InFlight:           s.InFlight(),
+	}
+}
+
+// adminListen 监听管理接口的地址，unix:// 开头时使用 unix socket
+func adminListen(listen string) (net.Listener, error) {
+	if !strings.HasPrefix(listen, "unix://") {
+		return net.Listen("tcp", listen)
+	}
+
+	path := strings.TrimPrefix(listen, "unix://")
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, 0600); err != nil {
+		_ = listener.Close()
+		return nil, err
+	}
+	return listener, nil
+}
+
+func (a *Server) adminRoutes() *gin.Engine {
+	route := gin.New()
+
+	gl := &ginLogger{logger: a.logger}
+	route.Use(gin.LoggerWithWriter(gl))
+	route.Use(gin.Recovery())
+	route.Use(a.adminAuth)
+
+	route.GET("/admin/status", a.adminStatus)
+	route.GET("/admin/secwares", a.adminListSecwares)
+	route.POST("/admin/secwares/:project/restart", a.adminRestartSecware)
+	route.POST("/admin/secwares/:project/stop", a.adminStopSecware)
+	route.GET("/admin/secwares/:project/containers", a.adminSecwareContainers)
+	route.GET("/admin/secwares/:project/logs", a.adminSecwareLogs)
+	route.GET("/admin/registry", a.adminListRegistry)
+	route.GET("/admin/sync", a.adminLastSync)
+	route.POST("/admin/sync", a.adminSync)
+	return route
+}
+
+// adminAuth 校验请求头中的 Authorization: Bearer <ADMIN_TOKEN>，不接受没有 Bearer 前缀的 token
+func (a *Server) adminAuth(c *gin.Context) {
+	token, found := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+	if !found || a.config.AdminToken == "" || subtle.ConstantTimeCompare([]byte(token), []byte(a.config.AdminToken)) != 1 {
+		c.AbortWithStatusJSON(401, gin.H{"code": 401, "message": "unauthorized"})
+		return
+	}
+	c.Next()
+}
+
+func (a *Server) adminListSecwares(c *gin.Context) {
+	secwares := a.secwareManager.ListSecwares()
+	result := make([]adminSecwareStatus, len(secwares))
+	for idx, s := range secwares {
+		result[idx] = newAdminSecwareStatus(s)
+	}
+	c.JSON(200, gin.H{"code": 200, "message": "ok", "result": result})
+}
+
+// adminListRegistry 返回持久化的 secware project 记录，包括已经停止的版本
+func (a *Server) adminListRegistry(c *gin.Context) {
+	projects, err := a.secwareManager.ListSecwareProjects()
+	if err != nil {
+		c.JSON(500, gin.H{"code": 500, "message": err.Error()})
+		return
+	}
+	c.JSON(200, gin.H{"code": 200, "message": "ok", "result": projects})
+}
+
+func (a *Server) adminSync(c *gin.Context) {
+	_, err := a.secwareManager.SyncSecware()
+	if err != nil {
+		a.logger.Errorf("Admin sync secware failed: %v", err)
+	}
+	c.JSON(200, gin.H{"code": 200, "message": "ok", "result": a.secwareManager.GetLastSyncReport()})
+}
+
+func (a *Server) adminLastSync(c *gin.Context) {
+	c.JSON(200, gin.H{"code": 200, "message": "ok", "result": a.secwareManager.GetLastSyncReport()})
+}
+
+func (a *Server) adminRestartSecware(c *gin.Context) {
+	status, err := a.secwareManager.RestartSecware(c.Param("project"))
+	a.adminSecwareResponse(c, status, err)
+}
+
+func (a *Server) adminStopSecware(c *gin.Context) {
+	status, err := a.secwareManager.StopSecware(c.Param("project"))
+	a.adminSecwareResponse(c, status, err)
+}
+
+func (a *Server) adminSecwareContainers(c *gin.Context) {
+	containers, err := a.secwareManager.InspectSecware(c.Param("project"))
+	if err != nil {
+		a.adminInspectError(c, err)
+		return
+	}
+	c.JSON(200, gin.H{"code": 200, "message": "ok", "result": containers})
+}
+
+// adminSecwareLogs 返回一个 service 最后 tail 行的日志，tail 默认为 100
+func (a *Server) adminSecwareLogs(c *gin.Context) {
+	tail := 100
+	if v := c.Query("tail"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			c.JSON(400, gin.H{"code": 400, "message": "invalid tail"})
+			return
+		}
+		tail = n
+	}
+	service := c.Query("service")
+	if service == "" {
+		c.JSON(400, gin.H{"code": 400, "message": "service is required"})
+		return
+	}
+
+	logs, err := a.secwareManager.SecwareLogs(c.Param("project"), service, tail)
+	if err != nil {
+		a.adminInspectError(c, err)
+		return
+	}
+	c.JSON(200, gin.H{"code": 200, "message": "ok", "result": logs})
+}
+
+func (a *Server) adminInspectError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, secwaremanager.ErrContainerInspectUnsupported):
+		c.JSON(501, gin.H{"code": 501, "message": err.Error()})
+	case errors.Is(err, secwaremanager.ErrSecwareProjectNotFound):
+		c.JSON(404, gin.H{"code": 404, "message": err.Error()})
+	default:
+		c.JSON(500, gin.H{"code": 500, "message": err.Error()})
+	}
+}
+
+func (a *Server) adminSecwareResponse(c *gin.Context, status *secwaremanager.SecwareStatus, err error) {
+	if errors.Is(err, secwaremanager.ErrSecwareProjectNotFound) {
+		c.JSON(404, gin.H{"code": 404, "message": err.Error()})
+		return
+	}
+	if errors.Is(err, secwaremanager.ErrSecwareProjectDraining) {
+		c.JSON(409, gin.H{"code": 409, "message": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(500, gin.H{"code": 500, "message": err.Error()})
+		return
+	}
+	c.JSON(200, gin.H{"code": 200, "message": "ok", "result": newAdminSecwareStatus(status)})
+}
@@ -0,0 +1,88 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"github.com/Layr-Labs/eigensdk-go/logging"
+	"goplus/avs/config"
+	"goplus/avs/secwaremanager"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+func TestAdminAuth(t *testing.T) {
+	logger, _ := logging.NewZapLogger(logging.Development)
+	mgr, err := secwaremanager.NewSecwareManager(config.Config{Logger: logger, ComposeFilePath: t.TempDir()}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	svr := &Server{config: config.Config{AdminToken: "admin-token"}, logger: logger, secwareManager: mgr}
+	route := svr.adminRoutes()
+
+	for _, tc := range []struct {
+		header string
+		code   int
+	}{
+		{"", http.StatusUnauthorized},
+		{"Bearer wrong-token", http.StatusUnauthorized},
+		{"admin-token", http.StatusUnauthorized},
+		{"Basic admin-token", http.StatusUnauthorized},
+		{"Bearer admin-token", http.StatusOK},
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/admin/secwares", nil)
+		if tc.header != "" {
+			req.Header.Set("Authorization", tc.header)
+		}
+		w := httptest.NewRecorder()
+		route.ServeHTTP(w, req)
+		if w.Code != tc.code {
+			t.Errorf("authorization %q: expect %d, got %d", tc.header, tc.code, w.Code)
+		}
+	}
+}
+
+func TestAdminSecwareContainers_Unsupported(t *testing.T) {
+	logger, _ := logging.NewZapLogger(logging.Development)
+	mgr, err := secwaremanager.NewSecwareManager(config.Config{Logger: logger, ComposeFilePath: t.TempDir()}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	svr := &Server{config: config.Config{AdminToken: "admin-token"}, logger: logger, secwareManager: mgr}
+	route := svr.adminRoutes()
+
+	for _, path := range []string{"/admin/secwares/secware-1-1-7777/containers", "/admin/secwares/secware-1-1-7777/logs?service=api"} {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Authorization", "Bearer admin-token")
+		w := httptest.NewRecorder()
+		route.ServeHTTP(w, req)
+		if w.Code != http.StatusNotImplemented {
+			t.Errorf("%s: expect %d with the compose runner, got %d", path, http.StatusNotImplemented, w.Code)
+		}
+	}
+}
+
+func TestStart_AdminListenError(t *testing.T) {
+	logger, _ := logging.NewZapLogger(logging.Development)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+	_ = listener.Close()
+
+	adminListen := "unix://" + filepath.Join(t.TempDir(), "missing", "admin.sock")
+	svr := &Server{config: config.Config{APIPort: port, AdminListen: adminListen}, logger: logger}
+	if err := svr.Start(context.Background()); err == nil {
+		t.Fatal("expect error when admin api cannot listen")
+	}
+
+	// API server 没有被启动，端口仍然可用
+	listener, err = net.Listen("tcp", fmt.Sprintf(":%d", port))
+	if err != nil {
+		t.Fatalf("expect api port to be free, got %v", err)
+	}
+	_ = listener.Close()
+}
@@ -2,12 +2,35 @@
 package server
 
 import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/ethereum/go-ethereum/common"
 	"github.com/gin-gonic/gin"
+	"goplus/avs/secwaremanager"
+	"goplus/avs/state"
 	"goplus/shared/pkg/signature"
 	"goplus/shared/pkg/types"
+	"net"
 	"time"
 )
 
+// SignedOperatorResponse.Code 的取值
+const (
+	CodeOk              = 200
+	CodeSignFailed      = 400
+	CodeBadRequest      = 401
+	CodeBadSignature    = 402
+	CodeSecwareNotFound = 403
+	CodeTaskExpired     = 405 // 当前时间不在 task 的 StartTime/EndTime 范围内
+	CodeTaskReplayed    = 406 // task 已经被处理过
+	CodeResultRejected  = 407 // secware 的结果未通过校验
+	CodeSecwareBusy     = 408 // secware 的等待队列已满，或在队列中等到了 task 的截止时间
+	CodeTaskCacheFull   = 409 // 已处理 task 的缓存中都是未过期的记录，暂时不能接收新的 task
+	CodeInternalError   = 500
+)
+
 type echoRequest struct {
 	Data string `json:"data"`
 }
@@ -32,49 +55,303 @@ func (a *Server) handleTask(c *gin.Context) {
 	taskStartTime := time.Now()
 	task := types.SignedSecwareTask{}
 	if err := c.ShouldBindJSON(&task); err != nil {
-		c.JSON(400, NewErrorOperatorResponse(401, err.Error()))
+		c.JSON(400, NewErrorOperatorResponse(CodeBadRequest, err.Error()))
+		a.metricsIntf.IncTaskFailed()
+		return
+	}
+
+	if !signature.VerifySignedSecwareTaskWithAddress(&task, a.getGatewayAddress()) {
+		c.JSON(400, NewErrorOperatorResponse(CodeBadSignature, "bad SignedSecwareTask"))
+		a.metricsIntf.IncTaskFailed()
+		return
+	}
+
+	// 无法校验结果的 secware 不处理 task，避免在 secware 上浪费资源
+	if _, ok := a.getSecwareKey(task.Task.SecwareId, task.Task.SecwareVersion); !ok {
+		c.JSON(400, NewErrorOperatorResponse(CodeResultRejected, fmt.Sprintf("no key to verify results of secware %d-%d", task.Task.SecwareId, task.Task.SecwareVersion)))
 		a.metricsIntf.IncTaskFailed()
 		return
 	}
 
-	if !signature.VerifySignedSecwareTaskWithAddress(&task, a.config.AddressGateway) {
-		c.JSON(400, NewErrorOperatorResponse(402, "bad SignedSecwareTask"))
+	// 过期和重放的 task 不写入账本，避免覆盖原有的记录
+	if err := a.checkTaskTime(&task.Task, taskStartTime); err != nil {
+		c.JSON(400, NewErrorOperatorResponse(CodeTaskExpired, err.Error()))
 		a.metricsIntf.IncTaskFailed()
 		return
 	}
 
-	state, err := a.secwareManager.GetSecwareState(task.Task.SecwareId, task.Task.SecwareVersion)
+	taskHash, err := signature.HashJSON(task.Task)
 	if err != nil {
-		c.JSON(400, NewErrorOperatorResponse(403, err.Error()))
+		c.JSON(400, NewErrorOperatorResponse(CodeBadRequest, err.Error()))
 		a.metricsIntf.IncTaskFailed()
 		return
 	}
 
-	task.Operator = a.config.AddressOperator[:]
-	result, err := a.secwareAccessorIntf.HandleTask(state, &task)
+	// 在标记 task 之前排队，返回 busy 的 task 可以被 Gateway 重新派发
+	secwareName := fmt.Sprintf("%d-%d", task.Task.SecwareId, task.Task.SecwareVersion)
+	queueCtx, cancel := context.WithDeadline(c.Request.Context(), time.Unix(int64(task.Task.EndTime), 0))
+	releaseSlot, err := a.taskLimiter.acquire(queueCtx, secwareName)
+	cancel()
 	if err != nil {
-		c.JSON(400, NewErrorOperatorResponse(404, err.Error()))
+		message := fmt.Sprintf("secware %s busy, queue is full", secwareName)
+		if !errors.Is(err, errSecwareBusy) {
+			message = fmt.Sprintf("secware %s busy, task deadline reached in queue", secwareName)
+		}
+		c.JSON(503, NewErrorOperatorResponse(CodeSecwareBusy, message))
+		a.metricsIntf.IncTaskBusy()
+		a.metricsIntf.IncTaskFailed()
+		return
+	}
+	slotReleased := false
+	defer func() {
+		if !slotReleased {
+			releaseSlot()
+		}
+	}()
+
+	expireAt := int64(task.Task.EndTime) + int64(a.getTaskClockSkew().Seconds())
+	fresh, err := a.stateIntf.MarkTaskSeen(taskHash, expireAt)
+	if errors.Is(err, state.ErrSeenTasksFull) {
+		c.JSON(503, NewErrorOperatorResponse(CodeTaskCacheFull, err.Error()))
 		a.metricsIntf.IncTaskFailed()
 		return
 	}
-	signResult, err := signature.SignBLSOperatorResult(&result, a.config.BLSKeypair)
 	if err != nil {
-		c.JSON(400, NewErrorOperatorResponse(400, err.Error()))
+		a.logger.Errorf("Failed to mark task %s seen: %v", taskHash.Hex(), err)
+		c.JSON(500, NewErrorOperatorResponse(CodeInternalError, "internal error"))
 		a.metricsIntf.IncTaskFailed()
 		return
 	}
+	if !fresh {
+		c.JSON(400, NewErrorOperatorResponse(CodeTaskReplayed, "task already handled"))
+		a.metricsIntf.IncTaskFailed()
+		return
+	}
+
+	secwareState, err := a.secwareManager.AcquireSecware(task.Task.SecwareId, task.Task.SecwareVersion, time.Unix(int64(task.Task.EndTime), 0))
+	if err != nil {
+		a.unmarkTask(taskHash)
+		a.finishTask(c, &task, taskHash, taskStartTime, 400, NewErrorOperatorResponse(CodeSecwareNotFound, err.Error()))
+		return
+	}
 
-	taskDuration := time.Since(taskStartTime).Seconds()
-	a.metricsIntf.IncTaskHandled()
-	a.metricsIntf.SetTaskDuration(taskDuration)
+	task.Operator = a.config.AddressOperator[:]
+	message := "ok"
+	slotReleased = true
+	result, err := a.callSecware(c.Request.Context(), secwareState, &task, releaseSlot)
+	if err != nil {
+		// Secware 超时或崩溃时，由 Operator 填写并签名结果，其他错误不能归咎于 secware，不签名。
+		// task 已经交给了 secware，保留记录直到过期，避免断开连接后重发的 task 再次占用 secware
+		var attributable bool
+		result, attributable = newOperatorFilledResult(&task, err)
+		if errors.Is(err, errTaskExpired) {
+			a.finishTask(c, &task, taskHash, taskStartTime, 400, NewErrorOperatorResponse(CodeTaskExpired, err.Error()))
+			return
+		}
+		if !attributable {
+			a.logger.Errorf("Failed to call secware %d-%d for task %s: %v", task.Task.SecwareId, task.Task.SecwareVersion, taskHash.Hex(), err)
+			a.finishTask(c, &task, taskHash, taskStartTime, 500, NewErrorOperatorResponse(CodeInternalError, "failed to call secware"))
+			return
+		}
+		message = result.Result.Message
+		a.logger.Warnf("Secware %d-%d failed to handle task %s: %v", task.Task.SecwareId, task.Task.SecwareVersion, taskHash.Hex(), err)
+	} else if err := a.verifySecwareResult(&task, &result); err != nil {
+		a.metricsIntf.IncSecwareResultRejected()
+		a.logger.Warnf("Secware %d-%d result of task %s rejected: %v", task.Task.SecwareId, task.Task.SecwareVersion, taskHash.Hex(), err)
+		a.finishTask(c, &task, taskHash, taskStartTime, 400, NewErrorOperatorResponse(CodeResultRejected, err.Error()))
+		return
+	}
+
+	signResult, err := signature.SignBLSOperatorResult(&result, a.config.BLSSigner)
+	if err != nil {
+		a.finishTask(c, &task, taskHash, taskStartTime, 400, NewErrorOperatorResponse(CodeSignFailed, err.Error()))
+		return
+	}
 
 	response := SignedOperatorResponse{
-		Code:        200,
-		Message:     "ok",
+		Code:        CodeOk,
+		Message:     message,
 		Result:      &signResult.Result,
 		SigOperator: &signResult.SigOperator,
 	}
-	c.JSON(200, response)
+	a.finishTask(c, &task, taskHash, taskStartTime, 200, response)
+}
+
+var (
+	errSecwareTimeout = errors.New("secware timeout")
+	errTaskExpired    = errors.New("task end time passed before it reached the secware")
+)
+
+// callSecware 把 task 交给 secware 处理。访问 secware 的请求只以 task 的 EndTime 作为截止时间，
+// Gateway 断开连接时不取消，secware 处理完之前不会释放 secware 和 releaseSlot 占用的并发。
+// 只有在 EndTime 之前交给了 secware，到了 EndTime 仍未返回时才返回 errSecwareTimeout，
+// 来不及交给 secware 时返回 errTaskExpired，在此之前 ctx 结束时返回 ctx 的错误，不再等待 secware
+func (a *Server) callSecware(ctx context.Context, state *secwaremanager.SecwareStatus, task *types.SignedSecwareTask, releaseSlot func()) (types.SignedSecwareResult, error) {
+	deadline := time.Unix(int64(task.Task.EndTime), 0)
+	if !time.Now().Before(deadline) {
+		a.secwareManager.ReleaseSecware(state)
+		releaseSlot()
+		return types.SignedSecwareResult{}, errTaskExpired
+	}
+	secwareCtx, cancel := context.WithDeadline(context.WithoutCancel(ctx), deadline)
+
+	type handleResult struct {
+		result types.SignedSecwareResult
+		err    error
+	}
+	done := make(chan handleResult, 1)
+	go func() {
+		defer releaseSlot()
+		defer a.secwareManager.ReleaseSecware(state)
+		defer cancel()
+		result, err := a.secwareAccessorIntf.HandleTask(secwareCtx, state, task)
+		done <- handleResult{result: result, err: err}
+	}()
+
+	timer := time.NewTimer(time.Until(deadline))
+	defer timer.Stop()
+
+	var r handleResult
+	select {
+	case r = <-done:
+	case <-timer.C:
+		r.err = context.DeadlineExceeded
+	case <-ctx.Done():
+		r.err = ctx.Err()
+	}
+
+	var netErr net.Error
+	if r.err != nil && !time.Now().Before(deadline) && (errors.Is(r.err, context.DeadlineExceeded) || (errors.As(r.err, &netErr) && netErr.Timeout())) {
+		return types.SignedSecwareResult{}, errSecwareTimeout
+	}
+	return r.result, r.err
+}
+
+// verifySecwareResult 检查 secware 返回的结果是否对应当前的 task，并使用该 secware 版本的密钥校验其 HMAC。
+// 没有配置密钥的 secware 的结果一律拒绝
+func (a *Server) verifySecwareResult(task *types.SignedSecwareTask, result *types.SignedSecwareResult) error {
+	if result.Result.SecwareId != task.Task.SecwareId || result.Result.SecwareVersion != task.Task.SecwareVersion {
+		return fmt.Errorf("result is from secware %d-%d", result.Result.SecwareId, result.Result.SecwareVersion)
+	}
+	if !bytes.Equal(result.Result.Operator, task.Operator) {
+		return fmt.Errorf("result is for operator %s", result.Result.Operator)
+	}
+
+	key, ok := a.getSecwareKey(task.Task.SecwareId, task.Task.SecwareVersion)
+	if !ok {
+		return fmt.Errorf("no key to verify results of secware %d-%d", task.Task.SecwareId, task.Task.SecwareVersion)
+	}
+	if !signature.VerifySecwareSignature(result, key) {
+		return errors.New("bad secware signature")
+	}
+	return nil
+}
+
+func (a *Server) getSecwareKey(secwareId int, secwareVersion int) (types.HexBytes, bool) {
+	keys := a.secwareKeys.Load()
+	if keys == nil {
+		return nil, false
+	}
+	key, ok := (*keys)[fmt.Sprintf("%d-%d", secwareId, secwareVersion)]
+	return key, ok && len(key) > 0
+}
+
+// newOperatorFilledResult 根据 secware 的错误构造由 Operator 填写的结果。
+// 只有到了 task 的 EndTime 仍未返回，或者 secware 自身出错时才能填写结果，否则返回 false
+func newOperatorFilledResult(task *types.SignedSecwareTask, err error) (types.SignedSecwareResult, bool) {
+	var code int
+	var message string
+	switch {
+	case errors.Is(err, errSecwareTimeout):
+		code = types.SecwareCodeTimeout
+		message = "secware timeout"
+	case secwaremanager.IsSecwareFault(err):
+		code = types.SecwareCodeCrash
+		message = "secware crash"
+	default:
+		return types.SignedSecwareResult{}, false
+	}
+
+	return types.SignedSecwareResult{
+		Result: types.SecwareResult{
+			Code:           code,
+			Message:        message,
+			Details:        "{}",
+			Operator:       task.Operator,
+			SecwareId:      task.Task.SecwareId,
+			SecwareVersion: task.Task.SecwareVersion,
+		},
+	}, true
+}
+
+// checkTaskTime 检查当前时间是否在 task 的有效期内。StartTime 允许一定的时钟误差，
+// 到了 EndTime 的 task 不再交给 secware，否则 secware 没有收到 task 也会被判定为超时
+func (a *Server) checkTaskTime(task *types.SecwareTask, now time.Time) error {
+	skew := int64(a.getTaskClockSkew().Seconds())
+	ts := now.Unix()
+	if ts+skew < int64(task.StartTime) {
+		return fmt.Errorf("task not started yet, start time %d", task.StartTime)
+	}
+	if ts >= int64(task.EndTime) {
+		return fmt.Errorf("task expired, end time %d", task.EndTime)
+	}
+	return nil
+}
+
+// unmarkTask 删除还没有交给 secware 的 task 的记录，Gateway 重新派发时不会被当作重放。
+// 交给 secware 之后的 task 不能删除记录，否则重发同一个 task 可以反复占用 secware
+func (a *Server) unmarkTask(taskHash common.Hash) {
+	if err := a.stateIntf.UnmarkTaskSeen(taskHash); err != nil {
+		a.logger.Errorf("Failed to unmark task %s: %v", taskHash.Hex(), err)
+	}
+}
+
+// finishTask 返回 task 的处理结果，并将其记录到账本中
+func (a *Server) finishTask(c *gin.Context, task *types.SignedSecwareTask, taskHash common.Hash, taskStartTime time.Time, httpCode int, response SignedOperatorResponse) {
+	c.JSON(httpCode, response)
+
+	taskDuration := time.Since(taskStartTime)
+	outcome := state.OutcomeFailed
+	switch response.Code {
+	case CodeOk:
+		switch response.Result.Result.Code {
+		case types.SecwareCodeTimeout:
+			outcome = state.OutcomeTimeout
+		case types.SecwareCodeCrash:
+			outcome = state.OutcomeCrash
+		default:
+			outcome = state.OutcomeSigned
+		}
+	case CodeResultRejected:
+		outcome = state.OutcomeRejected
+	}
+
+	if response.Code == CodeOk {
+		a.metricsIntf.IncTaskHandled()
+		a.metricsIntf.SetTaskDuration(taskDuration.Seconds())
+	} else {
+		a.metricsIntf.IncTaskFailed()
+	}
+
+	record := state.TaskRecord{
+		TaskHash:       taskHash,
+		SecwareId:      task.Task.SecwareId,
+		SecwareVersion: task.Task.SecwareVersion,
+		SigGateway:     task.SigGateway,
+		Result:         response.Result,
+		Outcome:        outcome,
+		Code:           response.Code,
+		Message:        response.Message,
+		LatencyMs:      taskDuration.Milliseconds(),
+		CreatedAt:      taskStartTime.Unix(),
+	}
+	if response.SigOperator != nil {
+		record.SigOperator = *response.SigOperator
+	}
+
+	if err := a.stateIntf.SaveTaskRecord(&record); err != nil {
+		a.logger.Errorf("Failed to save task record %s: %v", taskHash.Hex(), err)
+	}
 }
 
 func (a *Server) ping(c *gin.Context) {
@@ -0,0 +1,260 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/mock"
+	"goplus/avs/secwaremanager"
+	"goplus/avs/secwaremanager/mocks"
+	"goplus/shared/pkg/signature"
+	"goplus/shared/pkg/types"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestCallSecware_Timeout(t *testing.T) {
+	accessor := &mocks.SecwareAccessor{}
+	svr := &Server{secwareManager: &secwaremanager.SecwareManager{}, secwareAccessorIntf: accessor}
+
+	state := &secwaremanager.SecwareStatus{SecwareId: 1, SecwareVersion: 2, Port: 7777}
+	task := &types.SignedSecwareTask{
+		Operator: types.HexBytes{0x11},
+		Task: types.SecwareTask{
+			SecwareId:      1,
+			SecwareVersion: 2,
+			EndTime:        types.HexInt64(time.Now().Add(time.Second).Unix()),
+		},
+	}
+	accessor.On("HandleTask", mock.Anything, state, task).After(3*time.Second).Return(types.SignedSecwareResult{}, nil).Once()
+
+	_, err := svr.callSecware(context.Background(), state, task, func() {})
+	if !errors.Is(err, errSecwareTimeout) {
+		t.Fatalf("expect errSecwareTimeout, got %v", err)
+	}
+
+	result, ok := newOperatorFilledResult(task, err)
+	if !ok || result.Result.Code != types.SecwareCodeTimeout {
+		t.Fatalf("expect code %d, got %d", types.SecwareCodeTimeout, result.Result.Code)
+	}
+	if result.Result.SecwareId != 1 || result.Result.SecwareVersion != 2 || result.Result.Operator.String() != "0x11" {
+		t.Fatalf("unexpected result %#v", result.Result)
+	}
+}
+
+func TestCallSecware_Canceled(t *testing.T) {
+	accessor := &mocks.SecwareAccessor{}
+	svr := &Server{secwareManager: &secwaremanager.SecwareManager{}, secwareAccessorIntf: accessor}
+
+	state := &secwaremanager.SecwareStatus{SecwareId: 1, SecwareVersion: 2, Port: 7777}
+	task := &types.SignedSecwareTask{
+		Task: types.SecwareTask{
+			SecwareId:      1,
+			SecwareVersion: 2,
+			EndTime:        types.HexInt64(time.Now().Add(time.Minute).Unix()),
+		},
+	}
+	accessor.On("HandleTask", mock.Anything, state, task).After(time.Second).Return(types.SignedSecwareResult{}, nil).Once()
+
+	// 在截止时间之前被取消，不能当作 secware 超时
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	_, err := svr.callSecware(ctx, state, task, func() {})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expect ctx error, got %v", err)
+	}
+	if _, ok := newOperatorFilledResult(task, err); ok {
+		t.Fatal("expect no operator filled result before the task end time")
+	}
+}
+
+func TestCallSecware_ClientGone(t *testing.T) {
+	accessor := &mocks.SecwareAccessor{}
+	svr := &Server{secwareManager: &secwaremanager.SecwareManager{}, secwareAccessorIntf: accessor}
+
+	state := &secwaremanager.SecwareStatus{SecwareId: 1, SecwareVersion: 2, Port: 7777}
+	task := &types.SignedSecwareTask{
+		Task: types.SecwareTask{
+			SecwareId:      1,
+			SecwareVersion: 2,
+			EndTime:        types.HexInt64(time.Now().Add(time.Minute).Unix()),
+		},
+	}
+	secwareCanceled := make(chan bool, 1)
+	accessor.On("HandleTask", mock.Anything, state, task).Run(func(args mock.Arguments) {
+		ctx := args.Get(0).(context.Context)
+		select {
+		case <-ctx.Done():
+			secwareCanceled <- true
+		case <-time.After(300 * time.Millisecond):
+			secwareCanceled <- false
+		}
+	}).Return(types.SignedSecwareResult{}, nil).Once()
+
+	// Gateway 断开连接后 callSecware 立即返回，但是不取消访问 secware 的请求
+	ctx, cancel := context.WithCancel(context.Background())
+	released := make(chan struct{})
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		cancel()
+	}()
+	_, err := svr.callSecware(ctx, state, task, func() { close(released) })
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expect ctx error, got %v", err)
+	}
+
+	select {
+	case <-released:
+		t.Fatal("slot released before secware returned")
+	default:
+	}
+	if <-secwareCanceled {
+		t.Fatal("secware request canceled with the client connection")
+	}
+	<-released
+}
+
+func TestCallSecware_Expired(t *testing.T) {
+	accessor := &mocks.SecwareAccessor{}
+	svr := &Server{secwareManager: &secwaremanager.SecwareManager{}, secwareAccessorIntf: accessor}
+
+	state := &secwaremanager.SecwareStatus{SecwareId: 1, SecwareVersion: 2, Port: 7777}
+	task := &types.SignedSecwareTask{
+		Task: types.SecwareTask{
+			SecwareId:      1,
+			SecwareVersion: 2,
+			EndTime:        types.HexInt64(time.Now().Unix()),
+		},
+	}
+
+	// 到了 EndTime 才轮到的 task 不交给 secware，也不能当作 secware 超时
+	released := false
+	_, err := svr.callSecware(context.Background(), state, task, func() { released = true })
+	if !errors.Is(err, errTaskExpired) {
+		t.Fatalf("expect errTaskExpired, got %v", err)
+	}
+	if !released {
+		t.Fatal("expect slot to be released")
+	}
+	if _, ok := newOperatorFilledResult(task, err); ok {
+		t.Fatal("expect no operator filled result for a task never sent to the secware")
+	}
+	accessor.AssertNotCalled(t, "HandleTask", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestCheckTaskTime(t *testing.T) {
+	svr := &Server{}
+	svr.taskClockSkew.Store(int64(5 * time.Second))
+
+	now := time.Unix(1000, 0)
+	cases := []struct {
+		start, end int64
+		ok         bool
+	}{
+		{1003, 1100, true}, // StartTime 允许时钟误差
+		{1006, 1100, false},
+		{900, 1001, true},
+		{900, 1000, false}, // EndTime 不允许时钟误差
+		{900, 997, false},
+	}
+	for _, tc := range cases {
+		task := &types.SecwareTask{StartTime: types.HexInt64(tc.start), EndTime: types.HexInt64(tc.end)}
+		if err := svr.checkTaskTime(task, now); (err == nil) != tc.ok {
+			t.Errorf("task %d-%d: expect ok %v, got %v", tc.start, tc.end, tc.ok, err)
+		}
+	}
+}
+
+func TestNewOperatorFilledResult_Crash(t *testing.T) {
+	task := &types.SignedSecwareTask{
+		Operator: types.HexBytes{0x11},
+		Task:     types.SecwareTask{SecwareId: 1, SecwareVersion: 2},
+	}
+
+	for _, err := range []error{
+		syscall.ECONNREFUSED,
+		&secwaremanager.SecwareStatusError{Path: "/secware", StatusCode: 500},
+		&secwaremanager.SecwareDecodeError{Path: "/secware", Err: errors.New("invalid character")},
+	} {
+		result, ok := newOperatorFilledResult(task, err)
+		if !ok || result.Result.Code != types.SecwareCodeCrash {
+			t.Fatalf("expect code %d for %v, got %d", types.SecwareCodeCrash, err, result.Result.Code)
+		}
+		if result.Result.Details != "{}" {
+			t.Fatalf("expect empty details, got %s", result.Result.Details)
+		}
+	}
+
+	// operator 本地的错误和取消不能归咎于 secware
+	for _, err := range []error{context.Canceled, syscall.EMFILE, errors.New("json: unsupported value")} {
+		if _, ok := newOperatorFilledResult(task, err); ok {
+			t.Fatalf("expect no operator filled result for %v", err)
+		}
+	}
+}
+
+func TestVerifySecwareResult(t *testing.T) {
+	key := []byte("secware-key")
+	keys := map[string]types.HexBytes{"1-2": key, "1-3": []byte("version-3-key")}
+	svr := &Server{}
+	svr.secwareKeys.Store(&keys)
+
+	task := &types.SignedSecwareTask{
+		Operator: types.HexBytes{0x11},
+		Task:     types.SecwareTask{SecwareId: 1, SecwareVersion: 2},
+	}
+	result := types.SecwareResult{
+		Code:           0,
+		Message:        "ok",
+		Details:        "{}",
+		Operator:       types.HexBytes{0x11},
+		SecwareId:      1,
+		SecwareVersion: 2,
+	}
+
+	signed, err := signature.SignSecwareResult(&result, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := svr.verifySecwareResult(task, signed); err != nil {
+		t.Fatalf("expect valid result, got %v", err)
+	}
+
+	badSig, _ := signature.SignSecwareResult(&result, []byte("other-key"))
+	if err := svr.verifySecwareResult(task, badSig); err == nil {
+		t.Fatal("expect bad signature to be rejected")
+	}
+
+	otherVersion := result
+	otherVersion.SecwareVersion = 3
+	signed, _ = signature.SignSecwareResult(&otherVersion, key)
+	if err := svr.verifySecwareResult(task, signed); err == nil {
+		t.Fatal("expect result of other version to be rejected")
+	}
+
+	// 密钥按版本区分，不能使用其他版本的密钥
+	task.Task.SecwareVersion = 3
+	if err := svr.verifySecwareResult(task, signed); err == nil {
+		t.Fatal("expect result signed with key of other version to be rejected")
+	}
+	task.Task.SecwareVersion = 2
+
+	// 没有配置密钥的 secware 的结果不会被签名
+	noKeyTask := &types.SignedSecwareTask{
+		Operator: types.HexBytes{0x11},
+		Task:     types.SecwareTask{SecwareId: 4, SecwareVersion: 1},
+	}
+	noKeyResult := result
+	noKeyResult.SecwareId = 4
+	noKeyResult.SecwareVersion = 1
+	if err := svr.verifySecwareResult(noKeyTask, &types.SignedSecwareResult{Result: noKeyResult}); err == nil {
+		t.Fatal("expect result of secware without key to be rejected")
+	}
+
+	otherOperator := result
+	otherOperator.Operator = types.HexBytes{0x22}
+	signed, _ = signature.SignSecwareResult(&otherOperator, key)
+	if err := svr.verifySecwareResult(task, signed); err == nil {
+		t.Fatal("expect result for other operator to be rejected")
+	}
+}
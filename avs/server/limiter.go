@@ -0,0 +1,159 @@
+// 限制每个 secware 同时处理的 task 数量，超出的 task 在有界队列中等待
+package server
+
+import (
+	"context"
+	"errors"
+	"goplus/avs/metrics"
+	"sync"
+	"time"
+)
+
+var errSecwareBusy = errors.New("secware busy")
+
+// secwareSlots 是单个 secware 正在处理和等待处理的 task
+type secwareSlots struct {
+	active  int
+	waiters []chan struct{}
+}
+
+// taskLimiter 按 secware 限制并发，等待的 task 按到达顺序获得处理的机会
+type taskLimiter struct {
+	lock           sync.Mutex
+	maxConcurrency int
+	queueDepth     int
+	secwares       map[string]*secwareSlots
+
+	metricsIntf metrics.AvsMetricsInterface
+}
+
+func newTaskLimiter(maxConcurrency int, queueDepth int, metricsIntf metrics.AvsMetricsInterface) *taskLimiter {
+	return &taskLimiter{
+		maxConcurrency: maxConcurrency,
+		queueDepth:     queueDepth,
+		secwares:       make(map[string]*secwareSlots),
+		metricsIntf:    metricsIntf,
+	}
+}
+
+// setLimits 修改并发和队列的上限，提高并发上限时立即唤醒等待的 task。
+// 已经在队列中的 task 不会因为队列上限降低而被拒绝
+func (l *taskLimiter) setLimits(maxConcurrency int, queueDepth int) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.maxConcurrency = maxConcurrency
+	l.queueDepth = queueDepth
+	for name, s := range l.secwares {
+		for s.active < l.maxConcurrency && len(s.waiters) > 0 {
+			l.handOver(name, s)
+		}
+	}
+}
+
+// acquire 获取 secware 处理 task 的机会，返回的 release 需要在 secware 处理完 task 后调用。
+// 队列已满时立即返回 errSecwareBusy，ctx 已经结束或者在队列中等到 ctx 结束时返回 ctx 的错误
+func (l *taskLimiter) acquire(ctx context.Context, name string) (release func(), err error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	l.lock.Lock()
+	s, ok := l.secwares[name]
+	if !ok {
+		s = &secwareSlots{}
+		l.secwares[name] = s
+	}
+	release = func() { l.release(name) }
+	if s.active < l.maxConcurrency && len(s.waiters) == 0 {
+		s.active++
+		l.lock.Unlock()
+		l.observeWait(name, 0)
+		return release, nil
+	}
+	if len(s.waiters) >= l.queueDepth {
+		l.lock.Unlock()
+		return nil, errSecwareBusy
+	}
+
+	waitStart := time.Now()
+	ready := make(chan struct{})
+	s.waiters = append(s.waiters, ready)
+	l.setQueueDepth(name, len(s.waiters))
+	l.lock.Unlock()
+
+	select {
+	case <-ready:
+		l.observeWait(name, time.Since(waitStart))
+		return release, nil
+	case <-ctx.Done():
+	}
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	for i, waiter := range s.waiters {
+		if waiter == ready {
+			s.waiters = append(s.waiters[:i], s.waiters[i+1:]...)
+			l.setQueueDepth(name, len(s.waiters))
+			l.cleanup(name, s)
+			return nil, ctx.Err()
+		}
+	}
+	// 在 ctx 结束的同时获得了处理的机会，交给下一个等待的 task
+	l.releaseLocked(name, s)
+	return nil, ctx.Err()
+}
+
+func (l *taskLimiter) release(name string) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if s, ok := l.secwares[name]; ok {
+		l.releaseLocked(name, s)
+	}
+}
+
+func (l *taskLimiter) releaseLocked(name string, s *secwareSlots) {
+	// 降低并发上限后，正在处理的 task 数量逐渐减少到新的上限以内
+	if s.active <= l.maxConcurrency && len(s.waiters) > 0 {
+		s.active--
+		l.handOver(name, s)
+		return
+	}
+	s.active--
+	l.cleanup(name, s)
+}
+
+// handOver 把处理的机会交给最早等待的 task
+func (l *taskLimiter) handOver(name string, s *secwareSlots) {
+	ready := s.waiters[0]
+	s.waiters = s.waiters[1:]
+	s.active++
+	close(ready)
+	l.setQueueDepth(name, len(s.waiters))
+}
+
+func (l *taskLimiter) cleanup(name string, s *secwareSlots) {
+	if s.active == 0 && len(s.waiters) == 0 {
+		delete(l.secwares, name)
+	}
+}
+
+// queued 返回 secware 在队列中等待的 task 数量
+func (l *taskLimiter) queued(name string) int {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if s, ok := l.secwares[name]; ok {
+		return len(s.waiters)
+	}
+	return 0
+}
+
+func (l *taskLimiter) setQueueDepth(name string, depth int) {
+	if l.metricsIntf != nil {
+		l.metricsIntf.SetSecwareQueueDepth(name, depth)
+	}
+}
+
+func (l *taskLimiter) observeWait(name string, wait time.Duration) {
+	if l.metricsIntf != nil {
+		l.metricsIntf.ObserveSecwareQueueWait(name, wait.Seconds())
+	}
+}
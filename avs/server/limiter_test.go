@@ -0,0 +1,123 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestTaskLimiter_Busy(t *testing.T) {
+	limiter := newTaskLimiter(1, 1, nil)
+
+	release, err := limiter.acquire(context.Background(), "1-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	acquired := make(chan func(), 1)
+	go func() {
+		r, err := limiter.acquire(context.Background(), "1-1")
+		if err != nil {
+			t.Errorf("expect queued task to be handled, got %v", err)
+		}
+		acquired <- r
+	}()
+	waitQueued(t, limiter, "1-1", 1)
+
+	start := time.Now()
+	if _, err := limiter.acquire(context.Background(), "1-1"); !errors.Is(err, errSecwareBusy) {
+		t.Fatalf("expect errSecwareBusy, got %v", err)
+	}
+	if time.Since(start) > 100*time.Millisecond {
+		t.Fatal("expect busy to be returned without waiting")
+	}
+
+	// 其他 secware 不受影响
+	otherRelease, err := limiter.acquire(context.Background(), "2-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherRelease()
+
+	release()
+	select {
+	case r := <-acquired:
+		r()
+	case <-time.After(time.Second):
+		t.Fatal("expect queued task to get the slot after release")
+	}
+	if len(limiter.secwares) != 0 {
+		t.Fatalf("expect no secware left, got %d", len(limiter.secwares))
+	}
+}
+
+func TestTaskLimiter_Deadline(t *testing.T) {
+	limiter := newTaskLimiter(1, 4, nil)
+
+	release, err := limiter.acquire(context.Background(), "1-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := limiter.acquire(ctx, "1-1"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expect context.DeadlineExceeded, got %v", err)
+	}
+	if queued := limiter.queued("1-1"); queued != 0 {
+		t.Fatalf("expect expired task to leave the queue, got %d queued", queued)
+	}
+
+	release()
+	if len(limiter.secwares) != 0 {
+		t.Fatalf("expect no secware left, got %d", len(limiter.secwares))
+	}
+
+	// ctx 已经结束时不分配空闲的并发
+	if _, err := limiter.acquire(ctx, "1-1"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expect context.DeadlineExceeded with a free slot, got %v", err)
+	}
+	if len(limiter.secwares) != 0 {
+		t.Fatalf("expect no secware left, got %d", len(limiter.secwares))
+	}
+}
+
+func TestTaskLimiter_SetLimits(t *testing.T) {
+	limiter := newTaskLimiter(1, 4, nil)
+
+	release, err := limiter.acquire(context.Background(), "1-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer release()
+
+	acquired := make(chan func(), 1)
+	go func() {
+		r, err := limiter.acquire(context.Background(), "1-1")
+		if err != nil {
+			t.Errorf("expect queued task to be handled, got %v", err)
+		}
+		acquired <- r
+	}()
+	waitQueued(t, limiter, "1-1", 1)
+
+	limiter.setLimits(2, 4)
+	select {
+	case r := <-acquired:
+		r()
+	case <-time.After(time.Second):
+		t.Fatal("expect queued task to get the slot after raising the limit")
+	}
+}
+
+func waitQueued(t *testing.T, limiter *taskLimiter, name string, n int) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for limiter.queued(name) != n {
+		if time.Now().After(deadline) {
+			t.Fatalf("expect %d queued tasks, got %d", n, limiter.queued(name))
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
@@ -0,0 +1,72 @@
+// Package server: /livez 和 /readyz 分别表示 operator 是否存活、是否可以接收 task
+package server
+
+import (
+	"context"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"time"
+)
+
+const probeRpcTimeout = 3 * time.Second
+
+type probeCheck struct {
+	Name    string `json:"name"`
+	Ok      bool   `json:"ok"`
+	Message string `json:"message,omitempty"`
+}
+
+func probeResponse(c *gin.Context, checks []probeCheck) {
+	for _, check := range checks {
+		if !check.Ok {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"code": http.StatusServiceUnavailable, "message": "not ok", "result": checks})
+			return
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"code": CodeOk, "message": "ok", "result": checks})
+}
+
+// livez 检查 secware 的同步和监控循环是否还在运行
+func (a *Server) livez(c *gin.Context) {
+	check := probeCheck{Name: "secware_manager", Ok: a.secwareManager.IsAlive()}
+	if !check.Ok {
+		check.Message = "secware manager or monitor loop is not running"
+	}
+	probeResponse(c, []probeCheck{check})
+}
+
+// readyz 检查最近是否成功同步过 secware 配置、是否有可用的 secware，以及 ETH RPC 是否可用
+func (a *Server) readyz(c *gin.Context) {
+	checks := make([]probeCheck, 0, 3)
+
+	// 允许偶尔有一次同步失败
+	sync := probeCheck{Name: "secware_sync", Ok: true}
+	lastSyncTime := a.secwareManager.GetLastSyncTime()
+	if lastSyncTime == 0 {
+		sync.Ok = false
+		sync.Message = "secware config never synced"
+	} else if age := time.Since(time.Unix(lastSyncTime, 0)); age > 3*a.secwareManager.GetSyncInterval() {
+		sync.Ok = false
+		sync.Message = fmt.Sprintf("last successful sync was %s ago", age.Truncate(time.Second))
+	}
+	checks = append(checks, sync)
+
+	secwares := probeCheck{Name: "available_secware", Ok: true}
+	if num := len(a.secwareManager.GetAvailableSecwareList()); num == 0 {
+		secwares.Ok = false
+		secwares.Message = "no secware available"
+	}
+	checks = append(checks, secwares)
+
+	rpc := probeCheck{Name: "eth_rpc", Ok: true}
+	ctx, cancel := context.WithTimeout(c.Request.Context(), probeRpcTimeout)
+	defer cancel()
+	if _, err := a.getAvsReader().BlockNumber(ctx); err != nil {
+		rpc.Ok = false
+		rpc.Message = err.Error()
+	}
+	checks = append(checks, rpc)
+
+	probeResponse(c, checks)
+}
@@ -0,0 +1,58 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/Layr-Labs/eigensdk-go/logging"
+	"github.com/gin-gonic/gin"
+	"goplus/avs/config"
+	"goplus/avs/secwaremanager"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestProbes_NotReady(t *testing.T) {
+	logger, _ := logging.NewZapLogger(logging.Development)
+	mgr, err := secwaremanager.NewSecwareManager(config.Config{Logger: logger, ComposeFilePath: t.TempDir()}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	svr := &Server{
+		logger:         logger,
+		secwareManager: mgr,
+		avsReader:      &fakeChainReader{rpcErr: errors.New("rpc down")},
+	}
+
+	route := gin.New()
+	route.GET("/livez", svr.livez)
+	route.GET("/readyz", svr.readyz)
+
+	// manager 尚未启动
+	w := httptest.NewRecorder()
+	route.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/livez", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("livez: expect 503, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	route.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("readyz: expect 503, got %d", w.Code)
+	}
+
+	var resp struct {
+		Result []probeCheck `json:"result"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Result) != 3 {
+		t.Fatalf("expect 3 checks, got %d", len(resp.Result))
+	}
+	for _, check := range resp.Result {
+		if check.Ok || check.Message == "" {
+			t.Errorf("check %s should fail with message, got %#v", check.Name, check)
+		}
+	}
+}
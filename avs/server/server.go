@@ -6,13 +6,19 @@ import (
 	"errors"
 	"fmt"
 	"github.com/Layr-Labs/eigensdk-go/logging"
+	"github.com/ethereum/go-ethereum/common"
 	"github.com/gin-gonic/gin"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"goplus/avs/chainio"
 	"goplus/avs/config"
 	"goplus/avs/metrics"
 	"goplus/avs/secwaremanager"
 	"goplus/avs/state"
+	"goplus/shared/pkg/types"
+	"net"
 	"net/http"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -22,20 +28,104 @@ type Server struct {
 	metricsIntf    metrics.AvsMetricsInterface
 	secwareManager *secwaremanager.SecwareManager
 	stateIntf      state.AvsStateInterface
+	taskLimiter    *taskLimiter
+
+	// 以下字段可以被热加载的配置修改
+	avsReader     chainReader
+	readerLock    sync.RWMutex
+	taskClockSkew atomic.Int64
+	gateway       atomic.Pointer[gatewayConfig] // Gateway 被更换时会被修改
+	registration  atomic.Pointer[registrationStatus]
+	secwareKeys   atomic.Pointer[map[string]types.HexBytes] // 密钥文件变化时整体替换
 
 	secwareAccessorIntf secwaremanager.SecwareAccessorInterface
 }
 
 func New(cfg config.Config, metricsIntf metrics.AvsMetricsInterface, secwareManager *secwaremanager.SecwareManager, state state.AvsStateInterface) (*Server, error) {
-	return &Server{
+	avsReader, err := chainio.NewAvsReader(cfg.RegCoordinatorAddr, cfg.EthHttpClient)
+	if err != nil {
+		return nil, err
+	}
+
+	svr := &Server{
 		config:         cfg,
 		logger:         cfg.Logger,
 		metricsIntf:    metricsIntf,
 		secwareManager: secwareManager,
 		stateIntf:      state,
+		avsReader:      avsReader,
+		taskLimiter:    newTaskLimiter(cfg.SecwareMaxConcurrency, cfg.SecwareQueueDepth, metricsIntf),
+
+		secwareAccessorIntf: secwareManager.SecwareAccessorIntf,
+	}
+	svr.taskClockSkew.Store(int64(cfg.TaskClockSkew))
+	svr.secwareKeys.Store(&cfg.SecwareKeys)
+	svr.gateway.Store(&gatewayConfig{address: cfg.AddressGateway, url: cfg.GatewayUrl})
+	return svr, nil
+}
+
+type gatewayConfig struct {
+	address common.Address
+	url     string
+}
+
+// SetGateway 更换 Gateway，之后只接受新 Gateway 签名的 task
+func (a *Server) SetGateway(address common.Address, url string) {
+	a.gateway.Store(&gatewayConfig{address: address, url: url})
+}
 
-		secwareAccessorIntf: &secwaremanager.SecwareAccessorImpl{},
-	}, nil
+func (a *Server) getGateway() gatewayConfig {
+	if gw := a.gateway.Load(); gw != nil {
+		return *gw
+	}
+	return gatewayConfig{address: a.config.AddressGateway, url: a.config.GatewayUrl}
+}
+
+func (a *Server) getGatewayAddress() common.Address {
+	return a.getGateway().address
+}
+
+// ApplyConfig 应用热加载的配置，ETH RPC 变化时重新创建 AvsReader
+func (a *Server) ApplyConfig(cfg config.Config) {
+	a.taskClockSkew.Store(int64(cfg.TaskClockSkew))
+	a.taskLimiter.setLimits(cfg.SecwareMaxConcurrency, cfg.SecwareQueueDepth)
+	a.secwareKeys.Store(&cfg.SecwareKeys)
+
+	// ETHRpc 和 avsReader 一起在 readerLock 下读写。创建 AvsReader 需要访问链上数据，
+	// 不持有锁，替换前重新检查 ETHRpc，避免覆盖并发的热加载
+	currentRpc := a.getETHRpc()
+	if cfg.ETHRpc == currentRpc {
+		return
+	}
+	avsReader, err := chainio.NewAvsReader(cfg.RegCoordinatorAddr, cfg.EthHttpClient)
+	if err != nil {
+		a.logger.Errorf("Failed to switch eth rpc, keep using %s: %v", currentRpc, err)
+		return
+	}
+	a.readerLock.Lock()
+	defer a.readerLock.Unlock()
+	if a.config.ETHRpc != currentRpc {
+		return
+	}
+	a.avsReader = avsReader
+	a.config.ETHRpc = cfg.ETHRpc
+	a.config.EthHttpClient = cfg.EthHttpClient
+}
+
+func (a *Server) getETHRpc() string {
+	a.readerLock.RLock()
+	defer a.readerLock.RUnlock()
+	return a.config.ETHRpc
+}
+
+func (a *Server) getAvsReader() chainReader {
+	a.readerLock.RLock()
+	defer a.readerLock.RUnlock()
+	return a.avsReader
+}
+
+func (a *Server) getTaskClockSkew() time.Duration {
+	return time.Duration(a.taskClockSkew.Load())
 }
 
 func (a *Server) Init() error {
@@ -63,8 +153,24 @@ func (a *Server) Start(ctx context.Context) error {
 
 	route.POST("/secware/task", a.handleTask)
 	route.GET("/avs/ping", a.ping)
+	route.GET("/avs/status", a.status)
+	route.GET("/livez", a.livez)
+	route.GET("/readyz", a.readyz)
 	route.GET("/metrics", gin.WrapH(promhttp.Handler()))
 
+	// 管理接口使用单独的 listener，只在配置了 ADMIN_LISTEN 时启动。
+	// 先打开管理接口的 listener，失败时不会留下已经启动的 API server
+	var adminListener net.Listener
+	if a.config.AdminListen != "" {
+		listener, err := adminListen(a.config.AdminListen)
+		if err != nil {
+			return err
+		}
+		adminListener = listener
+	}
+
+	go a.watchRegistration(ctx)
+
 	srv := &http.Server{
 		Addr:    fmt.Sprintf(":%d", a.config.APIPort),
 		Handler: route.Handler(),
@@ -78,11 +184,29 @@ func (a *Server) Start(ctx context.Context) error {
 		}
 	}()
 
+	var adminSrv *http.Server
+	adminDone := make(chan struct{})
+	if adminListener != nil {
+		adminSrv = &http.Server{Handler: a.adminRoutes().Handler()}
+		go func() {
+			if err := adminSrv.Serve(adminListener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				a.logger.Error(err.Error())
+				close(adminDone)
+			}
+		}()
+		a.logger.Infof("Admin API listening on %s", a.config.AdminListen)
+	}
+
+	// 任意一个 server 异常退出时，关闭另一个 server 后返回错误
+	var exitErr error
 	select {
 	case <-ctx.Done():
 	case <-apiDone:
 		a.logger.Info("Server shutdown...")
-		return errors.New("server exit unexpectedly")
+		exitErr = errors.New("server exit unexpectedly")
+	case <-adminDone:
+		a.logger.Info("Admin server shutdown...")
+		exitErr = errors.New("admin server exit unexpectedly")
 	}
 
 	shutdownCtx, shutdown := context.WithTimeout(context.Background(), 5*time.Second)
@@ -90,6 +214,15 @@ func (a *Server) Start(ctx context.Context) error {
 	if err := srv.Shutdown(shutdownCtx); err != nil {
 		a.logger.Error(err.Error())
 	}
+	if adminSrv != nil {
+		if err := adminSrv.Shutdown(shutdownCtx); err != nil {
+			a.logger.Error(err.Error())
+		}
+	}
+
+	if exitErr != nil {
+		return exitErr
+	}
 
 	<-shutdownCtx.Done()
 	a.logger.Info("Server shutdown complete")
@@ -0,0 +1,134 @@
+// Package server: /avs/status 返回 operator 的运行状态，供监控面板和负载均衡使用
+package server
+
+import (
+	"context"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/gin-gonic/gin"
+	"goplus/avs/chainio"
+	"time"
+)
+
+// chainReader 是 Server 需要从链上读取的信息，由 chainio.AvsReader 实现
+type chainReader interface {
+	OperatorStatus(ctx context.Context, operator common.Address) (uint8, error)
+	BlockNumber(ctx context.Context) (uint64, error)
+}
+
+const (
+	statusChainTimeout          = 5 * time.Second
+	registrationRefreshInterval = 30 * time.Second
+	registrationUnknown         = "UNKNOWN"
+)
+
+// registrationStatus 是最近一次从链上读取的 operator 注册状态，
+// status 接口只读取缓存，不会为每个请求访问链上数据
+type registrationStatus struct {
+	status    string
+	err       string
+	updatedAt int64
+}
+
+type secwareStatusView struct {
+	SecwareId      int    `json:"id"`
+	SecwareVersion int    `json:"version"`
+	Port           int    `json:"port,omitempty"`
+	Socket         string `json:"socket,omitempty"`
+	State          string `json:"state"`
+	LastHealthTime int64  `json:"last_health_time"`
+}
+
+type gatewayStatusView struct {
+	Address string `json:"address"`
+	URL     string `json:"url"`
+}
+
+type operatorStatusView struct {
+	Operator              string              `json:"operator"`
+	RegistrationStatus    string              `json:"registration_status"`
+	RegistrationError     string              `json:"registration_error,omitempty"`
+	RegistrationUpdatedAt int64               `json:"registration_updated_at"`
+	Gateway               gatewayStatusView   `json:"gateway"`
+	Secwares              []secwareStatusView `json:"secwares"`
+	LastSyncTime          int64               `json:"last_sync_time"`
+	LastHeartbeatTime     int64               `json:"last_heartbeat_time"`
+}
+
+// refreshRegistration 从链上读取 operator 的注册状态并更新缓存。
+// 读取失败时保留上一次成功读取的状态，并记录错误信息
+func (a *Server) refreshRegistration(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, statusChainTimeout)
+	defer cancel()
+
+	next := registrationStatus{status: registrationUnknown, updatedAt: time.Now().Unix()}
+	if prev := a.registration.Load(); prev != nil {
+		next.status = prev.status
+	}
+	registration, err := a.getAvsReader().OperatorStatus(ctx, a.config.AddressOperator)
+	if err != nil {
+		a.logger.Errorf("Failed to read operator status: %v", err)
+		next.err = err.Error()
+	} else {
+		next.status = chainio.OperatorStatusName(registration)
+	}
+	a.registration.Store(&next)
+}
+
+// watchRegistration 定期刷新 operator 的注册状态缓存
+func (a *Server) watchRegistration(ctx context.Context) {
+	ticker := time.NewTicker(registrationRefreshInterval)
+	defer ticker.Stop()
+
+	for {
+		a.refreshRegistration(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// statusView 汇总 operator 的注册状态、Gateway 配置和各个 secware 的状态，链上数据来自缓存。
+// detailed 为 false 时不返回 secware 的端口和 socket 等内部信息
+func (a *Server) statusView(detailed bool) operatorStatusView {
+	gateway := a.getGateway()
+	result := operatorStatusView{
+		Operator:           a.config.AddressOperator.Hex(),
+		RegistrationStatus: registrationUnknown,
+		Gateway:            gatewayStatusView{Address: gateway.address.Hex(), URL: gateway.url},
+		Secwares:           make([]secwareStatusView, 0),
+		LastSyncTime:       a.secwareManager.GetLastSyncTime(),
+		LastHeartbeatTime:  a.secwareManager.GetLastHeartbeatTime(),
+	}
+	if registration := a.registration.Load(); registration != nil {
+		result.RegistrationStatus = registration.status
+		result.RegistrationError = registration.err
+		result.RegistrationUpdatedAt = registration.updatedAt
+	}
+
+	for _, s := range a.secwareManager.ListSecwares() {
+		view := secwareStatusView{
+			SecwareId:      s.SecwareId,
+			SecwareVersion: s.SecwareVersion,
+			State:          s.GetState(),
+			LastHealthTime: s.LastHealthTime(),
+		}
+		if detailed {
+			view.Port = s.Port
+			view.Socket = s.SocketPath
+		}
+		result.Secwares = append(result.Secwares, view)
+	}
+	return result
+}
+
+// status 是公开的状态接口，不包含 secware 的内部地址
+func (a *Server) status(c *gin.Context) {
+	c.JSON(200, gin.H{"code": CodeOk, "message": "ok", "result": a.statusView(false)})
+}
+
+// adminStatus 是管理接口上的详细状态，包含 secware 的端口和 socket
+func (a *Server) adminStatus(c *gin.Context) {
+	c.JSON(200, gin.H{"code": CodeOk, "message": "ok", "result": a.statusView(true)})
+}
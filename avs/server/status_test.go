@@ -0,0 +1,107 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/Layr-Labs/eigensdk-go/logging"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/gin-gonic/gin"
+	"goplus/avs/config"
+	"goplus/avs/secwaremanager"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type fakeChainReader struct {
+	statusErr error
+	rpcErr    error
+	calls     int
+}
+
+func (r *fakeChainReader) OperatorStatus(ctx context.Context, operator common.Address) (uint8, error) {
+	r.calls++
+	if r.statusErr != nil {
+		return 0, r.statusErr
+	}
+	return 1, nil
+}
+
+func (r *fakeChainReader) BlockNumber(ctx context.Context) (uint64, error) {
+	if r.rpcErr != nil {
+		return 0, r.rpcErr
+	}
+	return 100, nil
+}
+
+func getStatus(t *testing.T, route *gin.Engine, path string) operatorStatusView {
+	w := httptest.NewRecorder()
+	route.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expect 200, got %d", w.Code)
+	}
+
+	var resp struct {
+		Result operatorStatusView `json:"result"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	return resp.Result
+}
+
+func TestStatus(t *testing.T) {
+	logger, _ := logging.NewZapLogger(logging.Development)
+	mgr, err := secwaremanager.NewSecwareManager(config.Config{Logger: logger, ComposeFilePath: t.TempDir()}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reader := &fakeChainReader{}
+	svr := &Server{
+		config:         config.Config{AddressOperator: common.HexToAddress("0x11")},
+		logger:         logger,
+		secwareManager: mgr,
+		avsReader:      reader,
+	}
+	svr.SetGateway(common.HexToAddress("0x22"), "http://gateway")
+
+	route := gin.New()
+	route.GET("/avs/status", svr.status)
+
+	// 注册状态尚未读取
+	result := getStatus(t, route, "/avs/status")
+	if result.Operator != common.HexToAddress("0x11").Hex() {
+		t.Errorf("unexpected operator %s", result.Operator)
+	}
+	if result.RegistrationStatus != registrationUnknown {
+		t.Errorf("unexpected registration status %s", result.RegistrationStatus)
+	}
+	if result.Gateway.Address != common.HexToAddress("0x22").Hex() || result.Gateway.URL != "http://gateway" {
+		t.Errorf("unexpected gateway %#v", result.Gateway)
+	}
+	if result.Secwares == nil || len(result.Secwares) != 0 {
+		t.Errorf("unexpected secwares %#v", result.Secwares)
+	}
+
+	svr.refreshRegistration(context.Background())
+	result = getStatus(t, route, "/avs/status")
+	if result.RegistrationStatus != "REGISTERED" || result.RegistrationError != "" {
+		t.Errorf("unexpected registration %s %s", result.RegistrationStatus, result.RegistrationError)
+	}
+
+	// 读取失败时保留上一次的状态
+	reader.statusErr = errors.New("rpc down")
+	svr.refreshRegistration(context.Background())
+	result = getStatus(t, route, "/avs/status")
+	if result.RegistrationStatus != "REGISTERED" || result.RegistrationError != "rpc down" {
+		t.Errorf("unexpected registration %s %s", result.RegistrationStatus, result.RegistrationError)
+	}
+
+	// 请求只读取缓存
+	calls := reader.calls
+	getStatus(t, route, "/avs/status")
+	if reader.calls != calls {
+		t.Errorf("status request should not read chain, %d calls", reader.calls-calls)
+	}
+}
@@ -0,0 +1,27 @@
+// Package signer: operator 的 BLS 和 ECDSA 签名后端。keystore 后端从加密的 keystore 文件读取私钥，
+// remote 后端请求远程签名服务签名，私钥不会进入 AVS 进程的内存。
+package signer
+
+import (
+	"github.com/Layr-Labs/eigensdk-go/crypto/bls"
+	sdkecdsa "github.com/Layr-Labs/eigensdk-go/crypto/ecdsa"
+	"goplus/shared/pkg/signature"
+)
+
+// NewKeystoreBLSSigner 从 keystore 文件读取 BLS 私钥
+func NewKeystoreBLSSigner(path string, password string) (*signature.KeyPairSigner, error) {
+	keyPair, err := bls.ReadPrivateKeyFromFile(path, password)
+	if err != nil {
+		return nil, err
+	}
+	return signature.NewKeyPairSigner(keyPair), nil
+}
+
+// NewKeystoreECDSASigner 从 keystore 文件读取 ECDSA 私钥
+func NewKeystoreECDSASigner(path string, password string) (*signature.PrivateKeySigner, error) {
+	privateKey, err := sdkecdsa.ReadKey(path, password)
+	if err != nil {
+		return nil, err
+	}
+	return signature.NewPrivateKeySigner(privateKey)
+}
@@ -0,0 +1,296 @@
+// Package signer: remote 后端使用 Web3Signer 风格的 HTTP 接口:
+//   - GET  /api/v1/bn254/publicKeys/{identifier}，返回 {"g1": "0x..", "g2": "0x.."}
+//   - POST /api/v1/bn254/sign/{identifier}，请求 {"type": "MESSAGE" | "HASHED_TO_CURVE", "data": "0x.."}，返回 G1 签名的 hex
+//   - POST /api/v1/eth1/sign/{address}，请求 {"data": "0x<32 字节 hash>"}，返回 [R || S || V] 签名的 hex
+//
+// 签名服务只能通过 https 访问，或者使用本机地址的 http。配置了 token 时每个请求都带有
+// Authorization: Bearer <token>
+package signer
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/Layr-Labs/eigensdk-go/crypto/bls"
+	"github.com/consensys/gnark-crypto/ecc/bn254"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"goplus/shared/pkg/signature"
+	"goplus/shared/pkg/types"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	remoteSignerTimeout = 10 * time.Second
+
+	blsSignTypeMessage       = "MESSAGE"
+	blsSignTypeHashedToCurve = "HASHED_TO_CURVE"
+
+	g1PointLength = 64
+	g2PointLength = 128
+)
+
+var ErrBadRemoteSignature = errors.New("remote signer returned an invalid signature")
+
+// RemoteOptions 是访问远程签名服务的认证和 TLS 配置
+type RemoteOptions struct {
+	Token      string // 非空时在请求头中发送 Authorization: Bearer <Token>
+	CACertPath string // 校验 https 签名服务证书的 CA，为空时使用系统的 CA
+}
+
+type remoteClient struct {
+	url    string
+	token  string
+	client *http.Client
+}
+
+// newRemoteClient 检查签名服务的地址，http 只允许本机地址，https 可以指定 CA 证书
+func newRemoteClient(rawUrl string, opts RemoteOptions) (*remoteClient, error) {
+	u, err := url.Parse(rawUrl)
+	if err != nil {
+		return nil, fmt.Errorf("invalid remote signer url: %w", err)
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	switch u.Scheme {
+	case "http":
+		if !isLoopbackHost(u.Hostname()) {
+			return nil, fmt.Errorf("remote signer %s must use https unless it listens on a loopback address", u.Host)
+		}
+	case "https":
+		if opts.CACertPath != "" {
+			pem, err := os.ReadFile(opts.CACertPath)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read remote signer ca cert: %w", err)
+			}
+			pool := x509.NewCertPool()
+			if !pool.AppendCertsFromPEM(pem) {
+				return nil, errors.New("no certificate found in remote signer ca cert")
+			}
+			transport.TLSClientConfig = &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}
+		}
+	default:
+		return nil, fmt.Errorf("unsupported remote signer url scheme %q", u.Scheme)
+	}
+
+	return &remoteClient{
+		url:    strings.TrimSuffix(rawUrl, "/"),
+		token:  opts.Token,
+		client: &http.Client{Timeout: remoteSignerTimeout, Transport: transport},
+	}, nil
+}
+
+func isLoopbackHost(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+func (c *remoteClient) do(method string, path string, reqBody interface{}) ([]byte, error) {
+	var body io.Reader
+	if reqBody != nil {
+		data, err := json.Marshal(reqBody)
+		if err != nil {
+			return nil, err
+		}
+		body = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, c.url+path, body)
+	if err != nil {
+		return nil, err
+	}
+	if reqBody != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("remote signer %s %s: status %d: %s", method, path, resp.StatusCode, strings.TrimSpace(string(respBody)))
+	}
+	return respBody, nil
+}
+
+// sign 请求远程签名，返回的签名是 hex 文本，可能带有 JSON 的引号
+func (c *remoteClient) sign(path string, reqBody interface{}) ([]byte, error) {
+	respBody, err := c.do(http.MethodPost, path, reqBody)
+	if err != nil {
+		return nil, err
+	}
+	sig, err := hexutil.Decode(strings.Trim(strings.TrimSpace(string(respBody)), `"`))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrBadRemoteSignature, err)
+	}
+	return sig, nil
+}
+
+type blsSignRequest struct {
+	Type string         `json:"type"`
+	Data types.HexBytes `json:"data"`
+}
+
+type blsPublicKeyResponse struct {
+	G1 types.HexBytes `json:"g1"`
+	G2 types.HexBytes `json:"g2"`
+}
+
+// RemoteBLSSigner 请求远程签名服务使用 BLS 私钥签名
+type RemoteBLSSigner struct {
+	client     *remoteClient
+	identifier string
+	pubKeyG1   *bls.G1Point
+	pubKeyG2   *bls.G2Point
+}
+
+// NewRemoteBLSSigner 创建远程 BLS 签名后端，并从签名服务读取公钥
+func NewRemoteBLSSigner(url string, identifier string, opts RemoteOptions) (*RemoteBLSSigner, error) {
+	client, err := newRemoteClient(url, opts)
+	if err != nil {
+		return nil, err
+	}
+	respBody, err := client.do(http.MethodGet, "/api/v1/bn254/publicKeys/"+identifier, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var pubKey blsPublicKeyResponse
+	if err := json.Unmarshal(respBody, &pubKey); err != nil {
+		return nil, err
+	}
+	if len(pubKey.G1) != g1PointLength || len(pubKey.G2) != g2PointLength {
+		return nil, errors.New("remote signer returned an invalid bls public key")
+	}
+
+	pubKeyG1 := new(bls.G1Point).Deserialize(pubKey.G1)
+	pubKeyG2 := new(bls.G2Point).Deserialize(pubKey.G2)
+	if ok, err := pubKeyG1.VerifyEquivalence(pubKeyG2); err != nil || !ok {
+		return nil, errors.New("remote signer returned mismatched bls g1 and g2 public keys")
+	}
+
+	return &RemoteBLSSigner{
+		client:     client,
+		identifier: identifier,
+		pubKeyG1:   pubKeyG1,
+		pubKeyG2:   pubKeyG2,
+	}, nil
+}
+
+func (s *RemoteBLSSigner) PubKeyG1() *bls.G1Point {
+	return s.pubKeyG1
+}
+
+func (s *RemoteBLSSigner) PubKeyG2() *bls.G2Point {
+	return s.pubKeyG2
+}
+
+func (s *RemoteBLSSigner) sign(signType string, data []byte) (*bls.Signature, error) {
+	sig, err := s.client.sign("/api/v1/bn254/sign/"+s.identifier, &blsSignRequest{Type: signType, Data: data})
+	if err != nil {
+		return nil, err
+	}
+	if len(sig) != g1PointLength {
+		return nil, ErrBadRemoteSignature
+	}
+	return &bls.Signature{G1Point: new(bls.G1Point).Deserialize(sig)}, nil
+}
+
+// SignMessage 请求远程签名，并使用公钥校验返回的签名
+func (s *RemoteBLSSigner) SignMessage(message [32]byte) (*bls.Signature, error) {
+	sig, err := s.sign(blsSignTypeMessage, message[:])
+	if err != nil {
+		return nil, err
+	}
+	if ok, err := sig.Verify(s.pubKeyG2, message); err != nil || !ok {
+		return nil, ErrBadRemoteSignature
+	}
+	return sig, nil
+}
+
+// SignHashedToCurveMessage 请求远程签名，并校验 e(sig, G2) == e(hashedMsg, pubKeyG2)
+func (s *RemoteBLSSigner) SignHashedToCurveMessage(g1HashedMsg *bn254.G1Affine) (*bls.Signature, error) {
+	sig, err := s.sign(blsSignTypeHashedToCurve, (&bls.G1Point{G1Affine: g1HashedMsg}).Serialize())
+	if err != nil {
+		return nil, err
+	}
+
+	_, _, _, g2Gen := bn254.Generators()
+	var negSig bn254.G1Affine
+	negSig.Neg(sig.G1Affine)
+	ok, err := bn254.PairingCheck([]bn254.G1Affine{*g1HashedMsg, negSig}, []bn254.G2Affine{*s.pubKeyG2.G2Affine, g2Gen})
+	if err != nil || !ok {
+		return nil, ErrBadRemoteSignature
+	}
+	return sig, nil
+}
+
+type ecdsaSignRequest struct {
+	Data types.HexBytes `json:"data"`
+}
+
+// RemoteECDSASigner 请求远程签名服务使用 ECDSA 私钥签名
+type RemoteECDSASigner struct {
+	client  *remoteClient
+	address common.Address
+}
+
+func NewRemoteECDSASigner(url string, address common.Address, opts RemoteOptions) (*RemoteECDSASigner, error) {
+	client, err := newRemoteClient(url, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &RemoteECDSASigner{
+		client:  client,
+		address: address,
+	}, nil
+}
+
+func (s *RemoteECDSASigner) Address() common.Address {
+	return s.address
+}
+
+// SignHash 请求远程签名，V 统一转换为 0 或 1，并校验签名来自 operator 的地址
+func (s *RemoteECDSASigner) SignHash(hash common.Hash) ([]byte, error) {
+	sig, err := s.client.sign("/api/v1/eth1/sign/"+s.address.Hex(), &ecdsaSignRequest{Data: hash.Bytes()})
+	if err != nil {
+		return nil, err
+	}
+	if len(sig) != crypto.SignatureLength {
+		return nil, ErrBadRemoteSignature
+	}
+	if sig[64] >= 27 {
+		sig[64] -= 27
+	}
+	if err := signature.VerifyECDSASigner(s, hash, sig); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrBadRemoteSignature, err)
+	}
+	return sig, nil
+}
+
+var (
+	_ signature.BLSSigner   = (*RemoteBLSSigner)(nil)
+	_ signature.ECDSASigner = (*RemoteECDSASigner)(nil)
+)
@@ -0,0 +1,189 @@
+package signer
+
+import (
+	"crypto/ecdsa"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"github.com/Layr-Labs/eigensdk-go/crypto/bls"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	ethtypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"goplus/shared/pkg/signature"
+	"goplus/shared/pkg/types"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newFakeRemoteSigner 是测试用的远程签名服务，使用 signKeyPair 和 signKey 签名，但公布 keyPair 的公钥
+func newFakeRemoteSigner(keyPair *bls.KeyPair, signKeyPair *bls.KeyPair, signKey *ecdsa.PrivateKey) *httptest.Server {
+	return httptest.NewServer(fakeRemoteSignerHandler(keyPair, signKeyPair, signKey))
+}
+
+func fakeRemoteSignerHandler(keyPair *bls.KeyPair, signKeyPair *bls.KeyPair, signKey *ecdsa.PrivateKey) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodGet && strings.HasPrefix(r.URL.Path, "/api/v1/bn254/publicKeys/"):
+			_ = json.NewEncoder(w).Encode(blsPublicKeyResponse{
+				G1: keyPair.GetPubKeyG1().Serialize(),
+				G2: keyPair.GetPubKeyG2().Serialize(),
+			})
+		case r.Method == http.MethodPost && strings.HasPrefix(r.URL.Path, "/api/v1/bn254/sign/"):
+			var req blsSignRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			var sig *bls.Signature
+			if req.Type == blsSignTypeMessage {
+				sig = signKeyPair.SignMessage([32]byte(req.Data))
+			} else {
+				sig = signKeyPair.SignHashedToCurveMessage(new(bls.G1Point).Deserialize(req.Data).G1Affine)
+			}
+			_, _ = w.Write([]byte(hexutil.Encode(sig.Serialize())))
+		case r.Method == http.MethodPost && strings.HasPrefix(r.URL.Path, "/api/v1/eth1/sign/"):
+			var req ecdsaSignRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			sig, err := crypto.Sign(req.Data, signKey)
+			if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			// 和 Web3Signer 一样返回 V 为 27 或 28 的签名
+			sig[64] += 27
+			_, _ = w.Write([]byte(hexutil.Encode(sig)))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+}
+
+func TestRemoteSigner(t *testing.T) {
+	keyPair, _ := bls.GenRandomBlsKeys()
+	key, _ := crypto.GenerateKey()
+	address := crypto.PubkeyToAddress(key.PublicKey)
+
+	server := newFakeRemoteSigner(keyPair, keyPair, key)
+	defer server.Close()
+
+	blsSigner, err := NewRemoteBLSSigner(server.URL, "operator", RemoteOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !blsSigner.PubKeyG1().Equal(keyPair.GetPubKeyG1().G1Affine) {
+		t.Fatal("unexpected g1 public key")
+	}
+
+	result := &types.SignedSecwareResult{Result: types.SecwareResult{SecwareId: 1, SecwareVersion: 2}}
+	signed, err := signature.SignBLSOperatorResult(result, blsSigner)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !signature.VerifyBLSOperatorSignatureWithBLSPubKey(signed, keyPair.GetPubKeyG2()) {
+		t.Fatal("bad remote bls signature")
+	}
+
+	point := keyPair.GetPubKeyG1().G1Affine
+	sig, err := blsSigner.SignHashedToCurveMessage(point)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !sig.Equal(keyPair.SignHashedToCurveMessage(point).G1Affine) {
+		t.Fatal("unexpected hashed to curve signature")
+	}
+
+	ecdsaSigner, err := NewRemoteECDSASigner(server.URL, address, RemoteOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx := ethtypes.NewTx(&ethtypes.DynamicFeeTx{ChainID: big.NewInt(17000), Nonce: 1, Gas: 21000})
+	signedTx, err := signature.TxSignerFn(ecdsaSigner, big.NewInt(17000))(address, tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sender, err := ethtypes.Sender(ethtypes.LatestSignerForChainID(big.NewInt(17000)), signedTx)
+	if err != nil || sender != address {
+		t.Fatalf("unexpected tx sender %s, err %v", sender.Hex(), err)
+	}
+}
+
+func TestRemoteSigner_WrongKey(t *testing.T) {
+	keyPair, _ := bls.GenRandomBlsKeys()
+	otherKeyPair, _ := bls.GenRandomBlsKeys()
+	key, _ := crypto.GenerateKey()
+	otherKey, _ := crypto.GenerateKey()
+
+	server := newFakeRemoteSigner(keyPair, otherKeyPair, otherKey)
+	defer server.Close()
+
+	blsSigner, err := NewRemoteBLSSigner(server.URL, "operator", RemoteOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := blsSigner.SignMessage([32]byte{1}); !errors.Is(err, ErrBadRemoteSignature) {
+		t.Fatalf("expect ErrBadRemoteSignature, got %v", err)
+	}
+	if _, err := blsSigner.SignHashedToCurveMessage(keyPair.GetPubKeyG1().G1Affine); !errors.Is(err, ErrBadRemoteSignature) {
+		t.Fatalf("expect ErrBadRemoteSignature, got %v", err)
+	}
+
+	ecdsaSigner, err := NewRemoteECDSASigner(server.URL, crypto.PubkeyToAddress(key.PublicKey), RemoteOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ecdsaSigner.SignHash(common.Hash{1}); !errors.Is(err, ErrBadRemoteSignature) {
+		t.Fatalf("expect ErrBadRemoteSignature, got %v", err)
+	}
+}
+
+func TestRemoteSigner_Transport(t *testing.T) {
+	keyPair, _ := bls.GenRandomBlsKeys()
+	key, _ := crypto.GenerateKey()
+	address := crypto.PubkeyToAddress(key.PublicKey)
+
+	// 非本机地址不能使用 http
+	if _, err := NewRemoteECDSASigner("http://10.0.0.1:9000", address, RemoteOptions{}); err == nil {
+		t.Fatal("expect error for plain http to a remote host")
+	}
+
+	handler := fakeRemoteSignerHandler(keyPair, keyPair, key)
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	caPath := filepath.Join(t.TempDir(), "ca.pem")
+	caPem := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	if err := os.WriteFile(caPath, caPem, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// 不信任签名服务的证书
+	if _, err := NewRemoteBLSSigner(server.URL, "operator", RemoteOptions{Token: "secret"}); err == nil {
+		t.Fatal("expect error for unknown certificate authority")
+	}
+	if _, err := NewRemoteBLSSigner(server.URL, "operator", RemoteOptions{Token: "wrong", CACertPath: caPath}); err == nil {
+		t.Fatal("expect error for wrong token")
+	}
+
+	blsSigner, err := NewRemoteBLSSigner(server.URL, "operator", RemoteOptions{Token: "secret", CACertPath: caPath})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := blsSigner.SignMessage([32]byte{1}); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -1,11 +1,209 @@
+// Package state: AvsDbState 使用嵌入式的 BoltDB 保存 AVS 的状态
 package state
 
-import "goplus/avs/config"
+import (
+	"encoding/binary"
+	"encoding/json"
+	"github.com/ethereum/go-ethereum/common"
+	bolt "go.etcd.io/bbolt"
+	"goplus/avs/config"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
 
-type AvsDbState struct{}
+var (
+	bucketTasks          = []byte("tasks")
+	bucketSeenTasks      = []byte("seen_tasks")        // task hash -> 过期时间
+	bucketSeenTaskExpiry = []byte("seen_tasks_expiry") // 过期时间 + task hash，用于按过期时间淘汰
+)
+
+type AvsDbState struct {
+	db *bolt.DB
+
+	seenLock     sync.Mutex
+	maxSeenTasks int
+	numSeenTasks int
+}
 
 func NewAvsDbState(cfg config.Config) (*AvsDbState, error) {
-	return &AvsDbState{}, nil
+	err := os.MkdirAll(cfg.DataPath, 0755)
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := bolt.Open(filepath.Join(cfg.DataPath, "avs.db"), 0600, &bolt.Options{Timeout: 1 * time.Second})
+	if err != nil {
+		return nil, err
+	}
+
+	numSeenTasks := 0
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{bucketTasks, bucketSeenTasks, bucketSeenTaskExpiry, bucketSecwareProjects} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		numSeenTasks = tx.Bucket(bucketSeenTasks).Stats().KeyN
+		return nil
+	})
+	if err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+
+	maxSeenTasks := cfg.SeenTaskCacheSize
+	if maxSeenTasks <= 0 {
+		maxSeenTasks = config.DefaultSeenTaskCacheSize
+	}
+
+	return &AvsDbState{
+		db:           db,
+		maxSeenTasks: maxSeenTasks,
+		numSeenTasks: numSeenTasks,
+	}, nil
+}
+
+// SaveTaskRecord 保存 task 的处理记录，同一个 task 的记录会被覆盖
+func (s *AvsDbState) SaveTaskRecord(record *TaskRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketTasks).Put(record.TaskHash.Bytes(), data)
+	})
+}
+
+func (s *AvsDbState) GetTaskRecord(taskHash common.Hash) (*TaskRecord, error) {
+	var data []byte
+	err := s.db.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket(bucketTasks).Get(taskHash.Bytes())
+		if v == nil {
+			return ErrTaskRecordNotFound
+		}
+		data = make([]byte, len(v))
+		copy(data, v)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	record := &TaskRecord{}
+	err = json.Unmarshal(data, record)
+	if err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+func seenTaskExpiryKey(taskHash common.Hash, expireAt int64) []byte {
+	key := make([]byte, 8+common.HashLength)
+	binary.BigEndian.PutUint64(key, uint64(expireAt))
+	copy(key[8:], taskHash.Bytes())
+	return key
+}
+
+// MarkTaskSeen 使用两个 bucket 维护有容量上限的已处理 task 缓存。
+// 写入前先淘汰已过期的记录，仍然超出容量时拒绝新的 task，未过期的记录不会被淘汰，否则会在有效期内被重放。
+func (s *AvsDbState) MarkTaskSeen(taskHash common.Hash, expireAt int64) (bool, error) {
+	s.seenLock.Lock()
+	defer s.seenLock.Unlock()
+
+	now := time.Now().Unix()
+	fresh := false
+	numSeenTasks := s.numSeenTasks
+
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		seen := tx.Bucket(bucketSeenTasks)
+		expiry := tx.Bucket(bucketSeenTaskExpiry)
+
+		if v := seen.Get(taskHash.Bytes()); v != nil {
+			oldExpireAt := int64(binary.BigEndian.Uint64(v))
+			if oldExpireAt >= now {
+				return nil
+			}
+			if err := expiry.Delete(seenTaskExpiryKey(taskHash, oldExpireAt)); err != nil {
+				return err
+			}
+			if err := seen.Delete(taskHash.Bytes()); err != nil {
+				return err
+			}
+			numSeenTasks--
+		}
+
+		c := expiry.Cursor()
+		for k, _ := c.First(); k != nil; k, _ = c.First() {
+			if int64(binary.BigEndian.Uint64(k[:8])) >= now {
+				break
+			}
+			hash := append([]byte{}, k[8:]...)
+			if err := c.Delete(); err != nil {
+				return err
+			}
+			if err := seen.Delete(hash); err != nil {
+				return err
+			}
+			numSeenTasks--
+		}
+		if numSeenTasks >= s.maxSeenTasks {
+			return ErrSeenTasksFull
+		}
+
+		value := make([]byte, 8)
+		binary.BigEndian.PutUint64(value, uint64(expireAt))
+		if err := seen.Put(taskHash.Bytes(), value); err != nil {
+			return err
+		}
+		if err := expiry.Put(seenTaskExpiryKey(taskHash, expireAt), []byte{}); err != nil {
+			return err
+		}
+		numSeenTasks++
+		fresh = true
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+
+	s.numSeenTasks = numSeenTasks
+	return fresh, nil
+}
+
+// UnmarkTaskSeen 删除 task 的记录，用于 task 没有被处理的情况，使 Gateway 可以重新派发
+func (s *AvsDbState) UnmarkTaskSeen(taskHash common.Hash) error {
+	s.seenLock.Lock()
+	defer s.seenLock.Unlock()
+
+	removed := false
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		seen := tx.Bucket(bucketSeenTasks)
+		v := seen.Get(taskHash.Bytes())
+		if v == nil {
+			return nil
+		}
+		expireAt := int64(binary.BigEndian.Uint64(v))
+		if err := tx.Bucket(bucketSeenTaskExpiry).Delete(seenTaskExpiryKey(taskHash, expireAt)); err != nil {
+			return err
+		}
+		removed = true
+		return seen.Delete(taskHash.Bytes())
+	})
+	if err != nil {
+		return err
+	}
+
+	if removed {
+		s.numSeenTasks--
+	}
+	return nil
+}
+
+func (s *AvsDbState) Close() error {
+	return s.db.Close()
 }
 
 var _ AvsStateInterface = (*AvsDbState)(nil)
@@ -0,0 +1,193 @@
+package state
+
+import (
+	"errors"
+	"github.com/ethereum/go-ethereum/common"
+	"goplus/avs/config"
+	"goplus/shared/pkg/types"
+	"testing"
+	"time"
+)
+
+func TestAvsDbState_TaskRecord(t *testing.T) {
+	cfg := config.Config{DataPath: t.TempDir()}
+	st, err := NewAvsDbState(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	taskHash := common.HexToHash("0x1234")
+	_, err = st.GetTaskRecord(taskHash)
+	if !errors.Is(err, ErrTaskRecordNotFound) {
+		t.Fatalf("expect ErrTaskRecordNotFound, got %v", err)
+	}
+
+	record := TaskRecord{
+		TaskHash:       taskHash,
+		SecwareId:      1,
+		SecwareVersion: 2,
+		SigGateway:     types.HexBytes{0x01, 0x02},
+		Result: &types.SignedSecwareResult{
+			Result:     types.SecwareResult{Code: 0, Message: "ok", Details: "{}", SecwareId: 1, SecwareVersion: 2},
+			SigSecware: types.HexBytes{0x03},
+		},
+		SigOperator: types.HexBytes{0x04},
+		Outcome:     OutcomeSigned,
+		Code:        200,
+		Message:     "ok",
+		LatencyMs:   12,
+		CreatedAt:   1700000000,
+	}
+	if err := st.SaveTaskRecord(&record); err != nil {
+		t.Fatal(err)
+	}
+
+	// 重新打开数据库，记录依然存在
+	if err := st.Close(); err != nil {
+		t.Fatal(err)
+	}
+	st, err = NewAvsDbState(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.Close()
+
+	saved, err := st.GetTaskRecord(taskHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if saved.Outcome != OutcomeSigned || saved.LatencyMs != 12 || saved.Result.Result.SecwareVersion != 2 {
+		t.Fatalf("expect %#v, got %#v", record, saved)
+	}
+	if saved.SigOperator.String() != "0x04" {
+		t.Fatalf("expect sig operator 0x04, got %s", saved.SigOperator)
+	}
+}
+
+func TestAvsDbState_MarkTaskSeen(t *testing.T) {
+	cfg := config.Config{DataPath: t.TempDir(), SeenTaskCacheSize: 2}
+	st, err := NewAvsDbState(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	future := time.Now().Unix() + 3600
+	hash1 := common.HexToHash("0x01")
+	hash2 := common.HexToHash("0x02")
+	hash3 := common.HexToHash("0x03")
+
+	fresh, err := st.MarkTaskSeen(hash1, future)
+	if err != nil || !fresh {
+		t.Fatalf("expect fresh task, got %v %v", fresh, err)
+	}
+	fresh, err = st.MarkTaskSeen(hash1, future)
+	if err != nil || fresh {
+		t.Fatalf("expect replayed task, got %v %v", fresh, err)
+	}
+
+	// 重启后依然能识别重放
+	if err := st.Close(); err != nil {
+		t.Fatal(err)
+	}
+	st, err = NewAvsDbState(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.Close()
+
+	fresh, err = st.MarkTaskSeen(hash1, future)
+	if err != nil || fresh {
+		t.Fatalf("expect replayed task after restart, got %v %v", fresh, err)
+	}
+
+	// 超出容量时拒绝新的 task，不淘汰未过期的记录
+	if fresh, err = st.MarkTaskSeen(hash2, future+10); err != nil || !fresh {
+		t.Fatalf("expect fresh task, got %v %v", fresh, err)
+	}
+	if _, err = st.MarkTaskSeen(hash3, future+20); !errors.Is(err, ErrSeenTasksFull) {
+		t.Fatalf("expect ErrSeenTasksFull, got %v", err)
+	}
+	if fresh, err = st.MarkTaskSeen(hash1, future); err != nil || fresh {
+		t.Fatalf("expect replayed task, got %v %v", fresh, err)
+	}
+
+	// 删除记录后 task 可以被重新处理
+	if err := st.UnmarkTaskSeen(hash2); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.UnmarkTaskSeen(hash2); err != nil {
+		t.Fatal(err)
+	}
+	if fresh, err = st.MarkTaskSeen(hash3, future+20); err != nil || !fresh {
+		t.Fatalf("expect fresh task, got %v %v", fresh, err)
+	}
+
+	// 已过期的记录不再视为重放，并且在容量已满时被淘汰
+	if err := st.UnmarkTaskSeen(hash3); err != nil {
+		t.Fatal(err)
+	}
+	past := time.Now().Unix() - 10
+	hash4 := common.HexToHash("0x04")
+	if fresh, err = st.MarkTaskSeen(hash4, past); err != nil || !fresh {
+		t.Fatalf("expect fresh task, got %v %v", fresh, err)
+	}
+	if fresh, err = st.MarkTaskSeen(hash4, past); err != nil || !fresh {
+		t.Fatalf("expect expired task to be fresh, got %v %v", fresh, err)
+	}
+	if fresh, err = st.MarkTaskSeen(hash2, future+10); err != nil || !fresh {
+		t.Fatalf("expect expired task to be evicted, got %v %v", fresh, err)
+	}
+}
+
+func TestAvsDbState_SecwareProject(t *testing.T) {
+	cfg := config.Config{DataPath: t.TempDir()}
+	st, err := NewAvsDbState(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := st.GetSecwareProject(1, 2); !errors.Is(err, ErrSecwareProjectNotFound) {
+		t.Fatalf("expect ErrSecwareProjectNotFound, got %v", err)
+	}
+
+	project := &SecwareProject{
+		SecwareId:      1,
+		SecwareVersion: 2,
+		ProjectName:    "secware-1-2-7777",
+		Port:           7777,
+		State:          "Available",
+		StartedAt:      1700000000,
+	}
+	if err := st.SaveSecwareProject(project); err != nil {
+		t.Fatal(err)
+	}
+
+	// 重启后依然能读取记录
+	if err := st.Close(); err != nil {
+		t.Fatal(err)
+	}
+	st, err = NewAvsDbState(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.Close()
+
+	saved, err := st.GetSecwareProject(1, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *saved != *project {
+		t.Fatalf("expect %#v, got %#v", project, saved)
+	}
+	projects, err := st.ListSecwareProjects()
+	if err != nil || len(projects) != 1 {
+		t.Fatalf("expect 1 project, got %v %v", projects, err)
+	}
+
+	if err := st.DeleteSecwareProject(1, 2); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := st.GetSecwareProject(1, 2); !errors.Is(err, ErrSecwareProjectNotFound) {
+		t.Fatalf("expect ErrSecwareProjectNotFound after delete, got %v", err)
+	}
+}
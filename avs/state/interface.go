@@ -1,4 +1,54 @@
 package state
 
+import (
+	"errors"
+	"github.com/ethereum/go-ethereum/common"
+	"goplus/shared/pkg/types"
+)
+
+const (
+	OutcomeSigned   = "Signed"
+	OutcomeTimeout  = "Timeout"  // Secware 超时，由 Operator 签名超时结果
+	OutcomeCrash    = "Crash"    // Secware 崩溃或返回无法解析的结果，由 Operator 签名崩溃结果
+	OutcomeRejected = "Rejected" // Secware 的结果未通过校验，Operator 拒绝签名
+	OutcomeFailed   = "Failed"
+)
+
+var ErrTaskRecordNotFound = errors.New("task record not found")
+
+// ErrSeenTasksFull 表示已处理 task 的缓存中都是未过期的记录，暂时不能接收新的 task
+var ErrSeenTasksFull = errors.New("seen task cache is full")
+
+// TaskRecord 是 Operator 处理过的一个 task 的记录，用于和 Gateway 对账
+type TaskRecord struct {
+	TaskHash       common.Hash                `json:"task_hash"`
+	SecwareId      int                        `json:"secware_id"`
+	SecwareVersion int                        `json:"secware_version"`
+	SigGateway     types.HexBytes             `json:"sig_gateway"`
+	Result         *types.SignedSecwareResult `json:"result,omitempty"`
+	SigOperator    types.HexBytes             `json:"sig_operator,omitempty"`
+	Outcome        string                     `json:"outcome"`
+	Code           int                        `json:"code"`    // 返回给 Gateway 的状态码
+	Message        string                     `json:"message"` // 返回给 Gateway 的状态描述
+	LatencyMs      int64                      `json:"latency_ms"`
+	CreatedAt      int64                      `json:"created_at"`
+}
+
+// AvsStateInterface 是 AVS 需要持久化的状态，重启后依然可用
 type AvsStateInterface interface {
+	SaveTaskRecord(record *TaskRecord) error
+	GetTaskRecord(taskHash common.Hash) (*TaskRecord, error)
+	// MarkTaskSeen 记录 task 已被处理，直到 expireAt(unix 秒) 之前都视为已处理。
+	// 如果 task 已经被记录过且尚未过期，返回 false；缓存已满时返回 ErrSeenTasksFull
+	MarkTaskSeen(taskHash common.Hash, expireAt int64) (bool, error)
+	// UnmarkTaskSeen 删除 task 的记录，用于没有交给 secware 处理的 task
+	UnmarkTaskSeen(taskHash common.Hash) error
+
+	// secware compose project 的记录，见 SecwareProject
+	SaveSecwareProject(project *SecwareProject) error
+	GetSecwareProject(secwareId int, secwareVersion int) (*SecwareProject, error)
+	ListSecwareProjects() ([]*SecwareProject, error)
+	DeleteSecwareProject(secwareId int, secwareVersion int) error
+
+	Close() error
 }
@@ -0,0 +1,85 @@
+package state
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	bolt "go.etcd.io/bbolt"
+)
+
+var ErrSecwareProjectNotFound = errors.New("secware project not found")
+
+var bucketSecwareProjects = []byte("secware_projects") // <id>-<version> -> SecwareProject
+
+// SecwareProject 是 runner 启动的 secware compose project 的记录，每个 secware 版本一条。
+// 重启后 runner 根据记录识别自己管理的 project，而不是只依靠 project 的名字
+type SecwareProject struct {
+	SecwareId       int    `json:"secware_id"`
+	SecwareVersion  int    `json:"secware_version"`
+	ProjectName     string `json:"project"`
+	Port            int    `json:"port"`
+	SocketPath      string `json:"socket_path,omitempty"`
+	ComposeFilePath string `json:"compose_file_path,omitempty"`
+	ComposeHash     string `json:"compose_hash,omitempty"` // compose 文件内容的 sha256
+	State           string `json:"state"`
+	Adopted         bool   `json:"adopted,omitempty"` // 启动时在 docker 中发现但没有记录，由 runner 接管
+	StartedAt       int64  `json:"started_at"`
+	StoppedAt       int64  `json:"stopped_at,omitempty"`
+	RestartCount    int    `json:"restart_count"` // 第一次启动之后又被启动的次数
+	LastError       string `json:"last_error,omitempty"`
+}
+
+func secwareProjectKey(secwareId int, secwareVersion int) []byte {
+	return []byte(fmt.Sprintf("%d-%d", secwareId, secwareVersion))
+}
+
+// SaveSecwareProject 保存 secware 版本的记录，同一个版本的记录会被覆盖
+func (s *AvsDbState) SaveSecwareProject(project *SecwareProject) error {
+	data, err := json.Marshal(project)
+	if err != nil {
+		return err
+	}
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketSecwareProjects).Put(secwareProjectKey(project.SecwareId, project.SecwareVersion), data)
+	})
+}
+
+func (s *AvsDbState) GetSecwareProject(secwareId int, secwareVersion int) (*SecwareProject, error) {
+	project := &SecwareProject{}
+	err := s.db.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket(bucketSecwareProjects).Get(secwareProjectKey(secwareId, secwareVersion))
+		if v == nil {
+			return ErrSecwareProjectNotFound
+		}
+		return json.Unmarshal(v, project)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return project, nil
+}
+
+func (s *AvsDbState) ListSecwareProjects() ([]*SecwareProject, error) {
+	projects := make([]*SecwareProject, 0)
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketSecwareProjects).ForEach(func(k, v []byte) error {
+			project := &SecwareProject{}
+			if err := json.Unmarshal(v, project); err != nil {
+				return fmt.Errorf("invalid secware project %s: %w", k, err)
+			}
+			projects = append(projects, project)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return projects, nil
+}
+
+func (s *AvsDbState) DeleteSecwareProject(secwareId int, secwareVersion int) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketSecwareProjects).Delete(secwareProjectKey(secwareId, secwareVersion))
+	})
+}
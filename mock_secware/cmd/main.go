@@ -8,6 +8,7 @@ import (
 	"goplus/mock_secware/pkg/handlers"
 	"net"
 	"net/http"
+	"os"
 )
 
 func main() {
@@ -30,8 +31,20 @@ func main() {
 	}
 
 	go func() {
-		fmt.Printf("Listening on %s\n", server.Addr)
-		err := server.ListenAndServe()
+		var err error
+		// 设定了 SECWARE_SOCKET 时通过 unix socket 提供服务，见 docker-compose-unix.yml
+		if socketPath := os.Getenv("SECWARE_SOCKET"); socketPath != "" {
+			fmt.Printf("Listening on %s\n", socketPath)
+			_ = os.Remove(socketPath)
+			var listener net.Listener
+			listener, err = net.Listen("unix", socketPath)
+			if err == nil {
+				err = server.Serve(listener)
+			}
+		} else {
+			fmt.Printf("Listening on %s\n", server.Addr)
+			err = server.ListenAndServe()
+		}
 		if errors.Is(err, http.ErrServerClosed) {
 			fmt.Printf("server closed\n")
 		} else if err != nil {
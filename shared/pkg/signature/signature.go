@@ -177,12 +177,15 @@ func VerifyOperatorSignatureWithAddress(signedResult *types.SignedOperatorResult
 	return VerifySignatureWithAddress(hashTask.Bytes(), signedResult.SigOperator, address)
 }
 
-func SignBLSOperatorResult(result *types.SignedSecwareResult, blsKeyPair *bls.KeyPair) (*types.SignedOperatorResult, error) {
+func SignBLSOperatorResult(result *types.SignedSecwareResult, blsSigner BLSSigner) (*types.SignedOperatorResult, error) {
 	hashTask, err := HashJSON(result)
 	if err != nil {
 		return nil, err
 	}
-	sigOperator := blsKeyPair.SignMessage(hashTask)
+	sigOperator, err := blsSigner.SignMessage(hashTask)
+	if err != nil {
+		return nil, err
+	}
 
 	return &types.SignedOperatorResult{
 		Result:      *result,
@@ -39,7 +39,7 @@ func TestBLS(t *testing.T) {
 	}
 
 	blsKeyPair := bls.NewKeyPair(new(fr.Element).SetBytes(skBLS))
-	signedOperatorResult, err := SignBLSOperatorResult(signedSecwareResult, blsKeyPair)
+	signedOperatorResult, err := SignBLSOperatorResult(signedSecwareResult, NewKeyPairSigner(blsKeyPair))
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -0,0 +1,103 @@
+package signature
+
+import (
+	"crypto/ecdsa"
+	"errors"
+	"github.com/Layr-Labs/eigensdk-go/crypto/bls"
+	"github.com/consensys/gnark-crypto/ecc/bn254"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	ethtypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"math/big"
+)
+
+// BLSSigner 使用 operator 的 BLS 私钥签名，私钥可以在本进程中，也可以在远程签名服务中
+type BLSSigner interface {
+	PubKeyG1() *bls.G1Point
+	PubKeyG2() *bls.G2Point
+	// SignMessage 签名 32 字节的消息
+	SignMessage(message [32]byte) (*bls.Signature, error)
+	// SignHashedToCurveMessage 签名已经映射到曲线上的消息，用于向 RegistryCoordinator 注册 BLS 公钥
+	SignHashedToCurveMessage(g1HashedMsg *bn254.G1Affine) (*bls.Signature, error)
+}
+
+// ECDSASigner 使用 operator 的 ECDSA 私钥签名
+type ECDSASigner interface {
+	Address() common.Address
+	// SignHash 签名 32 字节的 hash，返回 [R || S || V] 格式的签名，V 为 0 或 1
+	SignHash(hash common.Hash) ([]byte, error)
+}
+
+// KeyPairSigner 使用内存中的 BLS 私钥签名
+type KeyPairSigner struct {
+	keyPair *bls.KeyPair
+}
+
+func NewKeyPairSigner(keyPair *bls.KeyPair) *KeyPairSigner {
+	return &KeyPairSigner{keyPair: keyPair}
+}
+
+func (s *KeyPairSigner) PubKeyG1() *bls.G1Point {
+	return s.keyPair.GetPubKeyG1()
+}
+
+func (s *KeyPairSigner) PubKeyG2() *bls.G2Point {
+	return s.keyPair.GetPubKeyG2()
+}
+
+func (s *KeyPairSigner) SignMessage(message [32]byte) (*bls.Signature, error) {
+	return s.keyPair.SignMessage(message), nil
+}
+
+func (s *KeyPairSigner) SignHashedToCurveMessage(g1HashedMsg *bn254.G1Affine) (*bls.Signature, error) {
+	return s.keyPair.SignHashedToCurveMessage(g1HashedMsg), nil
+}
+
+// PrivateKeySigner 使用内存中的 ECDSA 私钥签名
+type PrivateKeySigner struct {
+	privateKey *ecdsa.PrivateKey
+	address    common.Address
+}
+
+func NewPrivateKeySigner(privateKey *ecdsa.PrivateKey) (*PrivateKeySigner, error) {
+	address, err := GetAddressFromPrivateKey(privateKey)
+	if err != nil {
+		return nil, err
+	}
+	return &PrivateKeySigner{privateKey: privateKey, address: address}, nil
+}
+
+func (s *PrivateKeySigner) Address() common.Address {
+	return s.address
+}
+
+func (s *PrivateKeySigner) SignHash(hash common.Hash) ([]byte, error) {
+	return SignHash(hash, s.privateKey)
+}
+
+// TxSignerFn 使用 ECDSASigner 签名交易，用于构造 txmgr 的 wallet
+func TxSignerFn(signer ECDSASigner, chainId *big.Int) bind.SignerFn {
+	txSigner := ethtypes.LatestSignerForChainID(chainId)
+	return func(address common.Address, tx *ethtypes.Transaction) (*ethtypes.Transaction, error) {
+		if address != signer.Address() {
+			return nil, bind.ErrNotAuthorized
+		}
+		sig, err := signer.SignHash(txSigner.Hash(tx))
+		if err != nil {
+			return nil, err
+		}
+		return tx.WithSignature(txSigner, sig)
+	}
+}
+
+// VerifyECDSASigner 检查签名是否来自 signer 的地址，用于校验远程签名服务返回的签名
+func VerifyECDSASigner(signer ECDSASigner, hash common.Hash, sig []byte) error {
+	if len(sig) != crypto.SignatureLength {
+		return errors.New("invalid ecdsa signature length")
+	}
+	if !VerifySignatureWithAddress(hash.Bytes(), sig, signer.Address()) {
+		return errors.New("ecdsa signature does not match signer address")
+	}
+	return nil
+}
@@ -34,6 +34,13 @@ type SignedSecwareTask struct {
 	SigGateway HexBytes    `json:"sig_gateway"` // Gateway 对 Task 的签名
 }
 
+// SecwareResult.Code 中由 Operator 填写的状态码
+const (
+	SecwareCodeOk      = 0
+	SecwareCodeTimeout = 1
+	SecwareCodeCrash   = 2
+)
+
 // SecwareResult 的各个字段正常情况下由 Secware 填写，Timeout/Crash 时由 Operator 填写。
 type SecwareResult struct {
 	Code           int      `json:"code"`            // 状态码 0: 正常，1: 超时，2: Crash，>=3: Secware自由使用，表示此交易不安全的各种状态